@@ -0,0 +1,240 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+const (
+	ansibleLegacyPrefix = "ansible.legacy."
+
+	// rawParamsKey is the parameter that contains the free-form arguments
+	// of a module, e.g. the command of the "shell" module.
+	rawParamsKey = "_raw_params"
+)
+
+// taskKeywords lists the keys of a task that are interpreted as keywords
+// rather than the module (action) to run.
+//
+// See https://docs.ansible.com/ansible/latest/reference_appendices/playbooks_keywords.html#task
+var taskKeywords = []string{
+	"action", "any_errors_fatal", "args", "async", "become", "become_exe", "become_flags",
+	"become_method", "become_user", "changed_when", "check_mode", "collections", "connection",
+	"debugger", "delay", "delegate_facts", "delegate_to", "diff", "environment", "failed_when",
+	"ignore_errors", "ignore_unreachable", "local_action", "loop", "loop_control",
+	"module_defaults", "name", "no_log", "notify", "poll", "port", "register", "remote_user",
+	"retries", "run_once", "tags", "throttle", "timeout", "until", "vars", "when",
+	// block keywords
+	"block", "rescue", "always",
+	// handler keywords
+	"listen",
+}
+
+// builtinModules are the modules of the "ansible.builtin" collection, which
+// are resolved by their short names before the collections of the play and role.
+//
+// See https://docs.ansible.com/ansible/latest/collections/ansible/builtin/index.html#modules
+var builtinModules = []string{
+	"add_host", "apt", "apt_key", "apt_repository", "assemble", "assert", "async_status",
+	"blockinfile", "command", "copy", "cron", "deb822_repository", "debconf", "debug", "dnf",
+	"dnf5", "dpkg_selections", "expect", "fail", "fetch", "file", "find", "gather_facts",
+	"get_url", "getent", "git", "group", "group_by", "hostname", "import_playbook",
+	"import_role", "import_tasks", "include", "include_role", "include_tasks", "include_vars",
+	"iptables", "known_hosts", "lineinfile", "meta", "mount_facts", "package", "package_facts",
+	"pause", "ping", "pip", "raw", "reboot", "replace", "rpm_key", "script", "service",
+	"service_facts", "set_fact", "set_stats", "setup", "shell", "slurp", "stat", "subversion",
+	"systemd", "systemd_service", "sysvinit", "tempfile", "template", "unarchive", "uri",
+	"user", "validate_argument_spec", "wait_for", "wait_for_connection", "yum", "yum_repository",
+}
+
+// TaskAction is the module (action) run by a task.
+type TaskAction struct {
+	// Name is the name of the module as written in the task, e.g. "copy".
+	Name string
+	// FQCN is the fully qualified collection name of the module, e.g. "ansible.builtin.copy".
+	FQCN string
+	// Params are the rendered parameters of the module. The free-form arguments,
+	// e.g. the command of the "shell" module, are stored under the "_raw_params" key.
+	Params Module
+	// Local is set for the "local_action" tasks that run on the controller.
+	Local bool
+}
+
+// rawAction is the action of a task before the parameters are rendered.
+type rawAction struct {
+	name   string
+	params map[string]any
+	local  bool
+}
+
+// Action returns the module run by the task. The module is specified either
+// as a key of the task, e.g. "copy: ...", or with the "action" and "local_action"
+// keywords, e.g. "action: copy src=a dest=b". It returns false for blocks and
+// tasks without a module.
+func (t *Task) Action() (*TaskAction, bool) {
+	action, ok := t.rawAction()
+	if !ok {
+		return nil, false
+	}
+
+	return &TaskAction{
+		Name:   action.name,
+		FQCN:   t.resolveModuleName(action.name),
+		Params: t.renderParams(action.params),
+		Local:  action.local,
+	}, true
+}
+
+// actionFQCN returns the fully qualified collection name of the module
+// run by the task without rendering its parameters.
+func (t *Task) actionFQCN() (string, bool) {
+	action, ok := t.rawAction()
+	if !ok {
+		return "", false
+	}
+	return t.resolveModuleName(action.name), true
+}
+
+func (t *Task) rawAction() (rawAction, bool) {
+	if t.IsBlock() {
+		return rawAction{}, false
+	}
+
+	additionalArgs, _ := t.raw["args"].(map[string]any)
+
+	var candidates []rawAction
+	for _, keyword := range []string{"action", "local_action"} {
+		if val, exists := t.raw[keyword]; exists {
+			if action, ok := parseActionKeyword(val, additionalArgs); ok {
+				action.local = keyword == "local_action"
+				candidates = append(candidates, action)
+			}
+		}
+	}
+
+	keys := lo.Keys(t.raw)
+	sort.Strings(keys)
+	for _, key := range keys {
+		if slices.Contains(taskKeywords, key) || strings.HasPrefix(key, "with_") {
+			continue
+		}
+		candidates = append(candidates, rawAction{
+			name:   key,
+			params: actionParams(key, t.raw[key], additionalArgs),
+		})
+	}
+
+	if len(candidates) == 0 {
+		return rawAction{}, false
+	}
+	if len(candidates) > 1 {
+		log.Printf("Conflicting action statements in task %q: %s", t.Name(),
+			strings.Join(lo.Map(candidates, func(a rawAction, _ int) string { return a.name }), ", "))
+	}
+	return candidates[0], true
+}
+
+// parseActionKeyword parses the value of the "action" or "local_action" keyword,
+// which is either a string with the module name followed by the arguments or
+// a dictionary with the "module" key.
+func parseActionKeyword(val any, additionalArgs map[string]any) (rawAction, bool) {
+	switch v := val.(type) {
+	case string:
+		name, args, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if name == "" {
+			return rawAction{}, false
+		}
+		return rawAction{name: name, params: actionParams(name, strings.TrimSpace(args), additionalArgs)}, true
+	case map[string]any:
+		name, ok := v["module"].(string)
+		if !ok || name == "" {
+			return rawAction{}, false
+		}
+		params := make(map[string]any, len(v))
+		for k, param := range v {
+			if k != "module" {
+				params[k] = param
+			}
+		}
+		return rawAction{name: name, params: actionParams(name, params, additionalArgs)}, true
+	}
+	return rawAction{}, false
+}
+
+// actionParams returns the parameters of the module merged with the "args" keyword.
+// The parameters of the module take precedence. The string parameters are parsed
+// as "k=v" pairs and free-form arguments.
+func actionParams(module string, val any, additionalArgs map[string]any) map[string]any {
+	res := lo.Assign(additionalArgs)
+	switch v := val.(type) {
+	case map[string]any:
+		res = lo.Assign(res, v)
+	case string:
+		params, err := parseModuleArgs(module, v)
+		if err != nil {
+			log.Printf("Failed to parse arguments of module %q: %s", module, err)
+			params = map[string]any{rawParamsKey: v}
+		}
+		res = lo.Assign(res, params)
+	case nil:
+	default:
+		log.Printf("Unsupported module arguments type: %T", val)
+	}
+	return res
+}
+
+// resolveModuleName returns the fully qualified collection name of the module.
+// The short names of the built-in modules and the modules from the "ansible.legacy"
+// collection resolve to "ansible.builtin". Other short names resolve to the first
+// collection from the "collections" keyword that is known to provide the module.
+// Since the bundled argument specs do not cover every collection, a module
+// unknown to all of them resolves to the first listed collection, as Ansible
+// would try it first, and stays in "ansible.legacy" only if no collection is listed.
+func (t *Task) resolveModuleName(name string) string {
+	if short, ok := strings.CutPrefix(name, ansibleLegacyPrefix); ok {
+		if slices.Contains(builtinModules, short) {
+			return applyBuiltinPrefix(short)
+		}
+		return name
+	}
+	if strings.Contains(name, ".") {
+		return name
+	}
+	if slices.Contains(builtinModules, name) {
+		return applyBuiltinPrefix(name)
+	}
+	collections := lo.Filter(t.Collections(), func(collection string, _ int) bool {
+		prefix := collection + "."
+		return prefix != ansibleBuiltinPrefix && prefix != ansibleLegacyPrefix
+	})
+	for _, collection := range collections {
+		if fqcn := collection + "." + name; defaultArgSpecs.Contains(fqcn) {
+			return fqcn
+		}
+	}
+	if len(collections) > 0 {
+		return collections[0] + "." + name
+	}
+	return ansibleLegacyPrefix + name
+}
+
+// Collections returns the collections searched for the modules of the task,
+// including the collections of the parent blocks, the role and the play.
+func (t *Task) Collections() []string {
+	var res []string
+	res = append(res, t.inner.Collections...)
+	// the tasks of an included role have the include task as the parent
+	if t.role != nil && (t.parent == nil || t.parent.role != t.role) {
+		res = append(res, t.role.meta.Collections()...)
+	}
+	if parent := t.scopeParent(); parent != nil {
+		res = append(res, parent.Collections()...)
+	} else if play := t.Play(); play != nil {
+		res = append(res, play.GetCollections()...)
+	}
+	return lo.Uniq(res)
+}
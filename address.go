@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+const (
+	addressSeparator  = " > "
+	addressHostPrefix = " @"
+)
+
+// TaskAddress is a stable, human-readable address of a compiled task, e.g.
+//
+//	site.yml > play[1] "web" > role geerlingguy.firewall > tasks/main.yml[3]
+//
+// The segments are the playbook files and the plays, the roles, and the
+// positions of the tasks in their files, starting with 1. The tasks of the
+// blocks are addressed by their section within the block, e.g.
+// "tasks/main.yml[2].rescue[1]", and the iterations of looped includes by
+// the loop index, e.g. "tasks[3] loop[0]". The host the task is bound to
+// follows the segments, e.g. "... > tasks[1] @web1".
+type TaskAddress struct {
+	Segments []string
+	Host     string
+}
+
+func (a TaskAddress) String() string {
+	res := strings.Join(a.Segments, addressSeparator)
+	if a.Host != "" {
+		res += addressHostPrefix + a.Host
+	}
+	return res
+}
+
+// Equal reports whether the addresses point to the same task.
+func (a TaskAddress) Equal(other TaskAddress) bool {
+	return a.Host == other.Host && slices.Equal(a.Segments, other.Segments)
+}
+
+// ParseTaskAddress parses the address produced by TaskAddress.String.
+func ParseTaskAddress(s string) (TaskAddress, error) {
+	var res TaskAddress
+	var segment strings.Builder
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(s):
+			segment.WriteByte(c)
+			segment.WriteByte(s[i+1])
+			i++
+			continue
+		case c == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && strings.HasPrefix(s[i:], addressSeparator):
+			res.Segments = append(res.Segments, segment.String())
+			segment.Reset()
+			i += len(addressSeparator) - 1
+			continue
+		case !inQuotes && strings.HasPrefix(s[i:], addressHostPrefix):
+			res.Host = s[i+len(addressHostPrefix):]
+			if res.Host == "" || strings.ContainsAny(res.Host, " \"") {
+				return TaskAddress{}, fmt.Errorf("invalid host in task address %q", s)
+			}
+			i = len(s)
+			continue
+		}
+		segment.WriteByte(c)
+	}
+	if inQuotes {
+		return TaskAddress{}, fmt.Errorf("unterminated quote in task address %q", s)
+	}
+	res.Segments = append(res.Segments, segment.String())
+	if lo.Contains(res.Segments, "") {
+		return TaskAddress{}, fmt.Errorf("empty segment in task address %q", s)
+	}
+	return res, nil
+}
+
+// Address returns the address of the compiled task.
+func (t *Task) Address() TaskAddress {
+	return TaskAddress{
+		Segments: t.addressSegments(),
+		Host:     t.host,
+	}
+}
+
+func (t *Task) addressSegments() []string {
+	var res []string
+	var segment string
+
+	switch {
+	case t.parent != nil && t.parent.IsBlock():
+		res = t.parent.addressSegments()
+		// the tasks of a block are addressed within the segment of the block
+		segment = res[len(res)-1] + fmt.Sprintf(".%s[%d]", t.section, t.index)
+		res = res[:len(res)-1]
+	case t.parent != nil:
+		res = t.parent.addressSegments()
+		if t.role != nil && t.role != t.parent.role {
+			res = append(res, t.role.addressSegments()...)
+		}
+		segment = t.fileSegment()
+	case t.role != nil:
+		if include := t.role.includeTask(); include != nil {
+			res = include.addressSegments()
+		} else if play := t.Play(); play != nil {
+			res = play.addressSegments()
+		}
+		res = append(res, t.role.addressSegments()...)
+		segment = t.fileSegment()
+	default:
+		if play := t.Play(); play != nil {
+			res = play.addressSegments()
+			segment = fmt.Sprintf("%s[%d]", t.playList, t.index)
+		} else {
+			segment = t.fileSegment()
+		}
+	}
+
+	if t.loopIndex != nil {
+		segment += fmt.Sprintf(" loop[%d]", *t.loopIndex)
+	}
+	return append(res, segment)
+}
+
+// fileSegment returns the position of the task in its file. The files of
+// the roles are relative to the role directory.
+func (t *Task) fileSegment() string {
+	filePath := t.metadata.path
+	if t.role != nil {
+		filePath = strings.TrimPrefix(filePath, t.role.path+"/")
+	}
+	return fmt.Sprintf("%s[%d]", filePath, t.index)
+}
+
+// addressSegments returns the segments of the role and the roles that depend on it.
+func (r *Role) addressSegments() []string {
+	var res []string
+	if r.parent != nil {
+		res = r.parent.addressSegments()
+	}
+	segment := "role " + r.name
+	if n := r.occurrence(); n > 1 {
+		segment += fmt.Sprintf("#%d", n)
+	}
+	return append(res, segment)
+}
+
+// occurrence returns the number of the role among the roles with the same
+// name of the play or the dependent role, e.g. 2 for the second entry of
+// a role with different parameters.
+func (r *Role) occurrence() int {
+	var siblings []*Role
+	switch {
+	case r.parent != nil:
+		siblings = r.parent.directDeps
+	case r.play != nil && r.definition != nil:
+		siblings = r.play.roles
+	}
+	n := 1
+	for _, sibling := range siblings {
+		if sibling == r {
+			return n
+		}
+		if sibling.name == r.name {
+			n++
+		}
+	}
+	return 1
+}
+
+// addressSegments returns the segments of the playbook and the play,
+// including the plays that import the playbook.
+func (p *Play) addressSegments() []string {
+	var res []string
+	if p.parent != nil {
+		res = p.parent.addressSegments()
+	}
+	segment := fmt.Sprintf("play[%d]", p.index)
+	if name := p.GetName(); name != "" {
+		segment += " " + strconv.Quote(name)
+	}
+	return append(res, p.GetPath(), segment)
+}
+
+var errTaskNotFound = errors.New("task not found")
+
+// FindTask returns the compiled task with the given address. If the address
+// contains the host, the task is bound to the host.
+func (p *AnsibleProject) FindTask(address string) (*Task, error) {
+	addr, err := ParseTaskAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	task, exists := p.tasksByAddress()[TaskAddress{Segments: addr.Segments}.String()]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errTaskNotFound, address)
+	}
+	if addr.Host != "" {
+		return task.ForHost(addr.Host), nil
+	}
+	return task, nil
+}
+
+// tasksByAddress returns the index of the compiled tasks by their addresses
+// without the host. The project is compiled once for all lookups.
+func (p *AnsibleProject) tasksByAddress() map[string]*Task {
+	p.taskIndexOnce.Do(func() {
+		p.taskIndex = make(map[string]*Task)
+		for _, task := range p.ListTasks() {
+			key := TaskAddress{Segments: task.addressSegments()}.String()
+			// the first task wins, as the tasks are searched in order
+			if _, exists := p.taskIndex[key]; !exists {
+				p.taskIndex[key] = task
+			}
+		}
+	})
+	return p.taskIndex
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskAddress(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site.yaml": {
+			Data: []byte(`---
+- name: Common
+  hosts: all
+  pre_tasks:
+    - name: Ping
+      ping:
+- import_playbook: web.yaml
+`),
+		},
+		"web.yaml": {
+			Data: []byte(`---
+- name: Web "frontend"
+  hosts: web
+  roles:
+    - role: firewall
+      port: 80
+    - role: firewall
+      port: 443
+  tasks:
+    - name: Setup
+      block:
+        - name: Install
+          package:
+            name: nginx
+      rescue:
+        - name: Report
+          debug:
+            msg: failed
+    - name: Deploy
+      include_tasks: "{{ item }}.yaml"
+      loop: [app]
+    - name: Monitoring
+      include_role:
+        name: monitoring
+`),
+		},
+		"app.yaml": {
+			Data: []byte(`---
+- name: Copy app
+  copy:
+    src: app
+    dest: /opt/app
+`),
+		},
+		"roles/firewall/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Open port
+  command: ufw allow {{ port }}
+`),
+		},
+		"roles/monitoring/meta/main.yaml": {
+			Data: []byte(`---
+dependencies:
+  - role: agent
+`),
+		},
+		"roles/monitoring/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Configure
+  block:
+    - name: Write config
+      copy:
+        content: ok
+        dest: /etc/monitoring
+`),
+		},
+		"roles/agent/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Install agent
+  package:
+    name: agent
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "site.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	addresses := lo.Map(tasks, func(task *Task, _ int) string {
+		return task.Address().String()
+	})
+
+	web := `site.yaml > play[2] > web.yaml > play[1] "Web \"frontend\""`
+	assert.Equal(t, []string{
+		`site.yaml > play[1] "Common" > pre_tasks[1]`,
+		web + ` > role firewall > tasks/main.yaml[1]`,
+		web + ` > role firewall#2 > tasks/main.yaml[1]`,
+		web + ` > tasks[1].block[1]`,
+		web + ` > tasks[1].rescue[1]`,
+		web + ` > tasks[2] loop[0] > app.yaml[1]`,
+		web + ` > tasks[3] > role monitoring > role agent > tasks/main.yaml[1]`,
+		web + ` > tasks[3] > role monitoring > tasks/main.yaml[1].block[1]`,
+	}, addresses)
+
+	for i, address := range addresses {
+		parsed, err := ParseTaskAddress(address)
+		require.NoError(t, err)
+		assert.Equal(t, address, parsed.String())
+
+		task, err := project.FindTask(address)
+		require.NoError(t, err)
+		assert.Equal(t, tasks[i].Name(), task.Name())
+	}
+
+	// the project is compiled once for all lookups
+	first, err := project.FindTask(addresses[1])
+	require.NoError(t, err)
+	second, err := project.FindTask(addresses[1])
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	task, err := project.FindTask(web + ` > role firewall#2 > tasks/main.yaml[1] @web1`)
+	require.NoError(t, err)
+	assert.Equal(t, "web1", task.Host())
+	assert.Equal(t, "443", task.actionParams()[rawParamsKey][len("ufw allow "):])
+	assert.Equal(t, web+` > role firewall#2 > tasks/main.yaml[1] @web1`, task.Address().String())
+
+	_, err = project.FindTask(web + ` > tasks[9]`)
+	require.ErrorIs(t, err, errTaskNotFound)
+
+	_, err = ParseTaskAddress(`site.yaml > play[1] "Common`)
+	require.Error(t, err)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// OptionSpec describes an option of a module as the "argument_spec" of
+// the Ansible module does.
+//
+// See https://docs.ansible.com/ansible/latest/dev_guide/developing_program_flow_modules.html#argument-spec
+type OptionSpec struct {
+	// Type is the type of the option: "str", "path", "bool", "int", "float",
+	// "list", "dict" or "raw". Options of other types are not converted.
+	Type string
+	// Elements is the type of the elements of the "list" options.
+	Elements string
+	Aliases  []string
+	// Default is the value of the option if it is not set.
+	Default any
+	// Choices are the allowed values of the option.
+	Choices []any
+	// NoLog is set for the options containing secrets, e.g. passwords.
+	NoLog bool
+}
+
+// ModuleSpec is the argument spec of a module.
+type ModuleSpec struct {
+	Options map[string]OptionSpec
+}
+
+// canonicalName returns the canonical name of the option with the given name or alias.
+func (s *ModuleSpec) canonicalName(name string) (string, bool) {
+	if _, exists := s.Options[name]; exists {
+		return name, true
+	}
+	for canonical, opt := range s.Options {
+		if slices.Contains(opt.Aliases, name) {
+			return canonical, true
+		}
+	}
+	return "", false
+}
+
+// ArgumentErrorKind is the kind of the problem with a module argument.
+type ArgumentErrorKind string
+
+const (
+	// ArgumentUnknown is reported for the options that the module does not support.
+	ArgumentUnknown ArgumentErrorKind = "unknown"
+	// ArgumentInvalid is reported for the values of the wrong type or not
+	// from the allowed choices.
+	ArgumentInvalid ArgumentErrorKind = "invalid"
+	// ArgumentConflict is reported when the option is set under several aliases.
+	ArgumentConflict ArgumentErrorKind = "conflict"
+)
+
+// ArgumentError is a problem with an argument of a module.
+type ArgumentError struct {
+	Kind ArgumentErrorKind
+	// Option is the name of the option as written in the task.
+	Option string
+	Reason string
+}
+
+func (e ArgumentError) Error() string {
+	return fmt.Sprintf("%s option %q: %s", e.Kind, e.Option, e.Reason)
+}
+
+// Normalize converts the parameters of the module to the canonical option
+// names and the types from the spec, and sets the defaults of the missing
+// options. Unknown values are kept as is. The parameters that cannot be
+// normalized are reported as errors and left out of the result.
+func (s *ModuleSpec) Normalize(params Module) (Module, []ArgumentError) {
+	res := make(Module, len(params))
+	// the names of the parameters as written in the task
+	setBy := make(map[string]string)
+	var errs []ArgumentError
+
+	names := lo.Keys(params)
+	sort.Strings(names)
+	for _, name := range names {
+		canonical, ok := s.canonicalName(name)
+		if !ok {
+			errs = append(errs, ArgumentError{
+				Kind:   ArgumentUnknown,
+				Option: name,
+				Reason: "unsupported parameter",
+			})
+			continue
+		}
+		if prev, exists := setBy[canonical]; exists {
+			errs = append(errs, ArgumentError{
+				Kind:   ArgumentConflict,
+				Option: name,
+				Reason: fmt.Sprintf("option %q is already set by %q", canonical, prev),
+			})
+			continue
+		}
+		setBy[canonical] = name
+
+		val, err := s.Options[canonical].convert(params[name])
+		if err != nil {
+			errs = append(errs, ArgumentError{
+				Kind:   ArgumentInvalid,
+				Option: name,
+				Reason: err.Error(),
+			})
+			continue
+		}
+		res[canonical] = val
+	}
+
+	for name, opt := range s.Options {
+		if _, exists := res[name]; !exists && opt.Default != nil {
+			if _, invalid := setBy[name]; !invalid {
+				res[name] = cloneValue(opt.Default)
+			}
+		}
+	}
+	return res, errs
+}
+
+// convert converts the value to the type of the option and checks the choices.
+func (o OptionSpec) convert(val any) (any, error) {
+	if ContainsUnknown(val) {
+		return val, nil
+	}
+	res, err := convertOptionValue(o.Type, o.Elements, val)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.Choices) == 0 || res == nil {
+		return res, nil
+	}
+
+	values := []any{res}
+	if list, ok := res.([]any); ok {
+		values = list
+	}
+	for _, v := range values {
+		if !slices.ContainsFunc(o.Choices, func(choice any) bool {
+			return toString(choice) == toString(v)
+		}) {
+			return nil, fmt.Errorf("value %q must be one of: %s", toString(v),
+				strings.Join(lo.Map(o.Choices, func(c any, _ int) string { return toString(c) }), ", "))
+		}
+	}
+	return res, nil
+}
+
+// convertOptionValue converts the value as the type checkers of Ansible do.
+func convertOptionValue(typ string, elements string, val any) (any, error) {
+	if val == nil {
+		return nil, nil
+	}
+	val = normalize(val)
+
+	switch typ {
+	case "str", "path":
+		switch v := val.(type) {
+		case string:
+			return v, nil
+		case bool, int, float64:
+			return toString(v), nil
+		}
+	case "bool":
+		if b, ok := keywordBool(val); ok {
+			return b, nil
+		}
+	case "int":
+		switch v := val.(type) {
+		case int:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		case string:
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+				return n, nil
+			}
+		}
+	case "float":
+		switch v := val.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f, nil
+			}
+		}
+	case "list":
+		var list []any
+		switch v := val.(type) {
+		case []any:
+			list = v
+		case string:
+			for _, item := range strings.Split(v, ",") {
+				list = append(list, item)
+			}
+		case int, float64, bool:
+			list = []any{toString(v)}
+		default:
+			return nil, fmt.Errorf("%T cannot be converted to a list", val)
+		}
+		if elements == "" {
+			return list, nil
+		}
+		res := make([]any, 0, len(list))
+		for _, item := range list {
+			converted, err := convertOptionValue(elements, "", item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid list element: %w", err)
+			}
+			res = append(res, converted)
+		}
+		return res, nil
+	case "dict":
+		switch v := val.(type) {
+		case map[string]any:
+			return v, nil
+		case string:
+			return parseDictOption(v)
+		}
+	default:
+		return val, nil
+	}
+	return nil, fmt.Errorf("%v (%T) cannot be converted to %s", val, val, typ)
+}
+
+// parseDictOption parses the string value of a "dict" option, which is either
+// a JSON object or a list of "k=v" pairs separated by commas or spaces.
+func parseDictOption(s string) (map[string]any, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") {
+		var res map[string]any
+		if err := json.Unmarshal([]byte(s), &res); err != nil {
+			return nil, fmt.Errorf("invalid JSON dictionary: %w", err)
+		}
+		return res, nil
+	}
+
+	res := make(map[string]any)
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("dictionary requested, could not parse %q", s)
+		}
+		res[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return res, nil
+}
+
+// ArgSpecRegistry contains the argument specs of modules by their fully
+// qualified collection names.
+type ArgSpecRegistry struct {
+	specs map[string]*ModuleSpec
+}
+
+// NewArgSpecRegistry returns the registry with the built-in argument specs of
+// the "ansible.builtin" modules and the most used cloud, Kubernetes and Docker modules.
+func NewArgSpecRegistry() *ArgSpecRegistry {
+	return &ArgSpecRegistry{
+		specs: maps.Clone(builtinModuleSpecs),
+	}
+}
+
+// Add registers the argument spec of the module with the given fully
+// qualified collection name, replacing the existing one.
+func (r *ArgSpecRegistry) Add(fqcn string, spec ModuleSpec) {
+	r.specs[fqcn] = &spec
+}
+
+// Contains reports whether the registry has the argument spec of the module
+// with the given fully qualified collection name.
+func (r *ArgSpecRegistry) Contains(fqcn string) bool {
+	_, exists := r.specs[fqcn]
+	return exists
+}
+
+// Lookup returns the argument spec of the module. Modules resolved to the
+// "ansible.legacy" collection, e.g. "ec2_instance" without the "collections"
+// keyword, are looked up by the short name if it is unambiguous.
+func (r *ArgSpecRegistry) Lookup(fqcn string) (*ModuleSpec, bool) {
+	if spec, exists := r.specs[fqcn]; exists {
+		return spec, true
+	}
+	short, ok := strings.CutPrefix(fqcn, ansibleLegacyPrefix)
+	if !ok || strings.Contains(short, ".") {
+		return nil, false
+	}
+
+	var found *ModuleSpec
+	for name, spec := range r.specs {
+		if name[strings.LastIndex(name, ".")+1:] != short {
+			continue
+		}
+		if found != nil && found != spec {
+			return nil, false
+		}
+		found = spec
+	}
+	return found, found != nil
+}
+
+// Normalize normalizes the parameters of the module according to its spec.
+// It returns false if there is no spec for the module.
+func (r *ArgSpecRegistry) Normalize(fqcn string, params Module) (Module, []ArgumentError, bool) {
+	spec, exists := r.Lookup(fqcn)
+	if !exists {
+		return nil, nil, false
+	}
+	res, errs := spec.Normalize(params)
+	return res, errs, true
+}
+
+var defaultArgSpecs = NewArgSpecRegistry()
+
+// NormalizedParams returns the parameters of the action with the canonical
+// option names and typed values according to the built-in argument spec of
+// the module, and the problems with the parameters. It returns false if there
+// is no built-in spec for the module.
+func (a *TaskAction) NormalizedParams() (Module, []ArgumentError, bool) {
+	return defaultArgSpecs.Normalize(a.FQCN, a.Params)
+}
@@ -0,0 +1,1513 @@
+package main
+
+import (
+	"maps"
+)
+
+func optionOf(typ string, aliases ...string) OptionSpec {
+	return OptionSpec{Type: typ, Aliases: aliases}
+}
+
+func optStr(aliases ...string) OptionSpec   { return optionOf("str", aliases...) }
+func optPath(aliases ...string) OptionSpec  { return optionOf("path", aliases...) }
+func optBool(aliases ...string) OptionSpec  { return optionOf("bool", aliases...) }
+func optInt(aliases ...string) OptionSpec   { return optionOf("int", aliases...) }
+func optFloat(aliases ...string) OptionSpec { return optionOf("float", aliases...) }
+func optDict(aliases ...string) OptionSpec  { return optionOf("dict", aliases...) }
+func optRaw(aliases ...string) OptionSpec   { return optionOf("raw", aliases...) }
+
+func optList(elements string, aliases ...string) OptionSpec {
+	opt := optionOf("list", aliases...)
+	opt.Elements = elements
+	return opt
+}
+
+func (o OptionSpec) withDefault(val any) OptionSpec {
+	o.Default = val
+	return o
+}
+
+func (o OptionSpec) withChoices(choices ...any) OptionSpec {
+	o.Choices = choices
+	return o
+}
+
+func (o OptionSpec) secret() OptionSpec {
+	o.NoLog = true
+	return o
+}
+
+type moduleOptions map[string]OptionSpec
+
+// with returns the options merged with the common options of the modules,
+// e.g. the authentication options of a cloud collection.
+func (o moduleOptions) with(common ...moduleOptions) moduleOptions {
+	res := maps.Clone(o)
+	for _, c := range common {
+		for k, v := range c {
+			if _, exists := res[k]; !exists {
+				res[k] = v
+			}
+		}
+	}
+	return res
+}
+
+func statePresentAbsent() OptionSpec {
+	return optStr().withDefault("present").withChoices("present", "absent")
+}
+
+func withTags(aliases ...string) moduleOptions {
+	return moduleOptions{
+		"tags":       optDict(aliases...),
+		"purge_tags": optBool().withDefault(true),
+	}
+}
+
+// fileCommonOptions are the options of the modules that create files.
+var fileCommonOptions = moduleOptions{
+	"mode":          optRaw(),
+	"owner":         optStr(),
+	"group":         optStr(),
+	"seuser":        optStr(),
+	"serole":        optStr(),
+	"selevel":       optStr(),
+	"setype":        optStr(),
+	"unsafe_writes": optBool().withDefault(false),
+	"attributes":    optStr("attr"),
+}
+
+var urlCommonOptions = moduleOptions{
+	"validate_certs":       optBool().withDefault(true),
+	"use_proxy":            optBool().withDefault(true),
+	"force_basic_auth":     optBool().withDefault(false),
+	"client_cert":          optPath(),
+	"client_key":           optPath(),
+	"http_agent":           optStr(),
+	"use_gssapi":           optBool().withDefault(false),
+	"use_netrc":            optBool().withDefault(true),
+	"unredirected_headers": optList("str"),
+	"decompress":           optBool().withDefault(true),
+	"ciphers":              optList("str"),
+}
+
+var commandOptions = moduleOptions{
+	rawParamsKey:        optStr(),
+	"cmd":               optStr(),
+	"chdir":             optPath(),
+	"executable":        optPath(),
+	"creates":           optPath(),
+	"removes":           optPath(),
+	"stdin":             optStr(),
+	"stdin_add_newline": optBool().withDefault(true),
+	"strip_empty_ends":  optBool().withDefault(true),
+}
+
+var packageManagerOptions = moduleOptions{
+	"name":              optList("str", "pkg"),
+	"list":              optStr(),
+	"exclude":           optList("str"),
+	"enablerepo":        optList("str"),
+	"disablerepo":       optList("str"),
+	"conf_file":         optStr(),
+	"disable_gpg_check": optBool().withDefault(false),
+	"skip_broken":       optBool().withDefault(false),
+	"update_cache":      optBool("expire-cache").withDefault(false),
+	"validate_certs":    optBool().withDefault(true),
+	"sslverify":         optBool().withDefault(true),
+	"update_only":       optBool().withDefault(false),
+	"installroot":       optStr().withDefault("/"),
+	"security":          optBool().withDefault(false),
+	"bugfix":            optBool().withDefault(false),
+	"allow_downgrade":   optBool().withDefault(false),
+	"enable_plugin":     optList("str"),
+	"disable_plugin":    optList("str"),
+	"releasever":        optStr(),
+	"autoremove":        optBool().withDefault(false),
+	"disable_excludes":  optStr(),
+	"download_only":     optBool().withDefault(false),
+	"download_dir":      optStr(),
+	"lock_timeout":      optInt().withDefault(30),
+	"install_weak_deps": optBool().withDefault(true),
+	"install_repoquery": optBool().withDefault(true),
+	"cacheonly":         optBool().withDefault(false),
+	"use_backend":       optStr().withDefault("auto"),
+	"state":             optStr().withChoices("absent", "installed", "latest", "present", "removed"),
+}
+
+var ansibleBuiltinModules = map[string]moduleOptions{
+	"copy": moduleOptions{
+		"src":            optPath(),
+		"content":        optStr(),
+		"dest":           optPath(),
+		"backup":         optBool().withDefault(false),
+		"force":          optBool("thirsty").withDefault(true),
+		"directory_mode": optRaw(),
+		"remote_src":     optBool().withDefault(false),
+		"local_follow":   optBool().withDefault(true),
+		"follow":         optBool().withDefault(false),
+		"validate":       optStr(),
+		"checksum":       optStr(),
+		"decrypt":        optBool().withDefault(true),
+	}.with(fileCommonOptions),
+	"file": moduleOptions{
+		"path":                     optPath("dest", "name"),
+		"state":                    optStr().withChoices("absent", "directory", "file", "hard", "link", "touch"),
+		"src":                      optPath(),
+		"recurse":                  optBool().withDefault(false),
+		"force":                    optBool().withDefault(false),
+		"follow":                   optBool().withDefault(true),
+		"modification_time":        optStr(),
+		"modification_time_format": optStr().withDefault("%Y%m%d%H%M.%S"),
+		"access_time":              optStr(),
+		"access_time_format":       optStr().withDefault("%Y%m%d%H%M.%S"),
+	}.with(fileCommonOptions),
+	"template": moduleOptions{
+		"src":                   optPath(),
+		"dest":                  optPath(),
+		"backup":                optBool().withDefault(false),
+		"force":                 optBool().withDefault(true),
+		"follow":                optBool().withDefault(false),
+		"validate":              optStr(),
+		"newline_sequence":      optStr().withDefault("\n").withChoices("\n", "\r", "\r\n"),
+		"block_start_string":    optStr().withDefault("{%"),
+		"block_end_string":      optStr().withDefault("%}"),
+		"variable_start_string": optStr().withDefault("{{"),
+		"variable_end_string":   optStr().withDefault("}}"),
+		"comment_start_string":  optStr(),
+		"comment_end_string":    optStr(),
+		"trim_blocks":           optBool().withDefault(true),
+		"lstrip_blocks":         optBool().withDefault(false),
+		"output_encoding":       optStr().withDefault("utf-8"),
+	}.with(fileCommonOptions),
+	"lineinfile": moduleOptions{
+		"path":          optPath("dest", "destfile", "name"),
+		"regexp":        optStr("regex"),
+		"search_string": optStr(),
+		"state":         statePresentAbsent(),
+		"line":          optStr("value"),
+		"backrefs":      optBool().withDefault(false),
+		"insertafter":   optStr(),
+		"insertbefore":  optStr(),
+		"create":        optBool().withDefault(false),
+		"backup":        optBool().withDefault(false),
+		"firstmatch":    optBool().withDefault(false),
+		"validate":      optStr(),
+	}.with(fileCommonOptions),
+	"blockinfile": moduleOptions{
+		"path":            optPath("dest", "destfile", "name"),
+		"state":           statePresentAbsent(),
+		"marker":          optStr().withDefault("# {mark} ANSIBLE MANAGED BLOCK"),
+		"block":           optStr("content").withDefault(""),
+		"insertafter":     optStr(),
+		"insertbefore":    optStr(),
+		"create":          optBool().withDefault(false),
+		"backup":          optBool().withDefault(false),
+		"marker_begin":    optStr().withDefault("BEGIN"),
+		"marker_end":      optStr().withDefault("END"),
+		"append_newline":  optBool().withDefault(false),
+		"prepend_newline": optBool().withDefault(false),
+		"validate":        optStr(),
+	}.with(fileCommonOptions),
+	"replace": moduleOptions{
+		"path":     optPath("dest", "destfile", "name"),
+		"regexp":   optStr(),
+		"replace":  optStr().withDefault(""),
+		"after":    optStr(),
+		"before":   optStr(),
+		"backup":   optBool().withDefault(false),
+		"validate": optStr(),
+		"encoding": optStr().withDefault("utf-8"),
+	}.with(fileCommonOptions),
+	"command": moduleOptions{
+		"argv":                 optList("str"),
+		"expand_argument_vars": optBool().withDefault(true),
+	}.with(commandOptions),
+	"shell": commandOptions,
+	"raw": moduleOptions{
+		rawParamsKey: optStr(),
+		"executable": optPath(),
+	},
+	"script": moduleOptions{
+		"decrypt": optBool().withDefault(true),
+	}.with(commandOptions),
+	"apt": moduleOptions{
+		"name":                         optList("str", "package", "pkg"),
+		"state":                        optStr().withDefault("present").withChoices("absent", "build-dep", "latest", "present", "fixed"),
+		"update_cache":                 optBool("update-cache"),
+		"update_cache_retries":         optInt().withDefault(5),
+		"update_cache_retry_max_delay": optInt().withDefault(12),
+		"cache_valid_time":             optInt().withDefault(0),
+		"purge":                        optBool().withDefault(false),
+		"default_release":              optStr("default-release"),
+		"install_recommends":           optBool("install-recommends"),
+		"force":                        optBool().withDefault(false),
+		"clean":                        optBool().withDefault(false),
+		"upgrade":                      optStr().withChoices("dist", "full", "no", "safe", "yes"),
+		"dpkg_options":                 optStr().withDefault("force-confdef,force-confold"),
+		"deb":                          optPath(),
+		"autoremove":                   optBool().withDefault(false),
+		"autoclean":                    optBool().withDefault(false),
+		"policy_rc_d":                  optInt(),
+		"only_upgrade":                 optBool().withDefault(false),
+		"fail_on_autoremove":           optBool().withDefault(false),
+		"force_apt_get":                optBool().withDefault(false),
+		"lock_timeout":                 optInt().withDefault(60),
+		"allow_unauthenticated":        optBool("allow-unauthenticated").withDefault(false),
+		"allow_downgrade":              optBool("allow-downgrade", "allow_downgrades", "allow-downgrades").withDefault(false),
+		"allow_change_held_packages":   optBool().withDefault(false),
+	},
+	"yum": packageManagerOptions,
+	"dnf": moduleOptions{
+		"allowerasing": optBool().withDefault(false),
+		"nobest":       optBool(),
+	}.with(packageManagerOptions),
+	"package": moduleOptions{
+		"name":  optList("str"),
+		"state": optStr(),
+		"use":   optStr().withDefault("auto"),
+	},
+	"pip": moduleOptions{
+		"name":                     optList("str"),
+		"version":                  optStr(),
+		"requirements":             optStr(),
+		"virtualenv":               optPath(),
+		"virtualenv_site_packages": optBool().withDefault(false),
+		"virtualenv_command":       optPath().withDefault("virtualenv"),
+		"virtualenv_python":        optStr(),
+		"state":                    optStr().withDefault("present").withChoices("absent", "forcereinstall", "latest", "present"),
+		"extra_args":               optStr(),
+		"editable":                 optBool().withDefault(false),
+		"chdir":                    optPath(),
+		"executable":               optPath(),
+		"umask":                    optStr(),
+		"break_system_packages":    optBool().withDefault(false),
+	},
+	"service": moduleOptions{
+		"name":      optStr(),
+		"state":     optStr().withChoices("reloaded", "restarted", "started", "stopped"),
+		"sleep":     optInt(),
+		"pattern":   optStr(),
+		"enabled":   optBool(),
+		"runlevel":  optStr().withDefault("default"),
+		"arguments": optStr("args").withDefault(""),
+		"use":       optStr().withDefault("auto"),
+	},
+	"systemd_service": moduleOptions{
+		"name":          optStr("service", "unit"),
+		"state":         optStr().withChoices("reloaded", "restarted", "started", "stopped"),
+		"enabled":       optBool(),
+		"force":         optBool(),
+		"masked":        optBool(),
+		"daemon_reload": optBool("daemon-reload").withDefault(false),
+		"daemon_reexec": optBool("daemon-reexec").withDefault(false),
+		"scope":         optStr().withDefault("system").withChoices("system", "user", "global"),
+		"no_block":      optBool().withDefault(false),
+	},
+	"user": moduleOptions{
+		"name":                 optStr("user"),
+		"uid":                  optInt(),
+		"comment":              optStr(),
+		"hidden":               optBool(),
+		"non_unique":           optBool().withDefault(false),
+		"seuser":               optStr(),
+		"group":                optStr(),
+		"groups":               optList("str"),
+		"append":               optBool().withDefault(false),
+		"shell":                optStr(),
+		"home":                 optPath(),
+		"skeleton":             optStr(),
+		"password":             optStr().secret(),
+		"state":                statePresentAbsent(),
+		"create_home":          optBool("createhome").withDefault(true),
+		"move_home":            optBool().withDefault(false),
+		"system":               optBool().withDefault(false),
+		"force":                optBool().withDefault(false),
+		"remove":               optBool().withDefault(false),
+		"login_class":          optStr(),
+		"generate_ssh_key":     optBool().withDefault(false),
+		"ssh_key_bits":         optInt(),
+		"ssh_key_type":         optStr().withDefault("rsa"),
+		"ssh_key_file":         optPath(),
+		"ssh_key_comment":      optStr(),
+		"ssh_key_passphrase":   optStr().secret(),
+		"update_password":      optStr().withDefault("always").withChoices("always", "on_create"),
+		"expires":              optFloat(),
+		"password_expire_max":  optInt(),
+		"password_expire_min":  optInt(),
+		"password_expire_warn": optInt(),
+		"password_lock":        optBool(),
+		"local":                optBool().withDefault(false),
+		"profile":              optStr(),
+		"authorization":        optStr(),
+		"role":                 optStr(),
+		"umask":                optStr(),
+		"uid_min":              optInt(),
+		"uid_max":              optInt(),
+	},
+	"group": moduleOptions{
+		"name":       optStr(),
+		"gid":        optInt(),
+		"state":      statePresentAbsent(),
+		"force":      optBool().withDefault(false),
+		"system":     optBool().withDefault(false),
+		"local":      optBool().withDefault(false),
+		"non_unique": optBool().withDefault(false),
+		"gid_min":    optInt(),
+		"gid_max":    optInt(),
+	},
+	"get_url": moduleOptions{
+		"url":          optStr(),
+		"dest":         optPath(),
+		"url_username": optStr("username"),
+		"url_password": optStr("password").secret(),
+		"force":        optBool("thirsty").withDefault(false),
+		"backup":       optBool().withDefault(false),
+		"checksum":     optStr().withDefault(""),
+		"timeout":      optInt().withDefault(10),
+		"headers":      optDict(),
+		"tmp_dest":     optPath(),
+	}.with(urlCommonOptions, fileCommonOptions),
+	"uri": moduleOptions{
+		"url":              optStr(),
+		"dest":             optPath(),
+		"url_username":     optStr("user"),
+		"url_password":     optStr("password").secret(),
+		"body":             optRaw(),
+		"body_format":      optStr().withDefault("raw").withChoices("form-urlencoded", "json", "raw", "form-multipart"),
+		"method":           optStr().withDefault("GET"),
+		"return_content":   optBool().withDefault(false),
+		"follow_redirects": optStr().withDefault("safe").withChoices("all", "no", "none", "safe", "urllib2", "yes"),
+		"creates":          optPath(),
+		"removes":          optPath(),
+		"status_code":      optList("int").withDefault([]any{200}),
+		"timeout":          optInt().withDefault(30),
+		"headers":          optDict().withDefault(map[string]any{}),
+		"ca_path":          optPath(),
+		"src":              optPath(),
+		"force":            optBool().withDefault(false),
+		"unix_socket":      optPath(),
+	}.with(urlCommonOptions, fileCommonOptions),
+	"unarchive": moduleOptions{
+		"src":            optPath(),
+		"dest":           optPath(),
+		"remote_src":     optBool().withDefault(false),
+		"creates":        optPath(),
+		"list_files":     optBool().withDefault(false),
+		"keep_newer":     optBool().withDefault(false),
+		"exclude":        optList("str").withDefault([]any{}),
+		"include":        optList("str").withDefault([]any{}),
+		"extra_opts":     optList("str").withDefault([]any{}),
+		"validate_certs": optBool().withDefault(true),
+		"io_buffer_size": optInt().withDefault(65536),
+		"decrypt":        optBool().withDefault(true),
+		"copy":           optBool().withDefault(true),
+	}.with(fileCommonOptions),
+	"git": moduleOptions{
+		"repo":              optStr("name"),
+		"dest":              optPath(),
+		"version":           optStr().withDefault("HEAD"),
+		"remote":            optStr().withDefault("origin"),
+		"refspec":           optStr(),
+		"reference":         optStr(),
+		"force":             optBool().withDefault(false),
+		"depth":             optInt(),
+		"clone":             optBool().withDefault(true),
+		"update":            optBool().withDefault(true),
+		"verify_commit":     optBool().withDefault(false),
+		"gpg_allowlist":     optList("str", "gpg_whitelist").withDefault([]any{}),
+		"accept_hostkey":    optBool().withDefault(false),
+		"accept_newhostkey": optBool().withDefault(false),
+		"key_file":          optPath(),
+		"ssh_opts":          optStr(),
+		"executable":        optPath(),
+		"bare":              optBool().withDefault(false),
+		"umask":             optRaw(),
+		"recursive":         optBool().withDefault(true),
+		"single_branch":     optBool().withDefault(false),
+		"track_submodules":  optBool().withDefault(false),
+		"archive":           optPath(),
+		"archive_prefix":    optStr(),
+		"separate_git_dir":  optPath(),
+	},
+	"cron": moduleOptions{
+		"name":         optStr(),
+		"user":         optStr(),
+		"job":          optStr("value"),
+		"state":        statePresentAbsent(),
+		"cron_file":    optPath(),
+		"backup":       optBool().withDefault(false),
+		"minute":       optStr().withDefault("*"),
+		"hour":         optStr().withDefault("*"),
+		"day":          optStr("dom").withDefault("*"),
+		"month":        optStr().withDefault("*"),
+		"weekday":      optStr("dow").withDefault("*"),
+		"special_time": optStr().withChoices("annually", "daily", "hourly", "monthly", "reboot", "weekly", "yearly"),
+		"disabled":     optBool().withDefault(false),
+		"env":          optBool().withDefault(false),
+		"insertafter":  optStr(),
+		"insertbefore": optStr(),
+	},
+	"apt_key": moduleOptions{
+		"id":             optStr(),
+		"url":            optStr(),
+		"data":           optStr(),
+		"file":           optPath(),
+		"keyring":        optPath(),
+		"keyserver":      optStr(),
+		"state":          statePresentAbsent(),
+		"validate_certs": optBool().withDefault(true),
+	},
+	"apt_repository": moduleOptions{
+		"repo":                         optStr(),
+		"state":                        statePresentAbsent(),
+		"mode":                         optRaw(),
+		"update_cache":                 optBool("update-cache").withDefault(true),
+		"update_cache_retries":         optInt().withDefault(5),
+		"update_cache_retry_max_delay": optInt().withDefault(12),
+		"validate_certs":               optBool().withDefault(true),
+		"filename":                     optStr(),
+		"codename":                     optStr(),
+		"install_python_apt":           optBool().withDefault(true),
+	},
+	"yum_repository": moduleOptions{
+		"name":                optStr(),
+		"description":         optStr(),
+		"baseurl":             optList("str"),
+		"mirrorlist":          optStr(),
+		"metalink":            optStr(),
+		"enabled":             optBool(),
+		"gpgcheck":            optBool(),
+		"gpgkey":              optList("str"),
+		"repo_gpgcheck":       optBool(),
+		"sslverify":           optBool("validate_certs"),
+		"sslcacert":           optStr("ca_cert"),
+		"sslclientcert":       optStr("client_cert"),
+		"sslclientkey":        optStr("client_key"),
+		"password":            optStr().secret(),
+		"username":            optStr(),
+		"proxy":               optStr(),
+		"proxy_password":      optStr().secret(),
+		"proxy_username":      optStr(),
+		"priority":            optStr(),
+		"file":                optStr(),
+		"reposdir":            optPath().withDefault("/etc/yum.repos.d"),
+		"exclude":             optList("str"),
+		"includepkgs":         optList("str"),
+		"skip_if_unavailable": optBool(),
+		"state":               statePresentAbsent(),
+	}.with(fileCommonOptions),
+	"rpm_key": moduleOptions{
+		"key":            optStr(),
+		"state":          statePresentAbsent(),
+		"validate_certs": optBool().withDefault(true),
+		"fingerprint":    optList("str"),
+	},
+	"debug": moduleOptions{
+		"msg":       optRaw().withDefault("Hello world!"),
+		"var":       optRaw(),
+		"verbosity": optInt().withDefault(0),
+	},
+	"assert": moduleOptions{
+		"that":        optList("str"),
+		"fail_msg":    optRaw("msg"),
+		"success_msg": optRaw(),
+		"quiet":       optBool().withDefault(false),
+	},
+	"fail": moduleOptions{
+		"msg": optRaw().withDefault("Failed as requested from task"),
+	},
+	"wait_for": moduleOptions{
+		"host":                     optStr().withDefault("127.0.0.1"),
+		"timeout":                  optInt().withDefault(300),
+		"connect_timeout":          optInt().withDefault(5),
+		"delay":                    optInt().withDefault(0),
+		"port":                     optInt(),
+		"active_connection_states": optList("str"),
+		"state":                    optStr().withDefault("started").withChoices("absent", "drained", "present", "started", "stopped"),
+		"path":                     optPath(),
+		"search_regex":             optStr(),
+		"exclude_hosts":            optList("str"),
+		"sleep":                    optInt().withDefault(1),
+		"msg":                      optStr(),
+	},
+	"stat": moduleOptions{
+		"path":                optPath("dest", "name"),
+		"follow":              optBool().withDefault(false),
+		"get_checksum":        optBool().withDefault(true),
+		"checksum_algorithm":  optStr("checksum", "checksum_algo").withDefault("sha1").withChoices("md5", "sha1", "sha224", "sha256", "sha384", "sha512"),
+		"get_mime":            optBool("mime", "mime_type", "mime-type").withDefault(true),
+		"get_attributes":      optBool("attr", "attributes").withDefault(true),
+		"get_selinux_context": optBool().withDefault(false),
+	},
+	"fetch": moduleOptions{
+		"src":               optStr(),
+		"dest":              optStr(),
+		"flat":              optBool().withDefault(false),
+		"fail_on_missing":   optBool().withDefault(true),
+		"validate_checksum": optBool().withDefault(true),
+	},
+	"slurp": moduleOptions{
+		"src": optPath("path"),
+	},
+	"find": moduleOptions{
+		"paths":              optList("path", "name", "path"),
+		"patterns":           optList("str", "pattern").withDefault([]any{}),
+		"excludes":           optList("str", "exclude"),
+		"contains":           optStr(),
+		"read_whole_file":    optBool().withDefault(false),
+		"file_type":          optStr().withDefault("file").withChoices("any", "directory", "file", "link"),
+		"age":                optStr(),
+		"age_stamp":          optStr().withDefault("mtime").withChoices("atime", "ctime", "mtime"),
+		"size":               optStr(),
+		"recurse":            optBool().withDefault(false),
+		"hidden":             optBool().withDefault(false),
+		"mode":               optRaw(),
+		"exact_mode":         optBool().withDefault(true),
+		"follow":             optBool().withDefault(false),
+		"get_checksum":       optBool().withDefault(false),
+		"checksum_algorithm": optStr("checksum", "checksum_algo").withDefault("sha1"),
+		"use_regex":          optBool().withDefault(false),
+		"depth":              optInt(),
+		"encoding":           optStr(),
+		"limit":              optInt(),
+	},
+	"known_hosts": moduleOptions{
+		"name":      optStr("host"),
+		"key":       optStr(),
+		"path":      optPath().withDefault("~/.ssh/known_hosts"),
+		"hash_host": optBool().withDefault(false),
+		"state":     statePresentAbsent(),
+	},
+	"iptables": moduleOptions{
+		"table":               optStr().withDefault("filter").withChoices("filter", "nat", "mangle", "raw", "security"),
+		"state":               statePresentAbsent(),
+		"action":              optStr().withDefault("append").withChoices("append", "insert"),
+		"rule_num":            optStr(),
+		"ip_version":          optStr().withDefault("ipv4").withChoices("ipv4", "ipv6", "both"),
+		"chain":               optStr(),
+		"protocol":            optStr(),
+		"source":              optStr(),
+		"destination":         optStr(),
+		"match":               optList("str").withDefault([]any{}),
+		"tcp_flags":           optDict().withDefault(map[string]any{}),
+		"jump":                optStr(),
+		"gateway":             optStr(),
+		"log_prefix":          optStr(),
+		"log_level":           optStr(),
+		"goto":                optStr(),
+		"in_interface":        optStr(),
+		"out_interface":       optStr(),
+		"fragment":            optStr(),
+		"set_counters":        optStr(),
+		"source_port":         optStr(),
+		"destination_port":    optStr(),
+		"destination_ports":   optList("str").withDefault([]any{}),
+		"to_ports":            optStr(),
+		"to_destination":      optStr(),
+		"to_source":           optStr(),
+		"syn":                 optStr().withDefault("ignore").withChoices("ignore", "match", "negate"),
+		"set_dscp_mark":       optStr(),
+		"set_dscp_mark_class": optStr(),
+		"comment":             optStr(),
+		"ctstate":             optList("str").withDefault([]any{}),
+		"src_range":           optStr(),
+		"dst_range":           optStr(),
+		"match_set":           optStr(),
+		"match_set_flags":     optStr(),
+		"limit":               optStr(),
+		"limit_burst":         optStr(),
+		"uid_owner":           optStr(),
+		"gid_owner":           optStr(),
+		"reject_with":         optStr(),
+		"icmp_type":           optStr(),
+		"flush":               optBool().withDefault(false),
+		"policy":              optStr().withChoices("ACCEPT", "DROP", "QUEUE", "RETURN"),
+		"wait":                optStr(),
+		"chain_management":    optBool().withDefault(false),
+		"numeric":             optBool().withDefault(false),
+	},
+	"include_role": moduleOptions{
+		"name":              optStr(),
+		"tasks_from":        optStr().withDefault("main"),
+		"vars_from":         optStr().withDefault("main"),
+		"defaults_from":     optStr().withDefault("main"),
+		"handlers_from":     optStr().withDefault("main"),
+		"allow_duplicates":  optBool().withDefault(true),
+		"public":            optBool(),
+		"apply":             optDict(),
+		"rolespec_validate": optBool().withDefault(true),
+	},
+	"import_role": moduleOptions{
+		"name":              optStr(),
+		"tasks_from":        optStr().withDefault("main"),
+		"vars_from":         optStr().withDefault("main"),
+		"defaults_from":     optStr().withDefault("main"),
+		"handlers_from":     optStr().withDefault("main"),
+		"allow_duplicates":  optBool().withDefault(true),
+		"rolespec_validate": optBool().withDefault(true),
+	},
+	"reboot": moduleOptions{
+		"pre_reboot_delay":  optInt().withDefault(0),
+		"post_reboot_delay": optInt().withDefault(0),
+		"reboot_timeout":    optInt().withDefault(600),
+		"connect_timeout":   optInt(),
+		"test_command":      optStr().withDefault("whoami"),
+		"msg":               optStr().withDefault("Reboot initiated by Ansible"),
+		"search_paths":      optList("str").withDefault([]any{"/sbin", "/bin", "/usr/sbin", "/usr/bin", "/usr/local/sbin"}),
+		"boot_time_command": optStr().withDefault("cat /proc/sys/kernel/random/boot_id"),
+		"reboot_command":    optStr(),
+	},
+	"tempfile": moduleOptions{
+		"state":  optStr().withDefault("file").withChoices("directory", "file"),
+		"path":   optPath(),
+		"prefix": optStr().withDefault("ansible."),
+		"suffix": optStr().withDefault(""),
+	},
+	"setup": moduleOptions{
+		"gather_subset":  optList("str").withDefault([]any{"all"}),
+		"gather_timeout": optInt().withDefault(10),
+		"filter":         optList("str").withDefault([]any{}),
+		"fact_path":      optPath().withDefault("/etc/ansible/facts.d"),
+	},
+}
+
+// awsCommonOptions are the options of all "amazon.aws" modules.
+var awsCommonOptions = moduleOptions{
+	"access_key":                   optStr("aws_access_key_id", "aws_access_key", "ec2_access_key").secret(),
+	"secret_key":                   optStr("aws_secret_access_key", "aws_secret_key", "ec2_secret_key").secret(),
+	"session_token":                optStr("aws_session_token", "security_token", "aws_security_token", "access_token").secret(),
+	"profile":                      optStr("aws_profile"),
+	"endpoint_url":                 optStr("aws_endpoint_url", "ec2_url", "s3_url"),
+	"region":                       optStr("aws_region", "ec2_region"),
+	"validate_certs":               optBool().withDefault(true),
+	"aws_ca_bundle":                optPath(),
+	"aws_config":                   optDict(),
+	"debug_botocore_endpoint_logs": optBool().withDefault(false),
+}
+
+var awsModules = map[string]moduleOptions{
+	"s3_bucket": moduleOptions{
+		"name":                    optStr(),
+		"state":                   statePresentAbsent(),
+		"policy":                  optRaw(),
+		"versioning":              optBool(),
+		"requester_pays":          optBool(),
+		"force":                   optBool().withDefault(false),
+		"encryption":              optStr().withChoices("none", "AES256", "aws:kms"),
+		"encryption_key_id":       optStr(),
+		"bucket_key_enabled":      optBool(),
+		"public_access":           optDict(),
+		"delete_public_access":    optBool().withDefault(false),
+		"object_ownership":        optStr().withChoices("BucketOwnerEnforced", "BucketOwnerPreferred", "ObjectWriter"),
+		"delete_object_ownership": optBool().withDefault(false),
+		"acl":                     optStr().withChoices("private", "public-read", "public-read-write", "authenticated-read"),
+		"validate_bucket_name":    optBool().withDefault(true),
+		"object_lock_enabled":     optBool(),
+		"ceph":                    optBool("rgw").withDefault(false),
+	}.with(withTags("resource_tags")),
+	"s3_object": moduleOptions{
+		"bucket":                optStr(),
+		"object":                optStr(),
+		"mode":                  optStr().withChoices("get", "put", "create", "geturl", "getstr", "delobj", "list", "copy"),
+		"permission":            optList("str").withDefault([]any{"private"}),
+		"src":                   optPath(),
+		"content":               optStr(),
+		"dest":                  optPath(),
+		"encrypt":               optBool().withDefault(true),
+		"encryption_mode":       optStr().withDefault("AES256").withChoices("AES256", "aws:kms"),
+		"encryption_kms_key_id": optStr(),
+		"overwrite":             optStr("force").withDefault("different"),
+		"metadata":              optDict(),
+		"headers":               optDict(),
+		"expiry":                optInt("expiration").withDefault(600),
+		"marker":                optStr(),
+		"max_keys":              optInt().withDefault(1000),
+		"prefix":                optStr().withDefault(""),
+		"version":               optStr(),
+		"retries":               optInt("retry").withDefault(0),
+		"ceph":                  optBool("rgw").withDefault(false),
+		"dualstack":             optBool().withDefault(false),
+		"sig_v4":                optBool().withDefault(true),
+		"copy_src":              optDict(),
+		"validate_bucket_name":  optBool().withDefault(true),
+	}.with(withTags()),
+	"ec2_instance": moduleOptions{
+		"instance_ids":                         optList("str"),
+		"state":                                optStr().withDefault("present").withChoices("present", "terminated", "running", "started", "stopped", "restarted", "rebooted", "absent"),
+		"wait":                                 optBool().withDefault(true),
+		"wait_timeout":                         optInt().withDefault(600),
+		"count":                                optInt(),
+		"exact_count":                          optInt(),
+		"image":                                optDict(),
+		"image_id":                             optStr(),
+		"instance_type":                        optStr(),
+		"user_data":                            optStr(),
+		"aap_callback":                         optDict("tower_callback"),
+		"ebs_optimized":                        optBool(),
+		"vpc_subnet_id":                        optStr("subnet_id"),
+		"availability_zone":                    optStr(),
+		"security_groups":                      optList("str").withDefault([]any{}),
+		"security_group":                       optStr(),
+		"instance_role":                        optStr(),
+		"name":                                 optStr(),
+		"filters":                              optDict(),
+		"launch_template":                      optDict(),
+		"key_name":                             optStr(),
+		"cpu_credit_specification":             optStr().withChoices("unlimited", "standard"),
+		"cpu_options":                          optDict(),
+		"tenancy":                              optStr().withChoices("dedicated", "default"),
+		"placement_group":                      optStr(),
+		"placement":                            optDict(),
+		"instance_initiated_shutdown_behavior": optStr().withChoices("stop", "terminate"),
+		"termination_protection":               optBool(),
+		"hibernation_options":                  optBool().withDefault(false),
+		"network":                              optDict(),
+		"network_interfaces":                   optList("dict"),
+		"network_interfaces_ids":               optList("dict"),
+		"volumes":                              optList("dict"),
+		"detailed_monitoring":                  optBool(),
+		"metadata_options":                     optDict(),
+		"license_specifications":               optList("dict"),
+		"additional_info":                      optStr(),
+	}.with(withTags("resource_tags")),
+	"ec2_security_group": moduleOptions{
+		"name":               optStr(),
+		"group_id":           optStr(),
+		"description":        optStr(),
+		"vpc_id":             optStr(),
+		"rules":              optList("dict"),
+		"rules_egress":       optList("dict", "egress_rules"),
+		"state":              statePresentAbsent(),
+		"purge_rules":        optBool().withDefault(true),
+		"purge_rules_egress": optBool("purge_egress_rules").withDefault(true),
+	}.with(withTags("resource_tags")),
+	"ec2_vpc_net": moduleOptions{
+		"name":          optStr(),
+		"vpc_id":        optStr(),
+		"cidr_block":    optList("str"),
+		"ipv6_cidr":     optBool(),
+		"purge_cidrs":   optBool().withDefault(false),
+		"tenancy":       optStr().withDefault("default").withChoices("default", "dedicated"),
+		"dns_support":   optBool().withDefault(true),
+		"dns_hostnames": optBool().withDefault(true),
+		"dhcp_opts_id":  optStr(),
+		"state":         statePresentAbsent(),
+		"multi_ok":      optBool().withDefault(false),
+	}.with(withTags("resource_tags")),
+	"iam_role": moduleOptions{
+		"name":                        optStr("role_name"),
+		"path":                        optStr("path_prefix", "prefix"),
+		"description":                 optStr(),
+		"boundary":                    optStr("boundary_policy_arn"),
+		"assume_role_policy_document": optRaw(),
+		"managed_policies":            optList("str", "managed_policy"),
+		"max_session_duration":        optInt(),
+		"state":                       statePresentAbsent(),
+		"create_instance_profile":     optBool().withDefault(true),
+		"delete_instance_profile":     optBool().withDefault(false),
+		"purge_policies":              optBool("purge_policy", "purge_managed_policies"),
+		"wait":                        optBool().withDefault(true),
+		"wait_timeout":                optInt().withDefault(120),
+	}.with(withTags("resource_tags")),
+	"iam_policy": moduleOptions{
+		"iam_type":        optStr().withChoices("user", "group", "role"),
+		"iam_name":        optStr(),
+		"policy_name":     optStr(),
+		"policy_json":     optRaw(),
+		"state":           statePresentAbsent(),
+		"skip_duplicates": optBool().withDefault(false),
+	},
+	"iam_user": moduleOptions{
+		"name":                    optStr("user_name"),
+		"path":                    optStr("prefix", "path_prefix"),
+		"boundary":                optStr("boundary_policy_arn", "permissions_boundary"),
+		"password":                optStr().secret(),
+		"password_reset_required": optBool().withDefault(false),
+		"update_password":         optStr().withDefault("always").withChoices("always", "on_create"),
+		"remove_password":         optBool(),
+		"managed_policies":        optList("str", "managed_policy"),
+		"state":                   statePresentAbsent(),
+		"purge_policies":          optBool("purge_policy", "purge_managed_policies").withDefault(false),
+		"wait":                    optBool().withDefault(true),
+		"wait_timeout":            optInt().withDefault(120),
+	}.with(withTags("resource_tags")),
+	"rds_instance": moduleOptions{
+		"db_instance_identifier":             optStr("id"),
+		"engine":                             optStr(),
+		"engine_version":                     optStr(),
+		"db_instance_class":                  optStr("class", "instance_type"),
+		"allocated_storage":                  optInt(),
+		"master_username":                    optStr("username"),
+		"master_user_password":               optStr("password").secret(),
+		"storage_encrypted":                  optBool(),
+		"kms_key_id":                         optStr(),
+		"publicly_accessible":                optBool(),
+		"backup_retention_period":            optInt(),
+		"multi_az":                           optBool(),
+		"deletion_protection":                optBool(),
+		"enable_iam_database_authentication": optBool(),
+		"auto_minor_version_upgrade":         optBool(),
+		"port":                               optInt(),
+		"state":                              optStr().withDefault("present").withChoices("present", "absent", "terminated", "running", "started", "stopped", "rebooted", "restarted"),
+		"skip_final_snapshot":                optBool().withDefault(false),
+		"final_db_snapshot_identifier":       optStr("final_snapshot_identifier"),
+		"enable_cloudwatch_logs_exports":     optList("str", "cloudwatch_log_exports"),
+		"vpc_security_group_ids":             optList("str"),
+		"db_subnet_group_name":               optStr("subnet_group"),
+		"apply_immediately":                  optBool().withDefault(false),
+		"storage_type":                       optStr().withChoices("standard", "gp2", "gp3", "io1", "io2"),
+		"copy_tags_to_snapshot":              optBool(),
+		"db_name":                            optStr(),
+		"wait":                               optBool().withDefault(true),
+	}.with(withTags()),
+	"cloudtrail": moduleOptions{
+		"name":                          optStr().withDefault("default"),
+		"state":                         optStr().withDefault("present").withChoices("present", "absent", "enabled", "disabled"),
+		"s3_bucket_name":                optStr(),
+		"s3_key_prefix":                 optStr(),
+		"sns_topic_name":                optStr(),
+		"is_multi_region_trail":         optBool().withDefault(false),
+		"enable_log_file_validation":    optBool("log_file_validation_enabled"),
+		"include_global_events":         optBool().withDefault(true),
+		"enable_logging":                optBool().withDefault(true),
+		"cloudwatch_logs_role_arn":      optStr(),
+		"cloudwatch_logs_log_group_arn": optStr(),
+		"kms_key_id":                    optStr(),
+	}.with(withTags()),
+	"lambda": moduleOptions{
+		"name":                   optStr(),
+		"state":                  statePresentAbsent(),
+		"runtime":                optStr(),
+		"role":                   optStr(),
+		"handler":                optStr(),
+		"zip_file":               optStr("src"),
+		"image_uri":              optStr(),
+		"s3_bucket":              optStr(),
+		"s3_key":                 optStr(),
+		"s3_object_version":      optStr(),
+		"description":            optStr().withDefault(""),
+		"timeout":                optInt().withDefault(3),
+		"memory_size":            optInt().withDefault(128),
+		"vpc_subnet_ids":         optList("str"),
+		"vpc_security_group_ids": optList("str"),
+		"environment_variables":  optDict(),
+		"dead_letter_arn":        optStr(),
+		"tracing_mode":           optStr().withChoices("Active", "PassThrough"),
+		"kms_key_arn":            optStr(),
+		"architecture":           optStr("architectures").withChoices("x86_64", "arm64"),
+		"layers":                 optList("dict"),
+	}.with(withTags()),
+	"kms_key": moduleOptions{
+		"alias":               optStr("key_alias"),
+		"key_id":              optStr("id", "key_arn"),
+		"enable_key_rotation": optBool(),
+		"description":         optStr(),
+		"enabled":             optBool().withDefault(true),
+		"multi_region":        optBool().withDefault(false),
+		"policy":              optRaw(),
+		"state":               statePresentAbsent(),
+		"key_spec":            optStr("customer_master_key_spec").withDefault("SYMMETRIC_DEFAULT"),
+		"key_usage":           optStr().withDefault("ENCRYPT_DECRYPT").withChoices("ENCRYPT_DECRYPT", "SIGN_VERIFY"),
+		"grants":              optList("dict").withDefault([]any{}),
+		"purge_grants":        optBool().withDefault(false),
+		"pending_window":      optInt("deletion_delay"),
+	}.with(withTags("resource_tags")),
+}
+
+// azureCommonOptions are the options of all "azure.azcollection" modules.
+var azureCommonOptions = moduleOptions{
+	"auth_source":                optStr().withChoices("auto", "cli", "credential_file", "env", "msi"),
+	"profile":                    optStr(),
+	"subscription_id":            optStr(),
+	"client_id":                  optStr(),
+	"secret":                     optStr().secret(),
+	"tenant":                     optStr(),
+	"ad_user":                    optStr(),
+	"password":                   optStr().secret(),
+	"cloud_environment":          optStr().withDefault("AzureCloud"),
+	"adfs_authority_url":         optStr(),
+	"cert_validation_mode":       optStr().withChoices("validate", "ignore"),
+	"api_profile":                optStr().withDefault("latest"),
+	"log_mode":                   optStr(),
+	"log_path":                   optStr(),
+	"x509_certificate_path":      optPath(),
+	"thumbprint":                 optStr(),
+	"disable_instance_discovery": optBool().withDefault(false),
+}
+
+var azureTagsOptions = moduleOptions{
+	"tags":        optDict(),
+	"append_tags": optBool().withDefault(true),
+}
+
+var azureModules = map[string]moduleOptions{
+	"azure_rm_resourcegroup": moduleOptions{
+		"name":                  optStr(),
+		"state":                 statePresentAbsent(),
+		"location":              optStr(),
+		"force_delete_nonempty": optBool("force").withDefault(false),
+	}.with(azureTagsOptions),
+	"azure_rm_storageaccount": moduleOptions{
+		"resource_group":           optStr("resource_group_name"),
+		"name":                     optStr(),
+		"state":                    statePresentAbsent(),
+		"location":                 optStr(),
+		"account_type":             optStr("type").withChoices("Premium_LRS", "Standard_GRS", "Standard_LRS", "Standard_RAGRS", "Standard_ZRS", "Premium_ZRS", "Standard_RAGZRS", "Standard_GZRS"),
+		"custom_domain":            optDict("custom_dns_domain_suffix"),
+		"kind":                     optStr().withDefault("Storage").withChoices("Storage", "StorageV2", "BlobStorage", "BlockBlobStorage", "FileStorage"),
+		"access_tier":              optStr().withChoices("Hot", "Cool"),
+		"force_delete_nonempty":    optBool("force_delete").withDefault(false),
+		"https_only":               optBool(),
+		"minimum_tls_version":      optStr().withChoices("TLS1_0", "TLS1_1", "TLS1_2"),
+		"public_network_access":    optStr().withChoices("Enabled", "Disabled"),
+		"allow_blob_public_access": optBool(),
+		"network_acls":             optDict(),
+		"blob_cors":                optList("dict"),
+		"static_website":           optDict(),
+		"encryption":               optDict(),
+		"is_hns_enabled":           optBool(),
+		"large_file_shares_state":  optStr().withChoices("Enabled", "Disabled"),
+		"enable_nfs_v3":            optBool(),
+	}.with(azureTagsOptions),
+	"azure_rm_virtualmachine": moduleOptions{
+		"resource_group":              optStr(),
+		"name":                        optStr(),
+		"state":                       statePresentAbsent(),
+		"location":                    optStr(),
+		"vm_size":                     optStr(),
+		"admin_username":              optStr(),
+		"admin_password":              optStr().secret(),
+		"ssh_password_enabled":        optBool().withDefault(true),
+		"ssh_public_keys":             optList("dict"),
+		"image":                       optRaw(),
+		"os_type":                     optStr().withDefault("Linux").withChoices("Windows", "Linux"),
+		"managed_disk_type":           optStr(),
+		"os_disk_size_gb":             optInt(),
+		"public_ip_allocation_method": optStr("public_ip_allocation").withDefault("Static").withChoices("Dynamic", "Static", "Disabled"),
+		"open_ports":                  optList("str"),
+		"network_interface_names":     optList("raw", "network_interfaces"),
+		"virtual_network_name":        optStr("virtual_network"),
+		"subnet_name":                 optStr("subnet"),
+		"started":                     optBool(),
+		"allocated":                   optBool().withDefault(true),
+		"availability_set":            optStr(),
+		"zones":                       optList("str"),
+		"security_profile":            optDict(),
+		"boot_diagnostics":            optDict(),
+		"custom_data":                 optStr(),
+		"data_disks":                  optList("dict"),
+		"license_type":                optStr(),
+		"priority":                    optStr(),
+		"vm_identity":                 optDict(),
+		"generalized":                 optBool().withDefault(false),
+		"remove_on_absent":            optList("str").withDefault([]any{"all"}),
+	}.with(azureTagsOptions),
+	"azure_rm_securitygroup": moduleOptions{
+		"resource_group":      optStr(),
+		"name":                optStr(),
+		"state":               statePresentAbsent(),
+		"location":            optStr(),
+		"rules":               optList("dict"),
+		"default_rules":       optList("dict"),
+		"purge_rules":         optBool().withDefault(false),
+		"purge_default_rules": optBool().withDefault(false),
+	}.with(azureTagsOptions),
+	"azure_rm_keyvault": moduleOptions{
+		"resource_group":                  optStr(),
+		"vault_name":                      optStr(),
+		"location":                        optStr(),
+		"vault_tenant":                    optStr(),
+		"access_policies":                 optList("dict"),
+		"sku":                             optDict(),
+		"enabled_for_deployment":          optBool(),
+		"enabled_for_disk_encryption":     optBool(),
+		"enabled_for_template_deployment": optBool(),
+		"enable_soft_delete":              optBool(),
+		"soft_delete_retention_in_days":   optInt(),
+		"enable_purge_protection":         optBool(),
+		"recover_mode":                    optBool(),
+		"state":                           statePresentAbsent(),
+	}.with(azureTagsOptions),
+	"azure_rm_sqlserver": moduleOptions{
+		"resource_group":                   optStr(),
+		"name":                             optStr(),
+		"location":                         optStr(),
+		"admin_username":                   optStr(),
+		"admin_password":                   optStr().secret(),
+		"version":                          optStr(),
+		"identity":                         optStr(),
+		"minimal_tls_version":              optStr().withChoices("1.0", "1.1", "1.2"),
+		"public_network_access":            optStr().withChoices("Enabled", "Disabled"),
+		"restrict_outbound_network_access": optStr().withChoices("Enabled", "Disabled"),
+		"change_admin_password":            optBool().withDefault(false),
+		"administrators":                   optDict(),
+		"state":                            statePresentAbsent(),
+	}.with(azureTagsOptions),
+	"azure_rm_aks": moduleOptions{
+		"resource_group":            optStr(),
+		"name":                      optStr(),
+		"state":                     statePresentAbsent(),
+		"location":                  optStr(),
+		"dns_prefix":                optStr(),
+		"kubernetes_version":        optStr(),
+		"linux_profile":             optDict(),
+		"agent_pool_profiles":       optList("dict"),
+		"service_principal":         optDict(),
+		"enable_rbac":               optBool().withDefault(false),
+		"network_profile":           optDict(),
+		"aad_profile":               optDict(),
+		"api_server_access_profile": optDict(),
+		"addon":                     optDict(),
+		"node_resource_group":       optStr(),
+	}.with(azureTagsOptions),
+	"azure_rm_webapp": moduleOptions{
+		"resource_group":          optStr(),
+		"name":                    optStr(),
+		"location":                optStr(),
+		"plan":                    optRaw(),
+		"frameworks":              optList("dict"),
+		"container_settings":      optDict(),
+		"scm_type":                optStr(),
+		"deployment_source":       optDict(),
+		"startup_file":            optStr(),
+		"client_affinity_enabled": optBool().withDefault(true),
+		"https_only":              optBool(),
+		"ftps_state":              optStr().withChoices("AllAllowed", "FtpsOnly", "Disabled"),
+		"min_tls_version":         optStr().withChoices("1.0", "1.1", "1.2"),
+		"http20_enabled":          optBool(),
+		"app_settings":            optDict(),
+		"purge_app_settings":      optBool().withDefault(false),
+		"app_state":               optStr().withDefault("started").withChoices("started", "stopped", "restarted"),
+		"state":                   statePresentAbsent(),
+	}.with(azureTagsOptions),
+}
+
+// gcpCommonOptions are the options of all "google.cloud" modules.
+var gcpCommonOptions = moduleOptions{
+	"project":                  optStr(),
+	"auth_kind":                optStr().withChoices("application", "machineaccount", "serviceaccount", "accesstoken"),
+	"service_account_contents": optRaw().secret(),
+	"service_account_file":     optPath(),
+	"service_account_email":    optStr(),
+	"access_token":             optStr().secret(),
+	"scopes":                   optList("str"),
+	"env_type":                 optStr(),
+	"state":                    statePresentAbsent(),
+}
+
+var gcpModules = map[string]moduleOptions{
+	"gcp_compute_instance": moduleOptions{
+		"name":                         optStr(),
+		"machine_type":                 optStr(),
+		"zone":                         optStr(),
+		"can_ip_forward":               optBool("ip_forward"),
+		"deletion_protection":          optBool(),
+		"disks":                        optList("dict"),
+		"network_interfaces":           optList("dict"),
+		"service_accounts":             optList("dict"),
+		"metadata":                     optDict(),
+		"labels":                       optDict(),
+		"tags":                         optDict(),
+		"scheduling":                   optDict(),
+		"shielded_instance_config":     optDict(),
+		"confidential_instance_config": optDict(),
+		"status":                       optStr().withChoices("RUNNING", "TERMINATED", "SUSPENDED"),
+		"min_cpu_platform":             optStr(),
+		"hostname":                     optStr(),
+		"guest_accelerators":           optList("dict"),
+	},
+	"gcp_compute_firewall": moduleOptions{
+		"name":                    optStr(),
+		"description":             optStr(),
+		"allowed":                 optList("dict"),
+		"denied":                  optList("dict"),
+		"destination_ranges":      optList("str"),
+		"direction":               optStr().withChoices("INGRESS", "EGRESS"),
+		"disabled":                optBool(),
+		"log_config":              optDict(),
+		"network":                 optDict(),
+		"priority":                optInt().withDefault(1000),
+		"source_ranges":           optList("str"),
+		"source_service_accounts": optList("str"),
+		"source_tags":             optList("str"),
+		"target_service_accounts": optList("str"),
+		"target_tags":             optList("str"),
+	},
+	"gcp_storage_bucket": moduleOptions{
+		"name":                          optStr(),
+		"acl":                           optList("dict"),
+		"cors":                          optList("dict"),
+		"default_event_based_hold":      optBool(),
+		"default_object_acl":            optList("dict"),
+		"lifecycle":                     optDict(),
+		"location":                      optStr(),
+		"logging":                       optDict(),
+		"metageneration":                optInt(),
+		"owner":                         optDict(),
+		"storage_class":                 optStr().withChoices("MULTI_REGIONAL", "REGIONAL", "STANDARD", "NEARLINE", "COLDLINE", "DURABLE_REDUCED_AVAILABILITY"),
+		"versioning":                    optDict(),
+		"website":                       optDict(),
+		"labels":                        optDict(),
+		"predefined_default_object_acl": optStr().withChoices("authenticatedRead", "bucketOwnerFullControl", "bucketOwnerRead", "private", "projectPrivate", "publicRead"),
+		"iam_configuration":             optDict(),
+		"retention_policy":              optDict(),
+		"encryption":                    optDict(),
+	},
+	"gcp_sql_instance": moduleOptions{
+		"name":                          optStr(),
+		"database_version":              optStr(),
+		"region":                        optStr(),
+		"settings":                      optDict(),
+		"backend_type":                  optStr(),
+		"connection_name":               optStr(),
+		"failover_replica":              optDict(),
+		"instance_type":                 optStr(),
+		"ip_address":                    optList("dict"),
+		"ipv6_address":                  optStr(),
+		"master_instance_name":          optStr(),
+		"max_disk_size":                 optInt(),
+		"on_premises_configuration":     optDict(),
+		"replica_configuration":         optDict(),
+		"disk_encryption_configuration": optDict(),
+		"root_password":                 optStr().secret(),
+	},
+	"gcp_container_cluster": moduleOptions{
+		"name":                              optStr(),
+		"location":                          optStr("zone"),
+		"description":                       optStr(),
+		"initial_node_count":                optInt(),
+		"node_config":                       optDict(),
+		"master_auth":                       optDict(),
+		"logging_service":                   optStr(),
+		"monitoring_service":                optStr(),
+		"network":                           optStr(),
+		"private_cluster_config":            optDict(),
+		"cluster_ipv4_cidr":                 optStr(),
+		"addons_config":                     optDict(),
+		"subnetwork":                        optStr(),
+		"enable_tpu":                        optBool(),
+		"legacy_abac":                       optDict(),
+		"network_policy":                    optDict(),
+		"default_max_pods_constraint":       optDict(),
+		"ip_allocation_policy":              optDict(),
+		"master_authorized_networks_config": optDict(),
+		"binary_authorization":              optDict(),
+		"release_channel":                   optDict(),
+		"shielded_nodes":                    optDict(),
+		"network_config":                    optDict(),
+		"enable_kubernetes_alpha":           optBool(),
+		"resource_labels":                   optDict(),
+		"kubectl_path":                      optStr(),
+		"kubectl_context":                   optStr(),
+	},
+	"gcp_iam_service_account": moduleOptions{
+		"name":         optStr(),
+		"display_name": optStr(),
+	},
+	"gcp_kms_crypto_key": moduleOptions{
+		"name":                          optStr(),
+		"labels":                        optDict(),
+		"purpose":                       optStr().withDefault("ENCRYPT_DECRYPT"),
+		"rotation_period":               optStr(),
+		"version_template":              optDict(),
+		"next_rotation_time":            optStr(),
+		"key_ring":                      optStr(),
+		"skip_initial_version_creation": optBool().withDefault(false),
+	},
+}
+
+// k8sCommonOptions are the connection options of the "kubernetes.core" modules.
+var k8sCommonOptions = moduleOptions{
+	"kubeconfig":         optRaw(),
+	"context":            optStr(),
+	"host":               optStr(),
+	"api_key":            optStr().secret(),
+	"username":           optStr(),
+	"password":           optStr().secret(),
+	"validate_certs":     optBool("verify_ssl"),
+	"ca_cert":            optPath("ssl_ca_cert"),
+	"client_cert":        optPath("cert_file"),
+	"client_key":         optPath("key_file"),
+	"proxy":              optStr(),
+	"no_proxy":           optStr(),
+	"proxy_headers":      optDict(),
+	"persist_config":     optBool(),
+	"impersonate_user":   optStr(),
+	"impersonate_groups": optList("str"),
+}
+
+var k8sResourceOptions = moduleOptions{
+	"kind":            optStr(),
+	"name":            optStr(),
+	"namespace":       optStr(),
+	"api_version":     optStr("api", "version").withDefault("v1"),
+	"label_selectors": optList("str"),
+	"wait":            optBool().withDefault(false),
+	"wait_sleep":      optInt().withDefault(5),
+	"wait_timeout":    optInt().withDefault(120),
+	"wait_condition":  optDict(),
+	"hidden_fields":   optList("str"),
+}
+
+var k8sModules = map[string]moduleOptions{
+	"k8s": moduleOptions{
+		"resource_definition": optRaw("definition", "inline"),
+		"src":                 optPath(),
+		"state":               optStr().withDefault("present").withChoices("absent", "present", "patched"),
+		"force":               optBool().withDefault(false),
+		"merge_type":          optList("str").withChoices("json", "merge", "strategic-merge"),
+		"validate":            optDict(),
+		"append_hash":         optBool().withDefault(false),
+		"apply":               optBool().withDefault(false),
+		"template":            optRaw(),
+		"continue_on_error":   optBool().withDefault(false),
+		"server_side_apply":   optDict(),
+		"generate_name":       optStr(),
+		"delete_options":      optDict(),
+	}.with(k8sResourceOptions, k8sCommonOptions),
+	"k8s_info": moduleOptions{
+		"field_selectors": optList("str").withDefault([]any{}),
+	}.with(k8sResourceOptions, k8sCommonOptions),
+	"k8s_scale": moduleOptions{
+		"resource_definition": optRaw("definition", "inline"),
+		"src":                 optPath(),
+		"replicas":            optInt(),
+		"current_replicas":    optInt(),
+		"resource_version":    optStr(),
+	}.with(k8sResourceOptions, k8sCommonOptions),
+	"k8s_exec": moduleOptions{
+		"namespace": optStr(),
+		"pod":       optStr(),
+		"container": optStr(),
+		"command":   optStr(),
+	}.with(k8sCommonOptions),
+	"helm": moduleOptions{
+		"chart_ref":         optPath(),
+		"chart_repo_url":    optStr(),
+		"chart_version":     optStr(),
+		"release_name":      optStr("name"),
+		"release_namespace": optStr("namespace"),
+		"release_state":     optStr("state").withDefault("present").withChoices("absent", "present"),
+		"release_values":    optRaw("values").withDefault(map[string]any{}),
+		"values_files":      optList("str").withDefault([]any{}),
+		"update_repo_cache": optBool().withDefault(false),
+		"set_values":        optList("dict"),
+		"binary_path":       optPath(),
+		"create_namespace":  optBool().withDefault(false),
+		"atomic":            optBool().withDefault(false),
+		"wait":              optBool().withDefault(false),
+		"wait_timeout":      optStr(),
+		"timeout":           optStr(),
+		"replace":           optBool().withDefault(false),
+		"skip_crds":         optBool().withDefault(false),
+		"history_max":       optInt(),
+		"force":             optBool().withDefault(false),
+		"purge":             optBool().withDefault(true),
+		"disable_hook":      optBool().withDefault(false),
+		"dependency_update": optBool("dep_up").withDefault(false),
+		"post_renderer":     optStr(),
+		"reuse_values":      optBool(),
+		"reset_values":      optBool().withDefault(true),
+		"context":           optStr("kube_context"),
+		"kubeconfig":        optRaw("kubeconfig_path"),
+		"host":              optStr("kube_apiserver"),
+		"api_key":           optStr("kube_token").secret(),
+		"validate_certs":    optBool("verify_ssl").withDefault(true),
+		"ca_cert":           optPath("ssl_ca_cert"),
+	},
+}
+
+// dockerCommonOptions are the connection options of the "community.docker" modules.
+var dockerCommonOptions = moduleOptions{
+	"docker_host":    optStr("docker_url").withDefault("unix:///var/run/docker.sock"),
+	"tls_hostname":   optStr(),
+	"api_version":    optStr("docker_api_version").withDefault("auto"),
+	"timeout":        optInt().withDefault(60),
+	"ca_path":        optPath("ca_cert", "tls_ca_cert", "cacert_path"),
+	"client_cert":    optPath("tls_client_cert", "cert_path"),
+	"client_key":     optPath("tls_client_key", "key_path"),
+	"tls":            optBool().withDefault(false),
+	"use_ssh_client": optBool().withDefault(false),
+	"validate_certs": optBool("tls_verify").withDefault(false),
+	"debug":          optBool().withDefault(false),
+}
+
+var dockerModules = map[string]moduleOptions{
+	"docker_container": moduleOptions{
+		"name":                       optStr(),
+		"image":                      optStr(),
+		"command":                    optRaw(),
+		"entrypoint":                 optList("str"),
+		"env":                        optDict(),
+		"env_file":                   optPath(),
+		"published_ports":            optList("str", "ports"),
+		"exposed_ports":              optList("str", "exposed", "expose"),
+		"volumes":                    optList("str"),
+		"mounts":                     optList("dict"),
+		"privileged":                 optBool(),
+		"user":                       optStr(),
+		"capabilities":               optList("str"),
+		"cap_drop":                   optList("str"),
+		"devices":                    optList("str"),
+		"network_mode":               optStr(),
+		"networks":                   optList("dict"),
+		"networks_cli_compatible":    optBool().withDefault(true),
+		"restart_policy":             optStr().withChoices("no", "on-failure", "always", "unless-stopped"),
+		"state":                      optStr().withDefault("started").withChoices("absent", "present", "healthy", "stopped", "started"),
+		"pull":                       optRaw(),
+		"read_only":                  optBool(),
+		"security_opts":              optList("str"),
+		"pid_mode":                   optStr(),
+		"ipc_mode":                   optStr(),
+		"userns_mode":                optStr(),
+		"uts":                        optStr(),
+		"log_driver":                 optStr(),
+		"log_options":                optDict("log_opt"),
+		"memory":                     optStr(),
+		"cpus":                       optFloat(),
+		"labels":                     optDict(),
+		"healthcheck":                optDict(),
+		"detach":                     optBool(),
+		"auto_remove":                optBool(),
+		"recreate":                   optBool().withDefault(false),
+		"restart":                    optBool().withDefault(false),
+		"keep_volumes":               optBool().withDefault(true),
+		"cleanup":                    optBool().withDefault(false),
+		"init":                       optBool(),
+		"hostname":                   optStr(),
+		"working_dir":                optStr(),
+		"ulimits":                    optList("str"),
+		"sysctls":                    optDict(),
+		"tmpfs":                      optList("str"),
+		"etc_hosts":                  optDict(),
+		"dns_servers":                optList("str"),
+		"container_default_behavior": optStr().withDefault("no_defaults").withChoices("compatibility", "no_defaults"),
+		"comparisons":                optDict(),
+		"force_kill":                 optBool("forcekill").withDefault(false),
+		"kill_signal":                optStr(),
+		"stop_signal":                optStr(),
+		"stop_timeout":               optInt(),
+		"output_logs":                optBool().withDefault(false),
+		"groups":                     optList("str"),
+		"links":                      optList("str"),
+		"volumes_from":               optList("str"),
+		"volume_driver":              optStr(),
+		"runtime":                    optStr(),
+		"platform":                   optStr(),
+		"interactive":                optBool(),
+		"tty":                        optBool(),
+		"paused":                     optBool(),
+		"shm_size":                   optStr(),
+		"storage_opts":               optDict(),
+	}.with(dockerCommonOptions),
+	"docker_image": moduleOptions{
+		"name":         optStr(),
+		"tag":          optStr().withDefault("latest"),
+		"source":       optStr().withChoices("build", "load", "pull", "local"),
+		"build":        optDict(),
+		"archive_path": optPath(),
+		"load_path":    optPath(),
+		"force_source": optBool().withDefault(false),
+		"force_absent": optBool().withDefault(false),
+		"force_tag":    optBool().withDefault(false),
+		"push":         optBool().withDefault(false),
+		"repository":   optStr(),
+		"pull":         optDict(),
+		"state":        statePresentAbsent(),
+	}.with(dockerCommonOptions),
+	"docker_network": moduleOptions{
+		"name":                optStr("network_name"),
+		"config_from":         optStr(),
+		"config_only":         optBool(),
+		"connected":           optList("str", "containers").withDefault([]any{}),
+		"driver":              optStr().withDefault("bridge"),
+		"driver_options":      optDict().withDefault(map[string]any{}),
+		"force":               optBool().withDefault(false),
+		"appends":             optBool("incremental").withDefault(false),
+		"state":               statePresentAbsent(),
+		"internal":            optBool(),
+		"labels":              optDict(),
+		"scope":               optStr().withChoices("local", "global", "swarm"),
+		"attachable":          optBool(),
+		"enable_ipv6":         optBool(),
+		"ipam_driver":         optStr(),
+		"ipam_driver_options": optDict(),
+		"ipam_config":         optList("dict"),
+	}.with(dockerCommonOptions),
+	"docker_compose_v2": moduleOptions{
+		"project_src":         optPath(),
+		"project_name":        optStr(),
+		"files":               optList("path"),
+		"env_files":           optList("path"),
+		"profiles":            optList("str"),
+		"definition":          optDict(),
+		"state":               optStr().withDefault("present").withChoices("absent", "stopped", "restarted", "present"),
+		"pull":                optStr().withDefault("policy").withChoices("always", "missing", "never", "policy"),
+		"build":               optStr().withDefault("policy").withChoices("always", "never", "policy"),
+		"recreate":            optStr().withDefault("auto").withChoices("always", "never", "auto"),
+		"remove_images":       optStr().withChoices("all", "local"),
+		"remove_volumes":      optBool().withDefault(false),
+		"remove_orphans":      optBool().withDefault(false),
+		"services":            optList("str"),
+		"scale":               optDict(),
+		"wait":                optBool().withDefault(false),
+		"wait_timeout":        optInt(),
+		"ignore_build_events": optBool().withDefault(true),
+		"cli_context":         optStr(),
+		"docker_cli":          optPath(),
+	}.with(dockerCommonOptions),
+	"docker_login": moduleOptions{
+		"registry_url": optStr("registry", "url").withDefault("https://index.docker.io/v1/"),
+		"username":     optStr(),
+		"password":     optStr().secret(),
+		"reauthorize":  optBool("reauth").withDefault(false),
+		"config_path":  optPath("dockercfg_path").withDefault("~/.docker/config.json"),
+		"state":        statePresentAbsent(),
+	}.with(dockerCommonOptions),
+	"docker_volume": moduleOptions{
+		"volume_name":    optStr("name"),
+		"driver":         optStr().withDefault("local"),
+		"driver_options": optDict().withDefault(map[string]any{}),
+		"labels":         optDict(),
+		"recreate":       optStr().withDefault("never").withChoices("always", "never", "options-changed"),
+		"state":          statePresentAbsent(),
+	}.with(dockerCommonOptions),
+	"docker_secret": moduleOptions{
+		"name":             optStr(),
+		"data":             optStr().secret(),
+		"data_is_b64":      optBool().withDefault(false),
+		"data_src":         optPath(),
+		"labels":           optDict(),
+		"force":            optBool().withDefault(false),
+		"rolling_versions": optBool().withDefault(false),
+		"versions_to_keep": optInt().withDefault(5),
+		"state":            statePresentAbsent(),
+	}.with(dockerCommonOptions),
+}
+
+// builtinModuleSpecs are the argument specs of the modules by their fully
+// qualified collection names.
+var builtinModuleSpecs = func() map[string]*ModuleSpec {
+	res := make(map[string]*ModuleSpec)
+	add := func(collection string, modules map[string]moduleOptions, common moduleOptions) {
+		for name, options := range modules {
+			res[collection+"."+name] = &ModuleSpec{Options: options.with(common)}
+		}
+	}
+	add("ansible.builtin", ansibleBuiltinModules, nil)
+	add("amazon.aws", awsModules, awsCommonOptions)
+	add("azure.azcollection", azureModules, azureCommonOptions)
+	add("google.cloud", gcpModules, gcpCommonOptions)
+	add("kubernetes.core", k8sModules, nil)
+	add("community.docker", dockerModules, nil)
+
+	// modules that are available under several names
+	res["ansible.builtin.systemd"] = res["ansible.builtin.systemd_service"]
+	res["azure.azcollection.azure_rm_networksecuritygroup"] = res["azure.azcollection.azure_rm_securitygroup"]
+	res["kubernetes.core.helm_release"] = res["kubernetes.core.helm"]
+	res["amazon.aws.aws_s3"] = res["amazon.aws.s3_object"]
+	res["amazon.aws.s3"] = res["amazon.aws.s3_object"]
+	res["amazon.aws.iam"] = res["amazon.aws.iam_user"]
+	return res
+}()
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgSpecNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		module   string
+		params   Module
+		expected Module
+		errs     []ArgumentError
+	}{
+		{
+			name:     "alias",
+			module:   "ansible.builtin.file",
+			params:   Module{"dest": "/tmp/app", "state": "directory", "recurse": "yes"},
+			expected: Module{"path": "/tmp/app", "state": "directory", "recurse": true},
+		},
+		{
+			name:     "list from string",
+			module:   "ansible.builtin.apt",
+			params:   Module{"pkg": "nginx,curl", "update_cache": "true"},
+			expected: Module{"name": []any{"nginx", "curl"}, "update_cache": true},
+		},
+		{
+			name:   "collection common options",
+			module: "amazon.aws.s3_bucket",
+			params: Module{"name": "logs", "aws_access_key": "key", "versioning": "no"},
+			expected: Module{
+				"name": "logs", "access_key": "key", "versioning": false,
+				"state": "present", "validate_certs": true,
+			},
+		},
+		{
+			name:     "int from string",
+			module:   "ansible.builtin.wait_for",
+			params:   Module{"port": "8080"},
+			expected: Module{"port": 8080},
+		},
+		{
+			name:     "dict from string",
+			module:   "ansible.builtin.get_url",
+			params:   Module{"url": "https://example.com", "headers": "Accept=json,X-Token=abc"},
+			expected: Module{"url": "https://example.com", "headers": map[string]any{"Accept": "json", "X-Token": "abc"}},
+		},
+		{
+			name:     "unknown value",
+			module:   "ansible.builtin.file",
+			params:   Module{"path": "/tmp/app", "mode": "0644", "owner": Unknown{}},
+			expected: Module{"path": "/tmp/app", "mode": "0644", "owner": Unknown{}},
+		},
+		{
+			name:     "unsupported option",
+			module:   "ansible.builtin.file",
+			params:   Module{"path": "/tmp/app", "size": 10},
+			expected: Module{"path": "/tmp/app"},
+			errs:     []ArgumentError{{Kind: ArgumentUnknown, Option: "size", Reason: "unsupported parameter"}},
+		},
+		{
+			name:     "invalid choice",
+			module:   "ansible.builtin.file",
+			params:   Module{"path": "/tmp/app", "state": "folder"},
+			expected: Module{"path": "/tmp/app"},
+			errs: []ArgumentError{{
+				Kind:   ArgumentInvalid,
+				Option: "state",
+				Reason: `value "folder" must be one of: absent, directory, file, hard, link, touch`,
+			}},
+		},
+		{
+			name:     "invalid type",
+			module:   "ansible.builtin.file",
+			params:   Module{"path": "/tmp/app", "recurse": "sometimes"},
+			expected: Module{"path": "/tmp/app"},
+			errs: []ArgumentError{{
+				Kind:   ArgumentInvalid,
+				Option: "recurse",
+				Reason: "sometimes (string) cannot be converted to bool",
+			}},
+		},
+		{
+			name:     "alias conflict",
+			module:   "ansible.builtin.file",
+			params:   Module{"dest": "/tmp/a", "path": "/tmp/b"},
+			expected: Module{"path": "/tmp/a"},
+			errs: []ArgumentError{{
+				Kind:   ArgumentConflict,
+				Option: "path",
+				Reason: `option "path" is already set by "dest"`,
+			}},
+		},
+	}
+
+	registry := NewArgSpecRegistry()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, ok := registry.Lookup(tt.module)
+			require.True(t, ok)
+
+			res, errs := spec.Normalize(tt.params)
+			assert.Equal(t, tt.errs, errs)
+
+			// compare only the options set in the task and the checked defaults
+			for name, val := range tt.expected {
+				assert.Equal(t, val, res[name], name)
+			}
+			for name := range tt.params {
+				if _, expected := tt.expected[name]; !expected {
+					assert.NotContains(t, res, name)
+				}
+			}
+		})
+	}
+}
+
+func TestArgSpecRegistryLookup(t *testing.T) {
+	registry := NewArgSpecRegistry()
+
+	_, ok := registry.Lookup("ansible.legacy.ec2_instance")
+	assert.True(t, ok)
+
+	_, ok = registry.Lookup("ansible.legacy.unknown_module")
+	assert.False(t, ok)
+
+	registry.Add("mycorp.app.deploy", ModuleSpec{
+		Options: map[string]OptionSpec{
+			"version": {Type: "str", Aliases: []string{"ver"}},
+			"restart": {Type: "bool", Default: false},
+		},
+	})
+	res, errs, ok := registry.Normalize("mycorp.app.deploy", Module{"ver": 1.5})
+	require.True(t, ok)
+	assert.Empty(t, errs)
+	assert.Equal(t, Module{"version": "1.5", "restart": false}, res)
+
+	_, ok = defaultArgSpecs.Lookup("mycorp.app.deploy")
+	assert.False(t, ok)
+}
+
+func TestTaskNormalizedParams(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  tasks:
+    - name: Create bucket
+      amazon.aws.s3_bucket:
+        name: logs
+        aws_region: "{{ region }}"
+        encryption: AES256
+    - name: Install packages
+      apt: pkg=nginx state=latest install-recommends=no
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 2)
+
+	action, ok := tasks[0].Action()
+	require.True(t, ok)
+	params, errs, ok := action.NormalizedParams()
+	require.True(t, ok)
+	assert.Empty(t, errs)
+	assert.Equal(t, "logs", params["name"])
+	assert.Equal(t, "AES256", params["encryption"])
+	assert.IsType(t, Unknown{}, params["region"])
+
+	action, ok = tasks[1].Action()
+	require.True(t, ok)
+	params, errs, ok = action.NormalizedParams()
+	require.True(t, ok)
+	assert.Empty(t, errs)
+	assert.Equal(t, []any{"nginx"}, params["name"])
+	assert.Equal(t, "latest", params["state"])
+	assert.Equal(t, false, params["install_recommends"])
+}
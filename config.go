@@ -14,11 +14,34 @@ const (
 )
 
 type AnsibleConfig struct {
-	Inventory []string
-	RolesPath []string
+	Inventory    []string
+	RolesPath    []string
+	Jinja2Native bool
 }
 
 func readAnsibleConfig(fsys fs.FS, projectPath string) (AnsibleConfig, error) {
+	ansibleCfg, err := readAnsibleConfigFile(fsys, projectPath)
+	if err != nil {
+		return ansibleCfg, err
+	}
+
+	// the environment variable takes precedence over the configuration file,
+	// and the legacy one is used only if the configuration file does not set
+	// the roles path
+	if rolesPath := os.Getenv(rolesPathEnv); rolesPath != "" {
+		ansibleCfg.RolesPath = resolveConfigPaths(filepath.SplitList(rolesPath), "")
+	}
+	if rolesPath := os.Getenv(legacyRolesPathEnv); rolesPath != "" && len(ansibleCfg.RolesPath) == 0 {
+		ansibleCfg.RolesPath = resolveConfigPaths(filepath.SplitList(rolesPath), "")
+	}
+	if len(ansibleCfg.RolesPath) == 0 {
+		ansibleCfg.RolesPath = resolveConfigPaths(defaultRolesPath, "")
+	}
+
+	return ansibleCfg, nil
+}
+
+func readAnsibleConfigFile(fsys fs.FS, projectPath string) (AnsibleConfig, error) {
 	ansibleCfg := AnsibleConfig{}
 
 	cfgpath := resolveAnsibleConfigPath(fsys, projectPath)
@@ -41,7 +64,11 @@ func readAnsibleConfig(fsys fs.FS, projectPath string) (AnsibleConfig, error) {
 		return ansibleCfg, err
 	}
 
-	ansibleCfg.RolesPath = cfg.Section("defaults").Key("roles_path").Strings(":")
+	// the relative paths are relative to the configuration file
+	ansibleCfg.RolesPath = resolveConfigPaths(
+		cfg.Section("defaults").Key("roles_path").Strings(":"), filepath.Dir(cfgpath))
+	ansibleCfg.Inventory = cfg.Section("defaults").Key("inventory").Strings(",")
+	ansibleCfg.Jinja2Native = cfg.Section("defaults").Key("jinja2_native").MustBool(false)
 
 	return ansibleCfg, nil
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordHash(t *testing.T) {
+	// the test vectors from https://www.akkadia.org/drepper/SHA-crypt.txt
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "sha512",
+			template: "{{ 'Hello world!' | password_hash('sha512', 'saltstring') }}",
+			expected: "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1",
+		},
+		{
+			name:     "sha512 rounds",
+			template: "{{ 'Hello world!' | password_hash('sha512_crypt', 'saltstringsaltstring', rounds=10000) }}",
+			expected: "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		},
+		{
+			name:     "sha256",
+			template: "{{ 'Hello world!' | password_hash('sha256', 'saltstring') }}",
+			expected: "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+		},
+		{
+			name:     "sha256 rounds",
+			template: "{{ 'Hello world!' | password_hash('sha256', 'saltstringsaltstring', rounds=10000) }}",
+			expected: "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA",
+		},
+	}
+
+	templater := &JinjaTemplater{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := templater.Evaluate(tt.template, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+
+	t.Run("derived salt", func(t *testing.T) {
+		first, err := templater.Evaluate("{{ 'secret' | password_hash }}", nil)
+		require.NoError(t, err)
+		assert.Regexp(t, `^\$6\$[./0-9A-Za-z]{16}\$[./0-9A-Za-z]{86}$`, first)
+
+		second, err := templater.Evaluate("{{ 'secret' | password_hash }}", nil)
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+
+		other, err := templater.Evaluate("{{ 'other' | password_hash }}", nil)
+		require.NoError(t, err)
+		assert.NotEqual(t, first[3:19], other[3:19])
+	})
+
+	t.Run("unsupported hash type", func(t *testing.T) {
+		_, err := templater.Evaluate("{{ 'secret' | password_hash('bcrypt') }}", nil)
+		require.Error(t, err)
+	})
+}
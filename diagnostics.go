@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// defaultMaxIncludeDepth is the maximum number of nested playbooks, task
+// files and roles, which protects against pathological but acyclic inputs.
+const defaultMaxIncludeDepth = 64
+
+// DiagnosticKind is the kind of a problem found while compiling the project.
+type DiagnosticKind string
+
+const (
+	// DiagnosticIncludeCycle is reported for the playbooks, task files and
+	// roles that include themselves, directly or through other files or roles.
+	DiagnosticIncludeCycle DiagnosticKind = "include-cycle"
+	// DiagnosticIncludeDepth is reported when the maximum include depth is exceeded.
+	DiagnosticIncludeDepth DiagnosticKind = "include-depth"
+	// DiagnosticIncludeError is reported for the includes that cannot be
+	// loaded, e.g. task files that are not valid YAML or invalid parameters
+	// of the include modules.
+	DiagnosticIncludeError DiagnosticKind = "include-error"
+	// DiagnosticFileNotFound is reported for the included task files and the
+	// vars files that are not found in any of the search paths.
+	DiagnosticFileNotFound DiagnosticKind = "file-not-found"
+	// DiagnosticRoleNotFound is reported for the roles that are not found in
+	// any of the role search paths.
+	DiagnosticRoleNotFound DiagnosticKind = "role-not-found"
+	// DiagnosticUnsupportedPlatform is reported for the roles applied to hosts
+	// with an operating system not listed in the platforms of "galaxy_info".
+	DiagnosticUnsupportedPlatform DiagnosticKind = "unsupported-platform"
+	// DiagnosticMissingPlugin is reported for the filter, test and lookup
+	// plugins used by the tasks and templates that are neither built-in nor
+	// registered, whose values are unknown.
+	DiagnosticMissingPlugin DiagnosticKind = "missing-plugin"
+)
+
+// Diagnostic is a problem found while compiling the project. The affected
+// includes are skipped, and the other tasks are still compiled.
+type Diagnostic struct {
+	Kind    DiagnosticKind
+	Message string
+	// Chain contains the playbooks, task files and roles from the outermost
+	// to the one that cannot be included, e.g.
+	// ["site.yml", "role app", "roles/app/tasks/main.yml", "role app"].
+	Chain []string
+	// Searched contains the paths searched for the missing file or role.
+	Searched []string
+}
+
+func (d Diagnostic) String() string {
+	res := fmt.Sprintf("%s: %s", d.Message, strings.Join(d.Chain, " -> "))
+	if len(d.Searched) > 0 {
+		res += fmt.Sprintf(" (searched: %s)", strings.Join(d.Searched, ", "))
+	}
+	return res
+}
+
+// Diagnostics returns the problems found while compiling the tasks of the project.
+func (p *AnsibleProject) Diagnostics() []Diagnostic {
+	if p.dataloader == nil {
+		return nil
+	}
+	return p.dataloader.diagnostics
+}
+
+// report records the diagnostic once, since the tasks can be compiled many times.
+func (l *DataLoader) report(d Diagnostic) {
+	for _, existing := range l.diagnostics {
+		if existing.Kind == d.Kind && existing.Message == d.Message && slices.Equal(existing.Chain, d.Chain) &&
+			slices.Equal(existing.Searched, d.Searched) {
+			return
+		}
+	}
+	log.Print(d.String())
+	l.diagnostics = append(l.diagnostics, d)
+}
+
+// canInclude reports whether the playbook, task file or role can be included
+// from the include stack. Cycles and too deep includes are reported.
+func (l *DataLoader) canInclude(stack []string, target string) bool {
+	if l == nil {
+		return true
+	}
+	chain := append(slices.Clone(stack), target)
+	if slices.Contains(stack, target) {
+		l.report(Diagnostic{
+			Kind:    DiagnosticIncludeCycle,
+			Message: fmt.Sprintf("Include cycle detected for %q", target),
+			Chain:   chain,
+		})
+		return false
+	}
+	maxDepth := l.maxIncludeDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxIncludeDepth
+	}
+	if len(stack) >= maxDepth {
+		l.report(Diagnostic{
+			Kind:    DiagnosticIncludeDepth,
+			Message: fmt.Sprintf("Maximum include depth %d exceeded by %q", maxDepth, target),
+			Chain:   chain,
+		})
+		return false
+	}
+	return true
+}
+
+// reportIncludeError reports the include that cannot be loaded. The include
+// is skipped, and the other tasks are still compiled.
+func (l *DataLoader) reportIncludeError(stack []string, err error) {
+	if l == nil {
+		log.Printf("Failed to include: %s", err)
+		return
+	}
+	l.report(Diagnostic{
+		Kind:    DiagnosticIncludeError,
+		Message: fmt.Sprintf("Failed to include: %s", err),
+		Chain:   slices.Clone(stack),
+	})
+}
+
+// reportMissingFile reports the file that is not found in the search paths
+// and returns true, so that the file is skipped. It returns false for the
+// other errors.
+func (l *DataLoader) reportMissingFile(stack []string, err error) bool {
+	var notFound *FileNotFoundError
+	if l == nil || !errors.As(err, &notFound) {
+		return false
+	}
+	l.report(Diagnostic{
+		Kind:     DiagnosticFileNotFound,
+		Message:  fmt.Sprintf("File %q not found", notFound.Name),
+		Chain:    append(slices.Clone(stack), notFound.Name),
+		Searched: notFound.Searched,
+	})
+	return true
+}
+
+// reportMissingRole reports the role that is not found in the role search
+// paths and returns true, so that the role is skipped. It returns false for
+// the other errors.
+func (l *DataLoader) reportMissingRole(stack []string, err error) bool {
+	var notFound *RoleNotFoundError
+	if !errors.As(err, &notFound) {
+		return false
+	}
+	l.report(Diagnostic{
+		Kind:     DiagnosticRoleNotFound,
+		Message:  fmt.Sprintf("Role %q not found", notFound.Name),
+		Chain:    append(slices.Clone(stack), roleFrame(roleBaseName(notFound.Name))),
+		Searched: notFound.Searched,
+	})
+	return true
+}
+
+// reportMissingPlugin reports the plugin that the unknown value is produced
+// by, if the plugin is not available. The user is the task or the template
+// that uses the plugin.
+func (l *DataLoader) reportMissingPlugin(stack []string, user string, u Unknown) {
+	if l == nil || u.MissingPlugin == "" {
+		return
+	}
+	l.report(Diagnostic{
+		Kind:    DiagnosticMissingPlugin,
+		Message: fmt.Sprintf("Plugin %q used by %s is not available", u.MissingPlugin, user),
+		Chain:   slices.Clone(stack),
+	})
+}
+
+func roleFrame(name string) string {
+	return "role " + name
+}
+
+// includeStack returns the playbooks, task files and roles the task is
+// included from, from the outermost to the file of the task.
+func (t *Task) includeStack() []string {
+	var res []string
+	if parent := t.scopeParent(); parent != nil {
+		res = parent.includeStack()
+	} else if play := t.Play(); play != nil {
+		res = play.includeStack()
+	}
+	if t.role != nil && (t.parent == nil || t.parent.role != t.role) {
+		res = append(res, t.role.includeStack()...)
+	}
+	// the tasks of a block share the file with the block
+	if t.metadata.path != "" && (len(res) == 0 || res[len(res)-1] != t.metadata.path) {
+		res = append(res, t.metadata.path)
+	}
+	return res
+}
+
+// includeStack returns the roles that depend on the role, followed by the role.
+func (r *Role) includeStack() []string {
+	var res []string
+	if r.parent != nil {
+		res = r.parent.includeStack()
+	}
+	return append(res, roleFrame(r.name))
+}
+
+// includeStack returns the playbooks that import the playbook of the play,
+// followed by the playbook of the play.
+func (p *Play) includeStack() []string {
+	var res []string
+	if p.parent != nil {
+		res = p.parent.includeStack()
+	}
+	return append(res, p.GetPath())
+}
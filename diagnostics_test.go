@@ -0,0 +1,244 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncludeCycles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site.yaml": {
+			Data: []byte(`---
+- import_playbook: site.yaml
+- hosts: all
+  roles:
+    - app
+  tasks:
+    - name: Include self
+      include_tasks: loop.yaml
+    - name: Include first
+      import_tasks: first.yaml
+`),
+		},
+		"loop.yaml": {
+			Data: []byte(`---
+- name: Recurse
+  include_tasks: loop.yaml
+`),
+		},
+		"first.yaml": {
+			Data: []byte(`---
+- name: Include second
+  import_tasks: second.yaml
+`),
+		},
+		"second.yaml": {
+			Data: []byte(`---
+- name: Second
+  debug:
+    msg: second
+- name: Include first again
+  import_tasks: first.yaml
+`),
+		},
+		"roles/app/meta/main.yaml": {
+			Data: []byte(`---
+dependencies:
+  - role: db
+`),
+		},
+		"roles/app/tasks/main.yaml": {
+			Data: []byte(`---
+- name: App
+  debug:
+    msg: app
+`),
+		},
+		"roles/db/meta/main.yaml": {
+			Data: []byte(`---
+dependencies:
+  - role: app
+`),
+		},
+		"roles/db/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Db
+  include_role:
+    name: app
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "site.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	assert.Equal(t, []string{"App", "Second"}, lo.Map(tasks, func(task *Task, _ int) string {
+		return task.Name()
+	}))
+	// the diagnostics are reported once
+	project.ListTasks()
+
+	diagnostics := project.Diagnostics()
+	require.Len(t, diagnostics, 5)
+	for _, d := range diagnostics {
+		assert.Equal(t, DiagnosticIncludeCycle, d.Kind)
+	}
+	chains := lo.Map(diagnostics, func(d Diagnostic, _ int) []string { return d.Chain })
+	assert.Equal(t, [][]string{
+		{"site.yaml", "site.yaml"},
+		{"site.yaml", "role app", "role db", "role app"},
+		{"site.yaml", "role app", "role db", "roles/db/tasks/main.yaml", "role app"},
+		{"site.yaml", "loop.yaml", "loop.yaml"},
+		{"site.yaml", "first.yaml", "second.yaml", "first.yaml"},
+	}, chains)
+}
+
+func TestMaxIncludeDepth(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  tasks:
+    - import_tasks: a.yaml
+`),
+		},
+		"a.yaml": {Data: []byte(`[{import_tasks: b.yaml}, {name: A, debug: {msg: a}}]`)},
+		"b.yaml": {Data: []byte(`[{import_tasks: c.yaml}, {name: B, debug: {msg: b}}]`)},
+		"c.yaml": {Data: []byte(`[{name: C, debug: {msg: c}}]`)},
+	}
+
+	project, err := NewParser(fsys, WithMaxIncludeDepth(3)).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	assert.Equal(t, []string{"B", "A"}, lo.Map(tasks, func(task *Task, _ int) string {
+		return task.Name()
+	}))
+
+	diagnostics := project.Diagnostics()
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, DiagnosticIncludeDepth, diagnostics[0].Kind)
+	assert.Equal(t, []string{"playbook.yaml", "a.yaml", "b.yaml", "c.yaml"}, diagnostics[0].Chain)
+}
+
+func TestIncludeErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site.yaml": {
+			Data: []byte(`---
+- import_playbook: missing.yaml
+- hosts: all
+  vars:
+    files: [a.yaml, b.yaml]
+  roles:
+    - app
+  tasks:
+    - name: Include broken file
+      include_tasks: broken.yaml
+    - name: Include list
+      include_tasks: "{{ files }}"
+    - name: Include broken role
+      include_role:
+        name: broken
+    - name: Include role with invalid parameters
+      include_role:
+        name: app
+        public: maybe
+    - name: Include public role
+      include_role:
+        name: db
+        public: "true"
+    - name: Last
+      debug:
+        msg: last
+`),
+		},
+		"broken.yaml":                  {Data: []byte(`- name: [`)},
+		"roles/broken/tasks/main.yaml": {Data: []byte(`{name: not a list}`)},
+		"roles/app/meta/main.yaml": {
+			Data: []byte(`---
+dependencies:
+  - role: db
+  - role: faulty
+`),
+		},
+		"roles/app/tasks/main.yaml":    {Data: []byte(`[{name: App, debug: {msg: app}}]`)},
+		"roles/db/meta/main.yaml":      {Data: []byte(`dependencies: {role: app}`)},
+		"roles/db/tasks/main.yaml":     {Data: []byte(`[{name: Db, debug: {msg: db}}]`)},
+		"roles/faulty/tasks/main.yaml": {Data: []byte(`: [`)},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "site.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	assert.Equal(t, []string{"Db", "App", "Db", "Last"}, lo.Map(tasks, func(task *Task, _ int) string {
+		return task.Name()
+	}))
+
+	diagnostics := project.Diagnostics()
+	for _, d := range diagnostics {
+		assert.Equal(t, DiagnosticIncludeError, d.Kind, d.String())
+	}
+	chains := lo.Map(diagnostics, func(d Diagnostic, _ int) []string { return d.Chain })
+	assert.Equal(t, [][]string{
+		{"site.yaml"},
+		{"site.yaml", "role app"},
+		{"site.yaml", "role app", "role db"},
+		{"site.yaml"},
+		{"site.yaml"},
+		{"site.yaml"},
+		{"site.yaml"},
+		{"site.yaml", "role db"},
+	}, chains)
+}
+
+func TestMissingPluginDiagnostics(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site.yaml": {
+			Data: []byte(`---
+- hosts: all
+  roles:
+    - app
+`),
+		},
+		"roles/app/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Configure
+  template:
+    src: app.conf.j2
+    dest: "{{ app_dir | to_app_path }}"
+`),
+		},
+		"roles/app/templates/app.conf.j2": {Data: []byte(`{{ lookup('vault_secret', 'db') }}`)},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "site.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 1)
+	// the diagnostics are reported once, however many times the task is rendered
+	for i := 0; i < 2; i++ {
+		_, isTemplate, err := tasks[0].RenderTemplate()
+		require.NoError(t, err)
+		require.True(t, isTemplate)
+	}
+
+	assert.Equal(t, []Diagnostic{
+		{
+			Kind:    DiagnosticMissingPlugin,
+			Message: `Plugin "to_app_path" used by task "Configure" is not available`,
+			Chain:   []string{"site.yaml", "role app", "roles/app/tasks/main.yaml"},
+		},
+		{
+			Kind:    DiagnosticMissingPlugin,
+			Message: `Plugin "vault_secret" used by template "roles/app/templates/app.conf.j2" is not available`,
+			Chain:   []string{"site.yaml", "role app", "roles/app/tasks/main.yaml", "roles/app/templates/app.conf.j2"},
+		},
+	}, project.Diagnostics())
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const factPrefix = "ansible_"
+
+// FactProfile contains the facts of a host as returned by the "setup" module,
+// without the "ansible_" prefix. This is the value of the "ansible_facts" variable.
+type FactProfile map[string]any
+
+// Vars returns the variables provided by the facts: "ansible_facts" and
+// the legacy top-level "ansible_*" variables.
+func (p FactProfile) Vars() Variables {
+	if p == nil {
+		return nil
+	}
+	res := make(Variables, len(p)+1)
+	for k, v := range p {
+		res[factPrefix+k] = v
+	}
+	res["ansible_facts"] = map[string]any(p.Clone())
+	return res
+}
+
+// Clone returns a deep copy of the profile.
+func (p FactProfile) Clone() FactProfile {
+	if p == nil {
+		return nil
+	}
+	res := make(FactProfile, len(p))
+	for k, v := range p {
+		res[k] = cloneValue(v)
+	}
+	return res
+}
+
+func cloneValue(val any) any {
+	switch v := val.(type) {
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for k, vv := range v {
+			res[k] = cloneValue(vv)
+		}
+		return res
+	case []any:
+		res := make([]any, len(v))
+		for i, vv := range v {
+			res[i] = cloneValue(vv)
+		}
+		return res
+	}
+	return val
+}
+
+// Merge returns a new profile with the facts of the other profile added
+// to the facts of this profile.
+func (p FactProfile) Merge(other FactProfile) FactProfile {
+	res := p.Clone()
+	if res == nil {
+		res = make(FactProfile, len(other))
+	}
+	maps.Copy(res, other)
+	return res
+}
+
+// ParseFactProfile parses the output of the "setup" module. The JSON can be
+// the module result ({"ansible_facts": {...}}), the ad-hoc command output
+// ("host | SUCCESS => {...}") or the content of a JSON fact cache file.
+func ParseFactProfile(r io.Reader) (FactProfile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// ad-hoc output, e.g. "localhost | SUCCESS => {"
+	if idx := bytes.Index(data, []byte("=>")); idx != -1 && bytes.IndexByte(data, '{') > idx {
+		data = data[idx+2:]
+	}
+
+	// the integral numbers are kept as integers, e.g. "processor_vcpus"
+	var raw map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to decode facts: %w", err)
+	}
+	fromJSONNumbers(raw)
+
+	if facts, ok := raw["ansible_facts"].(map[string]any); ok {
+		raw = facts
+	}
+
+	profile := make(FactProfile, len(raw))
+	for k, v := range raw {
+		profile[strings.TrimPrefix(k, factPrefix)] = v
+	}
+	return profile, nil
+}
+
+// FactProfilePreset returns a copy of the bundled fact profile with the given name,
+// e.g. "Ubuntu 22.04" or "RHEL 9". The name is case-insensitive.
+func FactProfilePreset(name string) (FactProfile, bool) {
+	profile, exists := factProfilePresets[normalizePresetName(name)]
+	if !exists {
+		return nil, false
+	}
+	return profile.Clone(), true
+}
+
+// FactProfilePresets returns the names of the bundled fact profiles,
+// including the aliases, e.g. "RedHat 9" and "RHEL 9".
+func FactProfilePresets() []string {
+	return slices.Clone(factProfilePresetNames)
+}
+
+func normalizePresetName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer("-", " ", "_", " ").Replace(name)
+}
+
+var factProfilePresets, factProfilePresetNames = func() (map[string]FactProfile, []string) {
+	profiles := []FactProfile{
+		linuxFacts("Ubuntu", "20.04", "focal", "Debian", "apt", "5.4.0-150-generic", "3.8.10"),
+		linuxFacts("Ubuntu", "22.04", "jammy", "Debian", "apt", "5.15.0-89-generic", "3.10.12"),
+		linuxFacts("Ubuntu", "24.04", "noble", "Debian", "apt", "6.8.0-31-generic", "3.12.3"),
+		linuxFacts("Debian", "11", "bullseye", "Debian", "apt", "5.10.0-26-amd64", "3.9.2"),
+		linuxFacts("Debian", "12", "bookworm", "Debian", "apt", "6.1.0-13-amd64", "3.11.2"),
+		linuxFacts("RedHat", "8", "Ootpa", "RedHat", "dnf", "4.18.0-513.5.1.el8_9.x86_64", "3.6.8"),
+		linuxFacts("RedHat", "9", "Plow", "RedHat", "dnf", "5.14.0-362.8.1.el9_3.x86_64", "3.9.18"),
+		linuxFacts("CentOS", "7", "Core", "RedHat", "yum", "3.10.0-1160.el7.x86_64", "2.7.5"),
+		linuxFacts("Rocky", "9", "Blue Onyx", "RedHat", "dnf", "5.14.0-284.11.1.el9_2.x86_64", "3.9.16"),
+		linuxFacts("Amazon", "2", "", "RedHat", "yum", "5.10.199-190.747.amzn2.x86_64", "2.7.18"),
+		linuxFacts("Amazon", "2023", "", "RedHat", "dnf", "6.1.61-85.141.amzn2023.x86_64", "3.9.16"),
+		linuxFacts("Alpine", "3.18", "", "Alpine", "apk", "6.1.62-0-lts", "3.11.6"),
+	}
+
+	aliases := map[string]string{
+		"RedHat 8":    "RHEL 8",
+		"RedHat 9":    "RHEL 9",
+		"Amazon 2":    "Amazon Linux 2",
+		"Amazon 2023": "Amazon Linux 2023",
+	}
+
+	res := make(map[string]FactProfile)
+	var names []string
+	for _, profile := range profiles {
+		name := profile["distribution"].(string) + " " + profile["distribution_version"].(string)
+		res[normalizePresetName(name)] = profile
+		names = append(names, name)
+		if alias, exists := aliases[name]; exists {
+			res[normalizePresetName(alias)] = profile
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+	return res, slices.Compact(names)
+}()
+
+func linuxFacts(distribution, version, release, osFamily, pkgMgr, kernel, pythonVersion string) FactProfile {
+	majorVersion, _, _ := strings.Cut(version, ".")
+	pythonParts := strings.Split(pythonVersion, ".")
+
+	serviceMgr := "systemd"
+	if osFamily == "Alpine" {
+		serviceMgr = "openrc"
+	}
+
+	selinux := map[string]any{
+		"status": "disabled",
+	}
+	if osFamily == "RedHat" {
+		selinux = map[string]any{
+			"status":      "enabled",
+			"mode":        "enforcing",
+			"config_mode": "enforcing",
+			"type":        "targeted",
+		}
+	}
+
+	return FactProfile{
+		"system":                     "Linux",
+		"kernel":                     kernel,
+		"architecture":               "x86_64",
+		"machine":                    "x86_64",
+		"os_family":                  osFamily,
+		"distribution":               distribution,
+		"distribution_version":       version,
+		"distribution_major_version": majorVersion,
+		"distribution_release":       release,
+		"pkg_mgr":                    pkgMgr,
+		"service_mgr":                serviceMgr,
+		"hostname":                   "localhost",
+		"fqdn":                       "localhost.localdomain",
+		"domain":                     "localdomain",
+		"nodename":                   "localhost",
+		"user_id":                    "root",
+		"virtualization_type":        "kvm",
+		"virtualization_role":        "guest",
+		"processor_vcpus":            2,
+		"memtotal_mb":                3933,
+		"python": map[string]any{
+			"executable": "/usr/bin/python" + pythonParts[0],
+			"version": map[string]any{
+				"major":  atoiOrZero(pythonParts[0]),
+				"minor":  atoiOrZero(pythonParts[1]),
+				"micro":  atoiOrZero(pythonParts[2]),
+				"string": pythonVersion,
+			},
+		},
+		"python_version": pythonVersion,
+		"interfaces":     []any{"lo", "eth0"},
+		"default_ipv4": map[string]any{
+			"address":    "10.0.0.10",
+			"alias":      "eth0",
+			"broadcast":  "10.0.0.255",
+			"gateway":    "10.0.0.1",
+			"interface":  "eth0",
+			"macaddress": "02:42:0a:00:00:0a",
+			"mtu":        1500,
+			"netmask":    "255.255.255.0",
+			"network":    "10.0.0.0",
+			"prefix":     "24",
+			"type":       "ether",
+		},
+		"default_ipv6":       map[string]any{},
+		"all_ipv4_addresses": []any{"10.0.0.10"},
+		"all_ipv6_addresses": []any{},
+		"selinux":            selinux,
+		"env": map[string]any{
+			"HOME":  "/root",
+			"LANG":  "C.UTF-8",
+			"PATH":  "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+			"SHELL": "/bin/bash",
+			"USER":  "root",
+		},
+	}
+}
+
+func atoiOrZero(s string) int {
+	res, _ := strconv.Atoi(s)
+	return res
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFactProfile(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{
+			name: "module result",
+			source: `{
+  "ansible_facts": {
+    "ansible_os_family": "Debian",
+    "ansible_distribution_major_version": "22",
+    "ansible_default_ipv4": {"address": "192.168.1.10"}
+  },
+  "changed": false
+}`,
+		},
+		{
+			name: "ad-hoc output",
+			source: `web1 | SUCCESS => {
+    "ansible_facts": {
+        "ansible_os_family": "Debian",
+        "ansible_distribution_major_version": "22",
+        "ansible_default_ipv4": {"address": "192.168.1.10"}
+    },
+    "changed": false
+}`,
+		},
+		{
+			name: "fact cache",
+			source: `{
+  "ansible_os_family": "Debian",
+  "ansible_distribution_major_version": "22",
+  "ansible_default_ipv4": {"address": "192.168.1.10"}
+}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := ParseFactProfile(strings.NewReader(tt.source))
+			require.NoError(t, err)
+
+			assert.Equal(t, FactProfile{
+				"os_family":                  "Debian",
+				"distribution_major_version": "22",
+				"default_ipv4": map[string]any{
+					"address": "192.168.1.10",
+				},
+			}, profile)
+		})
+	}
+}
+
+func TestFactProfilePreset(t *testing.T) {
+	profile, exists := FactProfilePreset("RHEL 9")
+	require.True(t, exists)
+	assert.Equal(t, "RedHat", profile["os_family"])
+	assert.Equal(t, "9", profile["distribution_major_version"])
+
+	profile, exists = FactProfilePreset("ubuntu-22.04")
+	require.True(t, exists)
+	assert.Equal(t, "Debian", profile["os_family"])
+	assert.Equal(t, "jammy", profile["distribution_release"])
+
+	_, exists = FactProfilePreset("Plan 9")
+	assert.False(t, exists)
+
+	names := FactProfilePresets()
+	assert.Equal(t, lo.Uniq(names), names)
+	for _, name := range []string{
+		"Ubuntu 20.04", "Ubuntu 22.04", "Ubuntu 24.04", "Debian 11", "Debian 12",
+		"RHEL 8", "RHEL 9", "RedHat 9", "CentOS 7", "Rocky 9",
+		"Amazon Linux 2", "Amazon Linux 2023", "Alpine 3.18",
+	} {
+		assert.Contains(t, names, name)
+		_, exists := FactProfilePreset(name)
+		assert.True(t, exists, name)
+	}
+}
+
+func TestParseSetupFacts(t *testing.T) {
+	profile, err := ParseFactProfile(strings.NewReader(`web1 | SUCCESS => {
+    "ansible_facts": {
+        "ansible_distribution": "Ubuntu",
+        "ansible_distribution_version": "22.04",
+        "ansible_processor_vcpus": 4,
+        "ansible_memtotal_mb": 7951,
+        "ansible_uptime_seconds": 12.5,
+        "ansible_python": {"version": {"major": 3, "minor": 10}},
+        "ansible_mounts": [{"mount": "/", "size_total": 10213466112}]
+    },
+    "changed": false
+}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, profile["processor_vcpus"])
+	assert.Equal(t, 12.5, profile["uptime_seconds"])
+	assert.Equal(t, 3, profile["python"].(map[string]any)["version"].(map[string]any)["major"])
+	assert.Equal(t, 10213466112, profile["mounts"].([]any)[0].(map[string]any)["size_total"])
+
+	templater := NewTemplater(nil, nil, WithNativeTemplates(true))
+	vars := profile.Vars()
+	res, err := templater.EvaluateValue("{{ ansible_processor_vcpus + 1 }}", vars)
+	require.NoError(t, err)
+	assert.Equal(t, 5, res)
+	res, err = templater.EvaluateValue("{{ ansible_processor_vcpus is integer }}", vars)
+	require.NoError(t, err)
+	assert.Equal(t, true, res)
+}
+
+func TestFactProfileVars(t *testing.T) {
+	profile := FactProfile{
+		"os_family": "RedHat",
+	}
+
+	assert.Equal(t, Variables{
+		"ansible_os_family": "RedHat",
+		"ansible_facts": map[string]any{
+			"os_family": "RedHat",
+		},
+	}, profile.Vars())
+}
@@ -0,0 +1,1369 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// filterFunc is the implementation of a Jinja2 filter. The value is the
+// left side of the filter expression.
+type filterFunc func(c *evalContext, val any, args []any, kwargs map[string]any) (any, error)
+
+// pluginPrefixes are the collections whose plugin names can be
+// used without the collection prefix.
+var pluginPrefixes = []string{
+	"ansible.builtin.", "ansible.legacy.", "ansible.utils.", "ansible.netcommon.", "community.general.",
+}
+
+// builtinFilters are the Jinja2 and Ansible filters.
+//
+// See https://jinja.palletsprojects.com/en/3.1.x/templates/#list-of-builtin-filters
+// and https://docs.ansible.com/ansible/latest/collections/ansible/builtin/index.html#filter-plugins
+var builtinFilters map[string]filterFunc
+
+func init() {
+	builtinFilters = map[string]filterFunc{
+		"default":              filterDefault,
+		"d":                    filterDefault,
+		"mandatory":            filterMandatory,
+		"bool":                 filterBool,
+		"ternary":              filterTernary,
+		"string":               stringFilter(func(s string) any { return s }),
+		"lower":                stringFilter(func(s string) any { return strings.ToLower(s) }),
+		"upper":                stringFilter(func(s string) any { return strings.ToUpper(s) }),
+		"capitalize":           stringFilter(func(s string) any { return capitalize(s) }),
+		"title":                stringFilter(func(s string) any { return title(s) }),
+		"trim":                 filterTrim,
+		"replace":              filterReplace,
+		"split":                filterSplit,
+		"splitlines":           stringFilter(func(s string) any { return splitString(s, "\n", -1) }),
+		"wordcount":            stringFilter(func(s string) any { return len(strings.Fields(s)) }),
+		"indent":               filterIndent,
+		"format":               filterFormat,
+		"quote":                stringFilter(func(s string) any { return shellQuote(s) }),
+		"comment":              filterComment,
+		"urlencode":            filterURLEncode,
+		"int":                  filterInt,
+		"float":                filterFloat,
+		"abs":                  filterAbs,
+		"round":                filterRound,
+		"pow":                  filterPow,
+		"log":                  filterLog,
+		"length":               filterLength,
+		"count":                filterLength,
+		"list":                 filterList,
+		"first":                filterFirst,
+		"last":                 filterLast,
+		"join":                 filterJoin,
+		"reverse":              filterReverse,
+		"sort":                 filterSort,
+		"unique":               filterUnique,
+		"min":                  filterMinMax(-1),
+		"max":                  filterMinMax(1),
+		"sum":                  filterSum,
+		"flatten":              filterFlatten,
+		"union":                filterSetOp("union"),
+		"intersect":            filterSetOp("intersect"),
+		"difference":           filterSetOp("difference"),
+		"symmetric_difference": filterSetOp("symmetric_difference"),
+		"zip":                  filterZip,
+		"batch":                filterBatch,
+		"map":                  filterMap,
+		"select":               filterSelect(false, false),
+		"reject":               filterSelect(true, false),
+		"selectattr":           filterSelect(false, true),
+		"rejectattr":           filterSelect(true, true),
+		"attr":                 filterAttr,
+		"extract":              filterExtract,
+		"items":                filterItems,
+		"dictsort":             filterItems,
+		"dict2items":           filterDict2Items,
+		"items2dict":           filterItems2Dict,
+		"combine":              filterCombine,
+		"subelements":          filterSubelements,
+		"to_json":              filterToJSON(false),
+		"to_nice_json":         filterToJSON(true),
+		"tojson":               filterToJSON(false),
+		"from_json":            filterFromJSON,
+		"to_yaml":              filterToYAML(false),
+		"to_nice_yaml":         filterToYAML(true),
+		"from_yaml":            filterFromYAML,
+		"from_yaml_all":        filterFromYAMLAll,
+		"regex_replace":        filterRegexReplace,
+		"regex_search":         filterRegexSearch,
+		"regex_findall":        filterRegexFindall,
+		"regex_escape":         stringFilter(func(s string) any { return regexp.QuoteMeta(s) }),
+		"b64encode":            stringFilter(func(s string) any { return base64.StdEncoding.EncodeToString([]byte(s)) }),
+		"b64decode":            filterB64Decode,
+		"basename":             stringFilter(func(s string) any { return path.Base(s) }),
+		"dirname":              stringFilter(func(s string) any { return pathDir(s) }),
+		"splitext":             filterSplitext,
+		"path_join":            filterPathJoin,
+		"hash":                 filterHash,
+		"md5":                  hashFilter(md5.New),
+		"sha1":                 hashFilter(sha1.New),
+		"checksum":             hashFilter(sha1.New),
+		"password_hash":        filterPasswordHash,
+		"ipaddr":               filterIPAddr,
+		"ipv4":                 filterIPVersion(4),
+		"ipv6":                 filterIPVersion(6),
+		"json_query":           filterJSONQuery,
+		"type_debug":           func(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) { return typeName(val), nil },
+		"safe":                 func(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) { return val, nil },
+	}
+}
+
+// undefinedFilters are the filters that accept undefined values.
+// Other filters fail on undefined values as with StrictUndefined in Ansible.
+var undefinedFilters = map[string]struct{}{
+	"default":    {},
+	"d":          {},
+	"mandatory":  {},
+	"type_debug": {},
+}
+
+// pluginShortName returns the plugin name without the collection prefix
+// if the collection is one of pluginPrefixes.
+func pluginShortName(name string) string {
+	for _, prefix := range pluginPrefixes {
+		if short, ok := strings.CutPrefix(name, prefix); ok {
+			return short
+		}
+	}
+	return name
+}
+
+func lookupFilter(name string) (filterFunc, bool) {
+	filter, exists := builtinFilters[pluginShortName(name)]
+	return filter, exists
+}
+
+// arg returns the positional argument with the given index or, if it is not
+// passed, the keyword argument with the given name or the default value.
+func arg(args []any, kwargs map[string]any, idx int, name string, def any) any {
+	if idx >= 0 && idx < len(args) {
+		return args[idx]
+	}
+	if val, exists := kwargs[name]; exists {
+		return val
+	}
+	return def
+}
+
+func stringFilter(fn func(s string) any) filterFunc {
+	return func(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+		return fn(toString(val)), nil
+	}
+}
+
+func filterDefault(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	def := arg(args, kwargs, 0, "default_value", "")
+	boolean := isTruthy(arg(args, kwargs, 1, "boolean", false))
+	if isUndefined(val) || (boolean && !isTruthy(val)) {
+		return def, nil
+	}
+	return val, nil
+}
+
+func filterMandatory(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	if u, ok := val.(undefined); ok {
+		if msg := arg(args, kwargs, 0, "msg", nil); msg != nil {
+			return nil, errors.New(toString(msg))
+		}
+		return nil, fmt.Errorf("mandatory variable %q not defined", u.name)
+	}
+	return val, nil
+}
+
+// toBool converts the value to a boolean as the Ansible "bool" filter does.
+func toBool(val any) bool {
+	switch v := normalize(val).(type) {
+	case bool:
+		return v
+	case int:
+		return v == 1
+	case float64:
+		return v == 1
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "yes", "on", "1", "true", "y", "t":
+			return true
+		}
+	}
+	return false
+}
+
+func filterBool(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	if val == nil {
+		return nil, nil
+	}
+	return toBool(val), nil
+}
+
+func filterTernary(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	trueVal := arg(args, kwargs, 0, "true_val", nil)
+	falseVal := arg(args, kwargs, 1, "false_val", nil)
+	if val == nil {
+		if noneVal := arg(args, kwargs, 2, "none_val", nil); noneVal != nil {
+			return noneVal, nil
+		}
+	}
+	if isTruthy(val) {
+		return trueVal, nil
+	}
+	return falseVal, nil
+}
+
+func filterTrim(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	chars := arg(args, kwargs, 0, "chars", nil)
+	if chars == nil {
+		return strings.TrimSpace(toString(val)), nil
+	}
+	return strings.Trim(toString(val), toString(chars)), nil
+}
+
+func filterReplace(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	if len(args) < 2 {
+		return nil, errors.New("replace filter requires 2 arguments")
+	}
+	count := -1
+	if c := arg(args, kwargs, 2, "count", nil); c != nil {
+		count, _ = toInt(c)
+	}
+	return strings.Replace(toString(val), toString(args[0]), toString(args[1]), count), nil
+}
+
+func filterSplit(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	sep := arg(args, kwargs, 0, "sep", nil)
+	limit := -1
+	if maxsplit := arg(args, kwargs, 1, "maxsplit", nil); maxsplit != nil {
+		if n, ok := toInt(maxsplit); ok && n >= 0 {
+			limit = n + 1
+		}
+	}
+	if sep == nil {
+		return splitString(toString(val), "", limit), nil
+	}
+	return splitString(toString(val), toString(sep), limit), nil
+}
+
+func filterIndent(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	width := "    "
+	if w := arg(args, kwargs, 0, "width", nil); w != nil {
+		if n, ok := normalize(w).(int); ok {
+			width = strings.Repeat(" ", n)
+		} else {
+			width = toString(w)
+		}
+	}
+	first := isTruthy(arg(args, kwargs, 1, "first", false))
+	blank := isTruthy(arg(args, kwargs, 2, "blank", false))
+
+	lines := strings.Split(toString(val), "\n")
+	for i, line := range lines {
+		if (i == 0 && !first) || (line == "" && !blank) {
+			continue
+		}
+		lines[i] = width + line
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func filterFormat(_ *evalContext, val any, args []any, _ map[string]any) (any, error) {
+	return formatPercent(toString(val), args)
+}
+
+// shellQuote quotes the string for use in a shell command as the Python shlex.quote function does.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+	if safe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+func filterComment(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	style := toString(arg(args, kwargs, 0, "style", "plain"))
+	prefix := "# "
+	decoration := ""
+	switch style {
+	case "c":
+		prefix = "// "
+	case "cblock":
+		prefix, decoration = " * ", "/*\n"
+	case "erlang":
+		prefix = "% "
+	case "xml":
+		prefix, decoration = " - ", "<!--\n"
+	}
+	if d := arg(args, kwargs, -1, "decoration", nil); d != nil {
+		prefix = toString(d)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(decoration)
+	if decoration == "" {
+		sb.WriteString(strings.TrimRight(prefix, " ") + "\n")
+	}
+	for _, line := range strings.Split(toString(val), "\n") {
+		sb.WriteString(strings.TrimRight(prefix+line, " ") + "\n")
+	}
+	switch style {
+	case "cblock":
+		sb.WriteString(" */")
+	case "xml":
+		sb.WriteString("-->")
+	default:
+		sb.WriteString(strings.TrimRight(prefix, " "))
+	}
+	return sb.String(), nil
+}
+
+func filterURLEncode(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	if m, ok := normalize(val).(map[string]any); ok {
+		values := url.Values{}
+		for k, v := range m {
+			values.Set(k, toString(v))
+		}
+		return values.Encode(), nil
+	}
+	return strings.ReplaceAll(url.QueryEscape(toString(val)), "+", "%20"), nil
+}
+
+func filterInt(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	def := arg(args, kwargs, 0, "default", 0)
+	if base := arg(args, kwargs, 1, "base", nil); base != nil {
+		b, _ := toInt(base)
+		n, err := strconv.ParseInt(strings.TrimSpace(toString(val)), b, 64)
+		if err != nil {
+			return def, nil
+		}
+		return int(n), nil
+	}
+	if n, ok := toInt(val); ok {
+		return n, nil
+	}
+	return def, nil
+}
+
+func filterFloat(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	if f, ok := toFloat(val); ok {
+		return f, nil
+	}
+	return arg(args, kwargs, 0, "default", 0.0), nil
+}
+
+func filterAbs(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	f, isFloat, ok := toNumber(val)
+	if !ok {
+		return nil, fmt.Errorf("bad operand type for abs(): '%s'", typeName(val))
+	}
+	if isFloat {
+		return math.Abs(f), nil
+	}
+	return int(math.Abs(f)), nil
+}
+
+func filterRound(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	f, ok := toFloat(val)
+	if !ok {
+		return nil, fmt.Errorf("round filter requires a number, got %s", typeName(val))
+	}
+	precision, _ := toInt(arg(args, kwargs, 0, "precision", 0))
+	method := toString(arg(args, kwargs, 1, "method", "common"))
+	scale := math.Pow(10, float64(precision))
+	switch method {
+	case "ceil":
+		return math.Ceil(f*scale) / scale, nil
+	case "floor":
+		return math.Floor(f*scale) / scale, nil
+	}
+	return math.Round(f*scale) / scale, nil
+}
+
+func filterPow(_ *evalContext, val any, args []any, _ map[string]any) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("pow filter requires an exponent")
+	}
+	base, ok1 := toFloat(val)
+	exp, ok2 := toFloat(args[0])
+	if !ok1 || !ok2 {
+		return nil, errors.New("pow filter requires numbers")
+	}
+	return math.Pow(base, exp), nil
+}
+
+func filterLog(_ *evalContext, val any, args []any, _ map[string]any) (any, error) {
+	f, ok := toFloat(val)
+	if !ok {
+		return nil, errors.New("log filter requires a number")
+	}
+	if len(args) > 0 {
+		base, _ := toFloat(args[0])
+		return math.Log(f) / math.Log(base), nil
+	}
+	return math.Log(f), nil
+}
+
+func filterLength(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	switch v := normalize(val).(type) {
+	case string:
+		return len([]rune(v)), nil
+	case []any:
+		return len(v), nil
+	case map[string]any:
+		return len(v), nil
+	case undefined:
+		return 0, nil
+	}
+	return nil, fmt.Errorf("object of type '%s' has no len()", typeName(val))
+}
+
+func filterList(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	return toList(val)
+}
+
+func filterFirst(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return undefined{name: "first"}, nil
+	}
+	return items[0], nil
+}
+
+func filterLast(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return undefined{name: "last"}, nil
+	}
+	return items[len(items)-1], nil
+}
+
+func filterJoin(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	if attribute := arg(args, kwargs, 1, "attribute", nil); attribute != nil {
+		for i, item := range items {
+			items[i] = getAttrPath(item, toString(attribute))
+		}
+	}
+	return joinValues(items, toString(arg(args, kwargs, 0, "d", ""))), nil
+}
+
+func filterReverse(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	if s, ok := normalize(val).(string); ok {
+		runes := []rune(s)
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return string(runes), nil
+	}
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]any, len(items))
+	for i, item := range items {
+		res[len(items)-1-i] = item
+	}
+	return res, nil
+}
+
+func filterSort(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	reverse := isTruthy(arg(args, kwargs, 0, "reverse", false))
+	caseSensitive := isTruthy(arg(args, kwargs, 1, "case_sensitive", false))
+	attribute := arg(args, kwargs, 2, "attribute", nil)
+
+	key := func(item any) any {
+		if attribute != nil {
+			item = getAttrPath(item, toString(attribute))
+		}
+		if s, ok := item.(string); ok && !caseSensitive {
+			return strings.ToLower(s)
+		}
+		return item
+	}
+
+	res := append([]any(nil), items...)
+	var sortErr error
+	sort.SliceStable(res, func(i, j int) bool {
+		cmp, err := compareValues(key(res[i]), key(res[j]))
+		if err != nil {
+			sortErr = err
+		}
+		if reverse {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+	if res == nil {
+		res = []any{}
+	}
+	return res, sortErr
+}
+
+func filterUnique(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	return uniqueValues(items), nil
+}
+
+func uniqueValues(items []any) []any {
+	res := []any{}
+	for _, item := range items {
+		if ok, _ := containsValue(res, item); !ok {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+func filterMinMax(sign int) filterFunc {
+	return func(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+		items, err := toList(val)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			return undefined{}, nil
+		}
+		attribute := arg(args, kwargs, -1, "attribute", nil)
+		key := func(item any) any {
+			if attribute != nil {
+				return getAttrPath(item, toString(attribute))
+			}
+			return item
+		}
+		res := items[0]
+		for _, item := range items[1:] {
+			cmp, err := compareValues(key(item), key(res))
+			if err != nil {
+				return nil, err
+			}
+			if cmp*sign > 0 {
+				res = item
+			}
+		}
+		return res, nil
+	}
+}
+
+func filterSum(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	attribute := arg(args, kwargs, -1, "attribute", nil)
+	var res any = arg(args, kwargs, 1, "start", 0)
+	for _, item := range items {
+		if attribute != nil {
+			item = getAttrPath(item, toString(attribute))
+		}
+		if res, err = binaryOp("+", res, item); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func filterFlatten(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	levels := -1
+	if l := arg(args, kwargs, 0, "levels", nil); l != nil {
+		levels, _ = toInt(l)
+	}
+	skipNulls := isTruthy(arg(args, kwargs, 1, "skip_nulls", true))
+	return flatten(items, levels, skipNulls), nil
+}
+
+func flatten(items []any, levels int, skipNulls bool) []any {
+	res := []any{}
+	for _, item := range items {
+		if item == nil && skipNulls {
+			continue
+		}
+		if nested, ok := normalize(item).([]any); ok && levels != 0 {
+			res = append(res, flatten(nested, levels-1, skipNulls)...)
+			continue
+		}
+		res = append(res, item)
+	}
+	return res
+}
+
+func filterSetOp(op string) filterFunc {
+	return func(_ *evalContext, val any, args []any, _ map[string]any) (any, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s filter requires an argument", op)
+		}
+		a, err := toList(val)
+		if err != nil {
+			return nil, err
+		}
+		b, err := toList(args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		contains := func(items []any, item any) bool {
+			ok, _ := containsValue(items, item)
+			return ok
+		}
+
+		res := []any{}
+		switch op {
+		case "union":
+			res = uniqueValues(append(append(res, a...), b...))
+		case "intersect":
+			for _, item := range uniqueValues(a) {
+				if contains(b, item) {
+					res = append(res, item)
+				}
+			}
+		case "difference":
+			for _, item := range uniqueValues(a) {
+				if !contains(b, item) {
+					res = append(res, item)
+				}
+			}
+		case "symmetric_difference":
+			for _, item := range uniqueValues(append(append([]any{}, a...), b...)) {
+				if contains(a, item) != contains(b, item) {
+					res = append(res, item)
+				}
+			}
+		}
+		return res, nil
+	}
+}
+
+func filterZip(_ *evalContext, val any, args []any, _ map[string]any) (any, error) {
+	lists := make([][]any, 0, len(args)+1)
+	for _, v := range append([]any{val}, args...) {
+		items, err := toList(v)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, items)
+	}
+	res := []any{}
+	for i := 0; ; i++ {
+		tuple := make([]any, 0, len(lists))
+		for _, items := range lists {
+			if i >= len(items) {
+				return res, nil
+			}
+			tuple = append(tuple, items[i])
+		}
+		res = append(res, tuple)
+	}
+}
+
+func filterBatch(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	size, ok := toInt(arg(args, kwargs, 0, "linecount", nil))
+	if !ok || size <= 0 {
+		return nil, errors.New("batch filter requires a positive size")
+	}
+	fill := arg(args, kwargs, 1, "fill_with", nil)
+	res := []any{}
+	for i := 0; i < len(items); i += size {
+		batch := append([]any{}, items[i:min(i+size, len(items))]...)
+		for fill != nil && len(batch) < size {
+			batch = append(batch, fill)
+		}
+		res = append(res, batch)
+	}
+	return res, nil
+}
+
+// getAttrPath returns the attribute of the value by a dotted path, e.g. "a.b.0".
+func getAttrPath(val any, attrPath string) any {
+	for _, part := range strings.Split(attrPath, ".") {
+		if idx, err := strconv.Atoi(part); err == nil {
+			if items, ok := normalize(val).([]any); ok {
+				v, _ := getItem(items, idx)
+				val = v
+				continue
+			}
+		}
+		val = getAttr(val, part)
+	}
+	return val
+}
+
+func filterMap(c *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]any, 0, len(items))
+	if attribute, exists := kwargs["attribute"]; exists {
+		def, hasDefault := kwargs["default"]
+		for _, item := range items {
+			v := getAttrPath(item, toString(attribute))
+			if isUndefined(v) && hasDefault {
+				v = def
+			}
+			res = append(res, v)
+		}
+		return res, nil
+	}
+
+	if len(args) == 0 {
+		return items, nil
+	}
+	name := toString(args[0])
+	for _, item := range items {
+		v, err := c.applyFilter(name, item, args[1:], kwargs)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+func filterSelect(reject, byAttr bool) filterFunc {
+	return func(c *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+		items, err := toList(val)
+		if err != nil {
+			return nil, err
+		}
+
+		var attribute string
+		if byAttr {
+			if len(args) == 0 {
+				return nil, errors.New("missing parameter for attribute name")
+			}
+			attribute = toString(args[0])
+			args = args[1:]
+		}
+
+		res := []any{}
+		for _, item := range items {
+			v := item
+			if byAttr {
+				v = getAttrPath(item, attribute)
+			}
+			var ok bool
+			if len(args) == 0 {
+				ok = isTruthy(v)
+			} else {
+				if ok, err = c.applyTest(toString(args[0]), v, args[1:], kwargs); err != nil {
+					return nil, err
+				}
+			}
+			if ok != reject {
+				res = append(res, item)
+			}
+		}
+		return res, nil
+	}
+}
+
+func filterAttr(_ *evalContext, val any, args []any, _ map[string]any) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("attr filter requires an attribute name")
+	}
+	return getAttr(val, toString(args[0])), nil
+}
+
+func filterExtract(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	container := arg(args, kwargs, 0, "container", nil)
+	res, err := getItem(container, val)
+	if err != nil {
+		return nil, err
+	}
+	if morekeys := arg(args, kwargs, 1, "morekeys", nil); morekeys != nil {
+		keys, ok := normalize(morekeys).([]any)
+		if !ok {
+			keys = []any{morekeys}
+		}
+		for _, key := range keys {
+			if res, err = getItem(res, key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+func filterItems(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	m, ok := normalize(val).(map[string]any)
+	if !ok {
+		if isUndefined(val) {
+			return []any{}, nil
+		}
+		return nil, fmt.Errorf("can only get item pairs from a mapping, got %s", typeName(val))
+	}
+	return dictItems(m), nil
+}
+
+func filterDict2Items(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	m, ok := normalize(val).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("dict2items requires a dictionary, got %s instead", typeName(val))
+	}
+	keyName := toString(arg(args, kwargs, 0, "key_name", "key"))
+	valueName := toString(arg(args, kwargs, 1, "value_name", "value"))
+
+	res := make([]any, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		res = append(res, map[string]any{keyName: k, valueName: m[k]})
+	}
+	return res, nil
+}
+
+func filterItems2Dict(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	keyName := toString(arg(args, kwargs, 0, "key_name", "key"))
+	valueName := toString(arg(args, kwargs, 1, "value_name", "value"))
+
+	res := make(map[string]any, len(items))
+	for _, item := range items {
+		m, ok := normalize(item).(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("items2dict requires a list of dictionaries, got %s", typeName(item))
+		}
+		key, exists := m[keyName]
+		if !exists {
+			return nil, fmt.Errorf("items2dict requires each dictionary to have the key %q", keyName)
+		}
+		res[toString(key)] = m[valueName]
+	}
+	return res, nil
+}
+
+func filterCombine(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	recursive := isTruthy(kwargs["recursive"])
+	listMerge := toString(arg(nil, kwargs, -1, "list_merge", "replace"))
+
+	var dicts []any
+	for _, v := range append([]any{val}, args...) {
+		// the dictionaries can be passed as a list
+		if items, ok := normalize(v).([]any); ok {
+			dicts = append(dicts, items...)
+		} else {
+			dicts = append(dicts, v)
+		}
+	}
+
+	res := map[string]any{}
+	for _, d := range dicts {
+		m, ok := normalize(d).(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("failed to combine variables, expected dicts but got a '%s'", typeName(d))
+		}
+		res = mergeDicts(res, m, recursive, listMerge)
+	}
+	return res, nil
+}
+
+func mergeDicts(a, b map[string]any, recursive bool, listMerge string) map[string]any {
+	res := make(map[string]any, len(a)+len(b))
+	for k, v := range a {
+		res[k] = v
+	}
+	for k, v := range b {
+		existing, exists := res[k]
+		if !exists {
+			res[k] = v
+			continue
+		}
+		existingMap, ok1 := normalize(existing).(map[string]any)
+		newMap, ok2 := normalize(v).(map[string]any)
+		if recursive && ok1 && ok2 {
+			res[k] = mergeDicts(existingMap, newMap, recursive, listMerge)
+			continue
+		}
+		existingList, ok1 := normalize(existing).([]any)
+		newList, ok2 := normalize(v).([]any)
+		if ok1 && ok2 {
+			res[k] = mergeLists(existingList, newList, listMerge)
+			continue
+		}
+		res[k] = v
+	}
+	return res
+}
+
+func mergeLists(a, b []any, listMerge string) []any {
+	switch listMerge {
+	case "keep":
+		return a
+	case "append":
+		return append(append([]any{}, a...), b...)
+	case "prepend":
+		return append(append([]any{}, b...), a...)
+	case "append_rp":
+		res := []any{}
+		for _, item := range a {
+			if ok, _ := containsValue(b, item); !ok {
+				res = append(res, item)
+			}
+		}
+		return append(res, b...)
+	case "prepend_rp":
+		res := append([]any{}, b...)
+		for _, item := range a {
+			if ok, _ := containsValue(b, item); !ok {
+				res = append(res, item)
+			}
+		}
+		return res
+	}
+	return b
+}
+
+func filterSubelements(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("subelements filter requires a subelement name")
+	}
+	skipMissing := isTruthy(arg(args, kwargs, 1, "skip_missing", false))
+
+	res := []any{}
+	for _, item := range items {
+		sub := getAttrPath(item, toString(args[0]))
+		if isUndefined(sub) {
+			if skipMissing {
+				continue
+			}
+			return nil, fmt.Errorf("could not find %q key in iterated item", toString(args[0]))
+		}
+		subItems, err := toList(sub)
+		if err != nil {
+			return nil, err
+		}
+		for _, subItem := range subItems {
+			res = append(res, []any{item, subItem})
+		}
+	}
+	return res, nil
+}
+
+func filterToJSON(nice bool) filterFunc {
+	return func(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+		indent := 0
+		if nice {
+			indent = 4
+		}
+		if i := arg(nil, kwargs, -1, "indent", nil); i != nil {
+			indent, _ = toInt(i)
+		}
+		var sb strings.Builder
+		if err := writeJSON(&sb, val, indent, 0); err != nil {
+			return nil, err
+		}
+		return sb.String(), nil
+	}
+}
+
+// writeJSON encodes the value as the Python json.dumps function does.
+// Dictionary keys are sorted.
+func writeJSON(sb *strings.Builder, val any, indent, level int) error {
+	newline := func(level int) {
+		if indent > 0 {
+			sb.WriteString("\n" + strings.Repeat(" ", indent*level))
+		}
+	}
+	sep := ", "
+	if indent > 0 {
+		sep = ","
+	}
+
+	switch v := normalize(val).(type) {
+	case nil:
+		sb.WriteString("null")
+	case undefined:
+		return fmt.Errorf("%q is undefined", v.name)
+	case bool:
+		sb.WriteString(strconv.FormatBool(v))
+	case int:
+		sb.WriteString(strconv.Itoa(v))
+	case float64:
+		sb.WriteString(formatFloat(v))
+	case string:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		sb.WriteString(strings.TrimSuffix(buf.String(), "\n"))
+	case []any:
+		if len(v) == 0 {
+			sb.WriteString("[]")
+			return nil
+		}
+		sb.WriteString("[")
+		for i, item := range v {
+			if i > 0 {
+				sb.WriteString(sep)
+			}
+			newline(level + 1)
+			if err := writeJSON(sb, item, indent, level+1); err != nil {
+				return err
+			}
+		}
+		newline(level)
+		sb.WriteString("]")
+	case map[string]any:
+		if len(v) == 0 {
+			sb.WriteString("{}")
+			return nil
+		}
+		sb.WriteString("{")
+		for i, k := range sortedKeys(v) {
+			if i > 0 {
+				sb.WriteString(sep)
+			}
+			newline(level + 1)
+			if err := writeJSON(sb, k, indent, level+1); err != nil {
+				return err
+			}
+			sb.WriteString(": ")
+			if err := writeJSON(sb, v[k], indent, level+1); err != nil {
+				return err
+			}
+		}
+		newline(level)
+		sb.WriteString("}")
+	default:
+		return fmt.Errorf("object of type %s is not JSON serializable", typeName(val))
+	}
+	return nil
+}
+
+func filterFromJSON(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(toString(val)))
+	dec.UseNumber()
+	var res any
+	if err := dec.Decode(&res); err != nil {
+		return nil, fmt.Errorf("from_json: %w", err)
+	}
+	return fromJSONNumbers(res), nil
+}
+
+func fromJSONNumbers(val any) any {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i, item := range v {
+			v[i] = fromJSONNumbers(item)
+		}
+	case map[string]any:
+		for k, item := range v {
+			v[k] = fromJSONNumbers(item)
+		}
+	}
+	return val
+}
+
+func filterToYAML(nice bool) filterFunc {
+	return func(_ *evalContext, val any, _ []any, kwargs map[string]any) (any, error) {
+		indent := 2
+		if nice {
+			indent = 4
+		}
+		if i := arg(nil, kwargs, -1, "indent", nil); i != nil {
+			indent, _ = toInt(i)
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(indent)
+		if err := enc.Encode(plainValue(val)); err != nil {
+			return nil, err
+		}
+		return buf.String(), nil
+	}
+}
+
+// plainValue converts the value to the plain Go types for encoding.
+func plainValue(val any) any {
+	switch v := normalize(val).(type) {
+	case []any:
+		res := make([]any, len(v))
+		for i, item := range v {
+			res[i] = plainValue(item)
+		}
+		return res
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for k, item := range v {
+			res[k] = plainValue(item)
+		}
+		return res
+	case undefined:
+		return nil
+	default:
+		return v
+	}
+}
+
+func filterFromYAML(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	var res any
+	if err := yaml.Unmarshal([]byte(toString(val)), &res); err != nil {
+		return nil, fmt.Errorf("from_yaml: %w", err)
+	}
+	return res, nil
+}
+
+func filterFromYAMLAll(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	dec := yaml.NewDecoder(strings.NewReader(toString(val)))
+	res := []any{}
+	for {
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			if err.Error() == "EOF" {
+				return res, nil
+			}
+			return nil, fmt.Errorf("from_yaml_all: %w", err)
+		}
+		res = append(res, doc)
+	}
+}
+
+var (
+	pythonNamedGroup     = regexp.MustCompile(`\(\?P<`)
+	pythonBackref        = regexp.MustCompile(`\\(\d+)`)
+	pythonNamedBackref   = regexp.MustCompile(`\\g<(\w+)>`)
+	pythonNamedRefSearch = regexp.MustCompile(`^\\g<(\w+)>$`)
+	pythonIndexRefSearch = regexp.MustCompile(`^\\(\d+)$`)
+)
+
+// compilePythonRegex compiles the Python regular expression.
+func compilePythonRegex(expr string, kwargs map[string]any) (*regexp.Regexp, error) {
+	expr = pythonNamedGroup.ReplaceAllString(expr, "(?P<")
+	var flags string
+	if isTruthy(kwargs["ignorecase"]) {
+		flags += "i"
+	}
+	if isTruthy(kwargs["multiline"]) {
+		flags += "m"
+	}
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// pythonReplacement converts the Python replacement string to the Go syntax.
+func pythonReplacement(repl string) string {
+	repl = strings.ReplaceAll(repl, "$", "$$")
+	repl = pythonNamedBackref.ReplaceAllString(repl, "$${$1}")
+	return pythonBackref.ReplaceAllString(repl, "$${$1}")
+}
+
+func filterRegexReplace(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	re, err := compilePythonRegex(toString(arg(args, kwargs, 0, "pattern", "")), kwargs)
+	if err != nil {
+		return nil, err
+	}
+	repl := pythonReplacement(toString(arg(args, kwargs, 1, "replacement", "")))
+	s := toString(val)
+
+	count, _ := toInt(arg(args, kwargs, 4, "count", 0))
+	if count <= 0 {
+		return re.ReplaceAllString(s, repl), nil
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(s, count) {
+		sb.WriteString(s[last:match[0]])
+		sb.Write(re.ExpandString(nil, repl, s, match))
+		last = match[1]
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), nil
+}
+
+func filterRegexSearch(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("regex_search requires a regular expression")
+	}
+	re, err := compilePythonRegex(toString(args[0]), kwargs)
+	if err != nil {
+		return nil, err
+	}
+	s := toString(val)
+	match := re.FindStringSubmatchIndex(s)
+	if match == nil {
+		return nil, nil
+	}
+
+	if len(args) == 1 {
+		return s[match[0]:match[1]], nil
+	}
+
+	res := []any{}
+	for _, ref := range args[1:] {
+		refStr := toString(ref)
+		var group int
+		if m := pythonNamedRefSearch.FindStringSubmatch(refStr); m != nil {
+			group = re.SubexpIndex(m[1])
+		} else if m := pythonIndexRefSearch.FindStringSubmatch(refStr); m != nil {
+			group, _ = strconv.Atoi(m[1])
+		} else {
+			return nil, fmt.Errorf("unknown argument %q", refStr)
+		}
+		if group < 0 || 2*group+1 >= len(match) || match[2*group] == -1 {
+			res = append(res, nil)
+			continue
+		}
+		res = append(res, s[match[2*group]:match[2*group+1]])
+	}
+	return res, nil
+}
+
+func filterRegexFindall(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	re, err := compilePythonRegex(toString(arg(args, kwargs, 0, "regex", "")), kwargs)
+	if err != nil {
+		return nil, err
+	}
+	res := []any{}
+	for _, match := range re.FindAllStringSubmatch(toString(val), -1) {
+		switch len(match) {
+		case 1:
+			res = append(res, match[0])
+		case 2:
+			res = append(res, match[1])
+		default:
+			groups := make([]any, len(match)-1)
+			for i, g := range match[1:] {
+				groups[i] = g
+			}
+			res = append(res, groups)
+		}
+	}
+	return res, nil
+}
+
+func filterB64Decode(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	s := strings.TrimSpace(toString(val))
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		if data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "=")); err != nil {
+			return nil, fmt.Errorf("b64decode: %w", err)
+		}
+	}
+	return string(data), nil
+}
+
+func pathDir(s string) string {
+	if !strings.Contains(s, "/") {
+		return ""
+	}
+	dir := path.Dir(s)
+	return dir
+}
+
+func filterSplitext(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	s := toString(val)
+	ext := path.Ext(s)
+	if ext == path.Base(s) {
+		ext = ""
+	}
+	return []any{strings.TrimSuffix(s, ext), ext}, nil
+}
+
+func filterPathJoin(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+	parts, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := normalize(val).(string); ok {
+		return s, nil
+	}
+	res := ""
+	for _, part := range parts {
+		p := toString(part)
+		if strings.HasPrefix(p, "/") || res == "" {
+			res = p
+			continue
+		}
+		res = strings.TrimSuffix(res, "/") + "/" + p
+	}
+	return res, nil
+}
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+func hashFilter(newHash func() hash.Hash) filterFunc {
+	return func(_ *evalContext, val any, _ []any, _ map[string]any) (any, error) {
+		h := newHash()
+		h.Write([]byte(toString(val)))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+}
+
+func filterHash(c *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	algorithm := toString(arg(args, kwargs, 0, "hashtype", "sha1"))
+	newHash, exists := hashAlgorithms[algorithm]
+	if !exists {
+		return nil, fmt.Errorf("unsupported hash type %q", algorithm)
+	}
+	return hashFilter(newHash)(c, val, nil, nil)
+}
@@ -4,7 +4,6 @@ go 1.21.2
 
 require (
 	github.com/bmatcuk/doublestar/v4 v4.6.1
-	github.com/flosch/pongo2/v6 v6.0.0
 	github.com/mitchellh/mapstructure v1.5.0
 	github.com/samber/lo v1.39.0
 	github.com/stretchr/testify v1.8.4
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// legacyIncludeAction is the deprecated "include" module, which was
+	// replaced by "include_tasks" and "import_tasks".
+	legacyIncludeAction = "include"
+
+	defaultLoopVar = "item"
+)
+
+// IsDynamicInclude reports whether the task includes tasks or a role at
+// runtime with "include_tasks", "include_role" or the dynamic legacy "include".
+// Unlike the static imports, the keywords of the dynamic includes are not
+// inherited by the included tasks, only the keywords of the "apply" parameter are.
+func (t *Task) IsDynamicInclude() bool {
+	return t.actionOneOf(includeTasksAction, includeRoleAction) ||
+		(t.actionOneOf(legacyIncludeAction) && t.isDynamicLegacyInclude())
+}
+
+// IsStaticImport reports whether the task imports tasks or a role when the
+// playbook is parsed, with "import_tasks", "import_role" or the static legacy "include".
+func (t *Task) IsStaticImport() bool {
+	return t.actionOneOf(importTasksAction, importRoleAction) ||
+		(t.actionOneOf(legacyIncludeAction) && !t.isDynamicLegacyInclude())
+}
+
+// isDynamicLegacyInclude reports whether the legacy "include" is processed
+// at runtime, as Ansible does when the include has a loop or a templated file
+// name. The "static" parameter overrides the detection.
+func (t *Task) isDynamicLegacyInclude() bool {
+	action, ok := t.rawAction()
+	if !ok {
+		return false
+	}
+	if static, exists := action.params["static"]; exists {
+		return !toBool(static)
+	}
+	if t.hasLoop() {
+		return true
+	}
+	file, exists := action.params["file"]
+	if !exists {
+		file = action.params[rawParamsKey]
+	}
+	return containsTemplate(file)
+}
+
+// applyInner contains the keywords of the "apply" parameter of a dynamic
+// include, which are applied to all included tasks.
+type applyInner struct {
+	Tags StringList `yaml:"tags"`
+
+	keywordsInner `yaml:",inline"`
+}
+
+// applyKeywords returns the keywords of the "apply" parameter of the dynamic
+// include. The values are kept as is to be rendered with the variables of the
+// included tasks.
+func (t *Task) applyKeywords() *applyInner {
+	action, ok := t.rawAction()
+	if !ok {
+		return nil
+	}
+	val, exists := action.params["apply"]
+	if !exists {
+		return nil
+	}
+
+	// the keywords are decoded the same way as the keywords of the task
+	b, err := yaml.Marshal(val)
+	if err != nil {
+		log.Printf("Invalid \"apply\" keywords of task %q: %s", t.Name(), err)
+		return nil
+	}
+	var res applyInner
+	if err := yaml.Unmarshal(b, &res); err != nil {
+		log.Printf("Invalid \"apply\" keywords of task %q: %s", t.Name(), err)
+		return nil
+	}
+	return &res
+}
+
+// legacyIncludeVars returns the variables passed to the tasks included with
+// the legacy "include", e.g. "include: users.yaml user=app".
+func (t *Task) legacyIncludeVars() Variables {
+	if !t.actionOneOf(legacyIncludeAction) {
+		return nil
+	}
+	action, ok := t.rawAction()
+	if !ok {
+		return nil
+	}
+	res := make(Variables)
+	for k, v := range action.params {
+		if k != rawParamsKey && k != "file" && k != "static" {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// hasLoop reports whether the task has the "loop" or "with_<lookup>" keyword.
+func (t *Task) hasLoop() bool {
+	_, _, ok := t.loopKeyword()
+	return ok
+}
+
+// loopKeyword returns the name of the lookup used by the "with_<lookup>"
+// keyword, or an empty string for the "loop" keyword, and the value of the keyword.
+// Ansible rejects the tasks with more than one loop keyword, so the task loop
+// is ignored in that case rather than picking one of the keywords.
+func (t *Task) loopKeyword() (string, any, bool) {
+	keys := lo.Filter(lo.Keys(t.raw), func(key string, _ int) bool {
+		return key == "loop" || strings.HasPrefix(key, "with_")
+	})
+	switch len(keys) {
+	case 0:
+		return "", nil, false
+	case 1:
+		lookup, _ := strings.CutPrefix(keys[0], "with_")
+		return lo.Ternary(keys[0] == "loop", "", lookup), t.raw[keys[0]], true
+	}
+	sort.Strings(keys)
+	log.Printf("Task %q has more than one loop keyword: %s", t.Name(), strings.Join(keys, ", "))
+	return "", nil, false
+}
+
+// loopItems returns the items of the loop of the task. The items of the
+// "with_<lookup>" keywords are produced by the lookup, as Ansible does.
+//
+// See https://docs.ansible.com/ansible/latest/playbook_guide/playbooks_loops.html
+func (t *Task) loopItems() ([]any, error) {
+	lookup, val, ok := t.loopKeyword()
+	if !ok {
+		return nil, nil
+	}
+
+	vars := t.getVars()
+	rendered := t.renderVariable(val, vars)
+	if u, ok := rendered.(Unknown); ok {
+		return nil, &UnknownValueError{Value: u}
+	}
+
+	if lookup == "" {
+		items, ok := rendered.([]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid loop data, a list is required: %v", rendered)
+		}
+		return items, nil
+	}
+
+	terms, ok := rendered.([]any)
+	if !ok {
+		terms = []any{rendered}
+	}
+	// the terms are passed to the lookup as variables, since they are already rendered
+	lookupVars := lo.Assign(vars)
+	args := []string{strconv.Quote(lookup)}
+	for i, term := range terms {
+		name := fmt.Sprintf("__loop_term_%d", i)
+		lookupVars[name] = term
+		args = append(args, name)
+	}
+	res, err := t.getTemplater().EvaluateValue(
+		fmt.Sprintf("{{ query(%s) }}", strings.Join(args, ", ")), lookupVars)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := res.([]any)
+	if !ok {
+		return nil, fmt.Errorf("lookup %q returned %T instead of a list", lookup, res)
+	}
+	return items, nil
+}
+
+// loopVars returns the names of the loop variable and the index variable
+// from the "loop_control" keyword.
+func (t *Task) loopVars() (string, string) {
+	loopControl, _ := t.raw["loop_control"].(map[string]any)
+	loopVar, _ := loopControl["loop_var"].(string)
+	indexVar, _ := loopControl["index_var"].(string)
+	return lo.Ternary(loopVar == "", defaultLoopVar, loopVar), indexVar
+}
+
+// includeIterations returns the copies of the include task for each item of
+// its loop, with the loop variables set. The include task is returned as is if
+// it has no loop or the loop items cannot be determined.
+func (t *Task) includeIterations() Tasks {
+	if !t.hasLoop() {
+		return Tasks{t}
+	}
+	if t.actionOneOf(importTasksAction, importRoleAction) {
+		log.Printf("Loops cannot be used with static imports, task %q", t.Name())
+		return Tasks{t}
+	}
+
+	items, err := t.loopItems()
+	if err != nil {
+		log.Printf("Failed to expand the loop of task %q: %s", t.Name(), err)
+		return Tasks{t}
+	}
+
+	loopVar, indexVar := t.loopVars()
+	res := make(Tasks, 0, len(items))
+	for i, item := range items {
+		iteration := *t
+		iteration.inner.Vars = lo.Assign(t.inner.Vars, Variables{loopVar: item})
+		if indexVar != "" {
+			iteration.inner.Vars[indexVar] = i
+		}
+		iteration.loopIndex = lo.ToPtr(i)
+		iteration.cachedVars = nil
+		res = append(res, &iteration)
+	}
+	return res
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  vars:
+    components: [api, worker]
+  tasks:
+    - name: Include with apply
+      include_tasks:
+        file: setup.yaml
+        apply:
+          tags: [setup]
+          become: true
+      tags: [include]
+      become_user: nobody
+    - name: Import
+      import_tasks: setup.yaml
+      tags: [import]
+    - name: Include components
+      include_tasks: "{{ item }}.yaml"
+      loop: "{{ components }}"
+    - name: Include components with lookup
+      include_tasks: "{{ component }}.yaml"
+      with_items:
+        - api
+      loop_control:
+        loop_var: component
+    - name: Include unknown components
+      include_tasks: "{{ item }}.yaml"
+      loop: "{{ unknown_components }}"
+`),
+		},
+		"setup.yaml": {
+			Data: []byte(`---
+- name: Setup
+  command: setup
+`),
+		},
+		"api.yaml": {
+			Data: []byte(`---
+- name: Deploy {{ item | default(component) }}
+  command: deploy api
+`),
+		},
+		"worker.yaml": {
+			Data: []byte(`---
+- name: Deploy worker
+  command: deploy worker
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 5)
+
+	assert.True(t, tasks[0].parent.IsDynamicInclude())
+	assert.False(t, tasks[0].parent.IsStaticImport())
+	assert.Equal(t, []string{"setup"}, tasks[0].Tags())
+	kw := tasks[0].Keywords()
+	assert.Equal(t, lo.ToPtr(true), kw.Become)
+	assert.Nil(t, kw.BecomeUser)
+
+	assert.True(t, tasks[1].parent.IsStaticImport())
+	assert.Equal(t, []string{"import"}, tasks[1].Tags())
+
+	assert.Equal(t, "api.yaml", tasks[2].metadata.path)
+	assert.Equal(t, "api", tasks[2].getVars()["item"])
+	assert.Equal(t, "worker.yaml", tasks[3].metadata.path)
+	assert.Equal(t, "worker", tasks[3].getVars()["item"])
+
+	assert.Equal(t, "api.yaml", tasks[4].metadata.path)
+	assert.Equal(t, "api", tasks[4].getVars()["component"])
+}
+
+func TestLegacyInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site.yaml": {
+			Data: []byte(`---
+- include: playbook.yaml
+`),
+		},
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  tasks:
+    - include: users.yaml user=app
+      tags: [users]
+    - include: "{{ item }}.yaml"
+      with_items: [packages]
+      tags: [packages]
+`),
+		},
+		"users.yaml": {
+			Data: []byte(`---
+- name: Create user
+  user:
+    name: "{{ user }}"
+`),
+		},
+		"packages.yaml": {
+			Data: []byte(`---
+- name: Install packages
+  package:
+    name: nginx
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "site.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 2)
+
+	module, exists := tasks[0].Module("user")
+	require.True(t, exists)
+	assert.Equal(t, "app", module["name"])
+	assert.Equal(t, []string{"users"}, tasks[0].Tags())
+
+	assert.Equal(t, "packages.yaml", tasks[1].metadata.path)
+
+	// the include with a loop is dynamic, so its tags are not inherited
+	assert.True(t, tasks[0].parent.IsStaticImport())
+	assert.True(t, tasks[1].parent.IsDynamicInclude())
+	assert.Empty(t, tasks[1].Tags())
+}
+
+func TestLoopKeyword(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    map[string]any
+		lookup string
+		loop   bool
+	}{
+		{name: "loop", raw: map[string]any{"loop": []any{1}}, lookup: "", loop: true},
+		{name: "with lookup", raw: map[string]any{"with_dict": map[string]any{}}, lookup: "dict", loop: true},
+		{name: "no loop", raw: map[string]any{"debug": nil}},
+		{name: "several loops", raw: map[string]any{"with_items": []any{1}, "with_dict": map[string]any{}, "loop": []any{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookup, _, ok := (&Task{raw: tt.raw}).loopKeyword()
+			assert.Equal(t, tt.loop, ok)
+			assert.Equal(t, tt.lookup, lookup)
+		})
+	}
+}
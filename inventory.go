@@ -1,12 +1,15 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"io/fs"
 	"log"
-	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"slices"
+	"sort"
 	"strings"
 
 	"github.com/bmatcuk/doublestar/v4"
@@ -15,110 +18,465 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-const defaultInventoryPath = "/etc/ansible/hosts"
+const (
+	defaultInventoryPath = "/etc/ansible/hosts"
+
+	allGroup       = "all"
+	ungroupedGroup = "ungrouped"
+	localhost      = "localhost"
+)
 
 type HostGroup struct {
 	hosts    []string
 	children []string
+	vars     Variables
 }
 
 type Inventory struct {
 	groups   map[string]*HostGroup
-	hostVars map[string]map[string]string
+	hostVars map[string]Variables
+
+	groupFacts map[string]FactProfile
+	hostFacts  map[string]FactProfile
 }
 
 func NewInventory() Inventory {
 	return Inventory{
-		groups:   make(map[string]*HostGroup),
-		hostVars: make(map[string]map[string]string),
+		groups:     make(map[string]*HostGroup),
+		hostVars:   make(map[string]Variables),
+		groupFacts: make(map[string]FactProfile),
+		hostFacts:  make(map[string]FactProfile),
 	}
 }
 
-func (i *Inventory) AddHosts(groupName string, hosts []string) {
+func (i *Inventory) group(groupName string) *HostGroup {
 	group, exists := i.groups[groupName]
 	if !exists {
-		group = &HostGroup{
-			hosts: hosts,
-		}
+		group = &HostGroup{}
 		i.groups[groupName] = group
-	} else {
-		group.hosts = append(group.hosts, hosts...)
 	}
+	return group
 }
+
+func (i *Inventory) AddHosts(groupName string, hosts []string) {
+	group := i.group(groupName)
+	group.hosts = lo.Uniq(append(group.hosts, hosts...))
+}
+
 func (i *Inventory) AddChildren(groupName string, children []string) {
-	group, exists := i.groups[groupName]
-	if !exists {
-		group = &HostGroup{
-			children: children,
+	group := i.group(groupName)
+	group.children = lo.Uniq(append(group.children, children...))
+	for _, child := range children {
+		i.group(child)
+	}
+}
+
+func (i *Inventory) AddGroupVars(groupName string, vars Variables) {
+	group := i.group(groupName)
+	group.vars = lo.Assign(group.vars, vars)
+}
+
+func (i *Inventory) AddHostVars(host string, vars Variables) {
+	i.hostVars[host] = lo.Assign(i.hostVars[host], vars)
+}
+
+// Merge adds the groups, hosts and variables of the other inventory to this inventory.
+func (i *Inventory) Merge(other Inventory) {
+	for name, group := range other.groups {
+		i.AddHosts(name, group.hosts)
+		i.AddChildren(name, group.children)
+		i.AddGroupVars(name, group.vars)
+	}
+	for host, vars := range other.hostVars {
+		i.AddHostVars(host, vars)
+	}
+	for groupName, facts := range other.groupFacts {
+		i.AddGroupFacts(groupName, facts)
+	}
+	for host, facts := range other.hostFacts {
+		i.AddHostFacts(host, facts)
+	}
+}
+
+// AddGroupFacts attaches the fact profile to all hosts of the group.
+func (i *Inventory) AddGroupFacts(groupName string, facts FactProfile) {
+	i.groupFacts[groupName] = i.groupFacts[groupName].Merge(facts)
+}
+
+// AddHostFacts attaches the fact profile to the host.
+func (i *Inventory) AddHostFacts(host string, facts FactProfile) {
+	i.hostFacts[host] = i.hostFacts[host].Merge(facts)
+}
+
+// HostFacts returns the facts of the host. The facts attached to the host
+// take precedence over the facts attached to its groups.
+func (i *Inventory) HostFacts(host string) FactProfile {
+	var res FactProfile
+	if facts, exists := i.groupFacts[allGroup]; exists {
+		res = res.Merge(facts)
+	}
+	for _, groupName := range i.sortedGroupNames(host) {
+		if facts, exists := i.groupFacts[groupName]; exists {
+			res = res.Merge(facts)
 		}
-		i.groups[groupName] = group
-	} else {
-		group.children = append(group.children, children...)
 	}
+	if facts, exists := i.hostFacts[host]; exists {
+		res = res.Merge(facts)
+	}
+	return res
+}
+
+// Hosts returns the sorted list of all hosts in the inventory.
+func (i *Inventory) Hosts() []string {
+	var hosts []string
+	for _, group := range i.groups {
+		hosts = append(hosts, group.hosts...)
+	}
+	hosts = lo.Uniq(hosts)
+	sort.Strings(hosts)
+	return hosts
 }
-func (i *Inventory) AddGroupVars(groupName string, vars map[string]string) {
-	if groupName == "all" {
-		// TODO add vars to all hosts
+
+// HasHost reports whether the host is defined in the inventory.
+func (i *Inventory) HasHost(host string) bool {
+	return slices.Contains(i.Hosts(), host)
+}
+
+// GroupHosts returns the hosts of the group, including the hosts of its child groups.
+func (i *Inventory) GroupHosts(groupName string) []string {
+	switch groupName {
+	case allGroup:
+		return i.Hosts()
+	case ungroupedGroup:
+		return lo.Filter(i.Hosts(), func(host string, _ int) bool {
+			return len(i.GroupNames(host)) == 0 || slices.Equal(i.GroupNames(host), []string{ungroupedGroup})
+		})
 	}
+	hosts := i.groupHosts(groupName, make(map[string]bool))
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (i *Inventory) groupHosts(groupName string, visited map[string]bool) []string {
 	group, exists := i.groups[groupName]
-	if !exists {
-		log.Printf("group %q does not exists", groupName)
-		return
+	if !exists || visited[groupName] {
+		return nil
 	}
-	for _, host := range group.hosts {
-		i.AddHostVars(host, vars)
+	visited[groupName] = true
+
+	hosts := slices.Clone(group.hosts)
+	for _, child := range group.children {
+		hosts = append(hosts, i.groupHosts(child, visited)...)
 	}
+	return lo.Uniq(hosts)
+}
 
-	for _, childGroup := range group.children {
-		i.AddGroupVars(childGroup, vars)
+// Groups returns all groups with their hosts, including the implicit
+// "all" and "ungrouped" groups. This is the value of the "groups" magic variable.
+func (i *Inventory) Groups() map[string][]string {
+	res := make(map[string][]string, len(i.groups)+2)
+	for name := range i.groups {
+		res[name] = i.GroupHosts(name)
 	}
+	res[allGroup] = i.GroupHosts(allGroup)
+	res[ungroupedGroup] = i.GroupHosts(ungroupedGroup)
+	return res
 }
 
-func (i *Inventory) AddHostVars(host string, vars map[string]string) {
-	i.hostVars[host] = lo.Assign(i.hostVars[host], vars)
+// GroupNames returns the sorted list of groups the host belongs to, excluding
+// the implicit "all" group. This is the value of the "group_names" magic variable.
+func (i *Inventory) GroupNames(host string) []string {
+	var res []string
+	for name := range i.groups {
+		if name == allGroup {
+			continue
+		}
+		if slices.Contains(i.groupHosts(name, make(map[string]bool)), host) {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// HostVars returns the inventory variables of the host. Group variables are
+// applied from the least specific group ("all") to the most specific one,
+// and host variables take precedence over group variables.
+func (i *Inventory) HostVars(host string) Variables {
+	res := make(Variables)
+	if group, exists := i.groups[allGroup]; exists {
+		res = lo.Assign(res, group.vars)
+	}
+	for _, name := range i.sortedGroupNames(host) {
+		res = lo.Assign(res, i.groups[name].vars)
+	}
+	return lo.Assign(res, i.hostVars[host])
+}
+
+// sortedGroupNames returns the groups of the host ordered from the least specific to the most specific.
+func (i *Inventory) sortedGroupNames(host string) []string {
+	groupNames := i.GroupNames(host)
+	sort.SliceStable(groupNames, func(a, b int) bool {
+		return i.groupDepth(groupNames[a]) < i.groupDepth(groupNames[b])
+	})
+	return groupNames
+}
+
+// groupDepth returns the length of the longest chain of parent groups.
+func (i *Inventory) groupDepth(groupName string) int {
+	return i.groupDepthVisited(groupName, make(map[string]bool))
+}
+
+func (i *Inventory) groupDepthVisited(groupName string, visited map[string]bool) int {
+	if visited[groupName] {
+		return 0
+	}
+	visited[groupName] = true
+	depth := 0
+	for name, group := range i.groups {
+		if name != allGroup && slices.Contains(group.children, groupName) {
+			depth = max(depth, i.groupDepthVisited(name, visited)+1)
+		}
+	}
+	return depth
 }
 
-func parseInventories(fsys fs.FS, project *AnsibleProject) {
-	paths := []string{defaultInventoryPath, "inventory"}
-	paths = append(paths, project.cfg.Inventory...)
+// ResolveHosts returns the hosts matching the pattern, as used in the "hosts"
+// keyword of a play. Patterns can be combined with ":" or "," and support
+// exclusion ("!"), intersection ("&"), wildcards and regular expressions ("~").
+//
+// See https://docs.ansible.com/ansible/latest/inventory_guide/intro_patterns.html
+func (i *Inventory) ResolveHosts(pattern string) []string {
+	var (
+		res        []string
+		exclude    []string
+		intersects [][]string
+	)
+
+	for _, p := range splitHostPattern(pattern) {
+		switch {
+		case strings.HasPrefix(p, "!"):
+			exclude = append(exclude, i.matchHosts(p[1:])...)
+		case strings.HasPrefix(p, "&"):
+			intersects = append(intersects, i.matchHosts(p[1:]))
+		default:
+			res = append(res, i.matchHosts(p)...)
+		}
+	}
+
+	for _, hosts := range intersects {
+		res = lo.Intersect(res, hosts)
+	}
+
+	return lo.Without(lo.Uniq(res), exclude...)
+}
+
+func splitHostPattern(pattern string) []string {
+	var separators string
+	if strings.Contains(pattern, ",") {
+		separators = ","
+	} else {
+		separators = ":"
+	}
+
+	return lo.FilterMap(strings.Split(pattern, separators), func(p string, _ int) (string, bool) {
+		p = strings.TrimSpace(p)
+		return p, p != ""
+	})
+}
+
+func (i *Inventory) matchHosts(pattern string) []string {
+	if pattern == allGroup || pattern == "*" {
+		return i.Hosts()
+	}
+
+	if _, exists := i.groups[pattern]; exists || pattern == ungroupedGroup {
+		return i.GroupHosts(pattern)
+	}
+
+	if i.HasHost(pattern) {
+		return []string{pattern}
+	}
+
+	var match func(string) bool
+	if expr, ok := strings.CutPrefix(pattern, "~"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil
+		}
+		match = re.MatchString
+	} else if strings.ContainsAny(pattern, "*?[") {
+		match = func(s string) bool {
+			matched, _ := path.Match(pattern, s)
+			return matched
+		}
+	} else {
+		// localhost is implicitly available
+		if pattern == localhost {
+			return []string{localhost}
+		}
+		return nil
+	}
+
+	var res []string
+	for name := range i.groups {
+		if match(name) {
+			res = append(res, i.GroupHosts(name)...)
+		}
+	}
+	for _, host := range i.Hosts() {
+		if match(host) {
+			res = append(res, host)
+		}
+	}
+	return lo.Uniq(res)
+}
+
+func parseInventories(fsys fs.FS, project *AnsibleProject, paths []string) Inventory {
+	inventory := NewInventory()
+
+	if len(paths) == 0 {
+		paths = project.cfg.Inventory
+	}
+
+	if len(paths) == 0 {
+		paths = []string{defaultInventoryPath, filepath.Join(project.path, "inventory")}
+	}
 
 	for _, inventoryPath := range paths {
-		entries, _ := fs.ReadDir(fsys, inventoryPath) // TODO handle error
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
+		if !filepath.IsAbs(inventoryPath) && !strings.HasPrefix(inventoryPath, project.path) {
+			inventoryPath = filepath.Join(project.path, inventoryPath)
+		}
+		inventory.Merge(parseInventory(fsys, inventoryPath))
+	}
 
-			f, err := fsys.Open(filepath.Join(inventoryPath, entry.Name()))
-			if err != nil {
-				return
-			}
-			defer f.Close() // TODO
+	// the variables from group_vars and host_vars relative to the playbook directory
+	// take precedence over the variables relative to the inventory
+	inventory.Merge(parseInventoryVarsDirs(fsys, project.path))
 
-			switch filepath.Ext(entry.Name()) {
-			case "yml", "yaml":
-				_ = parseYAMLInventory(f)
-			case "": // TODO ini?
-				_ = parseINIInventory(f)
-			}
-			// TODO merge inventories
+	return inventory
+}
+
+func parseInventory(fsys fs.FS, inventoryPath string) Inventory {
+	inventory := NewInventory()
+
+	info, err := fs.Stat(fsys, inventoryPath)
+	if err != nil {
+		return inventory
+	}
+
+	if !info.IsDir() {
+		inventory.Merge(parseInventoryFile(fsys, inventoryPath))
+		inventory.Merge(parseInventoryVarsDirs(fsys, filepath.Dir(inventoryPath)))
+		return inventory
+	}
+
+	entries, err := fs.ReadDir(fsys, inventoryPath)
+	if err != nil {
+		log.Printf("Failed to read inventory dir %q: %s", inventoryPath, err)
+		return inventory
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
 		}
+		inventory.Merge(parseInventoryFile(fsys, filepath.Join(inventoryPath, entry.Name())))
+	}
+	inventory.Merge(parseInventoryVarsDirs(fsys, inventoryPath))
+
+	return inventory
+}
 
+func parseInventoryFile(fsys fs.FS, filePath string) Inventory {
+	f, err := fsys.Open(filePath)
+	if err != nil {
+		log.Printf("Failed to open inventory %q: %s", filePath, err)
+		return NewInventory()
 	}
+	defer f.Close()
 
+	switch filepath.Ext(filePath) {
+	case ".yml", ".yaml", ".json":
+		return parseYAMLInventory(f)
+	case "", ".ini":
+		return parseINIInventory(f)
+	}
+	return NewInventory()
 }
 
+// parseInventoryVarsDirs parses the group_vars and host_vars directories
+// located in the given directory.
+func parseInventoryVarsDirs(fsys fs.FS, dir string) Inventory {
+	inventory := NewInventory()
+
+	groupVars, err := parseGroupVars(fsys, dir)
+	if err != nil {
+		log.Printf("Failed to parse group vars in %q: %s", dir, err)
+	}
+	for groupName, vars := range groupVars {
+		inventory.AddGroupVars(groupName, vars)
+	}
+
+	hostVars, err := parseHostsVars(fsys, dir)
+	if err != nil {
+		log.Printf("Failed to parse host vars in %q: %s", dir, err)
+	}
+	for host, vars := range hostVars {
+		inventory.AddHostVars(host, vars)
+	}
+
+	return inventory
+}
+
+type yamlInventoryGroup struct {
+	Hosts    map[string]Variables          `yaml:"hosts"`
+	Children map[string]yamlInventoryGroup `yaml:"children"`
+	Vars     Variables                     `yaml:"vars"`
+}
+
+// https://docs.ansible.com/ansible/latest/collections/ansible/builtin/yaml_inventory.html
 func parseYAMLInventory(r io.Reader) Inventory {
 	inventory := NewInventory()
+
+	var groups map[string]yamlInventoryGroup
+	if err := yaml.NewDecoder(r).Decode(&groups); err != nil {
+		log.Printf("Failed to decode YAML inventory: %s", err)
+		return inventory
+	}
+
+	for groupName, group := range groups {
+		addYAMLInventoryGroup(&inventory, groupName, group)
+	}
+
 	return inventory
 }
 
+func addYAMLInventoryGroup(inventory *Inventory, groupName string, group yamlInventoryGroup) {
+	inventory.group(groupName)
+	inventory.AddHosts(groupName, lo.Keys(group.Hosts))
+	for host, vars := range group.Hosts {
+		inventory.AddHostVars(host, vars)
+	}
+
+	if group.Vars != nil {
+		inventory.AddGroupVars(groupName, group.Vars)
+	}
+
+	for childName, child := range group.Children {
+		if groupName != allGroup {
+			inventory.AddChildren(groupName, []string{childName})
+		}
+		addYAMLInventoryGroup(inventory, childName, child)
+	}
+}
+
 func parseINIInventory(r io.Reader) Inventory {
 	inventory := NewInventory()
 
 	conf, err := ini.LoadSources(ini.LoadOptions{
 		AllowBooleanKeys:   true,
-		KeyValueDelimiters: " ",
+		KeyValueDelimiters: "= ",
 	}, r)
 	if err != nil {
 		return inventory
@@ -126,8 +484,6 @@ func parseINIInventory(r io.Reader) Inventory {
 
 	vars := make(map[string]*ini.Section)
 
-	// TODO resolve all group
-
 	for _, section := range conf.Sections() {
 		if groupName, ok := strings.CutSuffix(section.Name(), ":vars"); ok {
 			vars[groupName] = section
@@ -139,8 +495,8 @@ func parseINIInventory(r io.Reader) Inventory {
 			inventory.AddChildren(groupName, children)
 		} else {
 			groupName := section.Name()
-			if groupName == "DEFAULT" {
-				groupName = "ungrouped"
+			if groupName == ini.DefaultSection {
+				groupName = ungroupedGroup
 			}
 			var hosts []string
 			for _, key := range section.Keys() {
@@ -148,7 +504,7 @@ func parseINIInventory(r io.Reader) Inventory {
 				// TODO handle quotes
 				// https://docs.ansible.com/ansible/latest/inventory_guide/intro_inventory.html#defining-variables-in-ini-format
 				variables := strings.Split(key.Value(), " ")
-				hostVars := make(map[string]string)
+				hostVars := make(Variables)
 				for _, variable := range variables {
 					parts := strings.SplitN(variable, "=", 2)
 					if len(parts) != 2 {
@@ -160,55 +516,72 @@ func parseINIInventory(r io.Reader) Inventory {
 
 				hosts = append(hosts, host)
 			}
-			inventory.AddHosts(groupName, hosts)
+			if len(hosts) > 0 || groupName != ungroupedGroup {
+				inventory.AddHosts(groupName, hosts)
+			}
 		}
 	}
 
-	for groupName, secrion := range vars {
-		inventory.AddGroupVars(groupName, secrion.KeysHash())
+	for groupName, section := range vars {
+		groupVars := make(Variables)
+		for k, v := range section.KeysHash() {
+			groupVars[k] = strings.TrimSpace(strings.TrimPrefix(v, "="))
+		}
+		inventory.AddGroupVars(groupName, groupVars)
 	}
 
 	return inventory
 }
 
-func parseGroupVars(fsys fs.FS, path string) (map[string]map[string]string, error) {
+func parseGroupVars(fsys fs.FS, path string) (map[string]Variables, error) {
 	return parseInventoryVars(fsys, filepath.Join(path, "group_vars"))
 }
 
-func parseHostsVars(fsys fs.FS, path string) (map[string]map[string]string, error) {
+func parseHostsVars(fsys fs.FS, path string) (map[string]Variables, error) {
 	return parseInventoryVars(fsys, filepath.Join(path, "host_vars"))
 }
 
-func parseInventoryVars(fsys fs.FS, path string) (map[string]map[string]string, error) {
-	vars := make(map[string]map[string]string)
+func parseInventoryVars(fsys fs.FS, root string) (map[string]Variables, error) {
+	vars := make(map[string]Variables)
+	if _, err := fs.Stat(fsys, root); err != nil {
+		return vars, nil
+	}
+
 	walkFn := func(path string, d fs.DirEntry) error {
 		if d.IsDir() {
 			return nil
 		}
-		parts := strings.Split(path, string(os.PathSeparator))
-		if len(parts) < 2 {
-			return nil
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
 		}
 		// host or group
-		name := parts[1]
+		name, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		if !strings.Contains(filepath.ToSlash(rel), "/") {
+			name = cutExtension(name)
+		}
 
 		ext := filepath.Ext(path)
-		if !slices.Contains([]string{"", "yml", "yaml", "json"}, ext) {
+		if !slices.Contains([]string{"", ".yml", ".yaml", ".json"}, ext) {
 			return nil
 		}
 		f, err := fsys.Open(path)
 		if err != nil {
 			return err
 		}
+		defer f.Close()
 
-		var v map[string]string
-		if err := yaml.NewDecoder(f).Decode(&v); err != nil {
-			return err
+		// the nested dictionaries are decoded as map[string]any, as in the other variables
+		var v map[string]any
+		if err := yaml.NewDecoder(f).Decode(&v); err != nil && !errors.Is(err, io.EOF) {
+			// a broken file does not affect the variables of the other files
+			log.Printf("Failed to decode variables from %q: %s", path, err)
+			return nil
 		}
-		vars[name] = v
+		vars[name] = lo.Assign(vars[name], Variables(v))
 		return nil
 	}
-	err := doublestar.GlobWalk(fsys, filepath.Join(path, "**"), walkFn, doublestar.WithFilesOnly())
+	err := doublestar.GlobWalk(fsys, filepath.Join(root, "**"), walkFn, doublestar.WithFilesOnly())
 	if err != nil {
 		return nil, err
 	}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,7 +17,77 @@ func TestParseINIInventory(t *testing.T) {
 	defer f.Close()
 
 	inventory := parseINIInventory(f)
-	_ = inventory
+
+	assert.Equal(t, []string{"host1", "host2", "host3", "host4", "host5"}, inventory.Hosts())
+	assert.Equal(t, []string{"host1", "host2", "host3", "host4", "host5"}, inventory.GroupHosts("southeast"))
+	assert.Equal(t, []string{"atlanta", "raleigh", "southeast"}, inventory.GroupNames("host2"))
+
+	vars := inventory.HostVars("host1")
+	assert.Equal(t, "foo", vars["node_name"])
+	assert.Equal(t, "30", vars["halon_system_timeout"])
+}
+
+func TestParseYAMLInventory(t *testing.T) {
+	src := `all:
+  hosts:
+    mail.example.com:
+  vars:
+    ntp_server: ntp.example.com
+  children:
+    webservers:
+      hosts:
+        foo.example.com:
+          http_port: 8080
+        bar.example.com:
+      vars:
+        http_port: 80
+    dbservers:
+      hosts:
+        one.example.com:
+`
+	inventory := parseYAMLInventory(strings.NewReader(src))
+
+	assert.Equal(t, []string{
+		"bar.example.com", "foo.example.com", "mail.example.com", "one.example.com",
+	}, inventory.Hosts())
+	assert.Equal(t, []string{"mail.example.com"}, inventory.GroupHosts("ungrouped"))
+	assert.Equal(t, []string{"webservers"}, inventory.GroupNames("foo.example.com"))
+
+	assert.Equal(t, Variables{
+		"ntp_server": "ntp.example.com",
+		"http_port":  8080,
+	}, inventory.HostVars("foo.example.com"))
+	assert.Equal(t, 80, inventory.HostVars("bar.example.com")["http_port"])
+}
+
+func TestResolveHosts(t *testing.T) {
+	inventory := NewInventory()
+	inventory.AddHosts("webservers", []string{"web1", "web2"})
+	inventory.AddHosts("dbservers", []string{"db1", "web2"})
+	inventory.AddHosts("staging", []string{"web1", "db1"})
+
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{pattern: "all", expected: []string{"db1", "web1", "web2"}},
+		{pattern: "webservers", expected: []string{"web1", "web2"}},
+		{pattern: "webservers:dbservers", expected: []string{"web1", "web2", "db1"}},
+		{pattern: "webservers,db1", expected: []string{"web1", "web2", "db1"}},
+		{pattern: "webservers:!staging", expected: []string{"web2"}},
+		{pattern: "webservers:&staging", expected: []string{"web1"}},
+		{pattern: "web*", expected: []string{"web1", "web2"}},
+		{pattern: "~db\\d", expected: []string{"db1"}},
+		{pattern: "localhost", expected: []string{"localhost"}},
+		{pattern: "unknown", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got := inventory.ResolveHosts(tt.pattern)
+			assert.ElementsMatch(t, tt.expected, got)
+		})
+	}
 }
 
 func TestParseHostVars(t *testing.T) {
@@ -24,10 +96,57 @@ func TestParseHostVars(t *testing.T) {
 	vars, err := parseHostsVars(fsys, ".")
 	require.NoError(t, err)
 
-	expected := map[string]map[string]string{
+	expected := map[string]Variables{
 		"host1": {
 			"node_name": "foo1",
 		},
 	}
 	assert.Equal(t, expected, vars)
 }
+
+func TestTypedGroupVars(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: web
+  tasks:
+    - name: Configure
+      debug:
+        msg: configure
+`),
+		},
+		"inventory/hosts": {
+			Data: []byte(`[web]
+web1
+`),
+		},
+		"inventory/group_vars/web.yaml": {
+			Data: []byte(`---
+count: 3
+ports: [80, 443]
+tls:
+  enabled: true
+`),
+		},
+		"inventory/group_vars/all/broken.yaml": {Data: []byte(`: [`)},
+		"inventory/host_vars/web1.yaml":        {Data: []byte(`weight: 10`)},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasksForHost("web1")
+	require.Len(t, tasks, 1)
+	vars := tasks[0].getVars()
+
+	hostvars := vars["hostvars"].(map[string]any)["web1"].(map[string]any)
+	assert.Equal(t, 3, hostvars["count"])
+	assert.Equal(t, []any{80, 443}, hostvars["ports"])
+	assert.Equal(t, map[string]any{"enabled": true}, hostvars["tls"])
+	assert.Equal(t, 10, hostvars["weight"])
+
+	res, err := NewTemplater(fsys, nil, WithNativeTemplates(true)).
+		EvaluateValue("{{ hostvars['web1'].count + 1 }}", vars)
+	require.NoError(t, err)
+	assert.Equal(t, 4, res)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+)
+
+// parseIPValue parses an IP address or a network in the CIDR notation.
+// A plain address is treated as a host network, e.g. 10.0.0.1/32.
+func parseIPValue(s string) (netip.Prefix, bool) {
+	s = strings.TrimSpace(s)
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix, true
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+// queryIP applies the ipaddr query to the prefix. The second value
+// reports whether the value passes the query.
+func queryIP(s string, prefix netip.Prefix, query string) (any, bool, error) {
+	addr := prefix.Addr()
+	switch query {
+	case "":
+		return s, true, nil
+	case "address":
+		return addr.String(), true, nil
+	case "network":
+		return prefix.Masked().Addr().String(), true, nil
+	case "cidr", "subnet":
+		return prefix.Masked().String(), true, nil
+	case "prefix":
+		return prefix.Bits(), true, nil
+	case "netmask":
+		return prefixMask(prefix).String(), true, nil
+	case "broadcast":
+		if !addr.Is4() || prefix.Bits() >= 31 {
+			return nil, false, nil
+		}
+		return lastAddr(prefix).String(), true, nil
+	case "size":
+		size := new(big.Int).Lsh(big.NewInt(1), uint(addr.BitLen()-prefix.Bits()))
+		if size.IsInt64() {
+			return int(size.Int64()), true, nil
+		}
+		return size.String(), true, nil
+	case "host":
+		if prefix.Bits() == addr.BitLen() || addr != prefix.Masked().Addr() {
+			return prefix.String(), true, nil
+		}
+		return nil, false, nil
+	case "net":
+		if prefix.Bits() < addr.BitLen() && addr == prefix.Masked().Addr() {
+			return prefix.String(), true, nil
+		}
+		return nil, false, nil
+	case "private":
+		if addr.IsPrivate() {
+			return s, true, nil
+		}
+		return nil, false, nil
+	case "public":
+		if addr.IsGlobalUnicast() && !addr.IsPrivate() {
+			return s, true, nil
+		}
+		return nil, false, nil
+	case "loopback":
+		if addr.IsLoopback() {
+			return s, true, nil
+		}
+		return nil, false, nil
+	case "ipv4", "ipv6":
+		if (query == "ipv4") == addr.Is4() {
+			return s, true, nil
+		}
+		return nil, false, nil
+	}
+	return nil, false, fmt.Errorf("ipaddr: unsupported query %q", query)
+}
+
+func prefixMask(prefix netip.Prefix) netip.Addr {
+	bytes := make([]byte, prefix.Addr().BitLen()/8)
+	for i := 0; i < prefix.Bits(); i++ {
+		bytes[i/8] |= 0x80 >> (i % 8)
+	}
+	mask, _ := netip.AddrFromSlice(bytes)
+	return mask
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Masked().Addr().AsSlice()
+	for i := prefix.Bits(); i < len(bytes)*8; i++ {
+		bytes[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+// ipFilter applies the query to a single value or filters a list of values.
+func ipFilter(val any, query string) (any, error) {
+	if items, ok := normalize(val).([]any); ok {
+		res := []any{}
+		for _, item := range items {
+			v, err := ipFilter(item, query)
+			if err != nil {
+				return nil, err
+			}
+			if v != false {
+				res = append(res, v)
+			}
+		}
+		return res, nil
+	}
+
+	s := toString(val)
+	prefix, ok := parseIPValue(s)
+	if !ok {
+		return false, nil
+	}
+	res, ok, err := queryIP(s, prefix, query)
+	if err != nil || !ok {
+		return false, err
+	}
+	return res, nil
+}
+
+func filterIPAddr(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	return ipFilter(val, toString(arg(args, kwargs, 0, "query", "")))
+}
+
+func filterIPVersion(version int) filterFunc {
+	return func(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+		res, err := ipFilter(val, fmt.Sprintf("ipv%d", version))
+		if err != nil || res == false {
+			return res, err
+		}
+		if query := toString(arg(args, kwargs, 0, "query", "")); query != "" {
+			return ipFilter(res, query)
+		}
+		return res, nil
+	}
+}
@@ -0,0 +1,1001 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxTemplateDepth limits the nesting of variables that reference
+// other variables in their values.
+const maxTemplateDepth = 50
+
+type evalContext struct {
+	templater *JinjaTemplater
+	vars      Variables
+	scopes    []map[string]any
+	depth     int
+
+	// partial enables the partial evaluation, in which the expressions
+	// that cannot be evaluated are left as is instead of failing the template.
+	partial  bool
+	unknowns []Unknown
+
+	// convert enables the conversion of the rendered template to a native value.
+	convert bool
+	// lastOutput is the value of the last rendered expression.
+	lastOutput any
+}
+
+func (c *evalContext) render(nodes []jinjaNode, sb *strings.Builder) error {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *textNode:
+			sb.WriteString(n.text)
+		case *outputNode:
+			val, err := c.eval(n.expr)
+			if err != nil {
+				if !c.partial {
+					return err
+				}
+				val = Unknown{Reason: err.Error()}
+				var unknownErr *UnknownValueError
+				if errors.As(err, &unknownErr) {
+					val = unknownErr.Value
+				}
+			}
+			// the unnamed undefined values, e.g. of an inline if without
+			// an else branch, render as empty strings
+			if u, ok := val.(undefined); ok && c.partial && u.name != "" {
+				val = Unknown{Reason: fmt.Sprintf("%q is undefined", u.name)}
+			}
+			// the undefined items of containers, e.g. of the extract
+			// filter results, cannot be rendered
+			if _, ok := val.(undefined); !ok {
+				if u, ok := findUndefined(val); ok {
+					if !c.partial {
+						return checkDefined(u)
+					}
+					val = Unknown{Reason: checkDefined(u).Error()}
+				}
+			}
+			if u, ok := findUnknown(val); ok {
+				if !c.partial {
+					return &UnknownValueError{Value: u}
+				}
+				u.Expr, u.Offset = n.src, n.pos
+				c.unknowns = append(c.unknowns, u)
+				sb.WriteString(n.src)
+				continue
+			}
+			c.lastOutput = val
+			sb.WriteString(toString(val))
+		case *ifNode:
+			if err := c.renderIf(n, sb); err != nil {
+				return err
+			}
+		case *forNode:
+			if err := c.renderFor(n, sb); err != nil {
+				return err
+			}
+		case *setNode:
+			val, err := c.eval(n.expr)
+			if err != nil {
+				return err
+			}
+			if err := c.assign(c.scopes[len(c.scopes)-1], n.targets, val); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported node %T", node)
+		}
+	}
+	return nil
+}
+
+func (c *evalContext) renderIf(n *ifNode, sb *strings.Builder) error {
+	for _, branch := range n.branches {
+		cond, err := c.eval(branch.cond)
+		if err != nil {
+			return err
+		}
+		if u, ok := cond.(Unknown); ok {
+			return &UnknownValueError{Value: u}
+		}
+		if err := checkDefined(cond); err != nil {
+			return err
+		}
+		if isTruthy(cond) {
+			return c.render(branch.body, sb)
+		}
+	}
+	return c.render(n.elseBody, sb)
+}
+
+func (c *evalContext) renderFor(n *forNode, sb *strings.Builder) error {
+	iterVal, err := c.eval(n.iter)
+	if err != nil {
+		return err
+	}
+	if u, ok := iterVal.(Unknown); ok {
+		return &UnknownValueError{Value: u}
+	}
+	if err := checkDefined(iterVal); err != nil {
+		return err
+	}
+	items, err := toList(iterVal)
+	if err != nil {
+		return err
+	}
+
+	scope := make(map[string]any)
+	c.scopes = append(c.scopes, scope)
+	defer func() {
+		c.scopes = c.scopes[:len(c.scopes)-1]
+	}()
+
+	if n.cond != nil {
+		var filtered []any
+		for _, item := range items {
+			if err := c.assign(scope, n.targets, item); err != nil {
+				return err
+			}
+			cond, err := c.eval(n.cond)
+			if err != nil {
+				return err
+			}
+			if u, ok := cond.(Unknown); ok {
+				return &UnknownValueError{Value: u}
+			}
+			if err := checkDefined(cond); err != nil {
+				return err
+			}
+			if isTruthy(cond) {
+				filtered = append(filtered, item)
+			}
+		}
+		items = filtered
+	}
+
+	if len(items) == 0 {
+		return c.render(n.elseBody, sb)
+	}
+
+	for i, item := range items {
+		if err := c.assign(scope, n.targets, item); err != nil {
+			return err
+		}
+		scope["loop"] = loopVars(items, i)
+		if err := c.render(n.body, sb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loopVars(items []any, i int) map[string]any {
+	res := map[string]any{
+		"index":     i + 1,
+		"index0":    i,
+		"revindex":  len(items) - i,
+		"revindex0": len(items) - i - 1,
+		"first":     i == 0,
+		"last":      i == len(items)-1,
+		"length":    len(items),
+	}
+	if i > 0 {
+		res["previtem"] = items[i-1]
+	}
+	if i < len(items)-1 {
+		res["nextitem"] = items[i+1]
+	}
+	return res
+}
+
+func (c *evalContext) assign(scope map[string]any, targets []string, val any) error {
+	if len(targets) == 1 {
+		scope[targets[0]] = val
+		return nil
+	}
+	items, err := toList(val)
+	if err != nil {
+		return err
+	}
+	if len(items) != len(targets) {
+		return fmt.Errorf("cannot unpack %d values into %d targets", len(items), len(targets))
+	}
+	for i, target := range targets {
+		scope[target] = items[i]
+	}
+	return nil
+}
+
+func (c *evalContext) eval(expr jinjaExpr) (any, error) {
+	switch e := expr.(type) {
+	case *literalExpr:
+		return e.val, nil
+	case *nameExpr:
+		return c.lookup(e.name)
+	case *listExpr:
+		items, err := c.evalList(e.items)
+		if err != nil {
+			return nil, err
+		}
+		return checkItems(items)
+	case *dictExpr:
+		res := make(map[string]any, len(e.keys))
+		for i := range e.keys {
+			key, err := c.eval(e.keys[i])
+			if err != nil {
+				return nil, err
+			}
+			val, err := c.eval(e.values[i])
+			if err != nil {
+				return nil, err
+			}
+			res[toString(key)] = val
+		}
+		return checkItems(res)
+	case *getattrExpr:
+		obj, err := c.eval(e.obj)
+		if err != nil {
+			return nil, err
+		}
+		return c.resolveLazy(getAttr(obj, e.name))
+	case *getitemExpr:
+		obj, err := c.eval(e.obj)
+		if err != nil {
+			return nil, err
+		}
+		key, err := c.eval(e.key)
+		if err != nil {
+			return nil, err
+		}
+		val, err := getItem(obj, key)
+		if err != nil {
+			return nil, err
+		}
+		return c.resolveLazy(val)
+	case *sliceExpr:
+		return c.evalSlice(e)
+	case *callExpr:
+		return c.evalCall(e)
+	case *filterExpr:
+		return c.evalFilter(e)
+	case *testExpr:
+		return c.evalTest(e)
+	case *unaryExpr:
+		return c.evalUnary(e)
+	case *binaryExpr:
+		return c.evalBinary(e)
+	case *compareExpr:
+		return c.evalCompare(e)
+	case *condExpr:
+		cond, err := c.eval(e.cond)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := cond.(Unknown); ok {
+			return cond, nil
+		}
+		if err := checkDefined(cond); err != nil {
+			return nil, err
+		}
+		if isTruthy(cond) {
+			return c.eval(e.expr)
+		}
+		if e.elseExpr == nil {
+			return undefined{}, nil
+		}
+		return c.eval(e.elseExpr)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", expr)
+}
+
+func (c *evalContext) evalList(exprs []jinjaExpr) ([]any, error) {
+	res := make([]any, 0, len(exprs))
+	for _, expr := range exprs {
+		val, err := c.eval(expr)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+// checkItems returns the list or dict literal, the unknown value if any
+// of its items is unknown, or an error if any of its items is undefined.
+func checkItems(items any) (any, error) {
+	if u, ok := findUnknown(items); ok {
+		return u, nil
+	}
+	if u, ok := findUndefined(items); ok {
+		return nil, checkDefined(u)
+	}
+	return items, nil
+}
+
+func (c *evalContext) lookup(name string) (any, error) {
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if val, exists := c.scopes[i][name]; exists {
+			return val, nil
+		}
+	}
+	if val, exists := c.vars[name]; exists {
+		return c.resolveLazy(val)
+	}
+	if fn, exists := jinjaGlobals[name]; exists {
+		return fn, nil
+	}
+	return undefined{name: name}, nil
+}
+
+// resolveLazy renders the templates contained in the value of a variable,
+// since variables in Ansible can reference other variables.
+func (c *evalContext) resolveLazy(val any) (any, error) {
+	if !containsTemplate(val) {
+		return val, nil
+	}
+	if c.depth >= maxTemplateDepth {
+		return nil, errors.New("maximum template nesting depth exceeded, probably a recursive variable")
+	}
+
+	switch v := val.(type) {
+	case string:
+		nested := &evalContext{templater: c.templater, vars: c.vars, depth: c.depth + 1, partial: c.partial, convert: true}
+		res, err := nested.evaluate(v)
+		var unknownErr *UnknownValueError
+		if errors.As(err, &unknownErr) {
+			return unknownErr.Value, nil
+		}
+		return res, err
+	case []any:
+		res := make([]any, len(v))
+		for i, item := range v {
+			rendered, err := c.resolveLazy(item)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = rendered
+		}
+		return res, nil
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for k, item := range v {
+			rendered, err := c.resolveLazy(item)
+			if err != nil {
+				return nil, err
+			}
+			res[k] = rendered
+		}
+		return res, nil
+	}
+	return val, nil
+}
+
+// evaluate renders the template source. In the partial evaluation mode
+// the result is Unknown if any of the expressions cannot be evaluated.
+func (c *evalContext) evaluate(src string) (any, error) {
+	return c.evaluateWithOptions(src, defaultTemplateOptions())
+}
+
+// evaluateWithOptions renders the template source parsed with the options.
+func (c *evalContext) evaluateWithOptions(src string, opts templateOptions) (any, error) {
+	nodes, err := c.templater.compile(src, opts)
+	if err != nil {
+		return c.unknownTemplate(src, err)
+	}
+	return c.renderTemplate(src, nodes)
+}
+
+func (c *evalContext) renderTemplate(src string, nodes []jinjaNode) (any, error) {
+	c.scopes = []map[string]any{make(map[string]any)}
+	c.unknowns = nil
+	var sb strings.Builder
+	if err := c.render(nodes, &sb); err != nil {
+		return c.unknownTemplate(src, err)
+	}
+	if len(c.unknowns) > 0 {
+		res := c.unknowns[0]
+		res.Partial = sb.String()
+		return res, nil
+	}
+	if c.convert {
+		return c.convertResult(nodes, sb.String()), nil
+	}
+	return sb.String(), nil
+}
+
+// unknownTemplate returns the error or, in the partial evaluation mode,
+// the unknown value for the whole template.
+func (c *evalContext) unknownTemplate(src string, err error) (any, error) {
+	if !c.partial {
+		return nil, err
+	}
+	res := Unknown{Expr: src, Partial: src, Reason: err.Error()}
+	var unknownErr *UnknownValueError
+	if errors.As(err, &unknownErr) {
+		res.Reason = unknownErr.Value.Reason
+	}
+	return res, nil
+}
+
+// containsTemplate reports whether the value contains any template tags
+// with the default delimiters.
+func containsTemplate(val any) bool {
+	switch v := val.(type) {
+	case string:
+		return defaultTemplateOptions().containsTag(v)
+	case []any:
+		for _, item := range v {
+			if containsTemplate(item) {
+				return true
+			}
+		}
+	case map[string]any:
+		for _, item := range v {
+			if containsTemplate(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func getAttr(obj any, name string) any {
+	switch v := normalize(obj).(type) {
+	case map[string]any:
+		if val, exists := v[name]; exists {
+			return val
+		}
+	case undefined:
+		return undefined{name: v.name + "." + name}
+	case Unknown:
+		return v
+	}
+	if method := getMethod(obj, name); method != nil {
+		return method
+	}
+	return undefined{name: name}
+}
+
+func getItem(obj any, key any) (any, error) {
+	switch v := normalize(obj).(type) {
+	case map[string]any:
+		if val, exists := v[toString(key)]; exists {
+			return val, nil
+		}
+		return undefined{name: toString(key)}, nil
+	case []any:
+		idx, ok := normalize(key).(int)
+		if !ok {
+			return nil, fmt.Errorf("list indices must be integers, not %s", typeName(key))
+		}
+		if idx < 0 {
+			idx += len(v)
+		}
+		if idx < 0 || idx >= len(v) {
+			return undefined{name: fmt.Sprintf("[%d]", idx)}, nil
+		}
+		return v[idx], nil
+	case string:
+		idx, ok := normalize(key).(int)
+		if !ok {
+			return nil, fmt.Errorf("string indices must be integers, not %s", typeName(key))
+		}
+		runes := []rune(v)
+		if idx < 0 {
+			idx += len(runes)
+		}
+		if idx < 0 || idx >= len(runes) {
+			return undefined{name: fmt.Sprintf("[%d]", idx)}, nil
+		}
+		return string(runes[idx]), nil
+	case undefined:
+		return undefined{name: v.name + "[" + toString(key) + "]"}, nil
+	case Unknown:
+		return v, nil
+	}
+	if name, ok := key.(string); ok {
+		return getAttr(obj, name), nil
+	}
+	return undefined{}, nil
+}
+
+func (c *evalContext) evalSlice(e *sliceExpr) (any, error) {
+	obj, err := c.eval(e.obj)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := make([]*int, 3)
+	for i, expr := range []jinjaExpr{e.start, e.stop, e.step} {
+		if expr == nil {
+			continue
+		}
+		val, err := c.eval(expr)
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			continue
+		}
+		n, ok := normalize(val).(int)
+		if !ok {
+			return nil, errors.New("slice indices must be integers or None")
+		}
+		bounds[i] = &n
+	}
+
+	switch v := normalize(obj).(type) {
+	case []any:
+		return sliceItems(v, bounds[0], bounds[1], bounds[2])
+	case string:
+		runes := make([]any, 0, len(v))
+		for _, r := range v {
+			runes = append(runes, string(r))
+		}
+		items, err := sliceItems(runes, bounds[0], bounds[1], bounds[2])
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		for _, item := range items {
+			sb.WriteString(item.(string))
+		}
+		return sb.String(), nil
+	}
+	return nil, fmt.Errorf("'%s' object is not subscriptable", typeName(obj))
+}
+
+func sliceItems(items []any, start, stop, step *int) ([]any, error) {
+	n := len(items)
+	st := 1
+	if step != nil {
+		st = *step
+	}
+	if st == 0 {
+		return nil, errors.New("slice step cannot be zero")
+	}
+
+	clamp := func(idx *int, def int, lower, upper int) int {
+		if idx == nil {
+			return def
+		}
+		i := *idx
+		if i < 0 {
+			i += n
+		}
+		return max(lower, min(i, upper))
+	}
+
+	var res []any
+	if st > 0 {
+		from, to := clamp(start, 0, 0, n), clamp(stop, n, 0, n)
+		for i := from; i < to; i += st {
+			res = append(res, items[i])
+		}
+	} else {
+		from, to := clamp(start, n-1, -1, n-1), clamp(stop, -1, -1, n-1)
+		for i := from; i > to; i += st {
+			res = append(res, items[i])
+		}
+	}
+	if res == nil {
+		res = []any{}
+	}
+	return res, nil
+}
+
+func (c *evalContext) evalArgs(args []jinjaExpr, kwargs map[string]jinjaExpr) ([]any, map[string]any, error) {
+	argVals, err := c.evalList(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	kwargVals := make(map[string]any, len(kwargs))
+	for name, expr := range kwargs {
+		val, err := c.eval(expr)
+		if err != nil {
+			return nil, nil, err
+		}
+		kwargVals[name] = val
+	}
+	return argVals, kwargVals, nil
+}
+
+func (c *evalContext) evalCall(e *callExpr) (any, error) {
+	fnVal, err := c.eval(e.fn)
+	if err != nil {
+		return nil, err
+	}
+	args, kwargs, err := c.evalArgs(e.args, e.kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := findUnknown(append([]any{fnVal}, args...)); ok {
+		return u, nil
+	}
+	fn, ok := fnVal.(jinjaFunc)
+	if !ok {
+		if u, ok := fnVal.(undefined); ok {
+			return nil, fmt.Errorf("%q is undefined", u.name)
+		}
+		return nil, fmt.Errorf("'%s' object is not callable", typeName(fnVal))
+	}
+	return fn(c, args, kwargs)
+}
+
+func (c *evalContext) evalFilter(e *filterExpr) (any, error) {
+	val, err := c.eval(e.expr)
+	if err != nil {
+		return nil, err
+	}
+	args, kwargs, err := c.evalArgs(e.args, e.kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := findUnknown(append([]any{val}, args...)); ok {
+		return u, nil
+	}
+	if _, exists := c.lookupFilter(e.name); !exists {
+		return lookupResult(missingPlugin("filter", e.name))
+	}
+	if u, ok := val.(undefined); ok {
+		if _, accepts := undefinedFilters[pluginShortName(e.name)]; !accepts {
+			return nil, fmt.Errorf("%q is undefined", u.name)
+		}
+	}
+	return c.applyFilter(e.name, val, args, kwargs)
+}
+
+func (c *evalContext) evalTest(e *testExpr) (any, error) {
+	val, err := c.eval(e.expr)
+	if err != nil {
+		return nil, err
+	}
+	args, kwargs, err := c.evalArgs(e.args, e.kwargs)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := findUnknown(append([]any{val}, args...)); ok {
+		return u, nil
+	}
+	if _, exists := c.lookupTest(e.name); !exists {
+		return lookupResult(missingPlugin("test", e.name))
+	}
+	name := pluginShortName(e.name)
+	if u, ok := val.(undefined); ok {
+		if _, isResult := resultTests[name]; isResult {
+			return Unknown{Reason: fmt.Sprintf("%q is undefined, the result of a task is not known offline", u.name)}, nil
+		}
+		if _, accepts := undefinedTests[name]; !accepts {
+			return nil, fmt.Errorf("%q is undefined", u.name)
+		}
+	}
+	if err := checkDefined(args...); err != nil {
+		return nil, err
+	}
+
+	ok, err := c.applyTest(e.name, val, args, kwargs)
+	if err != nil {
+		return lookupResult(err)
+	}
+	return ok != e.negated, nil
+}
+
+func (c *evalContext) applyFilter(name string, val any, args []any, kwargs map[string]any) (any, error) {
+	filter, exists := c.lookupFilter(name)
+	if !exists {
+		return nil, missingPlugin("filter", name)
+	}
+	return filter(c, val, args, kwargs)
+}
+
+func (c *evalContext) applyTest(name string, val any, args []any, kwargs map[string]any) (bool, error) {
+	test, exists := c.lookupTest(name)
+	if !exists {
+		return false, missingPlugin("test", name)
+	}
+	return test(c, val, args, kwargs)
+}
+
+func (c *evalContext) evalUnary(e *unaryExpr) (any, error) {
+	val, err := c.eval(e.expr)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := val.(Unknown); ok {
+		return val, nil
+	}
+	switch e.op {
+	case "not":
+		if err := checkDefined(val); err != nil {
+			return nil, err
+		}
+		return !isTruthy(val), nil
+	case "-", "+":
+		f, isFloat, ok := toNumber(val)
+		if !ok {
+			return nil, fmt.Errorf("bad operand type for unary %s: '%s'", e.op, typeName(val))
+		}
+		if e.op == "-" {
+			f = -f
+		}
+		if isFloat {
+			return f, nil
+		}
+		return int(f), nil
+	}
+	return nil, fmt.Errorf("unsupported unary operator %q", e.op)
+}
+
+func (c *evalContext) evalBinary(e *binaryExpr) (any, error) {
+	left, err := c.eval(e.left)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := left.(Unknown); ok {
+		return left, nil
+	}
+
+	switch e.op {
+	case "and", "or":
+		if err := checkDefined(left); err != nil {
+			return nil, err
+		}
+	}
+
+	switch e.op {
+	case "and":
+		if !isTruthy(left) {
+			return left, nil
+		}
+		return c.eval(e.right)
+	case "or":
+		if isTruthy(left) {
+			return left, nil
+		}
+		return c.eval(e.right)
+	}
+
+	right, err := c.eval(e.right)
+	if err != nil {
+		return nil, err
+	}
+	return binaryOp(e.op, left, right)
+}
+
+func binaryOp(op string, left, right any) (any, error) {
+	left, right = normalize(left), normalize(right)
+
+	if u, ok := findUnknown([]any{left, right}); ok {
+		return u, nil
+	}
+	if err := checkDefined(left, right); err != nil {
+		return nil, err
+	}
+
+	if op == "~" {
+		return toString(left) + toString(right), nil
+	}
+
+	lf, lFloat, lok := toNumber(left)
+	rf, rFloat, rok := toNumber(right)
+	if lok && rok {
+		return arithmetic(op, lf, rf, lFloat || rFloat)
+	}
+
+	switch op {
+	case "+":
+		switch l := left.(type) {
+		case string:
+			if r, ok := right.(string); ok {
+				return l + r, nil
+			}
+		case []any:
+			if r, ok := right.([]any); ok {
+				res := make([]any, 0, len(l)+len(r))
+				return append(append(res, l...), r...), nil
+			}
+		}
+	case "*":
+		if s, ok := left.(string); ok && rok && !rFloat {
+			return strings.Repeat(s, max(0, int(rf))), nil
+		}
+		if l, ok := left.([]any); ok && rok && !rFloat {
+			var res []any
+			for i := 0; i < int(rf); i++ {
+				res = append(res, l...)
+			}
+			return res, nil
+		}
+	case "%":
+		if s, ok := left.(string); ok {
+			return formatPercent(s, right)
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported operand type(s) for %s: '%s' and '%s'", op, typeName(left), typeName(right))
+}
+
+// checkDefined returns an error if any of the operands is undefined.
+func checkDefined(operands ...any) error {
+	for _, operand := range operands {
+		if u, ok := operand.(undefined); ok {
+			return fmt.Errorf("%q is undefined", u.name)
+		}
+	}
+	return nil
+}
+
+func arithmetic(op string, l, r float64, isFloat bool) (any, error) {
+	var res float64
+	switch op {
+	case "+":
+		res = l + r
+	case "-":
+		res = l - r
+	case "*":
+		res = l * r
+	case "/":
+		if r == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return l / r, nil
+	case "//":
+		if r == 0 {
+			return nil, errors.New("integer division or modulo by zero")
+		}
+		res = math.Floor(l / r)
+	case "%":
+		if r == 0 {
+			return nil, errors.New("integer division or modulo by zero")
+		}
+		res = l - r*math.Floor(l/r)
+	case "**":
+		res = math.Pow(l, r)
+		if r < 0 {
+			return res, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", op)
+	}
+	// the integers that overflow, e.g. "2 ** 100", fall back to floats
+	// instead of the arbitrary-precision integers of Python
+	if isFloat || res >= math.MaxInt64 || res <= math.MinInt64 || math.IsNaN(res) {
+		return res, nil
+	}
+	return int(res), nil
+}
+
+// formatPercent implements the printf-style string formatting with the "%" operator,
+// including the flags, the width and the precision, e.g. "%05d" or "%-10s".
+func formatPercent(format string, arg any) (string, error) {
+	args, ok := normalize(arg).([]any)
+	if !ok {
+		args = []any{arg}
+	}
+
+	var sb strings.Builder
+	argIdx := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		if format[i] == '%' {
+			sb.WriteByte('%')
+			continue
+		}
+
+		// the conversion spec is passed to fmt, which has the same flags
+		start := i
+		for i < len(format) && strings.IndexByte("-+ 0#", format[i]) >= 0 {
+			i++
+		}
+		for i < len(format) && (isDigit(format[i]) || format[i] == '.') {
+			i++
+		}
+		if i >= len(format) {
+			return "", errors.New("incomplete format")
+		}
+		spec, verb := "%"+format[start:i], format[i]
+
+		if argIdx >= len(args) {
+			return "", errors.New("not enough arguments for format string")
+		}
+		val := args[argIdx]
+		argIdx++
+		switch verb {
+		case 's':
+			fmt.Fprintf(&sb, spec+"s", toString(val))
+		case 'r':
+			fmt.Fprintf(&sb, spec+"s", repr(val))
+		case 'd', 'i', 'x', 'X', 'o':
+			n, ok := toInt(val)
+			if !ok {
+				return "", fmt.Errorf("%%%c format: a number is required, not %s", verb, typeName(val))
+			}
+			if verb == 'i' {
+				verb = 'd'
+			}
+			fmt.Fprintf(&sb, spec+string(verb), n)
+		case 'f', 'F', 'e', 'E', 'g', 'G':
+			f, ok := toFloat(val)
+			if !ok {
+				return "", fmt.Errorf("%%%c format: a number is required, not %s", verb, typeName(val))
+			}
+			if !strings.Contains(spec, ".") {
+				// Python defaults to 6 digits of precision, while fmt prints
+				// "%g" with the smallest precision that represents the value
+				spec += ".6"
+			}
+			fmt.Fprintf(&sb, spec+string(verb), f)
+		default:
+			return "", fmt.Errorf("unsupported format character %q", verb)
+		}
+	}
+	return sb.String(), nil
+}
+
+func (c *evalContext) evalCompare(e *compareExpr) (any, error) {
+	left, err := c.eval(e.left)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range e.ops {
+		right, err := c.eval(e.exprs[i])
+		if err != nil {
+			return nil, err
+		}
+		if u, ok := findUnknown([]any{left, right}); ok {
+			return u, nil
+		}
+		if err := checkDefined(left, right); err != nil {
+			return nil, err
+		}
+		ok, err := compareOp(op, left, right)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return false, nil
+		}
+		left = right
+	}
+	return true, nil
+}
+
+func compareOp(op string, left, right any) (bool, error) {
+	switch op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	case "in":
+		return containsValue(right, left)
+	case "not in":
+		ok, err := containsValue(right, left)
+		return !ok, err
+	}
+
+	cmp, err := compareValues(left, right)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("unsupported comparison operator %q", op)
+}
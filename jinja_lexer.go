@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenText
+	tokenVariableBegin
+	tokenVariableEnd
+	tokenBlockBegin
+	tokenBlockEnd
+	tokenName
+	tokenString
+	tokenInteger
+	tokenFloat
+	tokenOperator
+)
+
+const (
+	variableBegin = "{{"
+	variableEnd   = "}}"
+	blockBegin    = "{%"
+	blockEnd      = "%}"
+	commentBegin  = "{#"
+	commentEnd    = "#}"
+)
+
+type token struct {
+	typ tokenType
+	val string
+	// pos is the offset of the token in the template source
+	pos int
+}
+
+func (t token) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of template"
+	case tokenVariableEnd, tokenBlockEnd:
+		return t.val
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+// templateOptions are the options of the Jinja2 environment
+// that affect how templates are parsed.
+type templateOptions struct {
+	variableStart string
+	variableEnd   string
+	blockStart    string
+	blockEnd      string
+	commentStart  string
+	commentEnd    string
+	// trimBlocks removes the first newline after a block or comment tag.
+	trimBlocks bool
+	// lstripBlocks strips tabs and spaces from the beginning
+	// of a line to a block or comment tag.
+	lstripBlocks bool
+}
+
+// defaultTemplateOptions returns the options used by Ansible for templating.
+func defaultTemplateOptions() templateOptions {
+	return templateOptions{
+		variableStart: variableBegin,
+		variableEnd:   variableEnd,
+		blockStart:    blockBegin,
+		blockEnd:      blockEnd,
+		commentStart:  commentBegin,
+		commentEnd:    commentEnd,
+		trimBlocks:    true,
+	}
+}
+
+// containsTag reports whether the source contains the start of a variable,
+// block or comment tag.
+func (o templateOptions) containsTag(src string) bool {
+	return strings.Contains(src, o.variableStart) ||
+		strings.Contains(src, o.blockStart) ||
+		strings.Contains(src, o.commentStart)
+}
+
+// operators sorted by length, so that the longest operator is matched first
+var jinjaOperators = []string{
+	"//", "**", "==", "!=", "<=", ">=",
+	"+", "-", "*", "/", "%", "~", "<", ">", "=", "(", ")", "[", "]", "{", "}",
+	".", ",", ":", "|",
+}
+
+type lexer struct {
+	src    string
+	pos    int
+	tokens []token
+	opts   templateOptions
+
+	// trimNext is set when the previous tag ends with "-" and the
+	// leading whitespace of the next text must be removed
+	trimNext bool
+	// trimNewline is set when the previous tag is a block tag and
+	// the newline after it must be removed because of trim_blocks
+	trimNewline bool
+}
+
+// tokenize splits the Jinja2 template source into tokens.
+func tokenize(src string, opts templateOptions) ([]token, error) {
+	l := &lexer{src: src, opts: opts}
+	if err := l.run(); err != nil {
+		return nil, err
+	}
+	return l.tokens, nil
+}
+
+func (l *lexer) emit(typ tokenType, val string, pos int) {
+	l.tokens = append(l.tokens, token{typ: typ, val: val, pos: pos})
+}
+
+func (l *lexer) run() error {
+	for l.pos < len(l.src) {
+		idx, tag := l.nextTag()
+		if idx == -1 {
+			l.emitText(l.src[l.pos:], l.pos)
+			l.pos = len(l.src)
+			break
+		}
+
+		isBlock := tag != l.opts.variableStart
+		text := l.src[l.pos:idx]
+		after := idx + len(tag)
+		var modifier byte
+		if after < len(l.src) && (l.src[after] == '-' || (isBlock && l.src[after] == '+')) {
+			modifier = l.src[after]
+		}
+		switch {
+		case modifier == '-':
+			text = strings.TrimRightFunc(text, unicode.IsSpace)
+		case modifier != '+' && isBlock && l.opts.lstripBlocks:
+			text = l.lstripLine(text, l.pos)
+		}
+		l.emitText(text, l.pos)
+		l.pos = after
+		if modifier != 0 {
+			l.pos++
+		}
+
+		var err error
+		switch tag {
+		case l.opts.commentStart:
+			err = l.lexComment(idx)
+		case l.opts.variableStart:
+			l.emit(tokenVariableBegin, tag, idx)
+			err = l.lexCode(l.opts.variableEnd, tokenVariableEnd)
+		case l.opts.blockStart:
+			if l.isRawBlock() {
+				err = l.lexRaw(idx)
+			} else {
+				l.emit(tokenBlockBegin, tag, idx)
+				err = l.lexCode(l.opts.blockEnd, tokenBlockEnd)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	l.emit(tokenEOF, "", len(l.src))
+	return nil
+}
+
+// nextTag returns the offset and the delimiter of the next tag.
+func (l *lexer) nextTag() (int, string) {
+	res, resTag := -1, ""
+	for _, tag := range []string{l.opts.variableStart, l.opts.blockStart, l.opts.commentStart} {
+		if idx := strings.Index(l.src[l.pos:], tag); idx != -1 && (res == -1 || l.pos+idx < res) {
+			res, resTag = l.pos+idx, tag
+		}
+	}
+	return res, resTag
+}
+
+// lstripLine removes the tabs and spaces at the end of the text
+// if they start the line, as the lstrip_blocks option does.
+func (l *lexer) lstripLine(text string, pos int) string {
+	lineStart := strings.LastIndexByte(text, '\n') + 1
+	if lineStart == 0 && pos > 0 && l.src[pos-1] != '\n' {
+		return text
+	}
+	if strings.Trim(text[lineStart:], " \t") != "" {
+		return text
+	}
+	return text[:lineStart]
+}
+
+// endTag handles the modifier before the end delimiter of a tag.
+func (l *lexer) endTag(modifier byte, isBlock bool) {
+	switch {
+	case modifier == '-':
+		l.trimNext = true
+	case modifier != '+' && isBlock && l.opts.trimBlocks:
+		l.trimNewline = true
+	}
+}
+
+func (l *lexer) emitText(text string, pos int) {
+	if l.trimNewline {
+		l.trimNewline = false
+		if trimmed, ok := strings.CutPrefix(text, "\n"); ok {
+			pos++
+			text = trimmed
+		} else if trimmed, ok := strings.CutPrefix(text, "\r\n"); ok {
+			pos += 2
+			text = trimmed
+		}
+	}
+	if l.trimNext {
+		trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+		pos += len(text) - len(trimmed)
+		text = trimmed
+		l.trimNext = false
+	}
+	if text != "" {
+		l.emit(tokenText, text, pos)
+	}
+}
+
+func (l *lexer) lexComment(start int) error {
+	idx := strings.Index(l.src[l.pos:], l.opts.commentEnd)
+	if idx == -1 {
+		return fmt.Errorf("unclosed comment at offset %d", start)
+	}
+	end := l.pos + idx
+	l.endTag(l.src[max(end-1, 0)], true)
+	l.pos = end + len(l.opts.commentEnd)
+	return nil
+}
+
+func (l *lexer) isRawBlock() bool {
+	rest := strings.TrimLeft(l.src[l.pos:], " \t\n\r-+")
+	return strings.HasPrefix(rest, "raw") && strings.HasPrefix(strings.TrimLeft(rest[3:], " \t\n\r-+"), l.opts.blockEnd)
+}
+
+func (l *lexer) lexRaw(start int) error {
+	blockStart, blockEnd := l.opts.blockStart, l.opts.blockEnd
+	end := strings.Index(l.src[l.pos:], blockEnd)
+	l.endTag(l.src[l.pos+end-1], true)
+	l.pos += end + len(blockEnd)
+
+	for searchFrom := l.pos; ; {
+		idx := strings.Index(l.src[searchFrom:], blockStart)
+		if idx == -1 {
+			return fmt.Errorf("unclosed raw block at offset %d", start)
+		}
+		tagStart := searchFrom + idx
+		inner := strings.TrimLeft(l.src[tagStart+len(blockStart):], "-+ \t\n\r")
+		if !strings.HasPrefix(inner, "endraw") {
+			searchFrom = tagStart + len(blockStart)
+			continue
+		}
+		text := l.src[l.pos:tagStart]
+		switch modifier := l.src[tagStart+len(blockStart)]; {
+		case modifier == '-':
+			text = strings.TrimRightFunc(text, unicode.IsSpace)
+		case modifier != '+' && l.opts.lstripBlocks:
+			text = l.lstripLine(text, l.pos)
+		}
+		l.emitText(text, l.pos)
+		closing := strings.Index(l.src[tagStart:], blockEnd)
+		if closing == -1 {
+			return fmt.Errorf("unclosed raw block at offset %d", start)
+		}
+		closing += tagStart
+		l.endTag(l.src[closing-1], true)
+		l.pos = closing + len(blockEnd)
+		return nil
+	}
+}
+
+func (l *lexer) lexCode(end string, endType tokenType) error {
+	// the end tag is only recognized outside of brackets,
+	// so that "{{ {'a': {'b': 1}} }}" is a valid expression
+	depth := 0
+	for {
+		l.skipSpaces()
+		if l.pos >= len(l.src) {
+			return fmt.Errorf("unexpected end of template, expected %q", end)
+		}
+
+		isBlock := endType == tokenBlockEnd
+		if depth == 0 && (strings.HasPrefix(l.src[l.pos:], "-"+end) || (isBlock && strings.HasPrefix(l.src[l.pos:], "+"+end))) {
+			l.emit(endType, end, l.pos)
+			l.endTag(l.src[l.pos], isBlock)
+			l.pos += len(end) + 1
+			return nil
+		}
+		if depth == 0 && strings.HasPrefix(l.src[l.pos:], end) {
+			l.emit(endType, end, l.pos)
+			l.endTag(0, isBlock)
+			l.pos += len(end)
+			return nil
+		}
+
+		c := l.src[l.pos]
+		switch {
+		case c == '"' || c == '\'':
+			if err := l.lexString(c); err != nil {
+				return err
+			}
+		case isDigit(c):
+			l.lexNumber()
+		case isNameStart(c):
+			start := l.pos
+			for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+				l.pos++
+			}
+			l.emit(tokenName, l.src[start:l.pos], start)
+		default:
+			if !l.lexOperator() {
+				return fmt.Errorf("unexpected char %q at offset %d", c, l.pos)
+			}
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				depth = max(0, depth-1)
+			}
+		}
+	}
+}
+
+func (l *lexer) skipSpaces() {
+	for l.pos < len(l.src) && unicode.IsSpace(rune(l.src[l.pos])) {
+		l.pos++
+	}
+}
+
+func (l *lexer) lexOperator() bool {
+	for _, op := range jinjaOperators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.emit(tokenOperator, op, l.pos)
+			l.pos += len(op)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *lexer) lexNumber() {
+	start := l.pos
+	typ := tokenInteger
+	for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '_') {
+		l.pos++
+	}
+	if l.pos+1 < len(l.src) && l.src[l.pos] == '.' && isDigit(l.src[l.pos+1]) {
+		typ = tokenFloat
+		l.pos++
+		for l.pos < len(l.src) && (isDigit(l.src[l.pos]) || l.src[l.pos] == '_') {
+			l.pos++
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		next := l.pos + 1
+		if next < len(l.src) && (l.src[next] == '+' || l.src[next] == '-') {
+			next++
+		}
+		if next < len(l.src) && isDigit(l.src[next]) {
+			typ = tokenFloat
+			l.pos = next
+			for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+				l.pos++
+			}
+		}
+	}
+	l.emit(typ, strings.ReplaceAll(l.src[start:l.pos], "_", ""), start)
+}
+
+func (l *lexer) lexString(quote byte) error {
+	start := l.pos
+	l.pos++
+	var sb strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == quote:
+			l.pos++
+			l.emit(tokenString, sb.String(), start)
+			return nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.pos++
+			sb.WriteString(unescapeChar(l.src[l.pos]))
+		default:
+			sb.WriteByte(c)
+		}
+		l.pos++
+	}
+	return fmt.Errorf("unterminated string at offset %d", start)
+}
+
+func unescapeChar(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	case '\\', '\'', '"':
+		return string(c)
+	}
+	return "\\" + string(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || isDigit(c)
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// jinjaGlobals are the functions available in all templates.
+var jinjaGlobals = map[string]jinjaFunc{
+	"range":  globalRange,
+	"lookup": globalLookup,
+	"query":  globalQuery,
+	"q":      globalQuery,
+	"dict": func(_ *evalContext, args []any, kwargs map[string]any) (any, error) {
+		res := make(map[string]any, len(kwargs))
+		if len(args) > 0 {
+			items, err := dictFromItems(args[0])
+			if err != nil {
+				return nil, err
+			}
+			res = items
+		}
+		for k, v := range kwargs {
+			res[k] = v
+		}
+		return res, nil
+	},
+}
+
+func globalRange(_ *evalContext, args []any, _ map[string]any) (any, error) {
+	ints := make([]int, len(args))
+	for i, arg := range args {
+		n, ok := normalize(arg).(int)
+		if !ok {
+			return nil, fmt.Errorf("range() arguments must be integers, not %s", typeName(arg))
+		}
+		ints[i] = n
+	}
+
+	start, stop, step := 0, 0, 1
+	switch len(ints) {
+	case 1:
+		stop = ints[0]
+	case 2:
+		start, stop = ints[0], ints[1]
+	case 3:
+		start, stop, step = ints[0], ints[1], ints[2]
+	default:
+		return nil, fmt.Errorf("range expected 1 to 3 arguments, got %d", len(args))
+	}
+	if step == 0 {
+		return nil, errors.New("range() arg 3 must not be zero")
+	}
+
+	res := []any{}
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+func dictFromItems(val any) (map[string]any, error) {
+	if m, ok := normalize(val).(map[string]any); ok {
+		return m, nil
+	}
+	items, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]any, len(items))
+	for _, item := range items {
+		pair, ok := normalize(item).([]any)
+		if !ok || len(pair) != 2 {
+			return nil, errors.New("dictionary update sequence element must be a pair")
+		}
+		res[toString(pair[0])] = pair[1]
+	}
+	return res, nil
+}
+
+// getMethod returns the Python method of the value with the given name bound
+// to the value, or nil if the value has no such method.
+func getMethod(obj any, name string) jinjaFunc {
+	switch v := normalize(obj).(type) {
+	case string:
+		return stringMethod(v, name)
+	case map[string]any:
+		return dictMethod(v, name)
+	case []any:
+		return listMethod(v, name)
+	}
+	return nil
+}
+
+func stringArg(args []any, idx int, def string) string {
+	if idx < len(args) && args[idx] != nil {
+		return toString(args[idx])
+	}
+	return def
+}
+
+func stringMethod(s string, name string) jinjaFunc {
+	var fn func(args []any) (any, error)
+	switch name {
+	case "lower":
+		fn = func([]any) (any, error) { return strings.ToLower(s), nil }
+	case "upper":
+		fn = func([]any) (any, error) { return strings.ToUpper(s), nil }
+	case "capitalize":
+		fn = func([]any) (any, error) { return capitalize(s), nil }
+	case "title":
+		fn = func([]any) (any, error) { return title(s), nil }
+	case "strip", "lstrip", "rstrip":
+		fn = func(args []any) (any, error) {
+			cutset := stringArg(args, 0, "")
+			return stripString(s, name, cutset), nil
+		}
+	case "startswith":
+		fn = func(args []any) (any, error) {
+			return matchAffix(s, args, strings.HasPrefix)
+		}
+	case "endswith":
+		fn = func(args []any) (any, error) {
+			return matchAffix(s, args, strings.HasSuffix)
+		}
+	case "split":
+		fn = func(args []any) (any, error) {
+			limit := -1
+			if len(args) > 1 {
+				if n, ok := toInt(args[1]); ok && n >= 0 {
+					limit = n + 1
+				}
+			}
+			return splitString(s, stringArg(args, 0, ""), limit), nil
+		}
+	case "replace":
+		fn = func(args []any) (any, error) {
+			if len(args) < 2 {
+				return nil, errors.New("replace() takes at least 2 arguments")
+			}
+			count := -1
+			if len(args) > 2 {
+				count, _ = toInt(args[2])
+			}
+			return strings.Replace(s, toString(args[0]), toString(args[1]), count), nil
+		}
+	case "find", "index":
+		fn = func(args []any) (any, error) {
+			idx := strings.Index(s, stringArg(args, 0, ""))
+			if idx == -1 && name == "index" {
+				return nil, errors.New("substring not found")
+			}
+			return idx, nil
+		}
+	case "count":
+		fn = func(args []any) (any, error) { return strings.Count(s, stringArg(args, 0, "")), nil }
+	case "join":
+		fn = func(args []any) (any, error) {
+			if len(args) == 0 {
+				return nil, errors.New("join() takes exactly one argument")
+			}
+			items, err := toList(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return joinValues(items, s), nil
+		}
+	case "isdigit":
+		fn = func([]any) (any, error) {
+			return s != "" && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) == -1, nil
+		}
+	case "isalpha":
+		fn = func([]any) (any, error) {
+			return s != "" && strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) }) == -1, nil
+		}
+	case "format":
+		return func(_ *evalContext, args []any, kwargs map[string]any) (any, error) {
+			return formatBraces(s, args, kwargs)
+		}
+	case "splitlines":
+		fn = func([]any) (any, error) {
+			res := []any{}
+			for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+				res = append(res, strings.TrimSuffix(line, "\r"))
+			}
+			if s == "" {
+				return []any{}, nil
+			}
+			return res, nil
+		}
+	default:
+		return nil
+	}
+	return func(_ *evalContext, args []any, _ map[string]any) (any, error) {
+		return fn(args)
+	}
+}
+
+func matchAffix(s string, args []any, match func(string, string) bool) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("expected at least 1 argument")
+	}
+	if affixes, ok := normalize(args[0]).([]any); ok {
+		for _, affix := range affixes {
+			if match(s, toString(affix)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return match(s, toString(args[0])), nil
+}
+
+func stripString(s, method, cutset string) string {
+	trim := func(string) string { return s }
+	if cutset == "" {
+		switch method {
+		case "strip":
+			trim = strings.TrimSpace
+		case "lstrip":
+			trim = func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }
+		case "rstrip":
+			trim = func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }
+		}
+		return trim(s)
+	}
+	switch method {
+	case "strip":
+		return strings.Trim(s, cutset)
+	case "lstrip":
+		return strings.TrimLeft(s, cutset)
+	}
+	return strings.TrimRight(s, cutset)
+}
+
+// splitString splits the string as the Python str.split method does.
+func splitString(s, sep string, limit int) []any {
+	var parts []string
+	if sep == "" {
+		parts = strings.Fields(s)
+		if limit > 0 && len(parts) > limit {
+			// keep the remainder of the string intact
+			fields := strings.Fields(s)
+			rest := s
+			for i := 0; i < limit-1; i++ {
+				rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+				rest = rest[len(fields[i]):]
+			}
+			parts = append(fields[:limit-1], strings.TrimLeftFunc(rest, unicode.IsSpace))
+		}
+	} else {
+		parts = strings.SplitN(s, sep, limit)
+	}
+	res := make([]any, len(parts))
+	for i, part := range parts {
+		res[i] = part
+	}
+	return res
+}
+
+// formatBraces implements the Python str.format method for positional
+// and keyword fields without format specifications.
+func formatBraces(format string, args []any, kwargs map[string]any) (string, error) {
+	var sb strings.Builder
+	autoIdx := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c == '{' && i+1 < len(format) && format[i+1] == '{' {
+			sb.WriteByte('{')
+			i++
+			continue
+		}
+		if c == '}' && i+1 < len(format) && format[i+1] == '}' {
+			sb.WriteByte('}')
+			i++
+			continue
+		}
+		if c != '{' {
+			sb.WriteByte(c)
+			continue
+		}
+		end := strings.IndexByte(format[i:], '}')
+		if end == -1 {
+			return "", errors.New("single '{' encountered in format string")
+		}
+		field, _, _ := strings.Cut(format[i+1:i+end], ":")
+		i += end
+
+		var val any
+		switch {
+		case field == "":
+			if autoIdx >= len(args) {
+				return "", errors.New("replacement index out of range")
+			}
+			val = args[autoIdx]
+			autoIdx++
+		case isDigit(field[0]):
+			idx, ok := toInt(field)
+			if !ok || idx >= len(args) {
+				return "", errors.New("replacement index out of range")
+			}
+			val = args[idx]
+		default:
+			v, exists := kwargs[field]
+			if !exists {
+				return "", fmt.Errorf("missing format argument %q", field)
+			}
+			val = v
+		}
+		sb.WriteString(toString(val))
+	}
+	return sb.String(), nil
+}
+
+func dictMethod(m map[string]any, name string) jinjaFunc {
+	switch name {
+	case "items":
+		return func(*evalContext, []any, map[string]any) (any, error) {
+			return dictItems(m), nil
+		}
+	case "keys":
+		return func(*evalContext, []any, map[string]any) (any, error) {
+			return toList(m)
+		}
+	case "values":
+		return func(*evalContext, []any, map[string]any) (any, error) {
+			res := make([]any, 0, len(m))
+			for _, k := range sortedKeys(m) {
+				res = append(res, m[k])
+			}
+			return res, nil
+		}
+	case "get":
+		return func(_ *evalContext, args []any, _ map[string]any) (any, error) {
+			if len(args) == 0 {
+				return nil, errors.New("get expected at least 1 argument")
+			}
+			if val, exists := m[toString(args[0])]; exists {
+				return val, nil
+			}
+			if len(args) > 1 {
+				return args[1], nil
+			}
+			return nil, nil
+		}
+	case "copy":
+		return func(*evalContext, []any, map[string]any) (any, error) {
+			return cloneValue(m), nil
+		}
+	}
+	return nil
+}
+
+func dictItems(m map[string]any) []any {
+	res := make([]any, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		res = append(res, []any{k, m[k]})
+	}
+	return res
+}
+
+func listMethod(l []any, name string) jinjaFunc {
+	switch name {
+	case "index":
+		return func(_ *evalContext, args []any, _ map[string]any) (any, error) {
+			if len(args) == 0 {
+				return nil, errors.New("index expected at least 1 argument")
+			}
+			for i, item := range l {
+				if valuesEqual(item, args[0]) {
+					return i, nil
+				}
+			}
+			return nil, fmt.Errorf("%s is not in list", repr(args[0]))
+		}
+	case "count":
+		return func(_ *evalContext, args []any, _ map[string]any) (any, error) {
+			if len(args) == 0 {
+				return nil, errors.New("count expected 1 argument")
+			}
+			n := 0
+			for _, item := range l {
+				if valuesEqual(item, args[0]) {
+					n++
+				}
+			}
+			return n, nil
+		}
+	}
+	return nil
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	runes := []rune(strings.ToLower(s))
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func title(s string) string {
+	runes := []rune(s)
+	prevLetter := false
+	for i, r := range runes {
+		if unicode.IsLetter(r) {
+			if prevLetter {
+				runes[i] = unicode.ToLower(r)
+			} else {
+				runes[i] = unicode.ToUpper(r)
+			}
+			prevLetter = true
+		} else {
+			prevLetter = unicode.IsDigit(r) || r == '\''
+		}
+	}
+	return string(runes)
+}
+
+func joinValues(items []any, sep string) string {
+	parts := make([]string, len(items))
+	for i, item := range items {
+		parts[i] = toString(item)
+	}
+	return strings.Join(parts, sep)
+}
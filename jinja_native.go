@@ -0,0 +1,128 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// pythonInteger and pythonFloat match the number literals of Python, which
+// unlike Jinja2 does not accept decimal integers with leading zeros.
+var (
+	pythonInteger = regexp.MustCompile(`^(?:0(?:_?0)*|[1-9](?:_?[0-9])*)$`)
+	pythonFloat   = regexp.MustCompile(`^[0-9](?:_?[0-9])*(?:\.[0-9](?:_?[0-9])*)?(?:[eE][+-]?[0-9](?:_?[0-9])*)?$`)
+)
+
+// convertResult converts the rendered template to a native value, as Ansible
+// does with the result of every template.
+//
+// By default, the result that looks like a list, a dict or a boolean is
+// converted with the Python literal evaluation. With the native types enabled
+// (the "jinja2_native" setting), the value of a template that consists of
+// a single expression is kept as is, and any other result is converted if it
+// is a Python literal.
+//
+// See https://github.com/ansible/ansible/blob/devel/lib/ansible/template/native_helpers.py
+func (c *evalContext) convertResult(nodes []jinjaNode, out string) any {
+	if c.templater.nativeTypes() {
+		if len(nodes) == 1 {
+			if _, ok := nodes[0].(*outputNode); ok {
+				switch v := c.lastOutput.(type) {
+				case string:
+					out = v
+				case undefined:
+				default:
+					return v
+				}
+			}
+		}
+		if val, ok := literalEval(out); ok {
+			return val
+		}
+		return out
+	}
+
+	if strings.HasPrefix(out, "{") || strings.HasPrefix(out, "[") || out == "True" || out == "False" {
+		if val, ok := literalEval(out); ok {
+			return val
+		}
+	}
+	return out
+}
+
+// literalEval evaluates the Python literal (a string, number, boolean, None,
+// list, tuple or dict of literals), as ast.literal_eval does.
+func literalEval(src string) (any, bool) {
+	if src == "" || strings.TrimSpace(src) != src {
+		return nil, false
+	}
+	wrapped := variableBegin + src + variableEnd
+	tokens, err := tokenize(wrapped, defaultTemplateOptions())
+	if err != nil {
+		return nil, false
+	}
+	for i, tok := range tokens {
+		switch tok.typ {
+		case tokenName:
+			// Jinja2 accepts lowercase constants, but Python does not
+			if tok.val != "True" && tok.val != "False" && tok.val != "None" {
+				return nil, false
+			}
+		case tokenInteger, tokenFloat:
+			if i+1 >= len(tokens) {
+				return nil, false
+			}
+			// the token value has the underscores removed, so the raw
+			// source of the number is checked
+			raw := strings.TrimSpace(wrapped[tok.pos:tokens[i+1].pos])
+			if tok.typ == tokenInteger && !pythonInteger.MatchString(raw) ||
+				tok.typ == tokenFloat && !pythonFloat.MatchString(raw) {
+				return nil, false
+			}
+		}
+	}
+
+	nodes, err := parseTemplate(wrapped, defaultTemplateOptions())
+	if err != nil || len(nodes) != 1 {
+		return nil, false
+	}
+	output, ok := nodes[0].(*outputNode)
+	if !ok || !isLiteralExpr(output.expr) {
+		return nil, false
+	}
+	val, err := (&evalContext{}).eval(output.expr)
+	if err != nil {
+		return nil, false
+	}
+	return val, true
+}
+
+func isLiteralExpr(expr jinjaExpr) bool {
+	switch e := expr.(type) {
+	case *literalExpr:
+		return true
+	case *listExpr:
+		for _, item := range e.items {
+			if !isLiteralExpr(item) {
+				return false
+			}
+		}
+		return true
+	case *dictExpr:
+		for i := range e.keys {
+			if !isLiteralExpr(e.keys[i]) || !isLiteralExpr(e.values[i]) {
+				return false
+			}
+		}
+		return true
+	case *unaryExpr:
+		lit, ok := e.expr.(*literalExpr)
+		if !ok {
+			return false
+		}
+		switch lit.val.(type) {
+		case int, float64:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,900 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jinjaNode is a node of the template body.
+type jinjaNode any
+
+type textNode struct {
+	text string
+}
+
+type outputNode struct {
+	expr jinjaExpr
+	// src is the source of the expression including the delimiters.
+	src string
+	// pos is the offset of the expression in the template.
+	pos int
+}
+
+type ifNode struct {
+	branches []ifBranch
+	elseBody []jinjaNode
+}
+
+type ifBranch struct {
+	cond jinjaExpr
+	body []jinjaNode
+}
+
+type forNode struct {
+	targets  []string
+	iter     jinjaExpr
+	cond     jinjaExpr
+	body     []jinjaNode
+	elseBody []jinjaNode
+}
+
+type setNode struct {
+	targets []string
+	expr    jinjaExpr
+}
+
+// jinjaExpr is a node of an expression.
+type jinjaExpr any
+
+type literalExpr struct {
+	val any
+}
+
+type nameExpr struct {
+	name string
+}
+
+type listExpr struct {
+	items []jinjaExpr
+}
+
+type dictExpr struct {
+	keys   []jinjaExpr
+	values []jinjaExpr
+}
+
+type getattrExpr struct {
+	obj  jinjaExpr
+	name string
+}
+
+type getitemExpr struct {
+	obj jinjaExpr
+	key jinjaExpr
+}
+
+type sliceExpr struct {
+	obj   jinjaExpr
+	start jinjaExpr
+	stop  jinjaExpr
+	step  jinjaExpr
+}
+
+type callExpr struct {
+	fn     jinjaExpr
+	args   []jinjaExpr
+	kwargs map[string]jinjaExpr
+}
+
+type filterExpr struct {
+	expr   jinjaExpr
+	name   string
+	args   []jinjaExpr
+	kwargs map[string]jinjaExpr
+}
+
+// testExpr is the "is" expression that applies a test, e.g. "x is defined".
+type testExpr struct {
+	expr    jinjaExpr
+	name    string
+	args    []jinjaExpr
+	kwargs  map[string]jinjaExpr
+	negated bool
+}
+
+type unaryExpr struct {
+	op   string
+	expr jinjaExpr
+}
+
+type binaryExpr struct {
+	op    string
+	left  jinjaExpr
+	right jinjaExpr
+}
+
+type compareExpr struct {
+	left  jinjaExpr
+	ops   []string
+	exprs []jinjaExpr
+}
+
+type condExpr struct {
+	cond     jinjaExpr
+	expr     jinjaExpr
+	elseExpr jinjaExpr
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+	opts   templateOptions
+}
+
+// parseTemplate parses the Jinja2 template source into a list of nodes.
+func parseTemplate(src string, opts templateOptions) ([]jinjaNode, error) {
+	tokens, err := tokenize(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens, opts: opts}
+	body, end, err := p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	if end != "" {
+		return nil, fmt.Errorf("unexpected tag %q", end)
+	}
+	return body, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.typ != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isOperator(ops ...string) bool {
+	tok := p.peek()
+	if tok.typ != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if tok.val == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) isName(names ...string) bool {
+	tok := p.peek()
+	if tok.typ != tokenName {
+		return false
+	}
+	for _, name := range names {
+		if tok.val == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(typ tokenType, val string) error {
+	tok := p.next()
+	if tok.typ != typ || (val != "" && tok.val != val) {
+		return fmt.Errorf("unexpected %s at offset %d, expected %q", tok, tok.pos, val)
+	}
+	return nil
+}
+
+func (p *parser) expectName() (string, error) {
+	tok := p.next()
+	if tok.typ != tokenName {
+		return "", fmt.Errorf("unexpected %s at offset %d, expected name", tok, tok.pos)
+	}
+	return tok.val, nil
+}
+
+// parseBody parses nodes until the end of the template or until a block
+// tag that is not a statement (e.g. "endif" or "else"). The name of this tag
+// is returned and the block tag is left open.
+func (p *parser) parseBody() ([]jinjaNode, string, error) {
+	var body []jinjaNode
+	for {
+		tok := p.next()
+		switch tok.typ {
+		case tokenEOF:
+			return body, "", nil
+		case tokenText:
+			body = append(body, &textNode{text: tok.val})
+		case tokenVariableBegin:
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, "", err
+			}
+			end := p.peek()
+			if err := p.expect(tokenVariableEnd, p.opts.variableEnd); err != nil {
+				return nil, "", err
+			}
+			endPos := end.pos + strings.Index(p.src[end.pos:], end.val) + len(end.val)
+			body = append(body, &outputNode{expr: expr, src: p.src[tok.pos:endPos], pos: tok.pos})
+		case tokenBlockBegin:
+			name, err := p.expectName()
+			if err != nil {
+				return nil, "", err
+			}
+			var node jinjaNode
+			switch name {
+			case "if":
+				node, err = p.parseIf()
+			case "for":
+				node, err = p.parseFor()
+			case "set":
+				node, err = p.parseSet()
+			default:
+				return body, name, nil
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			body = append(body, node)
+		default:
+			return nil, "", fmt.Errorf("unexpected %s at offset %d", tok, tok.pos)
+		}
+	}
+}
+
+func (p *parser) parseIf() (jinjaNode, error) {
+	node := &ifNode{}
+	for {
+		cond, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenBlockEnd, ""); err != nil {
+			return nil, err
+		}
+		body, end, err := p.parseBody()
+		if err != nil {
+			return nil, err
+		}
+		node.branches = append(node.branches, ifBranch{cond: cond, body: body})
+
+		switch end {
+		case "elif":
+			continue
+		case "else":
+			if err := p.expect(tokenBlockEnd, ""); err != nil {
+				return nil, err
+			}
+			node.elseBody, end, err = p.parseBody()
+			if err != nil {
+				return nil, err
+			}
+			if end != "endif" {
+				return nil, fmt.Errorf("expected 'endif', got %q", end)
+			}
+			return node, p.expect(tokenBlockEnd, "")
+		case "endif":
+			return node, p.expect(tokenBlockEnd, "")
+		default:
+			return nil, fmt.Errorf("expected 'elif', 'else' or 'endif', got %q", end)
+		}
+	}
+}
+
+func (p *parser) parseFor() (jinjaNode, error) {
+	node := &forNode{}
+	for {
+		target, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		node.targets = append(node.targets, target)
+		if !p.isOperator(",") {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expect(tokenName, "in"); err != nil {
+		return nil, err
+	}
+
+	iter, err := p.parseCondExpr(false)
+	if err != nil {
+		return nil, err
+	}
+	node.iter = iter
+
+	if p.isName("if") {
+		p.next()
+		if node.cond, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.expect(tokenBlockEnd, ""); err != nil {
+		return nil, err
+	}
+
+	body, end, err := p.parseBody()
+	if err != nil {
+		return nil, err
+	}
+	node.body = body
+
+	if end == "else" {
+		if err := p.expect(tokenBlockEnd, ""); err != nil {
+			return nil, err
+		}
+		if node.elseBody, end, err = p.parseBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	if end != "endfor" {
+		return nil, fmt.Errorf("expected 'endfor', got %q", end)
+	}
+	return node, p.expect(tokenBlockEnd, "")
+}
+
+func (p *parser) parseSet() (jinjaNode, error) {
+	node := &setNode{}
+	for {
+		target, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		node.targets = append(node.targets, target)
+		if !p.isOperator(",") {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expect(tokenOperator, "="); err != nil {
+		return nil, err
+	}
+
+	expr, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	node.expr = expr
+	return node, p.expect(tokenBlockEnd, "")
+}
+
+// parseExpression parses an expression, including tuples without parentheses.
+func (p *parser) parseExpression() (jinjaExpr, error) {
+	expr, err := p.parseCondExpr(true)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator(",") {
+		return expr, nil
+	}
+
+	items := []jinjaExpr{expr}
+	for p.isOperator(",") {
+		p.next()
+		if p.isTupleEnd() {
+			break
+		}
+		item, err := p.parseCondExpr(true)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return &listExpr{items: items}, nil
+}
+
+func (p *parser) isTupleEnd() bool {
+	tok := p.peek()
+	return tok.typ == tokenVariableEnd || tok.typ == tokenBlockEnd || tok.typ == tokenEOF ||
+		p.isOperator(")", "]", "}")
+}
+
+func (p *parser) parseCondExpr(withCond bool) (jinjaExpr, error) {
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	for withCond && p.isName("if") {
+		p.next()
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		node := &condExpr{cond: cond, expr: expr}
+		if p.isName("else") {
+			p.next()
+			if node.elseExpr, err = p.parseCondExpr(true); err != nil {
+				return nil, err
+			}
+		}
+		expr = node
+	}
+	return expr, nil
+}
+
+func (p *parser) parseOr() (jinjaExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isName("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (jinjaExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isName("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (jinjaExpr, error) {
+	if p.isName("not") {
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "not", expr: expr}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (jinjaExpr, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &compareExpr{left: left}
+	for {
+		var op string
+		switch {
+		case p.isOperator("==", "!=", "<", ">", "<=", ">="):
+			op = p.next().val
+		case p.isName("in"):
+			p.next()
+			op = "in"
+		case p.isName("not") && p.pos+1 < len(p.tokens) &&
+			p.tokens[p.pos+1].typ == tokenName && p.tokens[p.pos+1].val == "in":
+			p.pos += 2
+			op = "not in"
+		default:
+			if len(node.ops) == 0 {
+				return left, nil
+			}
+			return node, nil
+		}
+		right, err := p.parseConcat()
+		if err != nil {
+			return nil, err
+		}
+		node.ops = append(node.ops, op)
+		node.exprs = append(node.exprs, right)
+	}
+}
+
+func (p *parser) parseConcat() (jinjaExpr, error) {
+	left, err := p.parseMath1()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("~") {
+		p.next()
+		right, err := p.parseMath1()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "~", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMath1() (jinjaExpr, error) {
+	left, err := p.parseMath2()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+", "-") {
+		op := p.next().val
+		right, err := p.parseMath2()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseMath2() (jinjaExpr, error) {
+	left, err := p.parsePow()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*", "/", "//", "%") {
+		op := p.next().val
+		right, err := p.parsePow()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePow() (jinjaExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("**") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "**", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (jinjaExpr, error) {
+	if p.isOperator("-", "+") {
+		op := p.next().val
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: op, expr: expr}, nil
+	}
+
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if expr, err = p.parsePostfix(expr); err != nil {
+		return nil, err
+	}
+	return p.parseFilters(expr)
+}
+
+func (p *parser) parsePrimary() (jinjaExpr, error) {
+	tok := p.next()
+	switch tok.typ {
+	case tokenName:
+		switch tok.val {
+		case "true", "True":
+			return &literalExpr{val: true}, nil
+		case "false", "False":
+			return &literalExpr{val: false}, nil
+		case "none", "None":
+			return &literalExpr{val: nil}, nil
+		}
+		return &nameExpr{name: tok.val}, nil
+	case tokenString:
+		val := tok.val
+		// adjacent strings are concatenated
+		for p.peek().typ == tokenString {
+			val += p.next().val
+		}
+		return &literalExpr{val: val}, nil
+	case tokenInteger:
+		val, err := strconv.Atoi(tok.val)
+		if errors.Is(err, strconv.ErrRange) {
+			// the integers of Python are unbounded, so the literals that
+			// overflow int fall back to float
+			f, err := strconv.ParseFloat(tok.val, 64)
+			if err != nil {
+				return nil, err
+			}
+			return &literalExpr{val: f}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &literalExpr{val: val}, nil
+	case tokenFloat:
+		val, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &literalExpr{val: val}, nil
+	case tokenOperator:
+		switch tok.val {
+		case "(":
+			if p.isOperator(")") {
+				p.next()
+				return &listExpr{}, nil
+			}
+			expr, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expect(tokenOperator, ")")
+		case "[":
+			items, err := p.parseList("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listExpr{items: items}, nil
+		case "{":
+			return p.parseDict()
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", tok, tok.pos)
+}
+
+func (p *parser) parseList(end string) ([]jinjaExpr, error) {
+	var items []jinjaExpr
+	for !p.isOperator(end) {
+		if len(items) > 0 {
+			if err := p.expect(tokenOperator, ","); err != nil {
+				return nil, err
+			}
+			if p.isOperator(end) {
+				break
+			}
+		}
+		item, err := p.parseCondExpr(true)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	p.next()
+	return items, nil
+}
+
+func (p *parser) parseDict() (jinjaExpr, error) {
+	node := &dictExpr{}
+	for !p.isOperator("}") {
+		if len(node.keys) > 0 {
+			if err := p.expect(tokenOperator, ","); err != nil {
+				return nil, err
+			}
+			if p.isOperator("}") {
+				break
+			}
+		}
+		key, err := p.parseCondExpr(true)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenOperator, ":"); err != nil {
+			return nil, err
+		}
+		val, err := p.parseCondExpr(true)
+		if err != nil {
+			return nil, err
+		}
+		node.keys = append(node.keys, key)
+		node.values = append(node.values, val)
+	}
+	p.next()
+	return node, nil
+}
+
+func (p *parser) parsePostfix(expr jinjaExpr) (jinjaExpr, error) {
+	for {
+		switch {
+		case p.isOperator("."):
+			p.next()
+			tok := p.next()
+			if tok.typ != tokenName && tok.typ != tokenInteger {
+				return nil, fmt.Errorf("unexpected %s at offset %d, expected attribute", tok, tok.pos)
+			}
+			if tok.typ == tokenInteger {
+				idx, _ := strconv.Atoi(tok.val)
+				expr = &getitemExpr{obj: expr, key: &literalExpr{val: idx}}
+			} else {
+				expr = &getattrExpr{obj: expr, name: tok.val}
+			}
+		case p.isOperator("["):
+			p.next()
+			node, err := p.parseSubscript(expr)
+			if err != nil {
+				return nil, err
+			}
+			expr = node
+		case p.isOperator("("):
+			p.next()
+			args, kwargs, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			expr = &callExpr{fn: expr, args: args, kwargs: kwargs}
+		default:
+			return expr, nil
+		}
+	}
+}
+
+func (p *parser) parseSubscript(obj jinjaExpr) (jinjaExpr, error) {
+	var parts [3]jinjaExpr
+	idx := 0
+	isSlice := false
+	for !p.isOperator("]") {
+		if p.isOperator(":") {
+			p.next()
+			isSlice = true
+			idx++
+			if idx > 2 {
+				return nil, fmt.Errorf("invalid slice at offset %d", p.peek().pos)
+			}
+			continue
+		}
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		parts[idx] = expr
+	}
+	p.next()
+
+	if !isSlice {
+		return &getitemExpr{obj: obj, key: parts[0]}, nil
+	}
+	return &sliceExpr{obj: obj, start: parts[0], stop: parts[1], step: parts[2]}, nil
+}
+
+// parseArgs parses call arguments after the opening parenthesis.
+func (p *parser) parseArgs() ([]jinjaExpr, map[string]jinjaExpr, error) {
+	var (
+		args   []jinjaExpr
+		kwargs map[string]jinjaExpr
+	)
+	for !p.isOperator(")") {
+		if len(args) > 0 || len(kwargs) > 0 {
+			if err := p.expect(tokenOperator, ","); err != nil {
+				return nil, nil, err
+			}
+			if p.isOperator(")") {
+				break
+			}
+		}
+
+		if p.peek().typ == tokenName && p.pos+1 < len(p.tokens) &&
+			p.tokens[p.pos+1].typ == tokenOperator && p.tokens[p.pos+1].val == "=" {
+			name := p.next().val
+			p.next()
+			val, err := p.parseCondExpr(true)
+			if err != nil {
+				return nil, nil, err
+			}
+			if kwargs == nil {
+				kwargs = make(map[string]jinjaExpr)
+			}
+			kwargs[name] = val
+			continue
+		}
+
+		arg, err := p.parseCondExpr(true)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	return args, kwargs, nil
+}
+
+// parseFilters parses the filters and the tests applied to the expression.
+func (p *parser) parseFilters(expr jinjaExpr) (jinjaExpr, error) {
+	for {
+		var err error
+		switch {
+		case p.isOperator("|"):
+			p.next()
+			expr, err = p.parseFilter(expr)
+		case p.isName("is"):
+			p.next()
+			expr, err = p.parseTest(expr)
+		default:
+			return expr, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseFilter(expr jinjaExpr) (jinjaExpr, error) {
+	name, err := p.parseDottedName()
+	if err != nil {
+		return nil, err
+	}
+	node := &filterExpr{expr: expr, name: name}
+	if p.isOperator("(") {
+		p.next()
+		if node.args, node.kwargs, err = p.parseArgs(); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// parseTest parses the test after the "is" keyword. A test with a single
+// argument can be called without parentheses, e.g. "x is divisibleby 3".
+func (p *parser) parseTest(expr jinjaExpr) (jinjaExpr, error) {
+	node := &testExpr{expr: expr}
+	if p.isName("not") {
+		p.next()
+		node.negated = true
+	}
+	name, err := p.parseDottedName()
+	if err != nil {
+		return nil, err
+	}
+	node.name = name
+
+	tok := p.peek()
+	switch {
+	case p.isOperator("("):
+		p.next()
+		if node.args, node.kwargs, err = p.parseArgs(); err != nil {
+			return nil, err
+		}
+	case tok.typ == tokenString || tok.typ == tokenInteger || tok.typ == tokenFloat ||
+		p.isOperator("[", "{") || (tok.typ == tokenName && !p.isName("else", "or", "and")):
+		if p.isName("is") {
+			return nil, fmt.Errorf("unexpected %s at offset %d, cannot chain multiple tests with is", tok, tok.pos)
+		}
+		arg, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		if arg, err = p.parsePostfix(arg); err != nil {
+			return nil, err
+		}
+		node.args = []jinjaExpr{arg}
+	}
+	return node, nil
+}
+
+// parseDottedName parses a plugin name that can be fully qualified,
+// e.g. "ansible.builtin.to_json".
+func (p *parser) parseDottedName() (string, error) {
+	name, err := p.expectName()
+	if err != nil {
+		return "", err
+	}
+	for p.isOperator(".") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].typ == tokenName {
+		p.next()
+		name += "." + p.next().val
+	}
+	return name, nil
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// testFunc is the implementation of a Jinja2 test, e.g. the "defined" test.
+type testFunc func(c *evalContext, val any, args []any, kwargs map[string]any) (bool, error)
+
+// builtinTests are the Jinja2 and Ansible tests available in the "is" expressions
+// and in the "select" and "reject" filters.
+//
+// See https://jinja.palletsprojects.com/en/3.1.x/templates/#list-of-builtin-tests
+// and https://docs.ansible.com/ansible/latest/playbook_guide/playbooks_tests.html
+var builtinTests map[string]testFunc
+
+// undefinedTests are the tests that accept undefined values. The other
+// tests fail on undefined values, as with the strict undefined of Ansible.
+var undefinedTests = map[string]struct{}{
+	"defined":   {},
+	"undefined": {},
+	"none":      {},
+	"string":    {},
+	"number":    {},
+	"mapping":   {},
+	"sequence":  {},
+	"iterable":  {},
+	"boolean":   {},
+	"integer":   {},
+	"float":     {},
+	"callable":  {},
+	"sameas":    {},
+}
+
+// resultTests are the tests of registered task results. Since the results are
+// not known offline, the undefined values passed to these tests are unknown.
+var resultTests = map[string]struct{}{
+	"failed":      {},
+	"failure":     {},
+	"succeeded":   {},
+	"success":     {},
+	"successful":  {},
+	"changed":     {},
+	"change":      {},
+	"skipped":     {},
+	"skip":        {},
+	"unreachable": {},
+	"reachable":   {},
+	"finished":    {},
+	"started":     {},
+}
+
+func init() {
+	builtinTests = map[string]testFunc{
+		"defined": func(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+			return !isUndefined(val), nil
+		},
+		"undefined": func(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+			return isUndefined(val), nil
+		},
+		"none": func(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+			return val == nil, nil
+		},
+		"truthy": func(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+			return isTruthy(val), nil
+		},
+		"falsy": func(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+			return !isTruthy(val), nil
+		},
+		"string": typeTest(func(val any) bool {
+			_, ok := val.(string)
+			return ok
+		}),
+		"number": typeTest(func(val any) bool {
+			_, isBool := val.(bool)
+			return isNumber(val) && !isBool
+		}),
+		"integer": typeTest(func(val any) bool {
+			_, ok := val.(int)
+			return ok
+		}),
+		"float": typeTest(func(val any) bool {
+			_, ok := val.(float64)
+			return ok
+		}),
+		"boolean": typeTest(func(val any) bool {
+			_, ok := val.(bool)
+			return ok
+		}),
+		"mapping": typeTest(func(val any) bool {
+			_, ok := val.(map[string]any)
+			return ok
+		}),
+		"sequence": typeTest(isIterable),
+		"iterable": typeTest(isIterable),
+		"callable": typeTest(func(val any) bool {
+			_, ok := val.(jinjaFunc)
+			return ok
+		}),
+		"sameas": testSameAs,
+		"lower": stringTest(func(s string) bool {
+			return s == strings.ToLower(s) && s != strings.ToUpper(s)
+		}),
+		"upper": stringTest(func(s string) bool {
+			return s == strings.ToUpper(s) && s != strings.ToLower(s)
+		}),
+		"divisibleby": testDivisibleBy,
+		"even":        intTest(func(n int) bool { return n%2 == 0 }),
+		"odd":         intTest(func(n int) bool { return n%2 != 0 }),
+		"equalto":     compareTest("=="),
+		"eq":          compareTest("=="),
+		"==":          compareTest("=="),
+		"ne":          compareTest("!="),
+		"!=":          compareTest("!="),
+		"lt":          compareTest("<"),
+		"lessthan":    compareTest("<"),
+		"<":           compareTest("<"),
+		"le":          compareTest("<="),
+		"<=":          compareTest("<="),
+		"gt":          compareTest(">"),
+		"greaterthan": compareTest(">"),
+		">":           compareTest(">"),
+		"ge":          compareTest(">="),
+		">=":          compareTest(">="),
+		"in": func(_ *evalContext, val any, args []any, _ map[string]any) (bool, error) {
+			if len(args) == 0 {
+				return false, fmt.Errorf("test 'in' requires an argument")
+			}
+			return containsValue(args[0], val)
+		},
+		"contains": func(_ *evalContext, val any, args []any, _ map[string]any) (bool, error) {
+			if len(args) == 0 {
+				return false, fmt.Errorf("test 'contains' requires an argument")
+			}
+			return containsValue(val, args[0])
+		},
+		"match":           regexTest("match"),
+		"search":          regexTest("search"),
+		"regex":           regexTest(""),
+		"version":         testVersion,
+		"version_compare": testVersion,
+		"subset":          subsetTest(false),
+		"issubset":        subsetTest(false),
+		"superset":        subsetTest(true),
+		"issuperset":      subsetTest(true),
+		"any":             testAny,
+		"all":             testAll,
+		"abs":             stringTest(path.IsAbs),
+		"vault_encrypted": stringTest(func(s string) bool { return strings.HasPrefix(s, "$ANSIBLE_VAULT;") }),
+		"failed":          resultTest("failed", false, false),
+		"failure":         resultTest("failed", false, false),
+		"succeeded":       resultTest("failed", false, true),
+		"success":         resultTest("failed", false, true),
+		"successful":      resultTest("failed", false, true),
+		"changed":         testChanged,
+		"change":          testChanged,
+		"skipped":         resultTest("skipped", false, false),
+		"skip":            resultTest("skipped", false, false),
+		"unreachable":     resultTest("unreachable", false, false),
+		"reachable":       resultTest("unreachable", false, true),
+		"finished":        resultTest("finished", true, false),
+		"started":         resultTest("started", true, false),
+		"vaulted_file":    unsupportedTest("vaulted_file"),
+		"file":            unsupportedTest("file"),
+		"directory":       unsupportedTest("directory"),
+		"exists":          unsupportedTest("exists"),
+		"link":            unsupportedTest("link"),
+		"mount":           unsupportedTest("mount"),
+		"same_file":       unsupportedTest("same_file"),
+		"is_file":         unsupportedTest("file"),
+		"is_dir":          unsupportedTest("directory"),
+		"is_link":         unsupportedTest("link"),
+		"is_mount":        unsupportedTest("mount"),
+		"is_abs":          stringTest(path.IsAbs),
+		"is_same_file":    unsupportedTest("same_file"),
+		"nan":             testNaN,
+		"escaped":         typeTest(func(any) bool { return false }),
+		"filter": func(c *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+			_, exists := c.lookupFilter(toString(val))
+			return exists, nil
+		},
+		"test": func(c *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+			_, exists := c.lookupTest(toString(val))
+			return exists, nil
+		},
+	}
+}
+
+// typeTest returns the test that checks the type of the value.
+func typeTest(check func(val any) bool) testFunc {
+	return func(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+		return check(normalize(val)), nil
+	}
+}
+
+func isIterable(val any) bool {
+	switch val.(type) {
+	case string, []any, map[string]any:
+		return true
+	}
+	return false
+}
+
+func stringTest(check func(s string) bool) testFunc {
+	return func(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+		s, ok := normalize(val).(string)
+		if !ok {
+			return false, fmt.Errorf("expected a string, got %s", typeName(val))
+		}
+		return check(s), nil
+	}
+}
+
+func intTest(check func(n int) bool) testFunc {
+	return func(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+		n, ok := normalize(val).(int)
+		if !ok {
+			return false, fmt.Errorf("expected an integer, got %s", typeName(val))
+		}
+		return check(n), nil
+	}
+}
+
+// unsupportedTest returns the test that depends on the file system of the
+// controller and therefore cannot be evaluated offline.
+func unsupportedTest(name string) testFunc {
+	return func(_ *evalContext, _ any, _ []any, _ map[string]any) (bool, error) {
+		return false, &UnknownValueError{
+			Value: Unknown{Reason: fmt.Sprintf("test %q cannot be evaluated offline", name)},
+		}
+	}
+}
+
+func compareTest(op string) testFunc {
+	return func(_ *evalContext, val any, args []any, _ map[string]any) (bool, error) {
+		if len(args) == 0 {
+			return false, fmt.Errorf("test %q requires an argument", op)
+		}
+		return compareOp(op, val, args[0])
+	}
+}
+
+// regexTest returns the test that matches the value against the regular
+// expression. The "regex" test takes the mode from the "match_type" argument.
+func regexTest(mode string) testFunc {
+	return func(_ *evalContext, val any, args []any, kwargs map[string]any) (bool, error) {
+		expr := toString(arg(args, kwargs, 0, "pattern", ""))
+		matchType := mode
+		if matchType == "" {
+			matchType = toString(arg(args, kwargs, 3, "match_type", "search"))
+		}
+		switch matchType {
+		case "match":
+			expr = "^(?:" + expr + ")"
+		case "fullmatch":
+			expr = "^(?:" + expr + ")$"
+		case "search":
+		default:
+			return false, fmt.Errorf("invalid match type %q", matchType)
+		}
+		flags := map[string]any{
+			"ignorecase": arg(args, kwargs, 1, "ignorecase", false),
+			"multiline":  arg(args, kwargs, 2, "multiline", false),
+		}
+		re, err := compilePythonRegex(expr, flags)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(toString(val)), nil
+	}
+}
+
+func testSameAs(_ *evalContext, val any, args []any, _ map[string]any) (bool, error) {
+	if len(args) == 0 {
+		return false, fmt.Errorf("test 'sameas' requires an argument")
+	}
+	// only the singletons and the immutable values can be identical in Python
+	a, b := normalize(val), normalize(args[0])
+	if typeName(a) != typeName(b) {
+		return false, nil
+	}
+	switch a.(type) {
+	case nil, bool, int, string:
+		return valuesEqual(a, b), nil
+	}
+	return false, nil
+}
+
+func testDivisibleBy(_ *evalContext, val any, args []any, kwargs map[string]any) (bool, error) {
+	n, ok := toInt(val)
+	if !ok {
+		return false, fmt.Errorf("expected a number, got %s", typeName(val))
+	}
+	num, ok := toInt(arg(args, kwargs, 0, "num", nil))
+	if !ok || num == 0 {
+		return false, fmt.Errorf("test 'divisibleby' requires a non-zero number")
+	}
+	return n%num == 0, nil
+}
+
+func testNaN(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+	f, ok := normalize(val).(float64)
+	return ok && f != f, nil
+}
+
+func testVersion(_ *evalContext, val any, args []any, kwargs map[string]any) (bool, error) {
+	version := arg(args, kwargs, 0, "version", nil)
+	if version == nil {
+		return false, fmt.Errorf("version value is required")
+	}
+	opName := toString(arg(args, kwargs, 1, "operator", "eq"))
+	op, exists := versionOperators[opName]
+	if !exists {
+		return false, fmt.Errorf("invalid operator type (%s)", opName)
+	}
+	versionType := toString(arg(args, kwargs, 3, "version_type", ""))
+	if isTruthy(arg(args, kwargs, 2, "strict", false)) {
+		if versionType != "" {
+			return false, fmt.Errorf("strict and version_type are mutually exclusive")
+		}
+		versionType = "strict"
+	}
+
+	res, err := compareVersions(toString(val), toString(version), versionType)
+	if err != nil {
+		return false, err
+	}
+	return compareOp(op, res, 0)
+}
+
+func subsetTest(superset bool) testFunc {
+	return func(_ *evalContext, val any, args []any, _ map[string]any) (bool, error) {
+		if len(args) == 0 {
+			return false, fmt.Errorf("test requires a list to compare with")
+		}
+		a, err := toList(val)
+		if err != nil {
+			return false, err
+		}
+		b, err := toList(args[0])
+		if err != nil {
+			return false, err
+		}
+		if superset {
+			a, b = b, a
+		}
+		for _, item := range a {
+			if ok, _ := containsValue(b, item); !ok {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+}
+
+func testAny(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+	items, err := toList(val)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if isTruthy(item) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func testAll(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+	items, err := toList(val)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if !isTruthy(item) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// taskResult returns the registered result of a task.
+func taskResult(val any, test string) (map[string]any, error) {
+	res, ok := normalize(val).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("the %q test expects a dictionary, got %s", test, typeName(val))
+	}
+	return res, nil
+}
+
+// resultTest returns the test of the registered task result that checks the
+// boolean field of the result, e.g. "failed".
+func resultTest(field string, def bool, negate bool) testFunc {
+	return func(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+		res, err := taskResult(val, field)
+		if err != nil {
+			return false, err
+		}
+		ok := def
+		if v, exists := res[field]; exists {
+			ok = toBool(v)
+		}
+		return ok != negate, nil
+	}
+}
+
+func testChanged(_ *evalContext, val any, _ []any, _ map[string]any) (bool, error) {
+	res, err := taskResult(val, "changed")
+	if err != nil {
+		return false, err
+	}
+	if changed, exists := res["changed"]; exists {
+		return toBool(changed), nil
+	}
+	// the results of a loop are changed if any of the items is changed
+	if results, ok := normalize(res["results"]).([]any); ok {
+		for _, item := range results {
+			if m, ok := normalize(item).(map[string]any); ok && toBool(m["changed"]) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func lookupTest(name string) (testFunc, bool) {
+	test, exists := builtinTests[pluginShortName(name)]
+	return test, exists
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// undefined is the value of an expression that cannot be resolved,
+// e.g. a missing variable or attribute.
+type undefined struct {
+	name string
+}
+
+// Unknown is the value of an expression that cannot be evaluated offline,
+// e.g. an undefined variable or the result of a lookup that requires network access.
+type Unknown struct {
+	// Expr is the source of the expression that cannot be evaluated, e.g. "{{ token }}".
+	Expr string
+	// Offset is the byte offset of the expression in the template.
+	Offset int
+	// Partial is the template with the known expressions rendered
+	// and the unknown ones left as is.
+	Partial string
+	// Reason describes why the value is unknown.
+	Reason string
+	// MissingPlugin is the name of the filter, test or lookup plugin that is
+	// neither built-in nor registered, if the value depends on it.
+	MissingPlugin string
+}
+
+// IsUnknown reports whether the value is unknown.
+func IsUnknown(val any) bool {
+	_, ok := val.(Unknown)
+	return ok
+}
+
+// ContainsUnknown reports whether the value or any of its nested values is unknown.
+func ContainsUnknown(val any) bool {
+	_, ok := findUnknown(val)
+	return ok
+}
+
+func (u Unknown) String() string {
+	return "<unknown: " + u.Reason + ">"
+}
+
+// findUnknown returns the first unknown value contained in the value.
+func findUnknown(val any) (Unknown, bool) {
+	switch v := val.(type) {
+	case Unknown:
+		return v, true
+	case []any:
+		for _, item := range v {
+			if u, ok := findUnknown(item); ok {
+				return u, true
+			}
+		}
+	case map[string]any:
+		for _, k := range sortedKeys(v) {
+			if u, ok := findUnknown(v[k]); ok {
+				return u, true
+			}
+		}
+	}
+	return Unknown{}, false
+}
+
+// findUndefined returns the first undefined value contained in the value.
+func findUndefined(val any) (undefined, bool) {
+	switch v := val.(type) {
+	case undefined:
+		return v, true
+	case []any:
+		for _, item := range v {
+			if u, ok := findUndefined(item); ok {
+				return u, true
+			}
+		}
+	case map[string]any:
+		for _, k := range sortedKeys(v) {
+			if u, ok := findUndefined(v[k]); ok {
+				return u, true
+			}
+		}
+	}
+	return undefined{}, false
+}
+
+// jinjaFunc is a callable value, e.g. a global function or a bound method.
+type jinjaFunc func(c *evalContext, args []any, kwargs map[string]any) (any, error)
+
+func isUndefined(val any) bool {
+	_, ok := val.(undefined)
+	return ok
+}
+
+// normalize converts Go values to the types used by the evaluator:
+// nil, bool, int, float64, string, []any and map[string]any.
+func normalize(val any) any {
+	switch v := val.(type) {
+	case nil, bool, int, float64, string, []any, map[string]any, undefined, jinjaFunc, Unknown:
+		return v
+	case Variables:
+		return map[string]any(v)
+	case FactProfile:
+		return map[string]any(v)
+	case Module:
+		return map[string]any(v)
+	case []string:
+		res := make([]any, len(v))
+		for i, s := range v {
+			res[i] = s
+		}
+		return res
+	case float32:
+		return float64(v)
+	}
+
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(rv.Uint())
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice, reflect.Array:
+		res := make([]any, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			res[i] = rv.Index(i).Interface()
+		}
+		return res
+	case reflect.Map:
+		res := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			res[fmt.Sprint(iter.Key().Interface())] = iter.Value().Interface()
+		}
+		return res
+	}
+	return val
+}
+
+// toString converts the value to a string as the Python str() function does.
+func toString(val any) string {
+	switch v := normalize(val).(type) {
+	case undefined:
+		return ""
+	case string:
+		return v
+	case []any, map[string]any:
+		return repr(v)
+	}
+	return repr(val)
+}
+
+// repr returns the Python representation of the value.
+func repr(val any) string {
+	switch v := normalize(val).(type) {
+	case nil:
+		return "None"
+	case undefined:
+		return ""
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return formatFloat(v)
+	case string:
+		return quoteString(v)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = repr(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]any:
+		items := make([]string, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			items = append(items, quoteString(k)+": "+repr(v[k]))
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	case jinjaFunc:
+		return "<function>"
+	}
+	return fmt.Sprint(val)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if strings.ContainsAny(s, "e") {
+		exp := strings.Index(s, "e")
+		if s[exp+1] != '-' && s[exp+1] != '+' {
+			s = s[:exp+1] + "+" + s[exp+1:]
+		}
+		if !strings.Contains(s[:exp], ".") && math.Abs(f) < 1e16 {
+			return strconv.FormatFloat(f, 'f', -1, 64) + ".0"
+		}
+		return s
+	}
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+func quoteString(s string) string {
+	quote := "'"
+	if strings.Contains(s, "'") && !strings.Contains(s, `"`) {
+		quote = `"`
+	}
+	var sb strings.Builder
+	sb.WriteString(quote)
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case string(r) == quote:
+			sb.WriteString(`\` + quote)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteString(quote)
+	return sb.String()
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isTruthy returns the truth value of the value as in Python.
+func isTruthy(val any) bool {
+	switch v := normalize(val).(type) {
+	case nil, undefined:
+		return false
+	case bool:
+		return v
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+// typeName returns the name of the Python type of the value.
+func typeName(val any) string {
+	switch normalize(val).(type) {
+	case nil:
+		return "NoneType"
+	case undefined:
+		return "AnsibleUndefined"
+	case bool:
+		return "bool"
+	case int:
+		return "int"
+	case float64:
+		return "float"
+	case string:
+		return "str"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "dict"
+	case jinjaFunc:
+		return "function"
+	case Unknown:
+		return "Unknown"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+// toNumber converts bool, int and float values to a number. The second
+// value reports whether the number is a float.
+func toNumber(val any) (float64, bool, bool) {
+	switch v := normalize(val).(type) {
+	case bool:
+		if v {
+			return 1, false, true
+		}
+		return 0, false, true
+	case int:
+		return float64(v), false, true
+	case float64:
+		return v, true, true
+	}
+	return 0, false, false
+}
+
+func isNumber(val any) bool {
+	_, _, ok := toNumber(val)
+	return ok
+}
+
+// toInt converts the value to an integer as the "int" filter does.
+func toInt(val any) (int, bool) {
+	switch v := normalize(val).(type) {
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return int(i), true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return int(f), true
+		}
+	}
+	return 0, false
+}
+
+// toFloat converts the value to a float as the "float" filter does.
+func toFloat(val any) (float64, bool) {
+	switch v := normalize(val).(type) {
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	f, _, ok := toNumber(val)
+	return f, ok
+}
+
+// toList converts an iterable value to a list. Dictionaries are converted
+// to the list of their keys and strings to the list of their characters.
+func toList(val any) ([]any, error) {
+	switch v := normalize(val).(type) {
+	case []any:
+		return v, nil
+	case map[string]any:
+		keys := sortedKeys(v)
+		res := make([]any, len(keys))
+		for i, k := range keys {
+			res[i] = k
+		}
+		return res, nil
+	case string:
+		res := make([]any, 0, len(v))
+		for _, r := range v {
+			res = append(res, string(r))
+		}
+		return res, nil
+	case undefined:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("'%s' object is not iterable", typeName(val))
+}
+
+// valuesEqual compares the values as the Python "==" operator does.
+func valuesEqual(a, b any) bool {
+	a, b = normalize(a), normalize(b)
+
+	if af, _, ok := toNumber(a); ok {
+		bf, _, ok := toNumber(b)
+		return ok && af == bf
+	}
+
+	switch av := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		bv, ok := b.(string)
+		return ok && av == bv
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			other, exists := bv[k]
+			if !exists || !valuesEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compareValues compares the values as the Python ordering operators do.
+// It returns -1, 0 or 1, or an error if the values cannot be ordered.
+func compareValues(a, b any) (int, error) {
+	a, b = normalize(a), normalize(b)
+
+	if af, _, ok := toNumber(a); ok {
+		if bf, _, ok := toNumber(b); ok {
+			switch {
+			case af < bf:
+				return -1, nil
+			case af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	switch av := a.(type) {
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv), nil
+		}
+	case []any:
+		if bv, ok := b.([]any); ok {
+			for i := 0; i < len(av) && i < len(bv); i++ {
+				if valuesEqual(av[i], bv[i]) {
+					continue
+				}
+				return compareValues(av[i], bv[i])
+			}
+			switch {
+			case len(av) < len(bv):
+				return -1, nil
+			case len(av) > len(bv):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	return 0, fmt.Errorf("'<' not supported between instances of '%s' and '%s'", typeName(a), typeName(b))
+}
+
+// containsValue implements the Python "in" operator.
+func containsValue(container, item any) (bool, error) {
+	switch c := normalize(container).(type) {
+	case string:
+		s, ok := normalize(item).(string)
+		if !ok {
+			return false, fmt.Errorf("'in <string>' requires string as left operand, not %s", typeName(item))
+		}
+		return strings.Contains(c, s), nil
+	case []any:
+		for _, v := range c {
+			if valuesEqual(v, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]any:
+		_, exists := c[toString(item)]
+		return exists, nil
+	case undefined:
+		return false, nil
+	}
+	return false, fmt.Errorf("argument of type '%s' is not iterable", typeName(container))
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// This file implements the "json_query"-lite subset of JMESPath: fields,
+// sub-expressions, indexes, list projections, flattening, filters,
+// multi-selects and literals. The expressions with functions, pipes, slices
+// or object projections fail the filter, so that the task is reported
+// instead of evaluated incorrectly.
+//
+// See https://jmespath.org/specification.html
+
+type jmesTokenType int
+
+const (
+	jmesEOF jmesTokenType = iota
+	jmesIdentifier
+	jmesQuotedIdentifier
+	jmesLiteral
+	jmesNumber
+	jmesDot
+	jmesStar
+	jmesLBracket
+	jmesRBracket
+	jmesFilter
+	jmesFlatten
+	jmesLBrace
+	jmesRBrace
+	jmesLParen
+	jmesRParen
+	jmesComma
+	jmesColon
+	jmesPipe
+	jmesOr
+	jmesAnd
+	jmesNot
+	jmesCompare
+	jmesCurrent
+)
+
+type jmesToken struct {
+	typ jmesTokenType
+	val string
+	lit any
+}
+
+// jmesBindingPowers are the binding powers of the tokens used by the Pratt parser.
+var jmesBindingPowers = map[jmesTokenType]int{
+	jmesPipe:     1,
+	jmesOr:       2,
+	jmesAnd:      3,
+	jmesCompare:  5,
+	jmesFlatten:  9,
+	jmesStar:     20,
+	jmesFilter:   21,
+	jmesDot:      40,
+	jmesNot:      45,
+	jmesLBrace:   50,
+	jmesLBracket: 55,
+	jmesLParen:   60,
+}
+
+// jmesProjectionStop is the binding power below which a projection stops.
+const jmesProjectionStop = 10
+
+func tokenizeJMESPath(src string) ([]jmesToken, error) {
+	var tokens []jmesToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case isNameStart(c):
+			start := i
+			for i < len(src) && isNameChar(src[i]) {
+				i++
+			}
+			tokens = append(tokens, jmesToken{typ: jmesIdentifier, val: src[start:i]})
+		case isDigit(c) || (c == '-' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			i++
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			tokens = append(tokens, jmesToken{typ: jmesNumber, val: src[start:i]})
+		case c == '"' || c == '\'' || c == '`':
+			end := i + 1
+			for end < len(src) && src[end] != c {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated %c at %d", c, i)
+			}
+			raw := src[i+1 : end]
+			i = end + 1
+			switch c {
+			case '"':
+				var s string
+				if err := json.Unmarshal([]byte(`"`+raw+`"`), &s); err != nil {
+					return nil, fmt.Errorf("invalid quoted identifier %q: %w", raw, err)
+				}
+				tokens = append(tokens, jmesToken{typ: jmesQuotedIdentifier, val: s})
+			case '\'':
+				s := strings.ReplaceAll(raw, `\'`, `'`)
+				tokens = append(tokens, jmesToken{typ: jmesLiteral, lit: s})
+			case '`':
+				var lit any
+				raw = strings.ReplaceAll(raw, "\\`", "`")
+				if err := json.Unmarshal([]byte(raw), &lit); err != nil {
+					// JMESPath allows unquoted strings in literals
+					lit = strings.TrimSpace(raw)
+				}
+				tokens = append(tokens, jmesToken{typ: jmesLiteral, lit: fromJSONNumbers(lit)})
+			}
+		default:
+			tok, size := jmesOperator(src[i:])
+			if size == 0 {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, tok)
+			i += size
+		}
+	}
+	return append(tokens, jmesToken{typ: jmesEOF}), nil
+}
+
+func jmesOperator(s string) (jmesToken, int) {
+	for _, op := range []struct {
+		val string
+		typ jmesTokenType
+	}{
+		{"[?", jmesFilter}, {"[]", jmesFlatten}, {"||", jmesOr}, {"&&", jmesAnd},
+		{"==", jmesCompare}, {"!=", jmesCompare}, {"<=", jmesCompare}, {">=", jmesCompare},
+		{"<", jmesCompare}, {">", jmesCompare}, {"!", jmesNot},
+		{".", jmesDot}, {"*", jmesStar}, {"[", jmesLBracket}, {"]", jmesRBracket},
+		{"{", jmesLBrace}, {"}", jmesRBrace}, {"(", jmesLParen}, {")", jmesRParen},
+		{",", jmesComma}, {":", jmesColon}, {"|", jmesPipe}, {"@", jmesCurrent},
+	} {
+		if strings.HasPrefix(s, op.val) {
+			return jmesToken{typ: op.typ, val: op.val}, len(op.val)
+		}
+	}
+	return jmesToken{}, 0
+}
+
+// errJMESPathUnsupported is returned for the JMESPath expressions outside of
+// the subset supported by the "json_query" filter.
+var errJMESPathUnsupported = errors.New("not supported by json_query")
+
+type jmesNodeType int
+
+const (
+	jmesNodeIdentity jmesNodeType = iota
+	jmesNodeField
+	jmesNodeSubexpr
+	jmesNodeIndex
+	jmesNodeProjection
+	jmesNodeFilterProjection
+	jmesNodeFlatten
+	jmesNodeCompare
+	jmesNodeAnd
+	jmesNodeOr
+	jmesNodeNot
+	jmesNodeLiteral
+	jmesNodeMultiList
+	jmesNodeMultiHash
+)
+
+type jmesNode struct {
+	typ      jmesNodeType
+	val      any
+	children []*jmesNode
+}
+
+type jmesParser struct {
+	tokens []jmesToken
+	pos    int
+}
+
+func parseJMESPath(src string) (*jmesNode, error) {
+	tokens, err := tokenizeJMESPath(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &jmesParser{tokens: tokens}
+	node, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.typ != jmesEOF {
+		return nil, fmt.Errorf("unexpected token %q", tok.val)
+	}
+	return node, nil
+}
+
+func (p *jmesParser) peek() jmesToken {
+	return p.tokens[p.pos]
+}
+
+func (p *jmesParser) peekAt(offset int) jmesToken {
+	if p.pos+offset >= len(p.tokens) {
+		return jmesToken{typ: jmesEOF}
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *jmesParser) next() jmesToken {
+	tok := p.tokens[p.pos]
+	if tok.typ != jmesEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *jmesParser) expect(typ jmesTokenType) error {
+	if tok := p.next(); tok.typ != typ {
+		return fmt.Errorf("unexpected token %q", tok.val)
+	}
+	return nil
+}
+
+func (p *jmesParser) parseExpression(bp int) (*jmesNode, error) {
+	left, err := p.nud(p.next())
+	if err != nil {
+		return nil, err
+	}
+	for bp < jmesBindingPowers[p.peek().typ] {
+		if left, err = p.led(p.next(), left); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *jmesParser) nud(tok jmesToken) (*jmesNode, error) {
+	identity := &jmesNode{typ: jmesNodeIdentity}
+	switch tok.typ {
+	case jmesLiteral:
+		return &jmesNode{typ: jmesNodeLiteral, val: tok.lit}, nil
+	case jmesIdentifier, jmesQuotedIdentifier:
+		return &jmesNode{typ: jmesNodeField, val: tok.val}, nil
+	case jmesCurrent:
+		return identity, nil
+	case jmesStar:
+		return nil, fmt.Errorf("object projections are %w", errJMESPathUnsupported)
+	case jmesFilter:
+		return p.led(tok, identity)
+	case jmesFlatten:
+		return p.led(tok, identity)
+	case jmesLBrace:
+		return p.parseMultiHash()
+	case jmesLBracket:
+		switch {
+		case p.peek().typ == jmesNumber || p.peek().typ == jmesColon:
+			return p.parseIndex(identity)
+		case p.peek().typ == jmesStar && p.peekAt(1).typ == jmesRBracket:
+			p.pos += 2
+			right, err := p.parseProjectionRHS(jmesBindingPowers[jmesStar])
+			if err != nil {
+				return nil, err
+			}
+			return &jmesNode{typ: jmesNodeProjection, children: []*jmesNode{identity, right}}, nil
+		}
+		return p.parseMultiList()
+	case jmesNot:
+		expr, err := p.parseExpression(jmesBindingPowers[jmesNot])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesNode{typ: jmesNodeNot, children: []*jmesNode{expr}}, nil
+	case jmesLParen:
+		expr, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(jmesRParen)
+	}
+	if tok.typ == jmesEOF {
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected token %q", tok.val)
+}
+
+func (p *jmesParser) led(tok jmesToken, left *jmesNode) (*jmesNode, error) {
+	bp := jmesBindingPowers[tok.typ]
+	switch tok.typ {
+	case jmesDot:
+		if p.peek().typ == jmesStar {
+			return nil, fmt.Errorf("object projections are %w", errJMESPathUnsupported)
+		}
+		right, err := p.parseDotRHS(bp)
+		if err != nil {
+			return nil, err
+		}
+		return &jmesNode{typ: jmesNodeSubexpr, children: []*jmesNode{left, right}}, nil
+	case jmesOr, jmesAnd:
+		right, err := p.parseExpression(bp)
+		if err != nil {
+			return nil, err
+		}
+		typ := map[jmesTokenType]jmesNodeType{jmesOr: jmesNodeOr, jmesAnd: jmesNodeAnd}[tok.typ]
+		return &jmesNode{typ: typ, children: []*jmesNode{left, right}}, nil
+	case jmesPipe:
+		return nil, fmt.Errorf("pipe expressions are %w", errJMESPathUnsupported)
+	case jmesLParen:
+		return nil, fmt.Errorf("functions are %w", errJMESPathUnsupported)
+	case jmesCompare:
+		right, err := p.parseExpression(bp)
+		if err != nil {
+			return nil, err
+		}
+		return &jmesNode{typ: jmesNodeCompare, val: tok.val, children: []*jmesNode{left, right}}, nil
+	case jmesFilter:
+		cond, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(jmesRBracket); err != nil {
+			return nil, err
+		}
+		right, err := p.parseProjectionRHS(bp)
+		if err != nil {
+			return nil, err
+		}
+		return &jmesNode{typ: jmesNodeFilterProjection, children: []*jmesNode{left, right, cond}}, nil
+	case jmesFlatten:
+		right, err := p.parseProjectionRHS(bp)
+		if err != nil {
+			return nil, err
+		}
+		flat := &jmesNode{typ: jmesNodeFlatten, children: []*jmesNode{left}}
+		return &jmesNode{typ: jmesNodeProjection, children: []*jmesNode{flat, right}}, nil
+	case jmesLBracket:
+		if p.peek().typ == jmesNumber || p.peek().typ == jmesColon {
+			return p.parseIndex(left)
+		}
+		if err := p.expect(jmesStar); err != nil {
+			return nil, err
+		}
+		if err := p.expect(jmesRBracket); err != nil {
+			return nil, err
+		}
+		right, err := p.parseProjectionRHS(jmesBindingPowers[jmesStar])
+		if err != nil {
+			return nil, err
+		}
+		return &jmesNode{typ: jmesNodeProjection, children: []*jmesNode{left, right}}, nil
+	}
+	return nil, fmt.Errorf("unexpected token %q", tok.val)
+}
+
+// parseIndex parses an index after the opening bracket.
+func (p *jmesParser) parseIndex(left *jmesNode) (*jmesNode, error) {
+	tok := p.next()
+	if tok.typ == jmesColon {
+		return nil, fmt.Errorf("slices are %w", errJMESPathUnsupported)
+	}
+	n, _ := strconv.Atoi(tok.val)
+	switch p.next().typ {
+	case jmesRBracket:
+		index := &jmesNode{typ: jmesNodeIndex, val: n}
+		return &jmesNode{typ: jmesNodeSubexpr, children: []*jmesNode{left, index}}, nil
+	case jmesColon:
+		return nil, fmt.Errorf("slices are %w", errJMESPathUnsupported)
+	}
+	return nil, errors.New("invalid index")
+}
+
+func (p *jmesParser) parseProjectionRHS(bp int) (*jmesNode, error) {
+	tok := p.peek()
+	switch {
+	case jmesBindingPowers[tok.typ] < jmesProjectionStop:
+		return &jmesNode{typ: jmesNodeIdentity}, nil
+	case tok.typ == jmesLBracket, tok.typ == jmesFilter:
+		return p.parseExpression(bp)
+	case tok.typ == jmesDot:
+		p.next()
+		return p.parseDotRHS(bp)
+	}
+	return nil, fmt.Errorf("unexpected token %q after projection", tok.val)
+}
+
+func (p *jmesParser) parseDotRHS(bp int) (*jmesNode, error) {
+	switch p.peek().typ {
+	case jmesIdentifier, jmesQuotedIdentifier:
+		return p.parseExpression(bp)
+	case jmesLBracket:
+		p.next()
+		return p.parseMultiList()
+	case jmesLBrace:
+		p.next()
+		return p.parseMultiHash()
+	}
+	return nil, fmt.Errorf("unexpected token %q after dot", p.peek().val)
+}
+
+func (p *jmesParser) parseMultiList() (*jmesNode, error) {
+	node := &jmesNode{typ: jmesNodeMultiList}
+	for {
+		expr, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, expr)
+		tok := p.next()
+		if tok.typ == jmesRBracket {
+			return node, nil
+		}
+		if tok.typ != jmesComma {
+			return nil, fmt.Errorf("unexpected token %q in multi-select list", tok.val)
+		}
+	}
+}
+
+func (p *jmesParser) parseMultiHash() (*jmesNode, error) {
+	node := &jmesNode{typ: jmesNodeMultiHash}
+	var keys []string
+	for {
+		key := p.next()
+		if key.typ != jmesIdentifier && key.typ != jmesQuotedIdentifier {
+			return nil, fmt.Errorf("expected a key name, got %q", key.val)
+		}
+		if err := p.expect(jmesColon); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key.val)
+		node.children = append(node.children, expr)
+		tok := p.next()
+		if tok.typ == jmesRBrace {
+			node.val = keys
+			return node, nil
+		}
+		if tok.typ != jmesComma {
+			return nil, fmt.Errorf("unexpected token %q in multi-select hash", tok.val)
+		}
+	}
+}
+
+// jmesTruthy returns the truth value of the value as defined by JMESPath.
+func jmesTruthy(val any) bool {
+	switch v := normalize(val).(type) {
+	case nil, undefined:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+func (n *jmesNode) eval(val any) (any, error) {
+	switch n.typ {
+	case jmesNodeIdentity:
+		return val, nil
+	case jmesNodeLiteral:
+		return n.val, nil
+	case jmesNodeField:
+		if m, ok := normalize(val).(map[string]any); ok {
+			return m[n.val.(string)], nil
+		}
+		return nil, nil
+	case jmesNodeSubexpr:
+		left, err := n.children[0].eval(val)
+		if err != nil || left == nil {
+			return nil, err
+		}
+		return n.children[1].eval(left)
+	case jmesNodeIndex:
+		items, ok := normalize(val).([]any)
+		if !ok {
+			return nil, nil
+		}
+		idx := n.val.(int)
+		if idx < 0 {
+			idx += len(items)
+		}
+		if idx < 0 || idx >= len(items) {
+			return nil, nil
+		}
+		return items[idx], nil
+	case jmesNodeFlatten:
+		left, err := n.children[0].eval(val)
+		if err != nil {
+			return nil, err
+		}
+		items, ok := normalize(left).([]any)
+		if !ok {
+			return nil, nil
+		}
+		return flatten(items, 1, false), nil
+	case jmesNodeProjection, jmesNodeFilterProjection:
+		return n.evalProjection(val)
+	case jmesNodeCompare:
+		return n.evalCompare(val)
+	case jmesNodeAnd, jmesNodeOr:
+		left, err := n.children[0].eval(val)
+		if err != nil {
+			return nil, err
+		}
+		if jmesTruthy(left) == (n.typ == jmesNodeOr) {
+			return left, nil
+		}
+		return n.children[1].eval(val)
+	case jmesNodeNot:
+		res, err := n.children[0].eval(val)
+		if err != nil {
+			return nil, err
+		}
+		return !jmesTruthy(res), nil
+	case jmesNodeMultiList:
+		if val == nil {
+			return nil, nil
+		}
+		res := make([]any, 0, len(n.children))
+		for _, child := range n.children {
+			v, err := child.eval(val)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, v)
+		}
+		return res, nil
+	case jmesNodeMultiHash:
+		if val == nil {
+			return nil, nil
+		}
+		keys := n.val.([]string)
+		res := make(map[string]any, len(keys))
+		for i, child := range n.children {
+			v, err := child.eval(val)
+			if err != nil {
+				return nil, err
+			}
+			res[keys[i]] = v
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("unsupported JMESPath node %d", n.typ)
+}
+
+func (n *jmesNode) evalProjection(val any) (any, error) {
+	left, err := n.children[0].eval(val)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := normalize(left).([]any)
+	if !ok {
+		return nil, nil
+	}
+
+	res := []any{}
+	for _, item := range items {
+		if n.typ == jmesNodeFilterProjection {
+			cond, err := n.children[2].eval(item)
+			if err != nil {
+				return nil, err
+			}
+			if !jmesTruthy(cond) {
+				continue
+			}
+		}
+		v, err := n.children[1].eval(item)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+func (n *jmesNode) evalCompare(val any) (any, error) {
+	left, err := n.children[0].eval(val)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.children[1].eval(val)
+	if err != nil {
+		return nil, err
+	}
+	op := n.val.(string)
+	switch op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	}
+	if !isNumber(left) || !isNumber(right) {
+		return nil, nil
+	}
+	return compareOp(op, left, right)
+}
+
+func filterJSONQuery(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+	expr := toString(arg(args, kwargs, 0, "expr", ""))
+	node, err := parseJMESPath(expr)
+	if err != nil {
+		return nil, fmt.Errorf("json_query: failed to parse %q: %w", expr, err)
+	}
+	return node.eval(plainValue(val))
+}
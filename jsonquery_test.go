@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONQuery(t *testing.T) {
+	vars := Variables{
+		"users": []any{
+			map[string]any{"name": "alice", "admin": true, "uid": 1000, "groups": []any{"wheel", "dev"}},
+			map[string]any{"name": "bob", "admin": false, "uid": 1001, "groups": []any{"dev"}},
+		},
+		"config": map[string]any{
+			"listen": "0.0.0.0",
+			"nested": map[string]any{"timeout": 30},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{name: "field", template: "{{ config | json_query('nested.timeout') }}", expected: "30"},
+		{name: "missing field", template: "{{ config | json_query('nested.missing.deeper') }}", expected: "None"},
+		{name: "index", template: "{{ users | json_query('[-1].name') }}", expected: "bob"},
+		{name: "projection", template: "{{ users | json_query('[*].name') }}", expected: "['alice', 'bob']"},
+		{name: "flatten", template: "{{ users | json_query('[*].groups[]') | unique }}", expected: "['wheel', 'dev']"},
+		{name: "filter", template: "{{ users | json_query('[?admin].name') }}", expected: "['alice']"},
+		{name: "filter comparison", template: "{{ users | json_query(\"[?uid > `1000` && name != 'carol'].name\") }}", expected: "['bob']"},
+		{name: "filter not", template: "{{ users | json_query('[?!admin].name') }}", expected: "['bob']"},
+		{name: "multi-select list", template: "{{ users | json_query('[0].[name, uid]') }}", expected: "['alice', 1000]"},
+		{name: "multi-select hash", template: "{{ config | json_query('{l: listen, t: nested.timeout}') }}", expected: "{'l': '0.0.0.0', 't': 30}"},
+	}
+
+	templater := &JinjaTemplater{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := templater.Evaluate(tt.template, vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+}
+
+func TestJSONQueryUnsupported(t *testing.T) {
+	for _, expr := range []string{
+		"length(@)",
+		"[*].name | [0]",
+		"[1:]",
+		"config.*",
+		"*.timeout",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := parseJMESPath(expr)
+			assert.ErrorIs(t, err, errJMESPathUnsupported)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// keywordsInner contains the keywords that the tasks inherit from the blocks,
+// includes, role entries and plays. The values are kept as is, since they
+// can be templates, e.g. "become: '{{ use_sudo }}'".
+//
+// See https://docs.ansible.com/ansible/latest/reference_appendices/playbooks_keywords.html
+type keywordsInner struct {
+	Become       any `yaml:"become"`
+	BecomeUser   any `yaml:"become_user"`
+	BecomeMethod any `yaml:"become_method"`
+	DelegateTo   any `yaml:"delegate_to"`
+	RunOnce      any `yaml:"run_once"`
+	NoLog        any `yaml:"no_log"`
+	IgnoreErrors any `yaml:"ignore_errors"`
+	CheckMode    any `yaml:"check_mode"`
+	Connection   any `yaml:"connection"`
+	RemoteUser   any `yaml:"remote_user"`
+	Environment  any `yaml:"environment"`
+}
+
+// TaskKeywords contains the effective values of the task keywords, including
+// the values inherited from the play, the role entry, the includes and the blocks.
+// The keywords that are not set are nil.
+type TaskKeywords struct {
+	Become       *bool
+	BecomeUser   *string
+	BecomeMethod *string
+	DelegateTo   *string
+	RunOnce      *bool
+	NoLog        *bool
+	IgnoreErrors *bool
+	CheckMode    *bool
+	Connection   *string
+	RemoteUser   *string
+	Environment  map[string]any
+	// ChangedWhen contains the conditions of the "changed_when" keyword,
+	// which is not inherited.
+	ChangedWhen []string
+
+	// Unknowns contains the keywords whose values cannot be determined,
+	// e.g. because they depend on undefined variables. The keys are the
+	// names of the keywords.
+	Unknowns map[string]Unknown
+}
+
+// Keywords returns the effective keywords of the task. The keywords set on
+// the task take precedence over the keywords of the blocks, the includes,
+// the role entry and the play, in this order. The environment variables
+// are merged.
+func (t *Task) Keywords() TaskKeywords {
+	res := TaskKeywords{
+		ChangedWhen: t.inner.ChangedWhen,
+	}
+
+	vars := t.getVars()
+	render := func(name string, val any) (any, bool) {
+		if val == nil {
+			return nil, false
+		}
+		rendered := t.renderVariable(val, vars)
+		if u, ok := rendered.(Unknown); ok {
+			if res.Unknowns == nil {
+				res.Unknowns = make(map[string]Unknown)
+			}
+			res.Unknowns[name] = u
+			return nil, false
+		}
+		// the value of the inner scope overrides the unknown value
+		delete(res.Unknowns, name)
+		return rendered, true
+	}
+	setBool := func(dst **bool, name string, val any) {
+		if v, ok := render(name, val); ok {
+			b, ok := keywordBool(v)
+			if !ok {
+				log.Printf("Invalid value of keyword %q: %v", name, v)
+				return
+			}
+			*dst = &b
+		}
+	}
+	setString := func(dst **string, name string, val any) {
+		if v, ok := render(name, val); ok {
+			s := toString(v)
+			*dst = &s
+		}
+	}
+
+	for _, layer := range t.keywordLayers() {
+		setBool(&res.Become, "become", layer.Become)
+		setString(&res.BecomeUser, "become_user", layer.BecomeUser)
+		setString(&res.BecomeMethod, "become_method", layer.BecomeMethod)
+		setString(&res.DelegateTo, "delegate_to", layer.DelegateTo)
+		setBool(&res.RunOnce, "run_once", layer.RunOnce)
+		setBool(&res.NoLog, "no_log", layer.NoLog)
+		setBool(&res.IgnoreErrors, "ignore_errors", layer.IgnoreErrors)
+		setBool(&res.CheckMode, "check_mode", layer.CheckMode)
+		setString(&res.Connection, "connection", layer.Connection)
+		setString(&res.RemoteUser, "remote_user", layer.RemoteUser)
+		if env, ok := render("environment", layer.Environment); ok {
+			res.Environment = lo.Assign(res.Environment, environmentVars(env))
+		}
+	}
+	return res
+}
+
+// keywordLayers returns the keywords of the play, the role entries, the parent
+// blocks and includes, and the task, from the outermost to the innermost.
+// The keywords of the dynamic includes are replaced by their "apply" keywords.
+func (t *Task) keywordLayers() []*keywordsInner {
+	var res []*keywordsInner
+	switch {
+	case t.parent == nil:
+		if include := t.scopeParent(); include != nil {
+			res = include.includedKeywordLayers()
+		} else if play := t.Play(); play != nil {
+			res = append(res, &play.inner.keywordsInner)
+		}
+		if t.role != nil {
+			res = append(res, t.role.keywordLayers()...)
+		}
+	case t.parent.IsDynamicInclude():
+		res = t.parent.includedKeywordLayers()
+	default:
+		res = t.parent.keywordLayers()
+	}
+	return append(res, &t.inner.keywordsInner)
+}
+
+// includedKeywordLayers returns the keyword layers inherited by the tasks of
+// the dynamic include, in which the keywords of the include itself are
+// replaced by the ones of the "apply" keyword.
+func (t *Task) includedKeywordLayers() []*keywordsInner {
+	res := t.keywordLayers()
+	res = res[:len(res)-1]
+	if apply := t.applyKeywords(); apply != nil {
+		res = append(res, &apply.keywordsInner)
+	}
+	return res
+}
+
+// environmentVars returns the environment variables of the "environment"
+// keyword, which is either a dictionary or a list of dictionaries.
+func environmentVars(val any) map[string]any {
+	switch v := val.(type) {
+	case map[string]any:
+		return v
+	case []any:
+		res := make(map[string]any)
+		for _, item := range v {
+			res = lo.Assign(res, environmentVars(item))
+		}
+		return res
+	}
+	log.Printf("Invalid value of keyword \"environment\": %v", val)
+	return nil
+}
+
+// keywordBool converts the value of a boolean keyword as Ansible does.
+// Unlike the "bool" filter, it fails on values that are not booleans.
+func keywordBool(val any) (bool, bool) {
+	switch v := normalize(val).(type) {
+	case bool:
+		return v, true
+	case int:
+		return v == 1, v == 0 || v == 1
+	case float64:
+		return v == 1, v == 0 || v == 1
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "yes", "on", "1", "true", "y", "t", "1.0":
+			return true, true
+		case "no", "off", "0", "false", "n", "f", "0.0", "":
+			return false, true
+		}
+	}
+	return false, false
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
-	"os"
-	"path/filepath"
-	"strings"
+	"path"
 
 	"github.com/samber/lo"
 	"gopkg.in/yaml.v3"
@@ -16,25 +16,49 @@ type DataLoader struct {
 	fsys fs.FS
 	root string
 
-	// The cache key is the role name
 	// The cache value is the path to the role definition directory
-	roleCache map[string]string
+	roleCache map[roleCacheKey]string
+	// roleContents contains the parsed files of the roles by the role path
+	roleContents map[string]*roleContent
+	// rolesPath contains the roles path from the environment or ansible.cfg
+	rolesPath []string
+
+	varResolver *VariableResolver
+	templater   Templater
+
+	// maxIncludeDepth is the maximum number of nested playbooks, task files and roles
+	maxIncludeDepth int
+	diagnostics     []Diagnostic
 }
 
 func NewDataloader(fsys fs.FS, root string) *DataLoader {
 	return &DataLoader{
-		fsys:      fsys,
-		root:      root,
-		roleCache: make(map[string]string),
+		fsys:         fsys,
+		root:         root,
+		roleCache:    make(map[roleCacheKey]string),
+		roleContents: make(map[string]*roleContent),
 	}
 }
 
+// roleCacheKey identifies the role reference, since the same name can refer
+// to different roles depending on the playbook and the role that uses it.
+type roleCacheKey struct {
+	name        string
+	playbookDir string
+	roleBaseDir string
+}
+
 // TODO: add public field
 type LoadRoleOptions struct {
 	TasksFile    string
 	DefaultsFile string
 	VarsFile     string
+	HandlersFile string
 	Public       *bool
+
+	// roleBaseDir is the directory of the role that depends on or includes
+	// the role, which is searched for the role as well
+	roleBaseDir string
 }
 
 func (o LoadRoleOptions) WithDefaults() LoadRoleOptions {
@@ -42,6 +66,8 @@ func (o LoadRoleOptions) WithDefaults() LoadRoleOptions {
 		TasksFile:    "main",
 		DefaultsFile: "main",
 		VarsFile:     "main",
+		HandlersFile: "main",
+		roleBaseDir:  o.roleBaseDir,
 	}
 
 	if o.TasksFile != "" {
@@ -56,6 +82,10 @@ func (o LoadRoleOptions) WithDefaults() LoadRoleOptions {
 		res.VarsFile = o.VarsFile
 	}
 
+	if o.HandlersFile != "" {
+		res.HandlersFile = o.HandlersFile
+	}
+
 	return res
 }
 
@@ -66,95 +96,28 @@ func (l *DataLoader) LoadRole(meta *Metadata, play *Play, roleName string) (*Rol
 func (l *DataLoader) LoadRoleWithOptions(meta *Metadata, play *Play, roleName string, opt LoadRoleOptions) (*Role, error) {
 	opt = opt.WithDefaults()
 
-	var rolePath string
-	// TODO: For caching it is necessary to load the role completely, so as not to depend on LoadRoleOptions
-	// if val, exists := l.roleCache[roleName]; exists {
-	// 	val.play = play
-	// 	val.metadata.parent = meta
-	// 	return &val, nil
-	// }
-
-	if val, exists := l.roleCache[roleName]; exists {
-		rolePath = val
-	} else if val, exists := l.resolveRolePath(roleName); exists {
-		rolePath = val
-	}
-
-	if rolePath == "" {
-		return nil, fmt.Errorf("role %q not found", roleName)
+	playbookDir := l.root
+	if play != nil {
+		playbookDir = path.Dir(play.GetPath())
 	}
+	cacheKey := roleCacheKey{name: roleName, playbookDir: playbookDir, roleBaseDir: opt.roleBaseDir}
 
-	r := &Role{
-		name: roleName,
-		path: rolePath,
-		metadata: Metadata{
-			parent: meta,
-			path:   rolePath,
-		},
-		play:       play,
-		dataloader: l,
-	}
-
-	walkFn := func(path string, d fs.DirEntry, err error) error {
+	rolePath, exists := l.roleCache[cacheKey]
+	if !exists {
+		resolved, err := l.resolveRolePath(roleName, playbookDir, opt.roleBaseDir)
 		if err != nil {
-			return err
-		}
-
-		if d.IsDir() {
-			return nil
-		}
-
-		dir, filename := filepath.Split(path)
-		if !isYAMLFile(filename) {
-			return nil
-		}
-
-		parts := strings.Split(dir, string(os.PathSeparator))
-		parentFolder := parts[len(parts)-2]
-
-		switch parentFolder {
-		case "tasks":
-			if cutExtension(filename) != opt.TasksFile {
-				return nil
-			}
-			tasks, err := l.LoadTasks(&r.metadata, r, path)
-			if err != nil {
-				return fmt.Errorf("failed to load tasks: %w", err)
-			}
-
-			r.tasks = append(r.tasks, tasks...)
-		case "defaults":
-			if cutExtension(filename) != opt.DefaultsFile {
-				return nil
-			}
-			if vars, err := l.parseVarsFile(path); err == nil {
-				r.defaults = lo.Assign(r.defaults, vars)
-			}
-		case "vars":
-			if cutExtension(filename) != opt.VarsFile {
-				return nil
-			}
-			if vars, err := l.parseVarsFile(path); err == nil {
-				r.vars = lo.Assign(r.vars, vars)
-			}
-		case "meta":
-			if cutExtension(filename) != "main" {
-				return nil
-			}
-			if meta, err := l.parseMetaFile(path); err == nil {
-				meta.metadata.parent = &r.metadata
-				r.meta = meta
-			}
+			return nil, err
 		}
-		return nil
+		rolePath = resolved
 	}
-	if err := fs.WalkDir(l.fsys, rolePath, walkFn); err != nil {
+
+	content, err := l.loadRoleContent(rolePath)
+	if err != nil {
 		return nil, err
 	}
+	l.roleCache[cacheKey] = rolePath
 
-	l.roleCache[roleName] = rolePath
-
-	return r, nil
+	return l.newRole(content, meta, play, roleBaseName(roleName), opt)
 }
 
 func (l *DataLoader) parseMetaFile(path string) (RoleMeta, error) {
@@ -163,6 +126,9 @@ func (l *DataLoader) parseMetaFile(path string) (RoleMeta, error) {
 		return meta, err
 	}
 	meta.metadata.path = path
+	for _, dep := range meta.inner.Dependencies {
+		dep.metadata.path = path
+	}
 	return meta, nil
 }
 
@@ -180,22 +146,11 @@ func (l *DataLoader) decodeYAMLFile(path string, dst any) error {
 		return err
 	}
 	defer f.Close()
-	return yaml.NewDecoder(f).Decode(dst)
-}
-
-func (l *DataLoader) resolveRolePath(name string) (string, bool) {
-	paths := []string{filepath.Join(l.root, "roles", name)}
-	if defaultRolesPath, exists := os.LookupEnv("DEFAULT_ROLES_PATH"); exists {
-		paths = append(paths, defaultRolesPath)
-	}
-
-	for _, p := range paths {
-		if isPathExists(l.fsys, p) {
-			return p, true
-		}
+	// an empty file has no content rather than an invalid one
+	if err := yaml.NewDecoder(f).Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+		return err
 	}
-
-	return "", false
+	return nil
 }
 
 func (l *DataLoader) LoadTasks(sourceMetadata *Metadata, role *Role, path string) (Tasks, error) {
@@ -203,15 +158,21 @@ func (l *DataLoader) LoadTasks(sourceMetadata *Metadata, role *Role, path string
 	if err := l.decodeYAMLFile(path, &tasks); err != nil {
 		return nil, fmt.Errorf("failed to decode tasks file %q: %w", path, err)
 	}
-	tasks = lo.Map(tasks, func(task *Task, _ int) *Task {
+	return l.initTasks(tasks, sourceMetadata, role, path), nil
+}
+
+// initTasks binds the decoded tasks of the file to the loader and the role.
+func (l *DataLoader) initTasks(tasks Tasks, sourceMetadata *Metadata, role *Role, path string) Tasks {
+	return lo.Map(tasks, func(task *Task, i int) *Task {
+		task.index = i + 1
 		task.metadata.parent = sourceMetadata
 		task.dataloader = l
+		task.varResolver = l.varResolver
+		task.templater = l.templater
 		task.role = role
 		task.UpdateNested(path)
 		return task
 	})
-
-	return tasks, nil
 }
 
 func (l *DataLoader) LoadPlaybook(sourceMetadata *Metadata, path string) (Playbook, error) {
@@ -228,17 +189,32 @@ func (l *DataLoader) LoadPlaybook(sourceMetadata *Metadata, path string) (Playbo
 		log.Printf("Failed to decode playbook %q: %s", path, err)
 		return nil, nil
 	}
-	for _, play := range playbook {
+	for i, play := range playbook {
+		play.index = i + 1
 		play.UpdateMetadata(sourceMetadata, path)
 		play.dataloader = l
 
+		for _, task := range play.listTasks() {
+			task.play = play
+			task.dataloader = l
+			task.varResolver = l.varResolver
+			task.templater = l.templater
+			task.UpdateNested(path)
+		}
+
 		roles := make([]*Role, 0, len(play.GetRoleDefinitions()))
 
 		for _, roleDef := range play.GetRoleDefinitions() {
-			role, err := l.LoadRole(&play.metadata, play, roleDef.GetName())
+			role, err := l.LoadRole(&roleDef.metadata, play, roleDef.GetName())
+			if l.reportMissingRole(play.includeStack(), err) {
+				continue
+			}
 			if err != nil {
-				return nil, fmt.Errorf("failed to load role %q: %w", roleDef.GetName(), err)
+				l.reportIncludeError(play.includeStack(), fmt.Errorf("failed to load role %q: %w", roleDef.GetName(), err))
+				continue
 			}
+			role.definition = roleDef
+			role.identity = roleIdentity(role)
 			roles = append(roles, role)
 		}
 		play.roles = roles
@@ -246,18 +222,26 @@ func (l *DataLoader) LoadPlaybook(sourceMetadata *Metadata, path string) (Playbo
 	return playbook, nil
 }
 
-func (l *DataLoader) LoadPlayVarsFile(playPath string, varsFile string) (map[string]any, error) {
-	path := filepath.Join(playPath, "vars", varsFile)
-	f, err := l.fsys.Open(path)
+// LoadPlayVarsFile loads the variables from the "vars_files" entry of the play.
+// The name of the file can be a template using the variables of the play.
+func (l *DataLoader) LoadPlayVarsFile(play *Play, varsFile string, vars Variables) (map[string]any, error) {
+	if l.templater != nil {
+		rendered := l.templater.EvaluatePartial(varsFile, vars)
+		name, ok := rendered.(string)
+		if !ok {
+			return nil, fmt.Errorf("vars file %q cannot be resolved", varsFile)
+		}
+		varsFile = name
+	}
+
+	path, err := play.SearchPath().Find(l.fsys, "", varsFile)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
 
-	var vars map[string]any
-	if err := yaml.NewDecoder(f).Decode(&vars); err != nil {
+	res, err := l.parseVarsFile(path)
+	if err != nil {
 		return nil, fmt.Errorf("failed to decode variables from %q: %w", path, err)
 	}
-
-	return vars, nil
+	return res, nil
 }
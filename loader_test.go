@@ -1,9 +1,11 @@
 package main
 
 import (
+	"io/fs"
 	"testing"
 	"testing/fstest"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -239,17 +241,328 @@ func TestLoadPlaysWithTasks(t *testing.T) {
     - name: Post task
       debug: null
       msg: Post task
+  roles:
+    - app
 `),
 		},
+		"roles/app/tasks/main.yaml": {Data: []byte(`[{name: Role task, debug: {msg: role}}]`)},
 	}
 
 	loader := NewDataloader(fsys, ".")
 	playbook, err := loader.LoadPlaybook(nil, "playbook.yaml")
 	require.NoError(t, err)
 
+	// the roles run between the pre_tasks and the tasks
 	tasks := playbook.Compile()
-	assert.Len(t, tasks, 3)
-	assert.Equal(t, "Pre task", tasks[0].Name())
-	assert.Equal(t, "Task", tasks[1].Name())
-	assert.Equal(t, "Post task", tasks[2].Name())
+	assert.Equal(t, []string{"Pre task", "Role task", "Task", "Post task"}, lo.Map(tasks, func(task *Task, _ int) string {
+		return task.Name()
+	}))
+}
+
+// countingFS counts the opened files.
+type countingFS struct {
+	fstest.MapFS
+	opened map[string]int
+}
+
+func (fsys *countingFS) Open(name string) (fs.File, error) {
+	fsys.opened[name]++
+	return fsys.MapFS.Open(name)
+}
+
+func (fsys *countingFS) ReadFile(name string) ([]byte, error) {
+	fsys.opened[name]++
+	return fsys.MapFS.ReadFile(name)
+}
+
+func TestLoadRoleFromCache(t *testing.T) {
+	fsys := &countingFS{
+		opened: make(map[string]int),
+		MapFS: fstest.MapFS{
+			"roles/web/tasks/main.yaml": {
+				Data: []byte(`---
+- name: Install
+  package:
+    name: "{{ web_package }}"
+`),
+			},
+			"roles/web/tasks/config.yml": {
+				Data: []byte(`---
+- name: Configure
+  template:
+    src: web.conf.j2
+    dest: /etc/web.conf
+`),
+			},
+			"roles/web/defaults/main.yaml": {Data: []byte(`web_package: nginx`)},
+			"roles/web/vars/main.yaml":     {Data: []byte(`web_user: www`)},
+			"roles/web/handlers/main.yaml": {
+				Data: []byte(`---
+- name: Restart web
+  service:
+    name: nginx
+    state: restarted
+`),
+			},
+			"roles/web/meta/main.yaml": {Data: []byte(`dependencies: []`)},
+			"roles/site/tasks/main.yaml": {
+				Data: []byte(`---
+- name: Configure web
+  include_role:
+    name: web
+    tasks_from: config
+`),
+			},
+		},
+	}
+
+	loader := NewDataloader(fsys, ".")
+	first, err := loader.LoadRole(nil, &Play{}, "web")
+	require.NoError(t, err)
+	second, err := loader.LoadRole(nil, nil, "web")
+	require.NoError(t, err)
+	config, err := loader.LoadRoleWithOptions(nil, nil, "web", LoadRoleOptions{TasksFile: "config.yml"})
+	require.NoError(t, err)
+
+	for name, count := range fsys.opened {
+		if isYAMLFile(name) {
+			assert.Equal(t, 1, count, name)
+		}
+	}
+
+	require.Len(t, first.tasks, 1)
+	require.Len(t, second.tasks, 1)
+	assert.NotSame(t, first.tasks[0], second.tasks[0])
+	assert.Same(t, first, first.tasks[0].role)
+	assert.Same(t, second, second.tasks[0].role)
+	assert.NotNil(t, first.play)
+	assert.Nil(t, second.play)
+
+	assert.Equal(t, "Install", first.tasks[0].Name())
+	assert.Equal(t, Variables{"web_package": "nginx"}, first.defaults)
+	assert.Equal(t, Variables{"web_user": "www"}, first.Vars())
+	require.Len(t, first.Handlers(), 1)
+	assert.Equal(t, "Restart web", first.Handlers()[0].Name())
+
+	require.Len(t, config.tasks, 1)
+	assert.Equal(t, "Configure", config.tasks[0].Name())
+	assert.Equal(t, "roles/web/tasks/config.yml", config.tasks[0].metadata.path)
+
+	site, err := loader.LoadRole(nil, nil, "site")
+	require.NoError(t, err)
+	tasks := site.Compile()
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "Configure", tasks[0].Name())
+	assert.Equal(t, 1, fsys.opened["roles/web/tasks/config.yml"])
+}
+
+func TestRoleDeduplication(t *testing.T) {
+	debugTask := func(name string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte("[{name: " + name + ", debug: {msg: " + name + "}}]")}
+	}
+
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  roles:
+    - common
+    - app
+    - role: common
+      port: 8080
+    - web
+    - web
+    - role: app
+      port: 9090
+`),
+		},
+		"roles/common/tasks/main.yaml": debugTask("Common"),
+		"roles/db/tasks/main.yaml":     debugTask("Db"),
+		"roles/app/meta/main.yaml": {
+			Data: []byte(`---
+dependencies:
+  - common
+  - db
+`),
+		},
+		"roles/app/tasks/main.yaml": debugTask("App"),
+		"roles/web/meta/main.yaml": {
+			Data: []byte(`---
+allow_duplicates: true
+dependencies:
+  - db
+`),
+		},
+		"roles/web/tasks/main.yaml": debugTask("Web"),
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	// the dependencies of the second app inherit its parameters,
+	// so they are not duplicates of the roles that already ran
+	expected := []string{"Common", "Db", "App", "Common", "Web", "Web", "Common", "Db", "App"}
+	for i := 0; i < 2; i++ {
+		tasks := project.ListTasks()
+		assert.Equal(t, expected, lo.Map(tasks, func(task *Task, _ int) string {
+			return task.Name()
+		}))
+	}
+}
+
+func TestLoadRoleDependencyEntries(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  roles:
+    - role: app
+      tags: [app]
+      app_port: 8080
+      environment:
+        LANG: C
+`),
+		},
+		"roles/app/meta/main.yaml": {
+			Data: []byte(`---
+dependencies:
+  - role: db
+    vars:
+      db_name: app
+    db_port: 5432
+    when: db_enabled
+    tags: [db]
+    become: true
+`),
+		},
+		"roles/db/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Create database
+  debug:
+    msg: "{{ db_name }}:{{ db_port }}"
+  when: db_name != ""
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 1)
+	task := tasks[0]
+
+	require.True(t, task.Role().IsDependency())
+	assert.Equal(t, Variables{"app_port": 8080, "db_name": "app", "db_port": 5432}, task.Role().Params())
+	assert.Equal(t, []string{"db_enabled", `db_name != ""`}, task.When())
+	assert.Equal(t, []string{"app", "db"}, task.Tags())
+	become, ok := task.Become()
+	assert.True(t, ok)
+	assert.True(t, become)
+
+	// the keywords of the role are inherited from the entries of the dependent roles
+	become, ok = task.Role().Become()
+	assert.True(t, ok)
+	assert.True(t, become)
+	assert.Equal(t, map[string]any{"LANG": "C"}, task.Role().Environment())
+	_, ok = task.Role().parent.Become()
+	assert.False(t, ok)
+
+	vars := task.getVars()
+	assert.Equal(t, "app", vars["db_name"])
+	assert.Equal(t, 8080, vars["app_port"])
+
+	// task file -> role db -> dependency entry -> meta/main.yaml of app -> role app -> roles entry -> play
+	roleMeta := task.metadata.parent
+	require.NotNil(t, roleMeta)
+	assert.Equal(t, "roles/db", roleMeta.path)
+	entry := roleMeta.parent
+	require.NotNil(t, entry)
+	assert.Equal(t, "roles/app/meta/main.yaml", entry.path)
+	assert.Equal(t, Range{startLine: 3, endLine: 9}, entry.rng)
+	require.NotNil(t, entry.parent)
+	assert.Equal(t, "roles/app/meta/main.yaml", entry.parent.path)
+	appMeta := entry.parent.parent
+	require.NotNil(t, appMeta)
+	assert.Equal(t, "roles/app", appMeta.path)
+	require.NotNil(t, appMeta.parent)
+	assert.Equal(t, "playbook.yaml", appMeta.parent.path)
+	assert.Equal(t, Range{startLine: 4, endLine: 8}, appMeta.parent.rng)
+}
+
+func TestIncludeRoleDependencyEntries(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  tasks:
+    - name: Include app
+      include_role:
+        name: app
+      vars:
+        region: eu
+      when: deploy
+`),
+		},
+		"roles/app/meta/main.yaml": {
+			Data: []byte(`---
+dependencies:
+  - role: db
+    when: db_enabled
+    become: true
+    environment:
+      LANG: C
+`),
+		},
+		"roles/app/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Deploy app
+  debug:
+    msg: deploy
+`),
+		},
+		"roles/db/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Create database
+  debug:
+    msg: "{{ region }}"
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 2)
+	db, app := tasks[0], tasks[1]
+	assert.Equal(t, "Create database", db.Name())
+	assert.Equal(t, "Deploy app", app.Name())
+
+	// the tasks of the dependency keep the keywords of the dependency entry
+	assert.Equal(t, []string{"deploy", "db_enabled"}, db.When())
+	become, ok := db.Become()
+	assert.True(t, ok)
+	assert.True(t, become)
+	assert.Equal(t, map[string]any{"LANG": "C"}, db.Environment())
+	assert.Equal(t, "eu", db.getVars()["region"])
+
+	// the tasks of the included role itself do not
+	assert.Equal(t, []string{"deploy"}, app.When())
+	_, ok = app.Become()
+	assert.False(t, ok)
+	assert.Empty(t, app.Environment())
+
+	// task file -> role db -> dependency entry -> meta/main.yaml of app -> role app -> include task
+	roleMeta := db.metadata.parent
+	require.NotNil(t, roleMeta)
+	assert.Equal(t, "roles/db", roleMeta.path)
+	entry := roleMeta.parent
+	require.NotNil(t, entry)
+	assert.Equal(t, "roles/app/meta/main.yaml", entry.path)
+	appMeta := entry.parent.parent
+	require.NotNil(t, appMeta)
+	assert.Equal(t, "roles/app", appMeta.path)
+	require.NotNil(t, appMeta.parent)
+	assert.Equal(t, "playbook.yaml", appMeta.parent.path)
 }
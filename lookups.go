@@ -0,0 +1,401 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// lookupFunc is the implementation of a lookup plugin. It returns the list
+// of values for the terms.
+type lookupFunc func(c *evalContext, terms []any, kwargs map[string]any) ([]any, error)
+
+// builtinLookups are the lookup plugins that can be evaluated offline.
+//
+// See https://docs.ansible.com/ansible/latest/collections/ansible/builtin/index.html#lookup-plugins
+var builtinLookups map[string]lookupFunc
+
+// unknownLookups are the lookup plugins whose results depend on network access,
+// external commands or secrets and therefore cannot be known offline.
+var unknownLookups = map[string]struct{}{
+	"url":                                 {},
+	"pipe":                                {},
+	"lines":                               {},
+	"password":                            {},
+	"dig":                                 {},
+	"dnstxt":                              {},
+	"redis":                               {},
+	"etcd":                                {},
+	"etcd3":                               {},
+	"consul_kv":                           {},
+	"hashi_vault":                         {},
+	"onepassword":                         {},
+	"passwordstore":                       {},
+	"aws_ssm":                             {},
+	"aws_secret":                          {},
+	"amazon.aws.aws_ssm":                  {},
+	"amazon.aws.aws_secret":               {},
+	"amazon.aws.secretsmanager_secret":    {},
+	"community.hashi_vault.hashi_vault":   {},
+	"community.hashi_vault.vault_kv2_get": {},
+	"azure.azcollection.azure_keyvault_secret": {},
+}
+
+func init() {
+	builtinLookups = map[string]lookupFunc{
+		"file":        lookupFile,
+		"template":    lookupTemplate,
+		"env":         lookupEnv,
+		"vars":        lookupVars,
+		"fileglob":    lookupFileglob,
+		"first_found": lookupFirstFound,
+		"items":       lookupItems,
+		"list":        lookupList,
+		"dict":        lookupDict,
+	}
+}
+
+func lookupPlugin(name string) (lookupFunc, bool) {
+	plugin, exists := builtinLookups[pluginShortName(name)]
+	return plugin, exists
+}
+
+func isUnknownLookup(name string) bool {
+	if _, exists := unknownLookups[name]; exists {
+		return true
+	}
+	_, exists := unknownLookups[pluginShortName(name)]
+	return exists
+}
+
+// runLookup runs the lookup plugin with the given name. The terms are the
+// arguments passed after the plugin name.
+func (c *evalContext) runLookup(args []any, kwargs map[string]any) ([]any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("lookup() requires the name of the lookup plugin")
+	}
+	name := toString(args[0])
+	terms := args[1:]
+
+	if isUnknownLookup(name) {
+		return nil, &UnknownValueError{
+			Value: Unknown{Reason: fmt.Sprintf("lookup %q cannot be evaluated offline", name)},
+		}
+	}
+
+	plugin, exists := c.lookupPlugin(name)
+	if !exists {
+		return nil, missingPlugin("lookup", name)
+	}
+
+	pluginKwargs := make(map[string]any, len(kwargs))
+	for k, v := range kwargs {
+		if k != "wantlist" && k != "errors" {
+			pluginKwargs[k] = v
+		}
+	}
+
+	res, err := plugin(c, terms, pluginKwargs)
+	if err != nil {
+		switch toString(kwargs["errors"]) {
+		case "ignore", "warn":
+			return []any{}, nil
+		}
+		return nil, fmt.Errorf("lookup %q failed: %w", name, err)
+	}
+	return res, nil
+}
+
+func globalLookup(c *evalContext, args []any, kwargs map[string]any) (any, error) {
+	res, err := c.runLookup(args, kwargs)
+	if err != nil {
+		return lookupResult(err)
+	}
+	if isTruthy(kwargs["wantlist"]) || len(res) == 0 {
+		return res, nil
+	}
+
+	// the results are joined with a comma if they are all strings
+	strs := make([]string, 0, len(res))
+	for _, item := range res {
+		s, ok := item.(string)
+		if !ok {
+			if len(res) == 1 {
+				return res[0], nil
+			}
+			return res, nil
+		}
+		strs = append(strs, s)
+	}
+	return strings.Join(strs, ","), nil
+}
+
+func globalQuery(c *evalContext, args []any, kwargs map[string]any) (any, error) {
+	res, err := c.runLookup(args, kwargs)
+	if err != nil {
+		return lookupResult(err)
+	}
+	return res, nil
+}
+
+// lookupResult converts the error about an unknown lookup result to the unknown value.
+func lookupResult(err error) (any, error) {
+	var unknownErr *UnknownValueError
+	if errors.As(err, &unknownErr) {
+		return unknownErr.Value, nil
+	}
+	return nil, err
+}
+
+// lookupSearchPaths returns the candidate paths of the file used by a lookup.
+// Relative paths are searched in the search path of the task and in its
+// subdirectory (e.g. "files" or "templates"), as Ansible does.
+func (c *evalContext) lookupSearchPaths(subdir string, name string) []string {
+	return searchPathFromVars(c.vars).Candidates(subdir, name)
+}
+
+func (c *evalContext) fsys() (fs.FS, error) {
+	if c.templater == nil || c.templater.fsys == nil {
+		return nil, errors.New("no filesystem available for lookups")
+	}
+	return c.templater.fsys, nil
+}
+
+// findLookupFile returns the path to the first existing file among the search paths.
+func (c *evalContext) findLookupFile(subdir string, name string) (string, error) {
+	fsys, err := c.fsys()
+	if err != nil {
+		return "", err
+	}
+	return searchPathFromVars(c.vars).Find(fsys, subdir, name)
+}
+
+func (c *evalContext) readLookupFile(subdir string, name string) (string, string, error) {
+	filePath, err := c.findLookupFile(subdir, name)
+	if err != nil {
+		return "", "", err
+	}
+	fsys, err := c.fsys()
+	if err != nil {
+		return "", "", err
+	}
+	b, err := fs.ReadFile(fsys, filePath)
+	if err != nil {
+		return "", "", err
+	}
+	return filePath, string(b), nil
+}
+
+func lookupFile(c *evalContext, terms []any, kwargs map[string]any) ([]any, error) {
+	res := make([]any, 0, len(terms))
+	for _, term := range terms {
+		_, content, err := c.readLookupFile("files", toString(term))
+		if err != nil {
+			return nil, err
+		}
+		if isTruthy(arg(nil, kwargs, -1, "lstrip", false)) {
+			content = strings.TrimLeft(content, " \t\r\n")
+		}
+		if isTruthy(arg(nil, kwargs, -1, "rstrip", true)) {
+			content = strings.TrimRight(content, " \t\r\n")
+		}
+		res = append(res, content)
+	}
+	return res, nil
+}
+
+func lookupTemplate(c *evalContext, terms []any, kwargs map[string]any) ([]any, error) {
+	vars := c.vars
+	if templateVars, ok := normalize(kwargs["template_vars"]).(map[string]any); ok {
+		vars = make(Variables, len(c.vars)+len(templateVars))
+		for k, v := range c.vars {
+			vars[k] = v
+		}
+		for k, v := range templateVars {
+			vars[k] = v
+		}
+	}
+
+	res := make([]any, 0, len(terms))
+	for _, term := range terms {
+		filePath, content, err := c.readLookupFile("templates", toString(term))
+		if err != nil {
+			return nil, err
+		}
+		if c.depth >= maxTemplateDepth {
+			return nil, fmt.Errorf("maximum template nesting depth exceeded while rendering %q", filePath)
+		}
+		content, opts, err := applyTemplateHeader(content, defaultTemplateOptions())
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %q: %w", filePath, err)
+		}
+		nested := &evalContext{templater: c.templater, vars: vars, depth: c.depth + 1}
+		rendered, err := nested.evaluateWithOptions(content, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %q: %w", filePath, err)
+		}
+		res = append(res, rendered)
+	}
+	return res, nil
+}
+
+func lookupEnv(c *evalContext, terms []any, kwargs map[string]any) ([]any, error) {
+	var env map[string]string
+	if c.templater != nil {
+		env = c.templater.env
+	}
+	res := make([]any, 0, len(terms))
+	for _, term := range terms {
+		if val, exists := env[toString(term)]; exists {
+			res = append(res, val)
+			continue
+		}
+		res = append(res, arg(nil, kwargs, -1, "default", ""))
+	}
+	return res, nil
+}
+
+func lookupVars(c *evalContext, terms []any, kwargs map[string]any) ([]any, error) {
+	def, hasDefault := kwargs["default"]
+	res := make([]any, 0, len(terms))
+	for _, term := range terms {
+		name := toString(term)
+		val, err := c.lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		if isUndefined(val) {
+			if !hasDefault {
+				return nil, fmt.Errorf("no variable found with this name: %s", name)
+			}
+			val = def
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+func lookupFileglob(c *evalContext, terms []any, _ map[string]any) ([]any, error) {
+	fsys, err := c.fsys()
+	if err != nil {
+		return nil, err
+	}
+	res := []any{}
+	for _, term := range terms {
+		for _, pattern := range c.lookupSearchPaths("files", toString(term)) {
+			matches, err := fs.Glob(fsys, pattern)
+			if err != nil {
+				return nil, err
+			}
+			// the first directory with matches wins
+			if len(matches) == 0 {
+				continue
+			}
+			for _, match := range matches {
+				if info, err := fs.Stat(fsys, match); err == nil && !info.IsDir() {
+					res = append(res, match)
+				}
+			}
+			break
+		}
+	}
+	return res, nil
+}
+
+func lookupFirstFound(c *evalContext, terms []any, kwargs map[string]any) ([]any, error) {
+	var files, paths []string
+	skip := isTruthy(kwargs["skip"])
+
+	addFiles := func(val any) {
+		items, ok := normalize(val).([]any)
+		if !ok {
+			items = []any{val}
+		}
+		for _, item := range items {
+			// file names can be separated by commas, semicolons or colons
+			files = append(files, strings.FieldsFunc(toString(item), func(r rune) bool {
+				return r == ',' || r == ';'
+			})...)
+		}
+	}
+	addPaths := func(val any) {
+		items, ok := normalize(val).([]any)
+		if !ok {
+			items = []any{val}
+		}
+		for _, item := range items {
+			paths = append(paths, strings.FieldsFunc(toString(item), func(r rune) bool {
+				return r == ',' || r == ';' || r == ':'
+			})...)
+		}
+	}
+
+	for _, term := range flatten(terms, -1, true) {
+		if m, ok := normalize(term).(map[string]any); ok {
+			addFiles(m["files"])
+			if p, exists := m["paths"]; exists {
+				addPaths(p)
+			}
+			skip = skip || isTruthy(m["skip"])
+			continue
+		}
+		addFiles(term)
+	}
+	if f, exists := kwargs["files"]; exists {
+		addFiles(f)
+	}
+	if p, exists := kwargs["paths"]; exists {
+		addPaths(p)
+	}
+
+	candidates := files
+	if len(paths) > 0 {
+		candidates = nil
+		for _, p := range paths {
+			for _, f := range files {
+				candidates = append(candidates, path.Join(p, f))
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		if filePath, err := c.findLookupFile("files", candidate); err == nil {
+			return []any{filePath}, nil
+		}
+	}
+	if skip {
+		return []any{}, nil
+	}
+	return nil, fmt.Errorf("no file was found when using first_found, candidates: %s", strings.Join(candidates, ", "))
+}
+
+func lookupItems(_ *evalContext, terms []any, _ map[string]any) ([]any, error) {
+	return flatten(terms, 1, false), nil
+}
+
+func lookupList(_ *evalContext, terms []any, _ map[string]any) ([]any, error) {
+	if len(terms) == 1 {
+		if items, ok := normalize(terms[0]).([]any); ok {
+			return items, nil
+		}
+	}
+	return terms, nil
+}
+
+func lookupDict(_ *evalContext, terms []any, _ map[string]any) ([]any, error) {
+	res := []any{}
+	for _, term := range terms {
+		m, ok := normalize(term).(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("with_dict expects a dict, got %s", typeName(term))
+		}
+		items, err := filterDict2Items(nil, m, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, items.([]any)...)
+	}
+	return res, nil
+}
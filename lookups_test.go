@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookups(t *testing.T) {
+	fsys := fstest.MapFS{
+		"roles/web/files/motd":              {Data: []byte("Welcome\n")},
+		"roles/web/files/keys/alice.pub":    {Data: []byte("ssh-ed25519 alice")},
+		"roles/web/files/keys/bob.pub":      {Data: []byte("ssh-ed25519 bob")},
+		"roles/web/templates/vhost.conf.j2": {Data: []byte("server_name {{ server_name }};")},
+		"files/banner":                      {Data: []byte("Playbook banner")},
+		"files/Debian.yml":                  {Data: []byte("os: debian")},
+	}
+
+	templater := NewTemplater(fsys, map[string]string{"HOME": "/home/ansible"})
+	vars := Variables{
+		"role_path":    "roles/web",
+		"playbook_dir": ".",
+		"server_name":  "example.com",
+		"os_family":    "Debian",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{name: "file in role", template: "{{ lookup('file', 'motd') }}", expected: "Welcome"},
+		{name: "file in playbook dir", template: "{{ lookup('ansible.builtin.file', 'banner') }}", expected: "Playbook banner"},
+		{name: "file without rstrip", template: "{{ lookup('file', 'motd', rstrip=false) | length }}", expected: "8"},
+		{name: "multiple files", template: "{{ lookup('file', 'motd', 'banner') }}", expected: "Welcome,Playbook banner"},
+		{name: "template", template: "{{ lookup('template', 'vhost.conf.j2') }}", expected: "server_name example.com;"},
+		{name: "template vars", template: "{{ lookup('template', 'vhost.conf.j2', template_vars={'server_name': 'other'}) }}", expected: "server_name other;"},
+		{name: "env", template: "{{ lookup('env', 'HOME') }}", expected: "/home/ansible"},
+		{name: "env missing", template: "{{ lookup('env', 'PATH', default='none') }}", expected: "none"},
+		{name: "vars", template: "{{ lookup('vars', 'server_' ~ 'name') }}", expected: "example.com"},
+		{name: "vars default", template: "{{ lookup('vars', 'missing', default='x') }}", expected: "x"},
+		{name: "fileglob", template: "{{ query('fileglob', 'keys/*.pub') }}", expected: "['roles/web/files/keys/alice.pub', 'roles/web/files/keys/bob.pub']"},
+		{name: "first_found", template: "{{ lookup('first_found', [os_family ~ '.yml', 'default.yml']) }}", expected: "files/Debian.yml"},
+		{name: "first_found skip", template: "{{ query('first_found', {'files': ['missing.yml'], 'skip': true}) }}", expected: "[]"},
+		{name: "query items", template: "{{ q('items', [1, [2, 3]], 4) }}", expected: "[1, [2, 3], 4]"},
+		{name: "wantlist", template: "{{ lookup('file', 'motd', wantlist=true) }}", expected: "['Welcome']"},
+		{name: "errors ignore", template: "{{ lookup('file', 'missing', errors='ignore') }}", expected: "[]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := templater.Evaluate(tt.template, vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+}
+
+func TestLookupErrors(t *testing.T) {
+	templater := NewTemplater(fstest.MapFS{}, nil)
+
+	_, err := templater.Evaluate("{{ lookup('file', 'missing') }}", nil)
+	require.ErrorContains(t, err, "could not find file")
+
+	_, err = templater.Evaluate("{{ lookup('vars', 'missing') }}", nil)
+	require.ErrorContains(t, err, "no variable found")
+
+	_, err = templater.Evaluate("{{ lookup('not_a_plugin', 'x') }}", nil)
+	var unknownErr *UnknownValueError
+	require.ErrorAs(t, err, &unknownErr)
+	assert.Equal(t, "not_a_plugin", unknownErr.Value.MissingPlugin)
+}
+
+func TestUnknownLookups(t *testing.T) {
+	templater := NewTemplater(fstest.MapFS{}, nil)
+	vars := Variables{
+		"token": "{{ lookup('amazon.aws.aws_ssm', '/app/token') }}",
+	}
+
+	for _, template := range []string{
+		"{{ lookup('url', 'https://example.com') }}",
+		"prefix-{{ lookup('aws_ssm', '/app/key') | upper }}",
+		"{{ token }}",
+		"{{ token | default('fallback') }}",
+		"{% if lookup('pipe', 'whoami') == 'root' %}root{% endif %}",
+	} {
+		_, err := templater.Evaluate(template, vars)
+		var unknownErr *UnknownValueError
+		require.True(t, errors.As(err, &unknownErr), template)
+		assert.Contains(t, unknownErr.Value.Reason, "cannot be evaluated offline")
+	}
+
+	out, err := templater.Evaluate("{{ 'static' if true else lookup('url', 'x') }}", vars)
+	require.NoError(t, err)
+	assert.Equal(t, "static", out)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// freeFormModules are the modules that take the free-form command, e.g.
+// "shell: echo hi chdir=/tmp". Only the "k=v" pairs of the options listed in
+// freeFormOptions are extracted from their arguments.
+//
+// See https://github.com/ansible/ansible/blob/devel/lib/ansible/parsing/mod_args.py
+var freeFormModules = []string{"command", "win_command", "shell", "win_shell", "script", "raw"}
+
+var freeFormOptions = []string{
+	"creates", "removes", "chdir", "executable", "warn",
+	"stdin", "stdin_add_newline", "strip_empty_ends",
+}
+
+// rawParamsModules are the modules that accept the "_raw_params" parameter.
+var rawParamsModules = append([]string{
+	"include", "include_vars", "include_tasks", "include_role", "import_tasks", "import_role",
+	"add_host", "group_by", "set_fact", "meta",
+}, freeFormModules...)
+
+// parseModuleArgs parses the string arguments of the module, e.g.
+// "src=a dest='/etc/b c'", as Ansible does. The arguments that are not
+// "k=v" pairs are joined into the "_raw_params" parameter.
+func parseModuleArgs(module string, args string) (map[string]any, error) {
+	short := pluginShortName(module)
+	res, err := parseKV(args, slices.Contains(freeFormModules, short))
+	if err != nil {
+		return nil, err
+	}
+	if raw, exists := res[rawParamsKey]; exists && !slices.Contains(rawParamsModules, short) {
+		// Ansible fails on such tasks, but the other parameters are still useful
+		log.Printf("Module %q does not take free-form arguments: %q", module, raw)
+	}
+	return res, nil
+}
+
+// parseKV converts the string of "k=v" pairs into a map. If checkRaw is set,
+// only the options of the free-form modules are extracted.
+func parseKV(args string, checkRaw bool) (map[string]any, error) {
+	res := make(map[string]any)
+	if args == "" {
+		return res, nil
+	}
+
+	tokens, err := splitArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawParams []string
+	for _, token := range tokens {
+		decoded := decodeEscapes(token)
+		pos := keyValueSeparator(decoded)
+		if pos < 0 {
+			rawParams = append(rawParams, strings.ReplaceAll(token, `\=`, "="))
+			continue
+		}
+		key, val := decoded[:pos], decoded[pos+1:]
+		if checkRaw && !slices.Contains(freeFormOptions, key) {
+			rawParams = append(rawParams, token)
+			continue
+		}
+		res[strings.TrimSpace(key)] = unquote(strings.TrimSpace(val))
+	}
+
+	if len(rawParams) > 0 {
+		res[rawParamsKey] = joinArgs(rawParams)
+	}
+	return res, nil
+}
+
+// keyValueSeparator returns the index of the first unescaped "=" that is not
+// the first character of the token, or -1 if there is none.
+func keyValueSeparator(token string) int {
+	for i := 1; i < len(token); i++ {
+		if token[i] == '=' && token[i-1] != '\\' {
+			return i
+		}
+	}
+	return -1
+}
+
+// decodeEscapes decodes the escape sequences like "\n" or "\x41" in the string.
+// Unknown sequences, e.g. "\=", are kept as is.
+func decodeEscapes(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for len(s) > 0 {
+		if s[0] != '\\' {
+			sb.WriteByte(s[0])
+			s = s[1:]
+			continue
+		}
+		r, _, tail, err := strconv.UnquoteChar(s, 0)
+		if err != nil {
+			sb.WriteByte(s[0])
+			s = s[1:]
+			continue
+		}
+		sb.WriteRune(r)
+		s = tail
+	}
+	return sb.String()
+}
+
+func unquote(s string) string {
+	if len(s) > 1 && s[0] == s[len(s)-1] && (s[0] == '"' || s[0] == '\'') && s[len(s)-2] != '\\' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// joinArgs joins the arguments with spaces, keeping the line breaks.
+func joinArgs(args []string) string {
+	var sb strings.Builder
+	for _, arg := range args {
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(arg)
+	}
+	return sb.String()
+}
+
+var errUnbalancedArgs = errors.New("unbalanced jinja2 block or quotes")
+
+// splitArgs splits the arguments on spaces, keeping the quoted strings and
+// Jinja2 blocks together. The line breaks are kept at the end of the arguments
+// that precede them, so that the arguments can be joined back with joinArgs.
+func splitArgs(args string) ([]string, error) {
+	var params []string
+	var quoteChar byte
+	printDepth, blockDepth, commentDepth := 0, 0, 0
+	inJinja := func() bool {
+		return printDepth > 0 || blockDepth > 0 || commentDepth > 0
+	}
+
+	lines := strings.Split(strings.TrimSpace(args), "\n")
+	for lineIdx, line := range lines {
+		lineContinuation := false
+		for idx, token := range strings.Split(line, " ") {
+			if token == `\` && quoteChar == 0 {
+				lineContinuation = true
+				continue
+			}
+
+			wasInsideQuotes := quoteChar != 0
+			quoteChar = quoteState(token, quoteChar)
+			insideQuotes := quoteChar != 0
+
+			appended := false
+			switch {
+			case insideQuotes && !wasInsideQuotes && !inJinja():
+				params = append(params, token)
+				appended = true
+			case inJinja() || insideQuotes || wasInsideQuotes:
+				if idx == 0 && wasInsideQuotes {
+					params[len(params)-1] += token
+				} else {
+					spacer := ""
+					if idx > 0 {
+						spacer = " "
+					}
+					params[len(params)-1] += spacer + token
+				}
+				appended = true
+			}
+
+			for _, block := range []struct {
+				depth       *int
+				open, close string
+			}{
+				{&printDepth, "{{", "}}"},
+				{&blockDepth, "{%", "%}"},
+				{&commentDepth, "{#", "#}"},
+			} {
+				prev := *block.depth
+				*block.depth = max(prev+strings.Count(token, block.open)-strings.Count(token, block.close), 0)
+				if *block.depth != prev && !appended {
+					params = append(params, token)
+					appended = true
+				}
+			}
+
+			if !inJinja() && !insideQuotes && !appended && token != "" {
+				params = append(params, token)
+			}
+		}
+
+		// keep the line break unless the line ends with the continuation
+		if len(params) > 0 && lineIdx != len(lines)-1 && !lineContinuation {
+			params[len(params)-1] += "\n"
+		}
+	}
+
+	if inJinja() || quoteChar != 0 {
+		return nil, fmt.Errorf("failed to split arguments %q: %w", args, errUnbalancedArgs)
+	}
+	return params, nil
+}
+
+// quoteState returns the quote character that is open after the token.
+func quoteState(token string, quoteChar byte) byte {
+	for i := 0; i < len(token); i++ {
+		c := token[i]
+		if (c != '"' && c != '\'') || (i > 0 && token[i-1] == '\\') {
+			continue
+		}
+		if quoteChar == 0 {
+			quoteChar = c
+		} else if c == quoteChar {
+			quoteChar = 0
+		}
+	}
+	return quoteChar
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseModuleArgs(t *testing.T) {
+	tests := []struct {
+		module   string
+		args     string
+		expected map[string]any
+	}{
+		{
+			module:   "copy",
+			args:     "src=a dest=/etc/b mode=0644",
+			expected: map[string]any{"src": "a", "dest": "/etc/b", "mode": "0644"},
+		},
+		{
+			module:   "copy",
+			args:     `content="hello world" dest='/tmp/my file'`,
+			expected: map[string]any{"content": "hello world", "dest": "/tmp/my file"},
+		},
+		{
+			module:   "apt",
+			args:     "name={{ packages | join(',') }} state=present",
+			expected: map[string]any{"name": "{{ packages | join(',') }}", "state": "present"},
+		},
+		{
+			module:   "shell",
+			args:     "echo hi chdir=/tmp creates=/x",
+			expected: map[string]any{"_raw_params": "echo hi", "chdir": "/tmp", "creates": "/x"},
+		},
+		{
+			module:   "ansible.builtin.command",
+			args:     "ls -l path=/etc",
+			expected: map[string]any{"_raw_params": "ls -l path=/etc"},
+		},
+		{
+			module:   "shell",
+			args:     `echo "a  b" > /tmp/out executable=/bin/bash`,
+			expected: map[string]any{"_raw_params": `echo "a  b" > /tmp/out`, "executable": "/bin/bash"},
+		},
+		{
+			module:   "shell",
+			args:     "set -e\necho {{ greeting }}\n\nexit 0\n",
+			expected: map[string]any{"_raw_params": "set -e\necho {{ greeting }}\n\nexit 0"},
+		},
+		{
+			module:   "include_tasks",
+			args:     "setup.yml",
+			expected: map[string]any{"_raw_params": "setup.yml"},
+		},
+		{
+			module:   "lineinfile",
+			args:     `path=/etc/hosts line=a\=b`,
+			expected: map[string]any{"path": "/etc/hosts", "line": `a\=b`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			params, err := parseModuleArgs(tt.module, tt.args)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, params)
+		})
+	}
+}
+
+func TestParseModuleArgsUnbalanced(t *testing.T) {
+	for _, args := range []string{
+		`echo "hi`,
+		"msg={{ greeting",
+	} {
+		_, err := parseModuleArgs("shell", args)
+		require.ErrorIs(t, err, errUnbalancedArgs, args)
+	}
+}
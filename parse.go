@@ -17,9 +17,73 @@ func WithInvertories(paths ...string) ParserOption {
 	}
 }
 
+// WithFactProfile attaches the fact profile to the hosts of the inventory group
+// or to the host with the given name.
+func WithFactProfile(target string, profile FactProfile) ParserOption {
+	return func(parser *Parser) {
+		parser.factProfiles = append(parser.factProfiles, targetFactProfile{
+			target:  target,
+			profile: profile,
+		})
+	}
+}
+
+// WithLookupEnv sets the environment variables available to the "env" lookup.
+// The environment of the current process is never used.
+func WithLookupEnv(env map[string]string) ParserOption {
+	return func(parser *Parser) {
+		parser.lookupEnv = env
+	}
+}
+
+// WithNativeTypes enables the native types of templates, as the "jinja2_native"
+// setting of Ansible does, regardless of the Ansible configuration.
+func WithNativeTypes() ParserOption {
+	return func(parser *Parser) {
+		parser.nativeTypes = true
+	}
+}
+
+// WithTemplater sets the templater used to render the templates of the project
+// instead of the built-in Jinja2 templater. The lookup environment, the native
+// types and the plugins are not applied to a custom templater.
+func WithTemplater(templater Templater) ParserOption {
+	return func(parser *Parser) {
+		parser.templater = templater
+	}
+}
+
+// WithPlugins sets the registry of the custom filters, tests and lookups
+// available to the built-in templater.
+func WithPlugins(plugins *PluginRegistry) ParserOption {
+	return func(parser *Parser) {
+		parser.plugins = plugins
+	}
+}
+
+// WithMaxIncludeDepth sets the maximum number of nested playbooks, task files
+// and roles. Deeper includes are skipped and reported as diagnostics.
+func WithMaxIncludeDepth(depth int) ParserOption {
+	return func(parser *Parser) {
+		parser.maxIncludeDepth = depth
+	}
+}
+
+type targetFactProfile struct {
+	target  string
+	profile FactProfile
+}
+
 type Parser struct {
-	fsys        fs.FS
-	inventories []string
+	fsys         fs.FS
+	inventories  []string
+	factProfiles []targetFactProfile
+	lookupEnv    map[string]string
+	nativeTypes  bool
+	templater    Templater
+	plugins      *PluginRegistry
+
+	maxIncludeDepth int
 }
 
 func NewParser(fsys fs.FS, opts ...ParserOption) *Parser {
@@ -98,8 +162,6 @@ func (p *Parser) parse(root string, playbooks ...string) (*AnsibleProject, error
 		return nil, err
 	}
 
-	parseInventories(p.fsys, project)
-
 	return project, nil
 }
 
@@ -110,9 +172,30 @@ func (p *Parser) initProject(root string) (*AnsibleProject, error) {
 	}
 
 	project := &AnsibleProject{
-		path:       root,
-		cfg:        cfg,
-		dataloader: NewDataloader(p.fsys, root),
+		path: root,
+		cfg:  cfg,
+	}
+
+	project.inventory = parseInventories(p.fsys, project, p.inventories)
+	for _, f := range p.factProfiles {
+		if _, isGroup := project.inventory.groups[f.target]; isGroup || f.target == allGroup {
+			project.inventory.AddGroupFacts(f.target, f.profile)
+		} else {
+			project.inventory.AddHostFacts(f.target, f.profile)
+		}
+	}
+	project.varResolver = NewVariableResolver(&project.inventory)
+
+	project.dataloader = NewDataloader(p.fsys, root)
+	project.dataloader.varResolver = project.varResolver
+	project.dataloader.maxIncludeDepth = p.maxIncludeDepth
+	project.dataloader.rolesPath = cfg.RolesPath
+	project.dataloader.templater = p.templater
+	if project.dataloader.templater == nil {
+		project.dataloader.templater = NewTemplater(p.fsys, p.lookupEnv,
+			WithTemplatePlugins(p.plugins),
+			WithNativeTemplates(p.nativeTypes || cfg.Jinja2Native),
+		)
 	}
 
 	return project, nil
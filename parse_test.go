@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"testing/fstest"
 
@@ -65,6 +67,36 @@ func TestResolveTaskVariableFromPlay(t *testing.T) {
 	assert.Equal(t, "some_value", vars["somevar"])
 }
 
+func TestTaskVarsInvalidation(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: localhost
+  vars:
+    somevar: before
+  tasks:
+    - name: Test task
+      debug:
+        msg: "{{ somevar }}"
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 1)
+	task := tasks[0]
+	assert.Equal(t, "before", task.getVars()["somevar"])
+
+	task.Play().GetVars()["somevar"] = "after"
+	assert.Equal(t, "before", task.getVars()["somevar"])
+
+	task.varResolver.invalidate()
+	assert.Equal(t, "after", task.getVars()["somevar"])
+}
+
 func TestOverrideTaskVariable(t *testing.T) {
 	fsys := fstest.MapFS{
 		"playbook.yaml": {
@@ -100,3 +132,311 @@ func TestOverrideTaskVariable(t *testing.T) {
 	vars := variableResolver.GetVars(task.Play(), task)
 	assert.Equal(t, "overrided", vars["somevar"])
 }
+
+func TestRoleParams(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: localhost
+  vars:
+    http_port: 8080
+  roles:
+    - role: test
+      http_port: 80
+      vars:
+        user: admin
+      when: enabled
+      tags: web
+      become: true
+      environment:
+        LANG: C
+`),
+		},
+		"roles/test/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Test task
+  debug:
+    msg: Test task
+  when: other
+  tags: debug
+- name: Block
+  become: false
+  block:
+    - name: Task in block
+      debug:
+        msg: Task in block
+`),
+		},
+	}
+
+	parser := NewParser(fsys)
+	project, err := parser.ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 2)
+
+	variableResolver := VariableResolver{}
+	vars := variableResolver.GetVars(tasks[0].Play(), tasks[0])
+	assert.Equal(t, 80, vars["http_port"])
+	assert.Equal(t, "admin", vars["user"])
+
+	assert.Equal(t, []string{"enabled", "other"}, tasks[0].When())
+	assert.Equal(t, []string{"web", "debug"}, tasks[0].Tags())
+	assert.Equal(t, map[string]any{"LANG": "C"}, tasks[0].Environment())
+
+	become, exists := tasks[0].Become()
+	assert.True(t, exists)
+	assert.True(t, become)
+
+	become, exists = tasks[1].Become()
+	assert.True(t, exists)
+	assert.False(t, become)
+}
+
+func TestMagicVariables(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- name: Web
+  hosts: webservers
+  roles:
+    - test
+`),
+		},
+		"inventory/hosts": {
+			Data: []byte(`[webservers]
+web1 http_port=80
+web2
+
+[dbservers]
+db1
+`),
+		},
+		"roles/test/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Test task
+  template:
+    src: "{{ role_path }}/templates/{{ role_name }}.j2"
+    dest: "/etc/{{ inventory_hostname }}"
+    owner: "{{ owner | default(omit) }}"
+    hosts: "{{ ansible_play_hosts | join(',') }}"
+    port: "{{ hostvars['web1']['http_port'] }}"
+    dir: "{{ playbook_dir }}"
+`),
+		},
+	}
+
+	parser := NewParser(fsys)
+	project, err := parser.ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	assert.Empty(t, project.ListTasksForHost("db1"))
+
+	tasks := project.ListTasksForHost("web2")
+	require.Len(t, tasks, 1)
+
+	module, exists := tasks[0].Module("template")
+	require.True(t, exists)
+
+	assert.Equal(t, Module{
+		"src":   "roles/test/templates/test.j2",
+		"dest":  "/etc/web2",
+		"hosts": "web1,web2",
+		"port":  "80",
+		"dir":   ".",
+	}, module)
+
+	vars := tasks[0].varResolver.GetVars(tasks[0].Play(), tasks[0])
+	assert.Equal(t, []string{"webservers"}, vars["group_names"])
+	assert.Equal(t, []string{"db1"}, vars["groups"].(map[string][]string)["dbservers"])
+}
+
+func TestHostFactProfiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  tasks:
+    - name: Install package
+      package:
+        name: "{{ ansible_facts.os_family }}-{{ ansible_distribution_major_version }}"
+`),
+		},
+		"inventory/hosts": {
+			Data: []byte(`[ubuntu]
+web1
+
+[rhel]
+web2
+web3
+`),
+		},
+	}
+
+	ubuntu, _ := FactProfilePreset("Ubuntu 22.04")
+	rhel, _ := FactProfilePreset("RHEL 9")
+
+	parser := NewParser(fsys,
+		WithFactProfile("ubuntu", ubuntu),
+		WithFactProfile("rhel", rhel),
+		WithFactProfile("web3", FactProfile{"distribution_major_version": "8"}),
+	)
+	project, err := parser.ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"web1": "Debian-22",
+		"web2": "RedHat-9",
+		"web3": "RedHat-8",
+	}
+
+	for host, name := range expected {
+		tasks := project.ListTasksForHost(host)
+		require.Len(t, tasks, 1)
+
+		module, exists := tasks[0].Module("package")
+		require.True(t, exists)
+		assert.Equal(t, name, module["name"], host)
+	}
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 1)
+
+	module, exists := tasks[0].WithFacts(ubuntu).Module("package")
+	require.True(t, exists)
+	assert.Equal(t, "Debian-22", module["name"])
+}
+
+func TestTemplateLookups(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  roles:
+    - test
+`),
+		},
+		"roles/test/files/authorized_keys": {
+			Data: []byte("ssh-ed25519 AAAA admin\n"),
+		},
+		"roles/test/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Add key
+  authorized_key:
+    user: "{{ lookup('env', 'DEPLOY_USER') }}"
+    key: "{{ lookup('file', 'authorized_keys') }}"
+`),
+		},
+	}
+
+	parser := NewParser(fsys, WithLookupEnv(map[string]string{"DEPLOY_USER": "deploy"}))
+	project, err := parser.ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 1)
+
+	module, exists := tasks[0].Module("authorized_key")
+	require.True(t, exists)
+	assert.Equal(t, Module{
+		"user": "deploy",
+		"key":  "ssh-ed25519 AAAA admin",
+	}, module)
+}
+
+func TestNativeTypes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ansible.cfg": {
+			Data: []byte(`[defaults]
+jinja2_native = True
+`),
+		},
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  vars:
+    http_port: 8080
+    encrypt: false
+  tasks:
+    - name: Create volume
+      volume:
+        port: "{{ http_port }}"
+        encrypt: "{{ encrypt }}"
+        tags: "{{ ['a', 'b'] }}"
+        mode: "0644"
+        dir_mode: "{{ '0755' }}"
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 1)
+
+	module, exists := tasks[0].Module("volume")
+	require.True(t, exists)
+	assert.Equal(t, Module{
+		"port":     8080,
+		"encrypt":  false,
+		"tags":     []any{"a", "b"},
+		"mode":     "0644",
+		"dir_mode": "0755",
+	}, module)
+}
+
+func BenchmarkTaskModule(b *testing.B) {
+	const roles, tasksPerRole, hosts = 20, 10, 50
+
+	fsys := fstest.MapFS{}
+	var playbook, inventory strings.Builder
+	playbook.WriteString("- hosts: all\n  vars:\n    app_name: shop\n    secure: true\n  roles:\n")
+	inventory.WriteString("[web]\n")
+	for i := 0; i < hosts; i++ {
+		fmt.Fprintf(&inventory, "web%02d.example.com\n", i)
+	}
+	for i := 0; i < roles; i++ {
+		fmt.Fprintf(&playbook, "    - role%02d\n", i)
+		fsys[fmt.Sprintf("roles/role%02d/defaults/main.yml", i)] = &fstest.MapFile{
+			Data: []byte(fmt.Sprintf("role%02d_port: %d\n", i, 8000+i)),
+		}
+		var tasks strings.Builder
+		for j := 0; j < tasksPerRole; j++ {
+			fmt.Fprintf(&tasks, "- name: task %d\n  copy:\n    dest: \"/etc/{{ app_name }}/role%02d-%d.conf\"\n    content: \"port={{ role%02d_port }}\"\n    mode: \"{{ '0644' if secure else '0666' }}\"\n", j, i, j, i)
+		}
+		fsys[fmt.Sprintf("roles/role%02d/tasks/main.yml", i)] = &fstest.MapFile{Data: []byte(tasks.String())}
+	}
+	fsys["playbook.yml"] = &fstest.MapFile{Data: []byte(playbook.String())}
+	fsys["hosts"] = &fstest.MapFile{Data: []byte(inventory.String())}
+
+	project, err := NewParser(fsys, WithInvertories("hosts")).ParseProject(".", "playbook.yml")
+	require.NoError(b, err)
+	tasks := project.ListTasks()
+	require.Len(b, tasks, roles*tasksPerRole)
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, task := range tasks {
+				if _, exists := task.ForHost("").Module("copy"); !exists {
+					b.Fatal("module not found")
+				}
+			}
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, task := range tasks {
+				task = task.ForHost("")
+				task.templater = &JinjaTemplater{}
+				task.varResolver.invalidate()
+				task.varResolver.inventoryMagic = nil
+				if _, exists := task.Module("copy"); !exists {
+					b.Fatal("module not found")
+				}
+			}
+		}
+	})
+}
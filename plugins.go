@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+)
+
+// FilterFunc is the Go implementation of a custom filter. The val is the value
+// the filter is applied to, e.g. "x" in "{{ x | to_cidr(24) }}".
+type FilterFunc func(val any, args []any, kwargs map[string]any) (any, error)
+
+// TestFunc is the Go implementation of a custom test. The val is the value
+// the test is applied to, e.g. "x" in "{{ x is valid_cidr }}".
+type TestFunc func(val any, args []any, kwargs map[string]any) (bool, error)
+
+// LookupFunc is the Go implementation of a custom lookup. It returns the list
+// of values for the terms. The vars are the variables available to the template.
+type LookupFunc func(terms []any, kwargs map[string]any, vars Variables) ([]any, error)
+
+// PluginRegistry contains the Go implementations of the filters, tests and lookups
+// that Ansible projects ship as Python plugins, e.g. in "filter_plugins/".
+//
+// The plugins are registered by name, either fully qualified (e.g. "mycorp.utils.to_cidr")
+// or short (e.g. "to_cidr"). Registered plugins take precedence over the built-in ones.
+// The registry must not be modified while the templates are rendered.
+type PluginRegistry struct {
+	filters map[string]filterFunc
+	tests   map[string]testFunc
+	lookups map[string]lookupFunc
+}
+
+func NewPluginRegistry() *PluginRegistry {
+	return &PluginRegistry{
+		filters: make(map[string]filterFunc),
+		tests:   make(map[string]testFunc),
+		lookups: make(map[string]lookupFunc),
+	}
+}
+
+// AddFilter registers the filter with the given name.
+func (r *PluginRegistry) AddFilter(name string, fn FilterFunc) {
+	r.filters[name] = func(_ *evalContext, val any, args []any, kwargs map[string]any) (any, error) {
+		return fn(val, args, kwargs)
+	}
+}
+
+// AddTest registers the test with the given name.
+func (r *PluginRegistry) AddTest(name string, fn TestFunc) {
+	r.tests[name] = func(_ *evalContext, val any, args []any, kwargs map[string]any) (bool, error) {
+		return fn(val, args, kwargs)
+	}
+}
+
+// AddLookup registers the lookup with the given name.
+func (r *PluginRegistry) AddLookup(name string, fn LookupFunc) {
+	r.lookups[name] = func(c *evalContext, terms []any, kwargs map[string]any) ([]any, error) {
+		return fn(terms, kwargs, c.vars)
+	}
+}
+
+// findPlugin returns the plugin registered with the name or, if there is none,
+// with the short name of the plugin.
+func findPlugin[T any](plugins map[string]T, name string) (T, bool) {
+	if plugin, exists := plugins[name]; exists {
+		return plugin, true
+	}
+	plugin, exists := plugins[pluginShortName(name)]
+	return plugin, exists
+}
+
+func (c *evalContext) plugins() *PluginRegistry {
+	if c.templater == nil {
+		return nil
+	}
+	return c.templater.plugins
+}
+
+func (c *evalContext) lookupFilter(name string) (filterFunc, bool) {
+	if plugins := c.plugins(); plugins != nil {
+		if filter, exists := findPlugin(plugins.filters, name); exists {
+			return filter, true
+		}
+	}
+	return lookupFilter(name)
+}
+
+func (c *evalContext) lookupTest(name string) (testFunc, bool) {
+	if plugins := c.plugins(); plugins != nil {
+		if test, exists := findPlugin(plugins.tests, name); exists {
+			return test, true
+		}
+	}
+	return lookupTest(name)
+}
+
+func (c *evalContext) lookupPlugin(name string) (lookupFunc, bool) {
+	if plugins := c.plugins(); plugins != nil {
+		if lookup, exists := findPlugin(plugins.lookups, name); exists {
+			return lookup, true
+		}
+	}
+	return lookupPlugin(name)
+}
+
+// missingPlugin returns the error about the plugin that is neither built-in nor
+// registered. Such plugins are usually implemented in Python by the project or
+// a collection, so the values they produce are unknown.
+func missingPlugin(kind string, name string) error {
+	return &UnknownValueError{
+		Value: Unknown{
+			Reason:        fmt.Sprintf("%s plugin %q is not available", kind, name),
+			MissingPlugin: name,
+		},
+	}
+}
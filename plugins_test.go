@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginRegistry(t *testing.T) {
+	plugins := NewPluginRegistry()
+	plugins.AddFilter("mycorp.utils.to_cidr", func(val any, args []any, _ map[string]any) (any, error) {
+		prefix := 24
+		if len(args) > 0 {
+			prefix = args[0].(int)
+		}
+		return fmt.Sprintf("%s/%d", val, prefix), nil
+	})
+	plugins.AddTest("mycorp.utils.internal", func(val any, _ []any, _ map[string]any) (bool, error) {
+		return strings.HasSuffix(fmt.Sprint(val), ".internal"), nil
+	})
+	plugins.AddLookup("vault_secret", func(terms []any, _ map[string]any, vars Variables) ([]any, error) {
+		return []any{fmt.Sprintf("%s-%s", vars["env"], terms[0])}, nil
+	})
+
+	templater := NewTemplater(nil, nil, WithTemplatePlugins(plugins))
+	vars := Variables{"ip": "10.0.0.1", "host": "db.internal", "env": "prod"}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{template: "{{ ip | mycorp.utils.to_cidr }}", expected: "10.0.0.1/24"},
+		{template: "{{ ip | mycorp.utils.to_cidr(16) }}", expected: "10.0.0.1/16"},
+		{template: "{{ host is mycorp.utils.internal }}", expected: "True"},
+		{template: "{{ lookup('vault_secret', 'db') }}", expected: "prod-db"},
+		{template: "{{ lookup('community.general.vault_secret', 'db') }}", expected: "prod-db"},
+		{template: "{{ [ip] | map('mycorp.utils.to_cidr', 8) | list }}", expected: "['10.0.0.1/8']"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			out, err := templater.Evaluate(tt.template, vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+}
+
+func TestMissingPlugins(t *testing.T) {
+	templater := NewTemplater(nil, nil)
+	vars := Variables{"ip": "10.0.0.1"}
+
+	for template, plugin := range map[string]string{
+		"{{ ip | mycorp.utils.to_cidr }}":          "mycorp.utils.to_cidr",
+		"{{ ip is mycorp.utils.internal }}":        "mycorp.utils.internal",
+		"{{ lookup('mycorp.utils.secret', 'x') }}": "mycorp.utils.secret",
+		"{{ [ip] | map('to_cidr') | list }}":       "to_cidr",
+	} {
+		out := templater.EvaluatePartial(template, vars)
+		require.True(t, IsUnknown(out), template)
+		assert.Equal(t, plugin, out.(Unknown).MissingPlugin, template)
+		assert.Contains(t, out.(Unknown).Reason, fmt.Sprintf("%q is not available", plugin), template)
+	}
+}
+
+type stubTemplater struct {
+	JinjaTemplater
+}
+
+func (t *stubTemplater) EvaluatePartial(template string, _ Variables) any {
+	return strings.ToUpper(template)
+}
+
+func TestParserPlugins(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  vars:
+    subnet: 10.1.0.0
+  tasks:
+    - name: Allow subnet
+      ufw:
+        from_ip: "{{ subnet | mycorp.utils.to_cidr }}"
+`),
+		},
+	}
+
+	plugins := NewPluginRegistry()
+	plugins.AddFilter("mycorp.utils.to_cidr", func(val any, _ []any, _ map[string]any) (any, error) {
+		return fmt.Sprintf("%s/16", val), nil
+	})
+
+	project, err := NewParser(fsys, WithPlugins(plugins)).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 1)
+	module, exists := tasks[0].Module("ufw")
+	require.True(t, exists)
+	assert.Equal(t, "10.1.0.0/16", module["from_ip"])
+
+	project, err = NewParser(fsys, WithTemplater(&stubTemplater{})).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+	tasks = project.ListTasks()
+	require.Len(t, tasks, 1)
+	module, exists = tasks[0].Module("ufw")
+	require.True(t, exists)
+	assert.Equal(t, "{{ SUBNET | MYCORP.UTILS.TO_CIDR }}", module["from_ip"])
+}
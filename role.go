@@ -1,6 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"path"
+
 	"github.com/samber/lo"
 	"gopkg.in/yaml.v3"
 )
@@ -13,13 +17,30 @@ type Role struct {
 	metadata Metadata
 	play     *Play
 
+	// parent is the role that depends on this role
+	parent *Role
+
+	// definition is the role entry through which the role was added to the play
+	definition *RoleDefinition
+
+	// include is the "include_role" task that included the role
+	include *Task
+
 	tasks    []*Task
+	handlers []*Task
 	defaults Variables
 	vars     Variables
 	meta     RoleMeta
+	// metaErr is the error of decoding the meta file, whose dependencies are skipped
+	metaErr error
 
 	directDeps []*Role
 	allDeps    []*Role
+	depsLoaded bool
+
+	// identity is the path and the parameters of the role entry, by which the
+	// roles of a play are deduplicated. It is empty for included roles.
+	identity string
 
 	dataloader *DataLoader
 }
@@ -28,10 +49,112 @@ func (r *Role) IsPublic() bool {
 	return r.pubic
 }
 
+// Handlers returns the handlers of the role.
+func (r *Role) Handlers() Tasks {
+	return r.handlers
+}
+
 func (r *Role) Vars() Variables {
 	return r.vars
 }
 
+// Params returns the role parameters passed by the caller of the role. The
+// dependencies also receive the parameters of the roles that depend on them.
+func (r *Role) Params() Variables {
+	var res Variables
+	if r.parent != nil {
+		res = r.parent.Params()
+	}
+	if r.definition == nil {
+		return res
+	}
+	return lo.Assign(res, r.definition.GetParams())
+}
+
+// When returns the conditions of the role entry, including the conditions
+// of the entries of the roles that depend on the role.
+func (r *Role) When() []string {
+	var res []string
+	if r.parent != nil {
+		res = r.parent.When()
+	}
+	if r.definition == nil {
+		return res
+	}
+	return append(res, r.definition.GetWhen()...)
+}
+
+// Tags returns the tags of the role entry, including the tags of the entries
+// of the roles that depend on the role.
+func (r *Role) Tags() []string {
+	var res []string
+	if r.parent != nil {
+		res = r.parent.Tags()
+	}
+	if r.definition == nil {
+		return res
+	}
+	return append(res, r.definition.GetTags()...)
+}
+
+// includeTask returns the "include_role" task that included the role or
+// the roles that depend on it, or nil if the role was added by the play.
+func (r *Role) includeTask() *Task {
+	for r.parent != nil {
+		r = r.parent
+	}
+	return r.include
+}
+
+// IsDependency reports whether the role was added as a dependency in the
+// "meta/main.yml" file of another role rather than by the play.
+func (r *Role) IsDependency() bool {
+	return r.parent != nil
+}
+
+// keywordLayers returns the keywords of the role entries, from the entry of
+// the outermost dependent role to the entry of the role.
+func (r *Role) keywordLayers() []*keywordsInner {
+	var res []*keywordsInner
+	if r.parent != nil {
+		res = r.parent.keywordLayers()
+	}
+	if r.definition != nil {
+		res = append(res, &r.definition.inner.keywordsInner)
+	}
+	return res
+}
+
+// Become returns the value of the "become" keyword of the role entry or, if it
+// is not set, of the entries of the roles that depend on the role, and whether
+// it is set. Templated values are not rendered and treated as not set.
+func (r *Role) Become() (bool, bool) {
+	var become, exists bool
+	for _, layer := range r.keywordLayers() {
+		if layer.Become == nil {
+			continue
+		}
+		if b, ok := keywordBool(layer.Become); ok {
+			become, exists = b, true
+		}
+	}
+	return become, exists
+}
+
+// Environment returns the environment variables of the role entry merged with
+// the ones of the entries of the roles that depend on the role. Templated
+// values are not rendered and treated as not set.
+func (r *Role) Environment() map[string]any {
+	var res map[string]any
+	for _, layer := range r.keywordLayers() {
+		switch layer.Environment.(type) {
+		case map[string]any, []any:
+			res = lo.Assign(res, environmentVars(layer.Environment))
+		}
+	}
+	return res
+}
+
 func (r *Role) getAllDeps() []*Role {
 	if len(r.allDeps) > 0 {
 		return r.allDeps
@@ -49,15 +172,73 @@ func (r *Role) getDirectDeps() []*Role {
 }
 
 func (r *Role) loadDeps() {
+	if r.depsLoaded {
+		return
+	}
+	r.depsLoaded = true
+
+	// the defaults of the play roles include the defaults of the dependencies
+	if r.dataloader != nil {
+		defer r.dataloader.varResolver.invalidate()
+	}
+	var stack []string
+	if r.play != nil {
+		stack = r.play.includeStack()
+	}
+	stack = append(stack, r.includeStack()...)
+
+	if r.metaErr != nil {
+		r.dataloader.reportIncludeError(stack, r.metaErr)
+		return
+	}
+
 	for _, dep := range r.meta.Dependencies() {
-		depRole, err := r.dataloader.LoadRole(&r.meta.metadata, r.play, dep.GetName())
+		if !r.dataloader.canInclude(stack, roleFrame(roleBaseName(dep.GetName()))) {
+			continue
+		}
+		// the tasks of the dependency refer to the entry in "meta/main.yml",
+		// which is shared by all uses of the role
+		entry := dep.metadata
+		entry.parent = &r.meta.metadata
+		// the dependencies are also searched next to the role
+		depRole, err := r.dataloader.LoadRoleWithOptions(&entry, r.play, dep.GetName(), LoadRoleOptions{
+			roleBaseDir: path.Dir(r.path),
+		})
+		if r.dataloader.reportMissingRole(stack, err) {
+			continue
+		}
 		if err != nil {
-			panic(err) // TODO: handle error
+			r.dataloader.reportIncludeError(stack, fmt.Errorf("failed to load role %q: %w", dep.GetName(), err))
+			continue
 		}
+		depRole.parent = r
+		depRole.definition = dep
+		depRole.identity = roleIdentity(depRole)
 		r.directDeps = append(r.directDeps, depRole)
 	}
 }
 
+// roleIdentity returns the identity of the role added with its role entry. The
+// parameters, variables and conditions of the entry make it a different role,
+// as the role cache of Ansible does. The parameters, conditions and tags of a
+// dependency include the ones inherited from the roles that depend on it.
+func roleIdentity(r *Role) string {
+	if r.definition == nil {
+		return r.path
+	}
+	params, err := json.Marshal(map[string]any{
+		"params": r.Params(),
+		"vars":   r.definition.inner.Vars,
+		"when":   r.When(),
+		"tags":   r.Tags(),
+	})
+	if err != nil {
+		// the entry cannot be compared with the others
+		return fmt.Sprintf("%s %p", r.path, r.definition)
+	}
+	return r.path + " " + string(params)
+}
+
 func (r *Role) LoadDefaultVars() Variables {
 	vars := make(Variables)
 	for _, dep := range r.getAllDeps() {
@@ -69,13 +250,26 @@ func (r *Role) LoadDefaultVars() Variables {
 // Compile returns the list of tasks for this role, which is created by first recursively
 // compiling tasks for all direct dependencies and then adding tasks for this role.
 func (r *Role) Compile() Tasks {
+	return r.compile(make(map[string]bool))
+}
+
+// compile compiles the role unless the same role with the same parameters has
+// already been compiled, since Ansible runs a role only once per play unless
+// the role allows duplicates. The compiled roles are tracked by their identity.
+func (r *Role) compile(compiled map[string]bool) Tasks {
+	if r.identity != "" && !r.meta.AllowDuplicates() {
+		if compiled[r.identity] {
+			return nil
+		}
+		compiled[r.identity] = true
+	}
 
 	r.loadDeps()
 
 	var res Tasks
 
 	for _, dep := range r.getDirectDeps() {
-		res = append(res, dep.Compile()...)
+		res = append(res, dep.compile(compiled)...)
 	}
 
 	for _, task := range r.tasks {
@@ -93,8 +287,23 @@ func (m RoleMeta) Dependencies() []*RoleDefinition {
 	return m.inner.Dependencies
 }
 
+// AllowDuplicates reports whether the role can run more than once in a play
+// with the same parameters.
+func (m RoleMeta) AllowDuplicates() bool {
+	return m.inner.AllowDuplicates
+}
+
+// Collections returns the collections searched for the modules of the role.
+func (m RoleMeta) Collections() []string {
+	return m.inner.Collections
+}
+
 type roleMetaInner struct {
 	Dependencies []*RoleDefinition `yaml:"dependencies"`
+	Collections  StringList        `yaml:"collections"`
+
+	AllowDuplicates bool       `yaml:"allow_duplicates"`
+	GalaxyInfo      GalaxyInfo `yaml:"galaxy_info"`
 }
 
 func (m *RoleMeta) UnmarshalYAML(node *yaml.Node) error {
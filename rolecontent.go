@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+// roleContent is the parsed content of all files of a role. It is loaded once
+// per role directory and shared by all uses of the role, which derive their
+// tasks, variables and metadata from it.
+type roleContent struct {
+	path string
+
+	// the keys are the file paths relative to the section directory without
+	// the extension, e.g. "main" or "install/debian"
+	tasks    map[string]roleTasksFile
+	handlers map[string]roleTasksFile
+	defaults map[string]Variables
+	vars     map[string]Variables
+	meta     *RoleMeta
+	metaErr  error
+}
+
+// roleTasksFile is the parsed tasks file. The tasks are decoded for each use
+// of the role, since the tasks are bound to the role, the play and the parent.
+type roleTasksFile struct {
+	path string
+	node *yaml.Node
+	err  error
+}
+
+// loadRoleContent returns the content of the role from the cache, or parses
+// all files of the role directory.
+func (l *DataLoader) loadRoleContent(rolePath string) (*roleContent, error) {
+	if content, exists := l.roleContents[rolePath]; exists {
+		return content, nil
+	}
+
+	content := &roleContent{
+		path:     rolePath,
+		tasks:    make(map[string]roleTasksFile),
+		handlers: make(map[string]roleTasksFile),
+		defaults: make(map[string]Variables),
+		vars:     make(map[string]Variables),
+	}
+
+	walkFn := func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isYAMLFile(d.Name()) {
+			return nil
+		}
+
+		section, name, ok := strings.Cut(strings.TrimPrefix(filePath, rolePath+"/"), "/")
+		if !ok {
+			return nil
+		}
+		name = cutExtension(name)
+
+		switch section {
+		case "tasks", "handlers":
+			files := lo.Ternary(section == "tasks", content.tasks, content.handlers)
+			// "main.yml" and "main.yaml" are the same file for Ansible
+			if _, exists := files[name]; !exists {
+				files[name] = l.parseTasksFile(filePath)
+			}
+		case "defaults", "vars":
+			files := lo.Ternary(section == "defaults", content.defaults, content.vars)
+			if _, exists := files[name]; exists {
+				return nil
+			}
+			vars, err := l.parseVarsFile(filePath)
+			if err != nil {
+				log.Printf("Failed to decode variables from %q: %s", filePath, err)
+				return nil
+			}
+			files[name] = vars
+		case "meta":
+			if name != "main" || content.meta != nil {
+				return nil
+			}
+			meta, err := l.parseMetaFile(filePath)
+			if err != nil {
+				content.metaErr = fmt.Errorf("failed to decode meta file %q: %w", filePath, err)
+				return nil
+			}
+			content.meta = &meta
+		}
+		return nil
+	}
+	if err := fs.WalkDir(l.fsys, rolePath, walkFn); err != nil {
+		return nil, err
+	}
+
+	l.roleContents[rolePath] = content
+	return content, nil
+}
+
+func (l *DataLoader) parseTasksFile(filePath string) roleTasksFile {
+	res := roleTasksFile{path: filePath}
+	data, err := fs.ReadFile(l.fsys, filePath)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		res.err = fmt.Errorf("failed to decode tasks file %q: %w", filePath, err)
+		return res
+	}
+	res.node = &node
+	return res
+}
+
+// newRole returns the use of the role with the files selected by the options.
+func (l *DataLoader) newRole(content *roleContent, meta *Metadata, play *Play, name string, opt LoadRoleOptions) (*Role, error) {
+	r := &Role{
+		name: name,
+		path: content.path,
+		metadata: Metadata{
+			parent: meta,
+			path:   content.path,
+		},
+		play:       play,
+		dataloader: l,
+		defaults:   lo.Assign(content.defaults[roleFileKey(opt.DefaultsFile)]),
+		vars:       lo.Assign(content.vars[roleFileKey(opt.VarsFile)]),
+	}
+
+	r.metaErr = content.metaErr
+	if content.meta != nil {
+		r.meta = *content.meta
+		r.meta.metadata.parent = &r.metadata
+	}
+
+	var err error
+	if r.tasks, err = l.roleTasks(r, content.tasks, opt.TasksFile); err != nil {
+		return nil, fmt.Errorf("failed to load tasks: %w", err)
+	}
+	if r.handlers, err = l.roleTasks(r, content.handlers, opt.HandlersFile); err != nil {
+		return nil, fmt.Errorf("failed to load handlers: %w", err)
+	}
+	return r, nil
+}
+
+// roleTasks decodes the tasks of the role file, if the file exists.
+func (l *DataLoader) roleTasks(r *Role, files map[string]roleTasksFile, name string) (Tasks, error) {
+	file, exists := files[roleFileKey(name)]
+	if !exists {
+		return nil, nil
+	}
+	if file.err != nil {
+		return nil, file.err
+	}
+	var tasks Tasks
+	if err := file.node.Decode(&tasks); err != nil {
+		return nil, fmt.Errorf("failed to decode tasks file %q: %w", file.path, err)
+	}
+	return l.initTasks(tasks, &r.metadata, r, file.path), nil
+}
+
+// roleFileKey returns the key of the file passed with e.g. "tasks_from",
+// which can have an extension.
+func roleFileKey(name string) string {
+	return cutExtension(path.Clean(name))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// GalaxyInfo is the "galaxy_info" section of the role metadata, which
+// describes the role for Ansible Galaxy.
+//
+// See https://galaxy.ansible.com/docs/contributing/creating_role.html#role-metadata
+type GalaxyInfo struct {
+	RoleName          string         `yaml:"role_name"`
+	Namespace         string         `yaml:"namespace"`
+	Author            string         `yaml:"author"`
+	Description       string         `yaml:"description"`
+	Company           string         `yaml:"company"`
+	License           StringList     `yaml:"license"`
+	MinAnsibleVersion string         `yaml:"min_ansible_version"`
+	Platforms         []RolePlatform `yaml:"platforms"`
+	GalaxyTags        StringList     `yaml:"galaxy_tags"`
+}
+
+// RolePlatform is an operating system the role supports, e.g. "Ubuntu" with
+// the versions "jammy" and "noble", or "EL" with "8" and "9". The "all"
+// version stands for all versions of the platform.
+type RolePlatform struct {
+	Name     string     `yaml:"name"`
+	Versions StringList `yaml:"versions"`
+}
+
+const allPlatformVersions = "all"
+
+// galaxyPlatformNames maps the distributions of the facts to the platform
+// names used by Ansible Galaxy, if the names differ.
+var galaxyPlatformNames = map[string]string{
+	"redhat":      "el",
+	"centos":      "el",
+	"rocky":       "el",
+	"almalinux":   "el",
+	"oraclelinux": "el",
+	"scientific":  "el",
+}
+
+// SupportsPlatform reports whether the role declares support for the operating
+// system described by the facts. The roles that declare no platforms, and the
+// facts without a distribution, are considered supported.
+func (g GalaxyInfo) SupportsPlatform(facts FactProfile) bool {
+	distribution, _ := facts["distribution"].(string)
+	if len(g.Platforms) == 0 || distribution == "" {
+		return true
+	}
+	system, _ := facts["system"].(string)
+
+	name := strings.ToLower(distribution)
+	if galaxyName, exists := galaxyPlatformNames[name]; exists {
+		name = galaxyName
+	}
+
+	versions := lo.FilterMap([]string{"distribution_version", "distribution_major_version", "distribution_release"},
+		func(key string, _ int) (string, bool) {
+			version := strings.ToLower(fmt.Sprint(facts[key]))
+			return version, facts[key] != nil && version != ""
+		})
+
+	for _, platform := range g.Platforms {
+		switch platformName := strings.ToLower(platform.Name); {
+		case platformName == "genericlinux" && system == "Linux",
+			platformName == "genericunix" && system != "Windows":
+			return true
+		case platformName != name && platformName != strings.ToLower(distribution):
+			continue
+		}
+		for _, version := range platform.Versions {
+			version = strings.ToLower(version)
+			if version == allPlatformVersions || lo.Contains(versions, version) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GalaxyInfo returns the "galaxy_info" section of the role metadata.
+func (m RoleMeta) GalaxyInfo() GalaxyInfo {
+	return m.inner.GalaxyInfo
+}
+
+// Name returns the name of the role.
+func (r *Role) Name() string {
+	return r.name
+}
+
+// Meta returns the metadata of the role from the "meta/main.yml" file.
+func (r *Role) Meta() RoleMeta {
+	return r.meta
+}
+
+// checkRolePlatforms reports the roles of the compiled tasks applied to the
+// hosts of the play whose facts show an operating system the roles do not
+// declare support for.
+func (p *Play) checkRolePlatforms(tasks Tasks) {
+	if p.dataloader == nil {
+		return
+	}
+	hosts := p.dataloader.varResolver.PlayHosts(p)
+	inventory := p.dataloader.varResolver.getInventory()
+	if len(hosts) == 0 || inventory == nil {
+		return
+	}
+
+	var roles []*Role
+	for _, task := range tasks {
+		for _, role := range task.roleChain() {
+			if !lo.Contains(roles, role) {
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	for _, role := range roles {
+		galaxyInfo := role.meta.GalaxyInfo()
+		for _, host := range hosts {
+			facts := inventory.HostFacts(host)
+			if galaxyInfo.SupportsPlatform(facts) {
+				continue
+			}
+			p.dataloader.report(Diagnostic{
+				Kind: DiagnosticUnsupportedPlatform,
+				Message: fmt.Sprintf("Role %q does not declare support for %v %v of host %q",
+					role.name, facts["distribution"], facts["distribution_version"], host),
+				Chain: append(p.includeStack(), role.includeStack()...),
+			})
+		}
+	}
+}
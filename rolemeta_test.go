@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleGalaxyInfo(t *testing.T) {
+	fsys := fstest.MapFS{
+		"roles/nginx/meta/main.yaml": {
+			Data: []byte(`---
+galaxy_info:
+  role_name: nginx
+  namespace: acme
+  author: Jane Doe
+  description: Installs nginx
+  license: MIT
+  min_ansible_version: 2.9
+  platforms:
+    - name: Ubuntu
+      versions:
+        - jammy
+        - noble
+    - name: EL
+      versions: [8, 9]
+  galaxy_tags: [web, nginx]
+collections:
+  - community.general
+dependencies: []
+`),
+		},
+		"roles/nginx/tasks/main.yaml": {Data: []byte(`[{name: Install, package: {name: nginx}}]`)},
+	}
+
+	role, err := NewDataloader(fsys, ".").LoadRole(nil, nil, "nginx")
+	require.NoError(t, err)
+
+	assert.Equal(t, "nginx", role.Name())
+	assert.Equal(t, []string{"community.general"}, role.Meta().Collections())
+	assert.Equal(t, GalaxyInfo{
+		RoleName:          "nginx",
+		Namespace:         "acme",
+		Author:            "Jane Doe",
+		Description:       "Installs nginx",
+		License:           StringList{"MIT"},
+		MinAnsibleVersion: "2.9",
+		Platforms: []RolePlatform{
+			{Name: "Ubuntu", Versions: StringList{"jammy", "noble"}},
+			{Name: "EL", Versions: StringList{"8", "9"}},
+		},
+		GalaxyTags: StringList{"web", "nginx"},
+	}, role.Meta().GalaxyInfo())
+
+	tests := []struct {
+		preset    string
+		supported bool
+	}{
+		{"Ubuntu 22.04", true},
+		{"Ubuntu 20.04", false},
+		{"RHEL 9", true},
+		{"Rocky 9", true},
+		{"CentOS 7", false},
+		{"Debian 12", false},
+	}
+	for _, tt := range tests {
+		facts, ok := FactProfilePreset(tt.preset)
+		require.True(t, ok, tt.preset)
+		assert.Equal(t, tt.supported, role.Meta().GalaxyInfo().SupportsPlatform(facts), tt.preset)
+	}
+
+	assert.True(t, GalaxyInfo{}.SupportsPlatform(FactProfile{"distribution": "Debian"}))
+	assert.True(t, role.Meta().GalaxyInfo().SupportsPlatform(nil))
+	generic := GalaxyInfo{Platforms: []RolePlatform{{Name: "GenericLinux", Versions: StringList{"all"}}}}
+	alpine, _ := FactProfilePreset("Alpine 3.18")
+	assert.True(t, generic.SupportsPlatform(alpine))
+}
+
+func TestRolePlatformWarnings(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  roles:
+    - app
+`),
+		},
+		"inventory/hosts": {
+			Data: []byte(`[ubuntu]
+web1
+
+[alpine]
+web2
+`),
+		},
+		"roles/app/meta/main.yaml": {
+			Data: []byte(`---
+galaxy_info:
+  platforms:
+    - name: Ubuntu
+      versions: [all]
+dependencies:
+  - base
+`),
+		},
+		"roles/app/tasks/main.yaml":  {Data: []byte(`[{name: App, debug: {msg: app}}]`)},
+		"roles/base/tasks/main.yaml": {Data: []byte(`[{name: Base, debug: {msg: base}}]`)},
+	}
+
+	ubuntu, _ := FactProfilePreset("Ubuntu 22.04")
+	alpine, _ := FactProfilePreset("Alpine 3.18")
+
+	project, err := NewParser(fsys,
+		WithFactProfile("ubuntu", ubuntu),
+		WithFactProfile("alpine", alpine),
+	).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	project.ListTasks()
+	project.ListTasks()
+
+	diagnostics := lo.Filter(project.Diagnostics(), func(d Diagnostic, _ int) bool {
+		return d.Kind == DiagnosticUnsupportedPlatform
+	})
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, `Role "app" does not declare support for Alpine 3.18 of host "web2"`, diagnostics[0].Message)
+	assert.Equal(t, []string{"playbook.yaml", "role app"}, diagnostics[0].Chain)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+const (
+	// rolesPathEnv is the environment variable that overrides the "roles_path"
+	// setting of ansible.cfg.
+	rolesPathEnv = "ANSIBLE_ROLES_PATH"
+	// legacyRolesPathEnv is the environment variable that earlier versions of
+	// the parser read the roles path from. It is still supported, but only
+	// when neither rolesPathEnv nor ansible.cfg sets the roles path.
+	legacyRolesPathEnv = "DEFAULT_ROLES_PATH"
+)
+
+// defaultRolesPath is the roles path used when neither the environment
+// variables nor ansible.cfg set it.
+var defaultRolesPath = []string{
+	"~/.ansible/roles",
+	"/usr/share/ansible/roles",
+	"/etc/ansible/roles",
+}
+
+// RoleNotFoundError is returned when a role is not found in any of the role search paths.
+type RoleNotFoundError struct {
+	Name     string
+	Searched []string
+}
+
+func (e *RoleNotFoundError) Error() string {
+	return fmt.Sprintf("the role %q was not found in %s", e.Name, strings.Join(e.Searched, ":"))
+}
+
+// resolveConfigPaths expands the home directory and the environment variables
+// in the paths. The relative paths are resolved against baseDir, e.g. the
+// directory of the configuration file.
+func resolveConfigPaths(paths []string, baseDir string) []string {
+	return lo.FilterMap(paths, func(p string, _ int) (string, bool) {
+		p = os.ExpandEnv(strings.TrimSpace(p))
+		if p == "" {
+			return "", false
+		}
+		if p == "~" || strings.HasPrefix(p, "~/") {
+			if homedir, err := os.UserHomeDir(); err == nil {
+				p = filepath.Join(homedir, p[1:])
+			}
+		}
+		if !filepath.IsAbs(p) && baseDir != "" {
+			p = filepath.Join(baseDir, p)
+		}
+		return p, true
+	})
+}
+
+// toFSPath converts the path to a path of the project file system, in which
+// the absolute paths are relative to the root.
+func toFSPath(p string) string {
+	p = path.Clean(filepath.ToSlash(p))
+	if path.IsAbs(p) {
+		return lo.Ternary(p == "/", ".", strings.TrimPrefix(p, "/"))
+	}
+	return p
+}
+
+// roleSearchPaths returns the directories where the roles are searched, in
+// the order Ansible uses: the "roles" directory next to the playbook, the
+// roles path, the directory of the role that depends on or includes the role,
+// and the playbook directory. The roles path falls back to the default roles
+// path of Ansible, e.g. "/etc/ansible/roles", whose absolute paths are
+// resolved in the project file system.
+//
+// See https://docs.ansible.com/ansible/latest/playbook_guide/playbooks_reuse_roles.html#storing-and-finding-roles
+func (l *DataLoader) roleSearchPaths(playbookDir string, roleBaseDir string) []string {
+	dirs := []string{
+		path.Join(playbookDir, "roles"),
+		// the project root is the working directory, which is searched for
+		// the playbooks in the subdirectories of the project
+		path.Join(l.root, "roles"),
+	}
+	dirs = append(dirs, l.rolesPath...)
+	if roleBaseDir != "" {
+		dirs = append(dirs, roleBaseDir)
+	}
+	dirs = append(dirs, playbookDir)
+	return lo.Uniq(lo.Map(dirs, func(dir string, _ int) string {
+		return toFSPath(dir)
+	}))
+}
+
+// resolveRolePath returns the directory of the role. A role can also be
+// referenced by its path, e.g. "role: ../shared/myrole", which is relative
+// to the playbook directory.
+func (l *DataLoader) resolveRolePath(name string, playbookDir string, roleBaseDir string) (string, error) {
+	candidates := lo.Map(l.roleSearchPaths(playbookDir, roleBaseDir), func(dir string, _ int) string {
+		return toFSPath(path.Join(dir, name))
+	})
+	if path.IsAbs(name) {
+		candidates = []string{toFSPath(name)}
+	} else {
+		candidates = append(candidates, toFSPath(path.Join(playbookDir, name)))
+	}
+	candidates = lo.Uniq(candidates)
+
+	for _, candidate := range candidates {
+		if info, err := fs.Stat(l.fsys, candidate); err == nil && info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", &RoleNotFoundError{Name: name, Searched: candidates}
+}
+
+// roleBaseName returns the name of the role referenced by its name or its path.
+func roleBaseName(name string) string {
+	if strings.Contains(name, "/") {
+		return path.Base(name)
+	}
+	return name
+}
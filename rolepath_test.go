@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleSearchPaths(t *testing.T) {
+	debugTask := func(name string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte("[{name: " + name + ", debug: {msg: " + name + "}}]")}
+	}
+
+	fsys := fstest.MapFS{
+		"ansible.cfg": {
+			Data: []byte(`[defaults]
+roles_path = shared-roles
+`),
+		},
+		"playbooks/site.yaml": {
+			Data: []byte(`---
+- hosts: all
+  roles:
+    - local
+    - common
+    - ../vendor/app
+    - ghost
+  tasks:
+    - name: Include env role
+      include_role:
+        name: env
+`),
+		},
+		"playbooks/roles/local/tasks/main.yaml": debugTask("Local"),
+		"shared-roles/common/tasks/main.yaml":   debugTask("Common"),
+		"vendor/app/meta/main.yaml": {
+			Data: []byte(`---
+dependencies:
+  - role: helper
+`),
+		},
+		"vendor/app/tasks/main.yaml":    debugTask("App"),
+		"vendor/helper/tasks/main.yaml": debugTask("Helper"),
+		"env-a/env/tasks/main.yaml":     debugTask("Env"),
+		"env-b/common/tasks/main.yaml":  debugTask("Env common"),
+	}
+
+	taskNames := func(project *AnsibleProject) []string {
+		return lo.Map(project.ListTasks(), func(task *Task, _ int) string {
+			return task.Name()
+		})
+	}
+
+	t.Run("config roles path", func(t *testing.T) {
+		t.Setenv(rolesPathEnv, "")
+		t.Setenv(legacyRolesPathEnv, "")
+
+		project, err := NewParser(fsys).ParseProject(".", "playbooks/site.yaml")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"Local", "Common", "Helper", "App"}, taskNames(project))
+
+		diagnostics := project.Diagnostics()
+		require.Len(t, diagnostics, 2)
+		assert.Equal(t, Diagnostic{
+			Kind:    DiagnosticRoleNotFound,
+			Message: `Role "ghost" not found`,
+			Chain:   []string{"playbooks/site.yaml", "role ghost"},
+			Searched: []string{
+				"playbooks/roles/ghost",
+				"roles/ghost",
+				"shared-roles/ghost",
+				"playbooks/ghost",
+			},
+		}, diagnostics[0])
+		assert.Equal(t, DiagnosticRoleNotFound, diagnostics[1].Kind)
+		assert.Equal(t, []string{"playbooks/site.yaml", "role env"}, diagnostics[1].Chain)
+	})
+
+	t.Run("environment roles path", func(t *testing.T) {
+		t.Setenv(rolesPathEnv, "env-a:env-b")
+
+		project, err := NewParser(fsys).ParseProject(".", "playbooks/site.yaml")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"Local", "Env common", "Helper", "App", "Env"}, taskNames(project))
+	})
+
+	withoutConfig := fstest.MapFS{}
+	for name, file := range fsys {
+		if name != "ansible.cfg" {
+			withoutConfig[name] = file
+		}
+	}
+
+	t.Run("legacy environment roles path", func(t *testing.T) {
+		t.Setenv(rolesPathEnv, "")
+		t.Setenv(legacyRolesPathEnv, "env-a:env-b")
+
+		// the configuration file takes precedence over the legacy variable
+		project, err := NewParser(fsys).ParseProject(".", "playbooks/site.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Local", "Common", "Helper", "App"}, taskNames(project))
+
+		project, err = NewParser(withoutConfig).ParseProject(".", "playbooks/site.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Local", "Env common", "Helper", "App", "Env"}, taskNames(project))
+	})
+
+	t.Run("default roles path", func(t *testing.T) {
+		t.Setenv(rolesPathEnv, "")
+		t.Setenv(legacyRolesPathEnv, "")
+
+		defaultPath := fstest.MapFS{
+			"etc/ansible/roles/ghost/tasks/main.yaml": debugTask("Ghost"),
+		}
+		for name, file := range withoutConfig {
+			defaultPath[name] = file
+		}
+
+		project, err := NewParser(defaultPath).ParseProject(".", "playbooks/site.yaml")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"Local", "Helper", "App", "Ghost"}, taskNames(project))
+
+		common, found := lo.Find(project.Diagnostics(), func(d Diagnostic) bool {
+			return d.Message == `Role "common" not found`
+		})
+		require.True(t, found)
+		assert.Subset(t, common.Searched, []string{
+			"playbooks/roles/common",
+			"roles/common",
+			"usr/share/ansible/roles/common",
+			"etc/ansible/roles/common",
+			"playbooks/common",
+		})
+	})
+}
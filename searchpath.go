@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// SearchPath resolves the relative paths of the files used by the tasks, e.g.
+// the files of "include_tasks", the "src" of the "template" module or the files
+// read by lookups, as Ansible does.
+//
+// See https://docs.ansible.com/ansible/latest/playbook_guide/playbook_pathing.html#resolving-local-relative-paths
+type SearchPath struct {
+	// dirs are the directories searched first: the path of the task role,
+	// the paths of the roles that depend on it or include it, and the directory
+	// of the task file.
+	dirs []string
+	// baseDir is the playbook directory searched as the last resort.
+	baseDir string
+}
+
+// FileNotFoundError is returned when a file is not found in any of the search paths.
+type FileNotFoundError struct {
+	Name     string
+	Searched []string
+}
+
+func (e *FileNotFoundError) Error() string {
+	return fmt.Sprintf("could not find file %q, searched: %s", e.Name, strings.Join(e.Searched, ", "))
+}
+
+// Candidates returns the paths where the file is searched, in order. Each
+// directory is searched with the subdirectory (e.g. "tasks", "files" or
+// "templates") and without it. For the "tasks" directories of roles, the
+// subdirectory of the role is searched instead.
+func (p SearchPath) Candidates(subdir string, name string) []string {
+	if path.IsAbs(name) {
+		return []string{strings.TrimPrefix(path.Clean(name), "/")}
+	}
+
+	// the subdirectory is not added if the name already starts with it
+	withSubdir := func(dir string) string {
+		if first, _, _ := strings.Cut(name, "/"); first == subdir || subdir == "" {
+			return ""
+		}
+		return path.Join(dir, subdir, name)
+	}
+
+	var res []string
+	for _, dir := range p.dirs {
+		if path.Base(dir) == "tasks" {
+			res = append(res, path.Join(path.Dir(dir), subdir, name), path.Join(dir, name))
+			continue
+		}
+		res = append(res, withSubdir(dir), path.Join(dir, name))
+	}
+	baseDir := lo.Ternary(p.baseDir == "", ".", p.baseDir)
+	res = append(res, withSubdir(baseDir), path.Join(baseDir, name))
+
+	return lo.Uniq(lo.Compact(res))
+}
+
+// Find returns the first existing file among the candidate paths.
+func (p SearchPath) Find(fsys fs.FS, subdir string, name string) (string, error) {
+	candidates := p.Candidates(subdir, name)
+	for _, candidate := range candidates {
+		if info, err := fs.Stat(fsys, candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", &FileNotFoundError{Name: name, Searched: candidates}
+}
+
+// Dirs returns the directories of the search path, as the
+// "ansible_search_path" variable contains them.
+func (p SearchPath) Dirs() []string {
+	return p.dirs
+}
+
+// SearchPath returns the search path of the files used by the task.
+func (t *Task) SearchPath() SearchPath {
+	var res SearchPath
+	for _, role := range t.roleChain() {
+		res.dirs = append(res.dirs, role.path)
+	}
+	if t.metadata.path != "" {
+		res.dirs = append(res.dirs, path.Dir(t.metadata.path))
+	}
+	res.dirs = lo.Uniq(res.dirs)
+
+	if play := t.Play(); play != nil && play.GetPath() != "" {
+		res.baseDir = path.Dir(play.GetPath())
+	}
+	return res
+}
+
+// SearchPath returns the search path of the files used by the play itself,
+// e.g. the "vars_files", which contains only the playbook directory.
+func (p *Play) SearchPath() SearchPath {
+	return SearchPath{baseDir: path.Dir(p.GetPath())}
+}
+
+// roleChain returns the role of the task followed by the roles that depend
+// on it and the roles of the includes, from the innermost to the outermost.
+func (t *Task) roleChain() []*Role {
+	var res []*Role
+	for task := t; task != nil; task = task.scopeParent() {
+		for role := task.role; role != nil; role = role.parent {
+			if !lo.Contains(res, role) {
+				res = append(res, role)
+			}
+		}
+	}
+	return res
+}
+
+// FindFile returns the path of the file used by the task, searching
+// the subdirectory of the role and playbook, e.g. "files" or "templates".
+func (t *Task) FindFile(subdir string, name string) (string, error) {
+	if t.dataloader == nil {
+		return "", fmt.Errorf("no filesystem available to find %q", name)
+	}
+	return t.SearchPath().Find(t.dataloader.fsys, subdir, name)
+}
+
+// srcSubdirs are the subdirectories searched for the "src" parameter
+// of the modules that transfer local files to the managed hosts.
+var srcSubdirs = map[string]string{
+	"ansible.builtin.copy":      "files",
+	"ansible.builtin.template":  "templates",
+	"ansible.builtin.unarchive": "files",
+}
+
+// SourceFile returns the local path of the "src" parameter of the "copy",
+// "template" and "unarchive" modules. It returns false if the task does not
+// run these modules or the source is on the managed host ("remote_src").
+func (t *Task) SourceFile() (string, bool, error) {
+	action, ok := t.Action()
+	if !ok {
+		return "", false, nil
+	}
+	subdir, ok := srcSubdirs[action.FQCN]
+	if !ok {
+		return "", false, nil
+	}
+	if remote, _ := keywordBool(action.Params["remote_src"]); remote {
+		return "", false, nil
+	}
+
+	src, ok := action.Params["src"].(string)
+	if !ok {
+		return "", true, fmt.Errorf("source of task %q cannot be resolved: %v", t.Name(), action.Params["src"])
+	}
+	res, err := t.FindFile(subdir, src)
+	return res, true, err
+}
+
+// searchPathFromVars returns the search path of the task whose variables
+// are used to render templates, which is stored in the "ansible_search_path"
+// and "playbook_dir" variables.
+func searchPathFromVars(vars Variables) SearchPath {
+	var res SearchPath
+	switch dirs := vars["ansible_search_path"].(type) {
+	case []string:
+		res.dirs = dirs
+	case []any:
+		for _, dir := range dirs {
+			if s, ok := dir.(string); ok && s != "" {
+				res.dirs = append(res.dirs, s)
+			}
+		}
+	}
+	if len(res.dirs) == 0 {
+		if dir, ok := vars["role_path"].(string); ok && dir != "" {
+			res.dirs = []string{dir}
+		}
+	}
+	if dir, ok := vars["playbook_dir"].(string); ok {
+		res.baseDir = dir
+	}
+	return res
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchPathCandidates(t *testing.T) {
+	sp := SearchPath{
+		dirs:    []string{"roles/app", "roles/base", "roles/app/tasks"},
+		baseDir: "playbooks",
+	}
+
+	assert.Equal(t, []string{
+		"roles/app/files/app.conf",
+		"roles/app/app.conf",
+		"roles/base/files/app.conf",
+		"roles/base/app.conf",
+		"roles/app/tasks/app.conf",
+		"playbooks/files/app.conf",
+		"playbooks/app.conf",
+	}, sp.Candidates("files", "app.conf"))
+
+	assert.Equal(t, []string{
+		"roles/app/files/app.conf",
+		"roles/base/files/app.conf",
+		"roles/app/files/files/app.conf",
+		"roles/app/tasks/files/app.conf",
+		"playbooks/files/app.conf",
+	}, sp.Candidates("files", "files/app.conf"))
+
+	assert.Equal(t, []string{"etc/app.conf"}, sp.Candidates("files", "/etc/app.conf"))
+
+	_, err := sp.Find(fstest.MapFS{}, "files", "app.conf")
+	var notFound *FileNotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "app.conf", notFound.Name)
+	assert.Len(t, notFound.Searched, 7)
+}
+
+func TestSearchPathIncludes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  vars:
+    os: debian
+  vars_files:
+    - "vars/{{ os }}.yaml"
+  roles:
+    - app
+  tasks:
+    - name: Setup
+      include_tasks: tasks/setup.yaml
+    - name: Missing tasks
+      include_tasks: missing.yaml
+`),
+		},
+		"vars/debian.yaml": {
+			Data: []byte(`package: apt`),
+		},
+		"tasks/setup.yaml": {
+			Data: []byte(`---
+- name: Common
+  import_tasks: common.yaml
+`),
+		},
+		"tasks/common.yaml": {
+			Data: []byte(`---
+- name: Install with {{ package }}
+  debug:
+    msg: "{{ package }}"
+`),
+		},
+		"roles/app/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Install
+  include_tasks: "{{ os }}.yaml"
+`),
+		},
+		"roles/app/tasks/debian.yaml": {
+			Data: []byte(`---
+- name: Copy config
+  copy:
+    src: app.conf
+    dest: /etc/app.conf
+- name: Render config
+  template:
+    src: app.conf.j2
+    dest: /etc/app.conf
+`),
+		},
+		"roles/app/files/app.conf":        {Data: []byte(`port=80`)},
+		"roles/app/templates/app.conf.j2": {Data: []byte(`port={{ port }}`)},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 3)
+
+	// the tasks of the roles run before the tasks of the play
+	assert.Equal(t, "roles/app/tasks/debian.yaml", tasks[0].metadata.path)
+	src, ok, err := tasks[0].SourceFile()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "roles/app/files/app.conf", src)
+
+	src, ok, err = tasks[1].SourceFile()
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "roles/app/templates/app.conf.j2", src)
+
+	assert.Equal(t, "tasks/common.yaml", tasks[2].metadata.path)
+	msg, exists := tasks[2].Module("debug")
+	require.True(t, exists)
+	assert.Equal(t, "apt", msg["msg"])
+
+	assert.Equal(t, []string{"roles/app", "roles/app/tasks"}, tasks[1].SearchPath().Dirs())
+}
+
+func TestSearchPathMissingFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbooks/site.yaml": {
+			Data: []byte(`---
+- hosts: all
+  vars_files:
+    - vars/missing.yaml
+  roles:
+    - app
+`),
+		},
+		"playbooks/roles/app/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Include setup
+  include_tasks: setup.yaml
+- name: Debug
+  debug:
+    msg: debug
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbooks/site.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 1)
+	tasks[0].getVars()
+
+	assert.Equal(t, []Diagnostic{
+		{
+			Kind:     DiagnosticFileNotFound,
+			Message:  `File "vars/missing.yaml" not found`,
+			Chain:    []string{"playbooks/site.yaml", "vars/missing.yaml"},
+			Searched: []string{"playbooks/vars/missing.yaml"},
+		},
+		{
+			Kind:    DiagnosticFileNotFound,
+			Message: `File "setup.yaml" not found`,
+			Chain:   []string{"playbooks/site.yaml", "role app", "playbooks/roles/app/tasks/main.yaml", "setup.yaml"},
+			Searched: []string{
+				"playbooks/roles/app/tasks/setup.yaml",
+				"playbooks/roles/app/setup.yaml",
+				"playbooks/tasks/setup.yaml",
+				"playbooks/setup.yaml",
+			},
+		},
+	}, project.Diagnostics())
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"log"
-	"path/filepath"
+	"path"
+	"slices"
+	"strings"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/samber/lo"
@@ -43,6 +46,15 @@ func (m Module) ToStringMap() map[string]string {
 
 type Tasks []*Task
 
+// BlockSection is the section of a block: "block", "rescue" or "always".
+type BlockSection string
+
+const (
+	SectionBlock  BlockSection = "block"
+	SectionRescue BlockSection = "rescue"
+	SectionAlways BlockSection = "always"
+)
+
 // Compile expands and compiles this collection of tasks, returning a flattened
 // list of all resulting tasks. Each Task within the collection is compiled
 // recursively, producing its constituent tasks, which are then appended to the
@@ -64,20 +76,42 @@ type Task struct {
 	role     *Role
 	play     *Play
 	parent   *Task
+	host     string
+	facts    FactProfile
 
 	varResolver *VariableResolver
-	templater   *Templater
+	templater   Templater
+
+	// section is the section of the parent block the task is defined in
+	section BlockSection
+	// index is the position of the task in its file or block section, starting with 1
+	index int
+	// playList is the list of the play the task is defined in, e.g. "pre_tasks"
+	playList string
+	// loopIndex is the index of the loop item of the include iteration
+	loopIndex *int
 
 	raw        map[string]any
 	dataloader *DataLoader
 
 	cachedVars Variables
+	// varsGeneration is the generation of the variable resolver
+	// the cached variables were computed in
+	varsGeneration uint64
 }
 
 type taskInner struct {
-	Name  string    `yaml:"name"`
-	Block []*Task   `yaml:"block"`
-	Vars  Variables `yaml:"vars"`
+	Name        string     `yaml:"name"`
+	Block       []*Task    `yaml:"block"`
+	Rescue      []*Task    `yaml:"rescue"`
+	Always      []*Task    `yaml:"always"`
+	Vars        Variables  `yaml:"vars"`
+	When        StringList `yaml:"when"`
+	Tags        StringList `yaml:"tags"`
+	ChangedWhen StringList `yaml:"changed_when"`
+	Collections StringList `yaml:"collections"`
+
+	keywordsInner `yaml:",inline"`
 }
 
 func (t *Task) GetMetadata() Metadata {
@@ -93,22 +127,163 @@ func (t *Task) Role() *Role {
 }
 
 func (t *Task) Play() *Play {
-	if t.role != nil {
+	if t.role != nil && t.role.play != nil {
 		return t.role.play
 	}
-	return t.play
+	if t.play != nil {
+		return t.play
+	}
+	if t.parent != nil {
+		return t.parent.Play()
+	}
+	return nil
+}
+
+// Host returns the host the task is bound to, or an empty string
+// if the task is rendered without a host context.
+func (t *Task) Host() string {
+	return t.host
+}
+
+// WithFacts returns a copy of the task bound to the given facts. The facts
+// take precedence over the facts attached to the task host in the inventory.
+func (t *Task) WithFacts(facts FactProfile) *Task {
+	res := *t
+	res.facts = facts
+	res.cachedVars = nil
+	return &res
+}
+
+// ForHost returns a copy of the task bound to the given host.
+func (t *Task) ForHost(host string) *Task {
+	res := *t
+	res.host = host
+	res.cachedVars = nil
+	return &res
 }
 
 func (t *Task) Vars() Variables {
 	return t.inner.Vars
 }
 
+// scopeParent returns the parent of the task or, for the top-level tasks
+// of the dependencies of an included role, the "include_role" task. The
+// dependency tasks are not children of the include, so that they inherit
+// the keywords of their role entries, but they share the scope of the include.
+func (t *Task) scopeParent() *Task {
+	if t.parent != nil {
+		return t.parent
+	}
+	if t.role != nil {
+		return t.role.includeTask()
+	}
+	return nil
+}
+
+// scopeVars returns the variables of the task merged with the variables
+// of the parent blocks and includes.
+func (t *Task) scopeVars() Variables {
+	parent := t.scopeParent()
+	if parent == nil {
+		return t.inner.Vars
+	}
+	return lo.Assign(parent.scopeVars(), parent.legacyIncludeVars(), t.inner.Vars)
+}
+
+// When returns the conditions of the task, including the conditions inherited
+// from the parent blocks, includes and the role entry.
+func (t *Task) When() []string {
+	var res []string
+	if t.parent != nil {
+		res = append(res, t.parent.When()...)
+	} else if t.role != nil {
+		if include := t.role.includeTask(); include != nil {
+			res = append(res, include.When()...)
+		}
+		res = append(res, t.role.When()...)
+	}
+	return append(res, t.inner.When...)
+}
+
+// Tags returns the tags of the task, including the tags inherited
+// from the parent blocks, static imports and the role entry, and the
+// tags applied by the dynamic includes.
+func (t *Task) Tags() []string {
+	return lo.Uniq(append(t.inheritedTags(), t.inner.Tags...))
+}
+
+func (t *Task) inheritedTags() []string {
+	switch {
+	case t.parent == nil && t.role != nil:
+		var res []string
+		if include := t.role.includeTask(); include != nil {
+			res = include.includedTags()
+		}
+		return append(res, t.role.Tags()...)
+	case t.parent == nil:
+		return nil
+	case t.parent.IsDynamicInclude():
+		return t.parent.includedTags()
+	}
+	return t.parent.Tags()
+}
+
+// includedTags returns the tags inherited by the tasks of the dynamic include,
+// which are the tags of the "apply" keyword rather than of the include itself.
+func (t *Task) includedTags() []string {
+	res := t.inheritedTags()
+	if apply := t.applyKeywords(); apply != nil {
+		res = append(res, apply.Tags...)
+	}
+	return res
+}
+
+// Become returns the effective value of the "become" keyword and whether
+// it has been set for the task or inherited.
+func (t *Task) Become() (bool, bool) {
+	become := t.Keywords().Become
+	if become == nil {
+		return false, false
+	}
+	return *become, true
+}
+
+// Environment returns the environment variables of the task merged with
+// the inherited ones.
+func (t *Task) Environment() map[string]any {
+	return t.Keywords().Environment
+}
+
+// Section returns the section of the innermost block the task is defined in,
+// including the blocks the task is included from, or an empty string if the
+// task is not defined in a block.
+func (t *Task) Section() BlockSection {
+	if t.section != "" {
+		return t.section
+	}
+	if parent := t.scopeParent(); parent != nil {
+		return parent.Section()
+	}
+	return ""
+}
+
+// blockTasks returns the tasks of all sections of the block.
+func (t *Task) blockTasks() []*Task {
+	res := make([]*Task, 0, len(t.inner.Block)+len(t.inner.Rescue)+len(t.inner.Always))
+	res = append(res, t.inner.Block...)
+	res = append(res, t.inner.Rescue...)
+	return append(res, t.inner.Always...)
+}
+
 func (t *Task) UpdateNested(path string) {
 	t.metadata.path = path
-	for _, b := range t.inner.Block {
+	for _, b := range t.blockTasks() {
 		b.metadata.path = path
 		b.dataloader = t.dataloader
+		b.varResolver = t.varResolver
+		b.templater = t.templater
 		b.role = t.role
+		b.UpdateNested(path)
 	}
 }
 
@@ -131,145 +306,168 @@ func (t *Task) UnmarshalYAML(node *yaml.Node) error {
 	if err := node.Decode(&t.inner); err != nil {
 		return err
 	}
-	for _, b := range t.inner.Block {
-		b.updateParent(t)
+	for section, tasks := range map[BlockSection][]*Task{
+		SectionBlock:  t.inner.Block,
+		SectionRescue: t.inner.Rescue,
+		SectionAlways: t.inner.Always,
+	} {
+		for i, b := range tasks {
+			b.updateParent(t)
+			b.section = section
+			b.index = i + 1
+		}
 	}
 	return nil
 }
 
-// isModuleFreeForm determines whether a module parameter is defined as a free-form
-// string value within the task's raw data.
-//
-// Example:
-// - include_tasks: file.yml
-func (t *Task) isModuleFreeForm(moduleName string) (string, bool) {
-	param, exists := t.raw[moduleName]
-	if !exists {
-		return "", false
-	}
-
-	if _, ok := param.(string); !ok {
-		return "", false
-	}
-
-	vars := t.varResolver.GetVars(t.Play(), t)
-
-	rendered, err := t.renderVariable(param, vars)
-	if err != nil {
-		log.Printf("Failed to render variable: %s", err)
-		return "", false
-	}
-
-	val, ok := rendered.(string)
-	if !ok {
-		return "", false
-	}
-
-	return val, true
-}
-
+// Module returns the rendered parameters of the module with the given name.
+// The parameters of the "args" keyword are merged into the module parameters.
+// The string parameters, e.g. "copy: src=a dest=b", are parsed as "k=v" pairs,
+// and the free-form arguments are stored under the "_raw_params" key.
 func (t *Task) Module(moduleName string) (Module, bool) {
 	val, exists := t.raw[moduleName]
 	if !exists {
 		return nil, false
 	}
-	params, ok := val.(map[string]any)
-	if !ok {
+	switch val.(type) {
+	case map[string]any, string, nil:
+	default:
 		return nil, false
 	}
 
-	// TODO: should variables be cached?
-	if t.cachedVars == nil {
-		t.cachedVars = t.varResolver.GetVars(t.Play(), t)
-	}
+	additionalArgs, _ := t.raw["args"].(map[string]any)
+	return t.renderParams(actionParams(moduleName, val, additionalArgs)), true
+}
 
+// renderParams renders the module parameters. Parameters that cannot be
+// rendered are kept as unknown values.
+func (t *Task) renderParams(params map[string]any) Module {
+	vars := t.getVars()
 	module := make(Module, len(params))
-
 	for name, param := range params {
-		rendered, err := t.renderVariable(param, t.cachedVars)
-		if err != nil {
-			log.Printf("Failed to render variable: %s", err)
-			return nil, false
+		rendered := t.renderVariable(param, vars)
+		if rendered == omitPlaceholder {
+			continue
 		}
-		module[name] = rendered
+		module[name] = removeOmitted(rendered)
 	}
+	return module
+}
 
-	return module, true
+// getVars returns the variables available to the task. They are computed
+// once and recomputed only when the variable resolver drops its scopes,
+// e.g. after the dependencies of a role are loaded.
+func (t *Task) getVars() Variables {
+	generation := t.varResolver.getGeneration()
+	if t.cachedVars == nil || t.varsGeneration != generation {
+		t.cachedVars = t.varResolver.GetVars(t.Play(), t)
+		t.varsGeneration = generation
+	}
+	return t.cachedVars
+}
+
+// getTemplater returns the templater of the task or, if the task is not
+// loaded by the parser, the templater without access to the file system.
+func (t *Task) getTemplater() Templater {
+	if t.templater == nil {
+		return NewTemplater(nil, nil)
+	}
+	return t.templater
 }
 
-func (t *Task) renderVariable(variable any, vars Variables) (any, error) {
+// renderVariable renders the templates in the variable in the partial evaluation mode.
+// The templates that cannot be rendered become Unknown values, while the other
+// items of lists and maps stay rendered.
+func (t *Task) renderVariable(variable any, vars Variables) any {
 	switch v := variable.(type) {
 	case string:
-		rendered, err := t.templater.Evaluate(v, vars)
-		if err != nil {
-			return "", err
+		res := t.getTemplater().EvaluatePartial(v, vars)
+		if u, ok := res.(Unknown); ok && u.MissingPlugin != "" {
+			t.dataloader.reportMissingPlugin(t.includeStack(), fmt.Sprintf("task %q", t.Name()), u)
 		}
-		return rendered, nil
+		return res
 	case []any:
 		res := make([]any, 0, len(v))
 		for _, vv := range v {
-			rendered, err := t.renderVariable(vv, vars)
-			if err != nil {
-				return "", err
-			}
-			res = append(res, rendered)
+			res = append(res, t.renderVariable(vv, vars))
 		}
-		return res, nil
+		return res
 	case map[string]any:
 		res := make(map[string]any, len(v))
 		for k, vv := range v {
-			rendered, err := t.renderVariable(vv, vars)
-			if err != nil {
-				return "", err
-			}
-			res[k] = rendered
+			res[k] = t.renderVariable(vv, vars)
 		}
-		return res, nil
+		return res
+	case nil, bool, int, float64:
+		return variable
 	}
 	log.Printf("Unsupported variable type: %T", variable)
-	return variable, nil
+	return variable
 }
 
 func (t *Task) isTaskInclude() bool {
-	return t.actionOneOf(applyBuiltinPrefixAll(importTasksAction, includeTasksAction))
+	return t.actionOneOf(importTasksAction, includeTasksAction, legacyIncludeAction)
 }
 
 func (t *Task) isRoleInclude() bool {
-	return t.actionOneOf(applyBuiltinPrefixAll(importRoleAction, includeRoleAction))
+	return t.actionOneOf(importRoleAction, includeRoleAction)
 }
 
-func (t *Task) actionOneOf(actions []string) bool {
-	for _, action := range actions {
-		_, exists := t.raw[action]
-		if exists {
-			return true
-		}
+// actionOneOf reports whether the task runs one of the built-in modules.
+func (t *Task) actionOneOf(actions ...string) bool {
+	fqcn, ok := t.actionFQCN()
+	if !ok {
+		return false
 	}
-	return false
+	short, isBuiltin := strings.CutPrefix(fqcn, ansibleBuiltinPrefix)
+	return isBuiltin && slices.Contains(actions, short)
 }
 
 func (t *Task) IsBlock() bool {
-	return len(t.inner.Block) > 0
+	return len(t.inner.Block) > 0 || len(t.inner.Rescue) > 0 || len(t.inner.Always) > 0
 }
 
 // RoleIncludeModule represents the "include_role" or "import_role" module
 type RoleIncludeModule struct {
-	Name         string `mapstruct:"name"`
-	TasksFrom    string `mapstruct:"tasks_from"`
-	DefaultsFrom string `mapstruct:"defaults_from"`
-	VarsFrom     string `mapstruct:"vars_from"`
-	Public       bool   `mapstruct:"public"`
+	Name         string `mapstructure:"name"`
+	TasksFrom    string `mapstructure:"tasks_from"`
+	DefaultsFrom string `mapstructure:"defaults_from"`
+	VarsFrom     string `mapstructure:"vars_from"`
+	HandlersFrom string `mapstructure:"handlers_from"`
+	Public       bool   `mapstructure:"public"`
+}
+
+// decodeModuleParams decodes the parameters of the include modules. The
+// strings are converted to the types of the fields, e.g. "true" to a bool.
+func decodeModuleParams(params map[string]string, dst any) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           dst,
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(params)
 }
 
 // TaskIncludeModule represents the "include_tasks" or "import_tasks" module
 type TaskInclude struct {
-	File string `mapstruct:"file"`
+	File string `mapstructure:"file"`
+}
+
+// actionParams returns the string parameters of the module run by the task.
+func (t *Task) actionParams() map[string]string {
+	action, ok := t.Action()
+	if !ok {
+		return make(map[string]string)
+	}
+	return action.Params.ToStringMap()
 }
 
 // Compile recursively compiles the current task and its subtasks, returning a
 // list of all resulting tasks. The behavior depends on the task type:
-//   - Block tasks: Each subtask in the block is compiled and its results are
-//     appended. Parent information is updated.
+//   - Block tasks: Each subtask in the "block", "rescue" and "always" sections is
+//     compiled and its results are appended. Parent information is updated.
 //   - Include tasks: The specified tasks file is loaded and its tasks are compiled,
 //     updating parent information.
 //   - Role include tasks: The specified role is loaded with options, and its compiled
@@ -277,12 +475,20 @@ type TaskInclude struct {
 //   - Other tasks: The current task is returned as a single-element list.
 func (t *Task) Compile() Tasks {
 	switch {
-	case len(t.inner.Block) > 0:
+	case t.IsBlock():
 		return t.compileBlockTasks()
 	case t.isTaskInclude():
-		return t.compileTaskInclude()
+		var res Tasks
+		for _, include := range t.includeIterations() {
+			res = append(res, include.compileTaskInclude()...)
+		}
+		return res
 	case t.isRoleInclude():
-		return t.compileRoleInclude()
+		var res Tasks
+		for _, include := range t.includeIterations() {
+			res = append(res, include.compileRoleInclude()...)
+		}
+		return res
 	default:
 		return Tasks{t}
 	}
@@ -290,8 +496,7 @@ func (t *Task) Compile() Tasks {
 
 func (t *Task) compileBlockTasks() Tasks {
 	var res []*Task
-	for _, task := range t.inner.Block {
-		// task.updateParent(t)
+	for _, task := range t.blockTasks() {
 		res = append(res, task.Compile()...)
 	}
 	return res
@@ -300,26 +505,39 @@ func (t *Task) compileBlockTasks() Tasks {
 func (t *Task) compileTaskInclude() Tasks {
 	var res []*Task
 
-	rawModule := make(map[string]string)
-	for _, action := range applyBuiltinPrefixAll(includeTasksAction, importTasksAction) {
-		if val, ok := t.isModuleFreeForm(action); ok {
-			rawModule["file"] = val
-		} else if val, ok := t.Module(action); ok {
-			rawModule = val.ToStringMap()
-		}
+	rawModule := t.actionParams()
+	if file, ok := rawModule[rawParamsKey]; ok {
+		rawModule["file"] = file
 	}
 
+	stack := t.includeStack()
 	var module TaskInclude
-	if err := mapstructure.Decode(rawModule, &module); err != nil {
-		panic(err) // TODO: handle error
+	if err := decodeModuleParams(rawModule, &module); err != nil {
+		t.dataloader.reportIncludeError(stack, fmt.Errorf("invalid parameters of task %q: %w", t.Name(), err))
+		return nil
 	}
 
-	// TODO: the task path can be absolute
-	tasksFile := filepath.Join(filepath.Dir(t.metadata.path), module.File)
+	// the templates rendered to other values than strings are not file names
+	if module.File == "" {
+		t.dataloader.reportIncludeError(stack, fmt.Errorf("tasks file of task %q cannot be resolved", t.Name()))
+		return nil
+	}
+	tasksFile, err := t.FindFile("tasks", module.File)
+	if t.dataloader.reportMissingFile(stack, err) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to include tasks: %s", err)
+		return nil
+	}
+	if !t.dataloader.canInclude(stack, tasksFile) {
+		return nil
+	}
 
 	loadedTasks, err := t.dataloader.LoadTasks(&t.metadata, t.role, tasksFile)
 	if err != nil {
-		panic(err) // TODO: handle error
+		t.dataloader.reportIncludeError(stack, err)
+		return nil
 	}
 
 	for _, task := range loadedTasks {
@@ -333,33 +551,53 @@ func (t *Task) compileTaskInclude() Tasks {
 func (t *Task) compileRoleInclude() Tasks {
 	var res []*Task
 
-	rawModule := make(map[string]string)
-	for _, action := range applyBuiltinPrefixAll(includeRoleAction, importRoleAction) {
-		if val, ok := t.isModuleFreeForm(action); ok {
-			rawModule["file"] = val
-		} else if val, ok := t.Module(action); ok {
-			rawModule = val.ToStringMap()
-		}
-	}
+	rawModule := t.actionParams()
 
+	stack := t.includeStack()
 	var module RoleIncludeModule
-	if err := mapstructure.Decode(rawModule, &module); err != nil {
-		panic(err) // TODO: handle error
+	if err := decodeModuleParams(rawModule, &module); err != nil {
+		t.dataloader.reportIncludeError(stack, fmt.Errorf("invalid parameters of task %q: %w", t.Name(), err))
+		return nil
+	}
+	if module.Name == "" {
+		t.dataloader.reportIncludeError(stack, fmt.Errorf("role of task %q cannot be resolved", t.Name()))
+		return nil
+	}
+
+	if !t.dataloader.canInclude(stack, roleFrame(roleBaseName(module.Name))) {
+		return nil
 	}
 
-	r, err := t.dataloader.LoadRoleWithOptions(&t.metadata, t.role.play, module.Name, LoadRoleOptions{
+	opt := LoadRoleOptions{
 		TasksFile:    module.TasksFrom,
-		DefaultsFile: module.Name,
+		DefaultsFile: module.DefaultsFrom,
 		VarsFile:     module.VarsFrom,
-	})
-
+		HandlersFile: module.HandlersFrom,
+	}
+	// the roles next to the role of the include are found as well
+	if t.role != nil {
+		opt.roleBaseDir = path.Dir(t.role.path)
+	}
+	r, err := t.dataloader.LoadRoleWithOptions(&t.metadata, t.Play(), module.Name, opt)
+	if t.dataloader.reportMissingRole(stack, err) {
+		return nil
+	}
 	if err != nil {
-		panic(err) // TODO: handle error
+		t.dataloader.reportIncludeError(stack, fmt.Errorf("failed to load role %q: %w", module.Name, err))
+		return nil
 	}
+	r.include = t
 	for _, task := range r.Compile() {
-		// TODO: do not update the parent in the metadata here, as the dependency chain may be lost
-		// if the task is a role dependency task
-		task.updateParent(t)
+		// only the top-level tasks of the role itself become the children of
+		// the include, so that the tasks keep their blocks and includes, and
+		// the tasks of the dependencies keep the keywords of their entries
+		root := task
+		for root.parent != nil && root.parent != t {
+			root = root.parent
+		}
+		if root.parent == nil && root.role == r {
+			root.updateParent(t)
+		}
 		res = append(res, task)
 	}
 
@@ -2,7 +2,9 @@ package main
 
 import (
 	"testing"
+	"testing/fstest"
 
+	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -25,3 +27,435 @@ amazon.aws.s3_bucket:
 	_, exists := task.Module("amazon.aws.s3_bucket")
 	assert.True(t, exists)
 }
+
+func TestModuleUnknownParams(t *testing.T) {
+	src := []byte(`name: Download archive
+get_url:
+  url: "https://{{ mirror_host }}/archive.tgz"
+  dest: /tmp/archive.tgz
+  validate_certs: "{{ validate | bool }}"
+  headers:
+    Authorization: "Bearer {{ lookup('aws_ssm', '/token') }}"
+    Accept: "{{ 'application/' ~ 'gzip' }}"
+  checksum: "{{ checksum | no_such_filter }}"
+`)
+
+	var task Task
+	require.NoError(t, yaml.Unmarshal(src, &task))
+
+	module, exists := task.Module("get_url")
+	require.True(t, exists)
+
+	assert.Equal(t, "/tmp/archive.tgz", module["dest"])
+	assert.Equal(t, Unknown{
+		Expr:    "{{ mirror_host }}",
+		Offset:  8,
+		Partial: "https://{{ mirror_host }}/archive.tgz",
+		Reason:  `"mirror_host" is undefined`,
+	}, module["url"])
+
+	// filters fail on undefined variables, so the value cannot be known
+	assert.True(t, IsUnknown(module["validate_certs"]))
+
+	headers := module["headers"].(map[string]any)
+	assert.Equal(t, "application/gzip", headers["Accept"])
+	assert.True(t, IsUnknown(headers["Authorization"]))
+	assert.True(t, ContainsUnknown(module["headers"]))
+
+	checksum := module["checksum"].(Unknown)
+	assert.Contains(t, checksum.Reason, "no_such_filter")
+}
+
+func TestRenderTemplate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  roles:
+    - nginx
+`),
+		},
+		"roles/nginx/defaults/main.yaml": {
+			Data: []byte(`---
+nginx_port: 8080
+nginx_locations: [/api, /static]
+`),
+		},
+		"roles/nginx/templates/site.conf.j2": {
+			Data: []byte(`#jinja2: lstrip_blocks: True
+# {{ ansible_managed }}
+server {
+    listen {{ nginx_port }};
+    server_name {{ server_name }};
+    {% for location in nginx_locations %}
+    location {{ location }} {}
+    {% endfor %}
+}
+`),
+		},
+		"roles/nginx/templates/upstream.conf.j2": {
+			Data: []byte("upstream app { server 127.0.0.1:{{ nginx_port }}; }\n"),
+		},
+		"roles/nginx/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Configure site
+  ansible.builtin.template:
+    src: site.conf.j2
+    dest: "/etc/nginx/sites-enabled/{{ site_name }}.conf"
+- name: Install nginx
+  package:
+    name: nginx
+- name: Configure upstream
+  action: template src=upstream.conf.j2 dest=/etc/nginx/conf.d/upstream.conf
+- name: Render locally
+  local_action:
+    module: template
+    src: upstream.conf.j2
+    dest: /tmp/upstream.conf
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 4)
+
+	file, isTemplate, err := tasks[0].RenderTemplate()
+	require.NoError(t, err)
+	require.True(t, isTemplate)
+
+	assert.Equal(t, "roles/nginx/templates/site.conf.j2", file.Src)
+	assert.Equal(t, "/etc/nginx/sites-enabled/{{ site_name }}.conf", file.Dest)
+	assert.Equal(t, `# Ansible managed
+server {
+    listen 8080;
+    server_name {{ server_name }};
+    location /api {}
+    location /static {}
+}
+`, file.Content)
+
+	require.Len(t, file.Unknowns, 2)
+	assert.Equal(t, "{{ server_name }}", file.Unknowns[0].Expr)
+	assert.Equal(t, "{{ site_name }}", file.Unknowns[1].Expr)
+
+	_, isTemplate, err = tasks[1].RenderTemplate()
+	require.NoError(t, err)
+	assert.False(t, isTemplate)
+
+	for _, task := range tasks[2:] {
+		file, isTemplate, err := task.RenderTemplate()
+		require.NoError(t, err)
+		require.True(t, isTemplate, task.Name())
+		assert.Equal(t, "roles/nginx/templates/upstream.conf.j2", file.Src)
+		assert.Equal(t, "upstream app { server 127.0.0.1:8080; }\n", file.Content)
+	}
+	file, _, err = tasks[2].RenderTemplate()
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/nginx/conf.d/upstream.conf", file.Dest)
+}
+
+func TestTaskAction(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  collections:
+    - community.general
+    - amazon.aws
+  vars:
+    dest_dir: /opt/app
+  roles:
+    - app
+  tasks:
+    - name: Copy file
+      copy:
+        src: app.conf
+        dest: "{{ dest_dir }}/app.conf"
+    - name: Copy legacy file
+      ansible.legacy.copy:
+        src: app.conf
+        dest: /etc/app.conf
+    - name: Run command
+      action: shell echo hi
+    - name: Create directory
+      action:
+        module: file
+        path: "{{ dest_dir }}"
+        state: directory
+    - name: Fetch archive
+      local_action: get_url url=https://example.com/app.tgz
+    - name: Run script
+      command: ./run.sh
+      args:
+        chdir: "{{ dest_dir }}"
+        creates: /tmp/old
+    - name: Send notification
+      slack:
+        msg: done
+    - name: Group tasks
+      block:
+        - name: Create user
+          user:
+            name: app
+`),
+		},
+		"roles/app/meta/main.yaml": {
+			Data: []byte(`---
+collections:
+  - mycorp.app
+`),
+		},
+		"roles/app/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Deploy application
+  deploy:
+    version: 1.0
+- name: Create instance
+  ec2_instance:
+    name: web
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 10)
+
+	tests := []struct {
+		name   string
+		fqcn   string
+		params Module
+		local  bool
+	}{
+		// the tasks of the roles run before the tasks of the play
+		{name: "deploy", fqcn: "mycorp.app.deploy", params: Module{"version": 1.0}},
+		{name: "ec2_instance", fqcn: "amazon.aws.ec2_instance", params: Module{"name": "web"}},
+		{name: "copy", fqcn: "ansible.builtin.copy", params: Module{"src": "app.conf", "dest": "/opt/app/app.conf"}},
+		{name: "ansible.legacy.copy", fqcn: "ansible.builtin.copy", params: Module{"src": "app.conf", "dest": "/etc/app.conf"}},
+		{name: "shell", fqcn: "ansible.builtin.shell", params: Module{"_raw_params": "echo hi"}},
+		{name: "file", fqcn: "ansible.builtin.file", params: Module{"path": "/opt/app", "state": "directory"}},
+		{
+			name:   "get_url",
+			fqcn:   "ansible.builtin.get_url",
+			params: Module{"url": "https://example.com/app.tgz"},
+			local:  true,
+		},
+		{
+			name:   "command",
+			fqcn:   "ansible.builtin.command",
+			params: Module{"_raw_params": "./run.sh", "chdir": "/opt/app", "creates": "/tmp/old"},
+		},
+		// the modules not known to be provided by the collections resolve to the first one
+		{name: "slack", fqcn: "community.general.slack", params: Module{"msg": "done"}},
+		{name: "user", fqcn: "ansible.builtin.user", params: Module{"name": "app"}},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.fqcn, func(t *testing.T) {
+			action, ok := tasks[i].Action()
+			require.True(t, ok)
+			assert.Equal(t, tt.name, action.Name)
+			assert.Equal(t, tt.fqcn, action.FQCN)
+			assert.Equal(t, tt.params, action.Params)
+			assert.Equal(t, tt.local, action.Local)
+		})
+	}
+
+	block := tasks[9].parent
+	require.NotNil(t, block)
+	_, ok := block.Action()
+	assert.False(t, ok)
+}
+
+func TestModuleFreeForm(t *testing.T) {
+	src := []byte(`name: Install nginx
+apt: name={{ package }} state=present update_cache=yes
+args:
+  state: latest
+  cache_valid_time: 3600
+vars:
+  package: nginx
+`)
+
+	var task Task
+	require.NoError(t, yaml.Unmarshal(src, &task))
+
+	module, exists := task.Module("apt")
+	require.True(t, exists)
+	assert.Equal(t, Module{
+		"name":             "nginx",
+		"state":            "present",
+		"update_cache":     "yes",
+		"cache_valid_time": 3600,
+	}, module)
+
+	src = []byte(`name: Run script
+shell: ./configure --prefix={{ prefix }} chdir=/src
+vars:
+  prefix: /usr/local
+`)
+
+	task = Task{}
+	require.NoError(t, yaml.Unmarshal(src, &task))
+
+	module, exists = task.Module("shell")
+	require.True(t, exists)
+	assert.Equal(t, Module{
+		"_raw_params": "./configure --prefix=/usr/local",
+		"chdir":       "/src",
+	}, module)
+}
+
+func TestTaskKeywords(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  become: true
+  remote_user: deploy
+  environment:
+    LANG: C
+  vars:
+    sudo_method: sudo
+  roles:
+    - role: db
+      become_user: postgres
+  tasks:
+    - name: Setup
+      import_tasks: setup.yaml
+      delegate_to: localhost
+      environment:
+        PROXY: http://proxy
+    - name: Unprivileged
+      become: false
+      command: whoami
+      changed_when: false
+`),
+		},
+		"setup.yaml": {
+			Data: []byte(`---
+- name: Secrets
+  no_log: yes
+  become_method: "{{ sudo_method }}"
+  block:
+    - name: Write secret
+      copy:
+        content: secret
+        dest: /etc/secret
+      ignore_errors: true
+      become_user: "{{ secret_owner }}"
+`),
+		},
+		"roles/db/tasks/main.yaml": {
+			Data: []byte(`---
+- name: Create database
+  command: createdb app
+  run_once: true
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 3)
+
+	// the tasks of the roles run before the tasks of the play
+	kw := tasks[0].Keywords()
+	assert.Equal(t, lo.ToPtr(true), kw.Become)
+	assert.Equal(t, lo.ToPtr("postgres"), kw.BecomeUser)
+	assert.Equal(t, lo.ToPtr(true), kw.RunOnce)
+	assert.Nil(t, kw.DelegateTo)
+
+	kw = tasks[1].Keywords()
+	assert.Equal(t, lo.ToPtr(true), kw.Become)
+	assert.Equal(t, lo.ToPtr("sudo"), kw.BecomeMethod)
+	assert.Nil(t, kw.BecomeUser)
+	assert.Equal(t, lo.ToPtr("localhost"), kw.DelegateTo)
+	assert.Equal(t, lo.ToPtr(true), kw.NoLog)
+	assert.Equal(t, lo.ToPtr(true), kw.IgnoreErrors)
+	assert.Equal(t, lo.ToPtr("deploy"), kw.RemoteUser)
+	assert.Equal(t, map[string]any{"LANG": "C", "PROXY": "http://proxy"}, kw.Environment)
+	require.Contains(t, kw.Unknowns, "become_user")
+	assert.Equal(t, "{{ secret_owner }}", kw.Unknowns["become_user"].Expr)
+
+	kw = tasks[2].Keywords()
+	assert.Equal(t, lo.ToPtr(false), kw.Become)
+	assert.Equal(t, []string{"false"}, kw.ChangedWhen)
+	assert.Nil(t, kw.NoLog)
+	assert.Empty(t, kw.Unknowns)
+}
+
+func TestBlockSections(t *testing.T) {
+	fsys := fstest.MapFS{
+		"playbook.yaml": {
+			Data: []byte(`---
+- hosts: all
+  tasks:
+    - name: Deploy
+      when: deploy_enabled
+      become: true
+      vars:
+        token_file: /tmp/token
+      block:
+        - name: Fetch token
+          get_url:
+            url: https://example.com/token
+            dest: "{{ token_file }}"
+      rescue:
+        - name: Report failure
+          debug:
+            msg: failed
+        - name: Nested
+          block:
+            - name: Retry
+              command: ./retry.sh
+      always:
+        - name: Remove token
+          file:
+            path: "{{ token_file }}"
+            state: absent
+    - name: Standalone
+      command: whoami
+`),
+		},
+	}
+
+	project, err := NewParser(fsys).ParseProject(".", "playbook.yaml")
+	require.NoError(t, err)
+
+	tasks := project.ListTasks()
+	require.Len(t, tasks, 5)
+
+	expected := []struct {
+		name    string
+		section BlockSection
+	}{
+		{"Fetch token", SectionBlock},
+		{"Report failure", SectionRescue},
+		{"Retry", SectionBlock},
+		{"Remove token", SectionAlways},
+	}
+	for i, exp := range expected {
+		task := tasks[i]
+		assert.Equal(t, exp.name, task.Name())
+		assert.Equal(t, exp.section, task.Section(), exp.name)
+		assert.Equal(t, []string{"deploy_enabled"}, task.When(), exp.name)
+		become, exists := task.Become()
+		assert.True(t, exists, exp.name)
+		assert.True(t, become, exp.name)
+	}
+
+	module, exists := tasks[3].Module("file")
+	require.True(t, exists)
+	assert.Equal(t, "/tmp/token", module["path"])
+
+	assert.Equal(t, SectionRescue, tasks[2].parent.Section())
+	assert.Empty(t, tasks[4].Section())
+}
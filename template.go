@@ -2,20 +2,246 @@ package main
 
 import (
 	"fmt"
-
-	"github.com/flosch/pongo2/v6"
+	"io/fs"
+	"strings"
+	"sync"
 )
 
-type Templater struct{}
+// Templater renders the templates of the project, e.g. module parameters
+// and the sources of the "template" module.
+type Templater interface {
+	// Evaluate renders the template to a string.
+	Evaluate(template string, vars Variables) (string, error)
+	// EvaluateValue renders the template and converts the result to a native value.
+	EvaluateValue(template string, vars Variables) (any, error)
+	// EvaluatePartial renders the template, keeping the expressions that cannot
+	// be evaluated as Unknown values.
+	EvaluatePartial(template string, vars Variables) any
+	// RenderFile renders the template file found in the "templates" search path.
+	// The params are the parameters of the "template" module, e.g. "trim_blocks".
+	RenderFile(name string, vars Variables, params map[string]any) (*TemplateFile, error)
+}
+
+// JinjaTemplater renders Jinja2 templates with the Ansible filters, tests and lookups
+// and the plugins from the registry.
+type JinjaTemplater struct {
+	// fsys is the file system used by the lookups, e.g. "file" or "template".
+	fsys fs.FS
+	// env is the environment used by the "env" lookup instead of the process environment.
+	env map[string]string
+	// native keeps the native type of single-expression templates, as the
+	// "jinja2_native" setting of Ansible does.
+	native bool
+	// plugins are the custom filters, tests and lookups.
+	plugins *PluginRegistry
+
+	// cache contains the compiled templates by their source and options
+	mu    sync.RWMutex
+	cache map[templateKey][]jinjaNode
+}
+
+// maxCachedTemplates limits the number of the compiled templates kept in the cache.
+const maxCachedTemplates = 4096
+
+type templateKey struct {
+	src  string
+	opts templateOptions
+}
+
+type TemplaterOption func(t *JinjaTemplater)
+
+// WithTemplatePlugins sets the registry of custom plugins available in templates.
+func WithTemplatePlugins(plugins *PluginRegistry) TemplaterOption {
+	return func(t *JinjaTemplater) {
+		t.plugins = plugins
+	}
+}
+
+// WithNativeTemplates keeps the native types of single-expression templates.
+func WithNativeTemplates(native bool) TemplaterOption {
+	return func(t *JinjaTemplater) {
+		t.native = native
+	}
+}
 
-func (t *Templater) Evaluate(variable string, vars Variables) (string, error) {
-	tpl, err := pongo2.FromString(variable)
+func NewTemplater(fsys fs.FS, env map[string]string, opts ...TemplaterOption) *JinjaTemplater {
+	t := &JinjaTemplater{
+		fsys: fsys,
+		env:  env,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// UnknownValueError is returned when the result of a template depends on
+// a value that cannot be evaluated offline.
+type UnknownValueError struct {
+	Value Unknown
+}
+
+func (e *UnknownValueError) Error() string {
+	return "template depends on an unknown value: " + e.Value.Reason
+}
+
+func (t *JinjaTemplater) nativeTypes() bool {
+	return t != nil && t.native
+}
+
+// compile parses the template. The parsed templates are cached,
+// since the same expressions are repeated across tasks and roles.
+// The templates that fail to parse are not cached.
+func (t *JinjaTemplater) compile(src string, opts templateOptions) ([]jinjaNode, error) {
+	if t == nil {
+		return parseTemplate(src, opts)
+	}
+
+	key := templateKey{src: src, opts: opts}
+	t.mu.RLock()
+	nodes, exists := t.cache[key]
+	t.mu.RUnlock()
+	if exists {
+		return nodes, nil
+	}
+
+	nodes, err := parseTemplate(src, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to load template from %q: %w", variable, err)
+		return nil, err
+	}
+	t.mu.Lock()
+	if t.cache == nil {
+		t.cache = make(map[templateKey][]jinjaNode)
+	}
+	if len(t.cache) >= maxCachedTemplates {
+		// evict an arbitrary template, the cache only has to stay bounded
+		for k := range t.cache {
+			delete(t.cache, k)
+			break
+		}
 	}
-	out, err := tpl.Execute(pongo2.Context(vars))
+	t.cache[key] = nodes
+	t.mu.Unlock()
+	return nodes, nil
+}
+
+// templateHeader starts the first line of a template file that overrides
+// the environment options, e.g. "#jinja2: trim_blocks: False, lstrip_blocks: True".
+const templateHeader = "#jinja2:"
+
+// applyTemplateHeader applies the overrides from the header of the template file
+// to the options and returns the template source without the header.
+func applyTemplateHeader(src string, opts templateOptions) (string, templateOptions, error) {
+	if !strings.HasPrefix(src, templateHeader) {
+		return src, opts, nil
+	}
+	header, body, _ := strings.Cut(src, "\n")
+	header = strings.TrimSuffix(header, "\r")
+
+	// Ansible splits the header on commas and colons without any quoting rules
+	for _, pair := range strings.Split(strings.TrimPrefix(header, templateHeader), ",") {
+		key, val, found := strings.Cut(pair, ":")
+		if !found {
+			return "", opts, fmt.Errorf("invalid template header %q", header)
+		}
+		if err := opts.set(strings.TrimSpace(key), parseHeaderValue(strings.TrimSpace(val))); err != nil {
+			return "", opts, err
+		}
+	}
+	return body, opts, nil
+}
+
+// parseHeaderValue parses the Python literal of a template header option.
+func parseHeaderValue(val string) any {
+	switch val {
+	case "True", "true":
+		return true
+	case "False", "false":
+		return false
+	}
+	if len(val) >= 2 && (val[0] == '\'' || val[0] == '"') && val[len(val)-1] == val[0] {
+		return val[1 : len(val)-1]
+	}
+	return val
+}
+
+// set sets the option by the name of the Jinja2 environment setting.
+func (o *templateOptions) set(name string, val any) error {
+	switch name {
+	case "trim_blocks":
+		o.trimBlocks = toBool(val)
+	case "lstrip_blocks":
+		o.lstripBlocks = toBool(val)
+	case "variable_start_string":
+		return setDelimiter(&o.variableStart, name, val)
+	case "variable_end_string":
+		return setDelimiter(&o.variableEnd, name, val)
+	case "block_start_string":
+		return setDelimiter(&o.blockStart, name, val)
+	case "block_end_string":
+		return setDelimiter(&o.blockEnd, name, val)
+	case "comment_start_string":
+		return setDelimiter(&o.commentStart, name, val)
+	case "comment_end_string":
+		return setDelimiter(&o.commentEnd, name, val)
+	case "newline_sequence", "keep_trailing_newline":
+		// do not affect the parsing
+	default:
+		return fmt.Errorf("unsupported template option %q", name)
+	}
+	return nil
+}
+
+func setDelimiter(dst *string, name string, val any) error {
+	s := toString(val)
+	if s == "" {
+		return fmt.Errorf("template option %q cannot be empty", name)
+	}
+	*dst = s
+	return nil
+}
+
+func (t *JinjaTemplater) Evaluate(variable string, vars Variables) (string, error) {
+	if !containsTemplate(variable) {
+		return variable, nil
+	}
+
+	c := &evalContext{templater: t, vars: vars}
+	out, err := c.evaluate(variable)
 	if err != nil {
 		return "", fmt.Errorf("failed to execute template %q: %w", variable, err)
 	}
+	return out.(string), nil
+}
+
+// EvaluateValue renders the template and converts the result to a native value
+// the way Ansible does, e.g. "{{ ports }}" evaluates to a list. With the native
+// types enabled, "{{ http_port }}" also keeps the integer type.
+func (t *JinjaTemplater) EvaluateValue(variable string, vars Variables) (any, error) {
+	if !containsTemplate(variable) {
+		return variable, nil
+	}
+
+	c := &evalContext{templater: t, vars: vars, convert: true}
+	out, err := c.evaluate(variable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute template %q: %w", variable, err)
+	}
 	return out, nil
 }
+
+// EvaluatePartial renders the template in the partial evaluation mode.
+// It returns the rendered value converted like EvaluateValue does or, if any of the expressions cannot be
+// evaluated (e.g. the variable is undefined or the template is invalid),
+// the Unknown value that keeps the original expression and the known parts
+// of the template rendered.
+func (t *JinjaTemplater) EvaluatePartial(variable string, vars Variables) any {
+	if !containsTemplate(variable) {
+		return variable
+	}
+
+	c := &evalContext{templater: t, vars: vars, partial: true, convert: true}
+	// errors are converted to unknown values in the partial mode
+	out, _ := c.evaluate(variable)
+	return out
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/samber/lo"
+)
+
+// defaultAnsibleManaged is the default value of the "ansible_managed" variable.
+const defaultAnsibleManaged = "Ansible managed"
+
+// templateModuleOptions are the parameters of the "template" module
+// that configure the Jinja2 environment.
+var templateModuleOptions = []string{
+	"trim_blocks",
+	"lstrip_blocks",
+	"variable_start_string",
+	"variable_end_string",
+	"block_start_string",
+	"block_end_string",
+	"comment_start_string",
+	"comment_end_string",
+}
+
+// TemplateFile is the file produced by the "template" module.
+type TemplateFile struct {
+	// Src is the path to the template source in the file system.
+	Src string
+	// Dest is the destination path on the managed host.
+	Dest string
+	// Content is the rendered content. Expressions that cannot be
+	// evaluated are kept in the content as is.
+	Content string
+	// Unknowns are the expressions of the template and its destination
+	// that cannot be evaluated offline.
+	Unknowns []Unknown
+}
+
+// RenderTemplate renders the source of the "template" module with the task variables.
+// The source is searched in the "templates" directory of the role and the playbook.
+// It returns false if the task does not use the "template" module, which is
+// also run by the "action" and "local_action" keywords.
+func (t *Task) RenderTemplate() (*TemplateFile, bool, error) {
+	action, ok := t.Action()
+	if !ok || action.FQCN != "ansible.builtin.template" {
+		return nil, false, nil
+	}
+	module := action.Params
+
+	src, ok := module["src"].(string)
+	if !ok {
+		return nil, true, fmt.Errorf("template source cannot be resolved: %v", module["src"])
+	}
+
+	vars := t.getVars()
+	dest, destKnown := module["dest"].(string)
+	if destKnown {
+		vars = lo.Assign(vars, Variables{"template_destpath": dest})
+	}
+
+	file, err := t.getTemplater().RenderFile(src, vars, module)
+	if err != nil {
+		return nil, true, err
+	}
+	for _, u := range file.Unknowns {
+		stack := append(t.includeStack(), file.Src)
+		t.dataloader.reportMissingPlugin(stack, fmt.Sprintf("template %q", file.Src), u)
+	}
+
+	file.Dest = dest
+	if u, ok := module["dest"].(Unknown); ok {
+		file.Dest = u.Partial
+		file.Unknowns = append(file.Unknowns, u)
+	}
+	return file, true, nil
+}
+
+// RenderFile renders the template file with the options from the parameters
+// of the "template" module.
+func (t *JinjaTemplater) RenderFile(name string, vars Variables, params map[string]any) (*TemplateFile, error) {
+	opts := defaultTemplateOptions()
+	for _, option := range templateModuleOptions {
+		val, exists := params[option]
+		if !exists || IsUnknown(val) {
+			continue
+		}
+		if err := opts.set(option, val); err != nil {
+			return nil, err
+		}
+	}
+	return t.renderFile(name, vars, opts)
+}
+
+// renderFile renders the template file found in the "templates" search path
+// in the partial evaluation mode. The "#jinja2:" header of the file overrides
+// the options.
+func (t *JinjaTemplater) renderFile(name string, vars Variables, opts templateOptions) (*TemplateFile, error) {
+	if t == nil {
+		return nil, errors.New("no templater available")
+	}
+
+	finder := &evalContext{templater: t, vars: vars}
+	filePath, content, err := finder.readLookupFile("templates", name)
+	if err != nil {
+		return nil, err
+	}
+
+	content, opts, err = applyTemplateHeader(content, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %q: %w", filePath, err)
+	}
+	nodes, err := t.compile(content, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", filePath, err)
+	}
+
+	fileVars := lo.Assign(vars, Variables{
+		"template_path":     filePath,
+		"template_fullpath": filePath,
+	})
+	if _, exists := fileVars["ansible_managed"]; !exists {
+		fileVars["ansible_managed"] = defaultAnsibleManaged
+	}
+
+	c := &evalContext{templater: t, vars: fileVars, partial: true}
+	out, err := c.renderTemplate(content, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %q: %w", filePath, err)
+	}
+
+	res := &TemplateFile{Src: filePath, Unknowns: c.unknowns}
+	switch v := out.(type) {
+	case string:
+		res.Content = v
+	case Unknown:
+		res.Content = v.Partial
+		if len(res.Unknowns) == 0 {
+			res.Unknowns = []Unknown{v}
+		}
+	}
+	return res, nil
+}
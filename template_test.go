@@ -0,0 +1,460 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplaterEvaluate(t *testing.T) {
+	vars := Variables{
+		"name":    "web",
+		"port":    8080,
+		"enabled": true,
+		"empty":   "",
+		"users": []any{
+			map[string]any{"name": "alice", "admin": true, "groups": []any{"wheel", "dev"}},
+			map[string]any{"name": "bob", "admin": false, "groups": []any{"dev"}},
+		},
+		"config": map[string]any{
+			"listen": "0.0.0.0",
+			"nested": map[string]any{"timeout": 30},
+		},
+		"packages": []any{"nginx", "curl", "nginx"},
+		"url":      "https://{{ name }}.example.com:{{ port }}",
+		"network":  "192.168.10.5/24",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{name: "plain text", template: "no templates here", expected: "no templates here"},
+		{name: "variable", template: "{{ name }}", expected: "web"},
+		{name: "concat", template: "{{ name ~ '-' ~ port }}", expected: "web-8080"},
+		{name: "arithmetic", template: "{{ port + 1 }} {{ 7 // 2 }} {{ 7 / 2 }} {{ 2 ** 3 }}", expected: "8081 3 3.5 8"},
+		{name: "inline if", template: "{{ 'on' if enabled else 'off' }}", expected: "on"},
+		{name: "power overflow", template: "{{ 2 ** 64 }} {{ 2 ** 62 }}", expected: "1.8446744073709552e+19 4611686018427387904"},
+		{name: "literal overflow", template: "{{ 9999999999999999999 }} {{ 9223372036854775807 }}", expected: "1e+19 9223372036854775807"},
+		{name: "percent format", template: "{{ '%05d|%-4s|%.2f|%x|%s' % (42, 'ab', 3.14159, 255, name) }}", expected: "00042|ab  |3.14|ff|web"},
+		{name: "comment", template: "{# only a comment #}text", expected: "text"},
+		{name: "list literal", template: "{{ [1, 'a', none, true] }}", expected: "[1, 'a', None, True]"},
+		{name: "dict literal", template: "{{ {'b': 2, 'a': 1} }}", expected: "{'a': 1, 'b': 2}"},
+		{name: "attribute", template: "{{ config.nested.timeout }}", expected: "30"},
+		{name: "item", template: "{{ config['listen'] }} {{ users[-1].name }}", expected: "0.0.0.0 bob"},
+		{name: "slice", template: "{{ packages[1:] }} {{ name[::-1] }}", expected: "['curl', 'nginx'] bew"},
+		{name: "nested variable", template: "{{ url }}", expected: "https://web.example.com:8080"},
+		{name: "method", template: "{{ name.upper() }} {{ 'a,b'.split(',') }}", expected: "WEB ['a', 'b']"},
+		{name: "format", template: "{{ '%s:%d' | format(name, port) }} {{ '{}-{}'.format(1, 2) }}", expected: "web:8080 1-2"},
+		{name: "default", template: "{{ missing | default('fallback') }}", expected: "fallback"},
+		{name: "default boolean", template: "{{ empty | default('fallback', true) }}", expected: "fallback"},
+		{name: "bool", template: "{{ 'yes' | bool }} {{ 'off' | bool }}", expected: "True False"},
+		{name: "ternary", template: "{{ enabled | ternary('up', 'down') }}", expected: "up"},
+		{name: "map attribute", template: "{{ users | map(attribute='name') | join(', ') }}", expected: "alice, bob"},
+		{name: "map filter", template: "{{ packages | map('upper') | list }}", expected: "['NGINX', 'CURL', 'NGINX']"},
+		{name: "selectattr", template: "{{ users | selectattr('admin') | map(attribute='name') | first }}", expected: "alice"},
+		{name: "rejectattr", template: "{{ users | rejectattr('name', 'equalto', 'alice') | map(attribute='name') | list }}", expected: "['bob']"},
+		{name: "select match", template: "{{ packages | select('match', 'ng') | unique }}", expected: "['nginx']"},
+		{name: "unique sort", template: "{{ packages | unique | sort }}", expected: "['curl', 'nginx']"},
+		{name: "length", template: "{{ packages | length }} {{ config | count }}", expected: "3 2"},
+		{name: "set operations", template: "{{ [1, 2, 3] | union([3, 4]) }} {{ [1, 2, 3] | intersect([2, 3, 4]) }} {{ [1, 2, 3] | difference([2]) }}", expected: "[1, 2, 3, 4] [2, 3] [1, 3]"},
+		{name: "flatten", template: "{{ [1, [2, [3]]] | flatten }} {{ [1, [2, [3]]] | flatten(levels=1) }}", expected: "[1, 2, 3] [1, 2, [3]]"},
+		{name: "min max sum", template: "{{ [3, 1, 2] | min }} {{ [3, 1, 2] | max }} {{ [3, 1, 2] | sum }}", expected: "1 3 6"},
+		{name: "combine", template: "{{ config | combine({'nested': {'retries': 3}}, recursive=true) }}", expected: "{'listen': '0.0.0.0', 'nested': {'retries': 3, 'timeout': 30}}"},
+		{name: "combine list merge", template: "{{ {'a': [1]} | combine({'a': [2]}, list_merge='append') }}", expected: "{'a': [1, 2]}"},
+		{name: "dict2items", template: "{{ config | dict2items | map(attribute='key') | list }}", expected: "['listen', 'nested']"},
+		{name: "items2dict", template: "{{ [{'key': 'a', 'value': 1}] | items2dict }}", expected: "{'a': 1}"},
+		{name: "to_json", template: "{{ config | to_json }}", expected: `{"listen": "0.0.0.0", "nested": {"timeout": 30}}`},
+		{name: "to_nice_json", template: "{{ {'a': [1]} | to_nice_json }}", expected: "{\n    \"a\": [\n        1\n    ]\n}"},
+		{name: "from_json", template: "{{ ('{\"a\": [1, 2.5]}' | from_json).a }}", expected: "[1, 2.5]"},
+		{name: "to_yaml", template: "{{ {'a': 1} | to_yaml }}", expected: "a: 1\n"},
+		{name: "from_yaml", template: "{{ ('a: [x, y]' | from_yaml).a[1] }}", expected: "y"},
+		{name: "regex_replace", template: "{{ 'web01.example.com' | regex_replace('^(\\\\w+)(\\\\d+)\\\\..*$', '\\\\1-\\\\2') }}", expected: "web0-1"},
+		{name: "regex_replace named", template: "{{ 'key=value' | regex_replace('(?P<k>\\\\w+)=(?P<v>\\\\w+)', '\\\\g<v>=\\\\g<k>') }}", expected: "value=key"},
+		{name: "regex_search", template: "{{ 'server1 server22' | regex_search('server\\\\d+') }}", expected: "server1"},
+		{name: "regex_search group", template: "{{ 'port: 443' | regex_search('port: (\\\\d+)', '\\\\1') }}", expected: "['443']"},
+		{name: "regex_findall", template: "{{ 'a1 b2 c3' | regex_findall('[a-z](\\\\d)') }}", expected: "['1', '2', '3']"},
+		{name: "regex_escape", template: "{{ '1.2.3' | regex_escape }}", expected: `1\.2\.3`},
+		{name: "b64", template: "{{ 'hello' | b64encode }} {{ 'aGVsbG8=' | b64decode }}", expected: "aGVsbG8= hello"},
+		{name: "path filters", template: "{{ '/etc/nginx/nginx.conf' | basename }} {{ '/etc/nginx/nginx.conf' | dirname }} {{ 'nginx.conf' | splitext }}", expected: "nginx.conf /etc/nginx ['nginx', '.conf']"},
+		{name: "hash", template: "{{ 'test' | hash('sha1') }} {{ 'test' | md5 }}", expected: "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3 098f6bcd4621d373cade4e832627b4f6"},
+		{name: "quote", template: "{{ \"it's\" | quote }} {{ 'simple' | quote }}", expected: `'it'"'"'s' simple`},
+		{name: "int float", template: "{{ '42' | int + 1 }} {{ 'x' | int(7) }} {{ '1.5' | float * 2 }}", expected: "43 7 3.0"},
+		{name: "round", template: "{{ 3.14159 | round(2) }} {{ 2.5 | round(0, 'floor') }}", expected: "3.14 2.0"},
+		{name: "indent", template: "{{ 'a\nb' | indent(2) }}", expected: "a\n  b"},
+		{name: "ipaddr", template: "{{ network | ipaddr('address') }} {{ network | ipaddr('network') }} {{ network | ipaddr('netmask') }} {{ network | ipaddr('prefix') }}", expected: "192.168.10.5 192.168.10.0 255.255.255.0 24"},
+		{name: "ipaddr filter list", template: "{{ ['10.0.0.1', 'nope', '::1'] | ipv4 }} {{ 'nope' | ipaddr }}", expected: "['10.0.0.1'] False"},
+		{name: "fqcn filter", template: "{{ [1, 2] | ansible.builtin.join('-') }}", expected: "1-2"},
+		{name: "for loop", template: "{% for u in users %}{{ loop.index }}:{{ u.name }}{% if not loop.last %},{% endif %}{% endfor %}", expected: "1:alice,2:bob"},
+		{name: "for dict items", template: "{% for k, v in config.items() if k != 'nested' %}{{ k }}={{ v }}{% endfor %}", expected: "listen=0.0.0.0"},
+		{name: "set", template: "{% set x = port * 2 %}{{ x }}", expected: "16160"},
+		{name: "whitespace control", template: "a\n{%- if true -%}\n  b\n{%- endif %}", expected: "ab"},
+		{name: "comparison", template: "{{ port > 80 and 'dev' in users[0].groups and name != 'db' }}", expected: "True"},
+	}
+
+	templater := &JinjaTemplater{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := templater.Evaluate(tt.template, vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+}
+
+func TestTemplaterEvaluateErrors(t *testing.T) {
+	templater := &JinjaTemplater{}
+
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{name: "syntax error", template: "{{ name | }}"},
+		{name: "unknown filter", template: "{{ name | does_not_exist }}"},
+		{name: "mandatory", template: "{{ missing | mandatory }}"},
+		{name: "recursive variable", template: "{{ loop_var }}"},
+		{name: "undefined if condition", template: "{% if missing %}on{% endif %}"},
+		{name: "undefined elif condition", template: "{% if false %}off{% elif missing %}on{% endif %}"},
+		{name: "undefined inline if condition", template: "{{ 'on' if missing else 'off' }}"},
+		{name: "undefined not operand", template: "{{ not missing }}"},
+		{name: "undefined and operand", template: "{{ missing and true }}"},
+		{name: "undefined or operand", template: "{{ missing or true }}"},
+		{name: "undefined for iterable", template: "{% for item in missing %}{{ item }}{% endfor %}"},
+		{name: "undefined for condition", template: "{% for item in [1, 2] if missing %}{{ item }}{% endfor %}"},
+		{name: "undefined list item", template: "{{ [name, missing] }}"},
+		{name: "undefined dict value", template: "{{ {'a': missing} }}"},
+		{name: "undefined list item length", template: "{{ [missing] | length }}"},
+		{name: "extract missing key", template: "{{ ['name', 'missing'] | map('extract', {'name': 1}) | list }}"},
+	}
+
+	vars := Variables{"name": "web", "loop_var": "{{ loop_var }}"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := templater.Evaluate(tt.template, vars)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestTemplaterEvaluatePartial(t *testing.T) {
+	templater := &JinjaTemplater{}
+	vars := Variables{
+		"host":     "example.com",
+		"base_url": "https://{{ host }}/{{ api_version }}",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected any
+	}{
+		{
+			name:     "known",
+			template: "https://{{ host }}",
+			expected: "https://example.com",
+		},
+		{
+			name:     "undefined variable",
+			template: "{{ port }}",
+			expected: Unknown{Expr: "{{ port }}", Partial: "{{ port }}", Reason: `"port" is undefined`},
+		},
+		{
+			name:     "known parts are rendered",
+			template: "{{ host }}:{{ port }}",
+			expected: Unknown{Expr: "{{ port }}", Offset: 11, Partial: "example.com:{{ port }}", Reason: `"port" is undefined`},
+		},
+		{
+			name:     "default",
+			template: "{{ port | default(443) }}",
+			expected: "443",
+		},
+		{
+			name:     "nested variable",
+			template: "{{ base_url }}/users",
+			expected: Unknown{Expr: "{{ base_url }}", Partial: "{{ base_url }}/users", Reason: `"api_version" is undefined`},
+		},
+		{
+			name:     "syntax error",
+			template: "{{ host | }}",
+			expected: Unknown{Expr: "{{ host | }}", Partial: "{{ host | }}", Reason: `unexpected }} at offset 10, expected name`},
+		},
+		{
+			name:     "inline if without else",
+			template: "{{ 1 if false }}",
+			expected: "",
+		},
+		{
+			name:     "unknown condition",
+			template: "{% if enabled == 'yes' %}on{% endif %}",
+			expected: Unknown{Expr: "{% if enabled == 'yes' %}on{% endif %}", Partial: "{% if enabled == 'yes' %}on{% endif %}", Reason: `"enabled" is undefined`},
+		},
+		{
+			name:     "undefined condition",
+			template: "{% if enabled %}on{% endif %}",
+			expected: Unknown{Expr: "{% if enabled %}on{% endif %}", Partial: "{% if enabled %}on{% endif %}", Reason: `"enabled" is undefined`},
+		},
+		{
+			name:     "undefined inline if condition",
+			template: "{{ 'on' if enabled else 'off' }}",
+			expected: Unknown{Expr: "{{ 'on' if enabled else 'off' }}", Partial: "{{ 'on' if enabled else 'off' }}", Reason: `"enabled" is undefined`},
+		},
+		{
+			name:     "undefined boolean operand",
+			template: "{{ not enabled or host }}",
+			expected: Unknown{Expr: "{{ not enabled or host }}", Partial: "{{ not enabled or host }}", Reason: `"enabled" is undefined`},
+		},
+		{
+			name:     "undefined loop",
+			template: "{% for item in items %}{{ item }}{% endfor %}",
+			expected: Unknown{Expr: "{% for item in items %}{{ item }}{% endfor %}", Partial: "{% for item in items %}{{ item }}{% endfor %}", Reason: `"items" is undefined`},
+		},
+		{
+			name:     "undefined list item",
+			template: "{{ [host, port] }}",
+			expected: Unknown{Expr: "{{ [host, port] }}", Partial: "{{ [host, port] }}", Reason: `"port" is undefined`},
+		},
+		{
+			name:     "undefined dict value",
+			template: "{{ {'a': port} | length }}",
+			expected: Unknown{Expr: "{{ {'a': port} | length }}", Partial: "{{ {'a': port} | length }}", Reason: `"port" is undefined`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, templater.EvaluatePartial(tt.template, vars))
+		})
+	}
+}
+
+func TestTemplateOptions(t *testing.T) {
+	vars := Variables{"items": []any{"a", "b"}}
+
+	tests := []struct {
+		name     string
+		template string
+		header   string
+		expected string
+	}{
+		{
+			name:     "trim blocks by default",
+			template: "{% for i in items %}\n{{ i }}\n{% endfor %}\n",
+			expected: "a\nb\n",
+		},
+		{
+			name:     "trim blocks disabled",
+			template: "{% for i in items %}\n{{ i }}\n{% endfor %}\n",
+			header:   "#jinja2: trim_blocks: False\n",
+			expected: "\na\n\nb\n\n",
+		},
+		{
+			name:     "lstrip blocks",
+			template: "  {% for i in items %}\n{{ i }}\n  {% endfor %}\n",
+			header:   "#jinja2: lstrip_blocks: True, trim_blocks: True\n",
+			expected: "a\nb\n",
+		},
+		{
+			name:     "lstrip disabled by the tag",
+			template: "  {%+ if true %}x{% endif %}",
+			header:   "#jinja2:lstrip_blocks:True\n",
+			expected: "  x",
+		},
+		{
+			name:     "trim disabled by the tag",
+			template: "{% if true +%}\nx{% endif %}",
+			expected: "\nx",
+		},
+		{
+			name:     "custom delimiters",
+			template: "[% for i in items %][[ i ]]{# {{ not a variable }} #}[% endfor %]",
+			header:   "#jinja2: variable_start_string: '[[', variable_end_string: ']]', block_start_string: \"[%\", block_end_string: \"%]\"\n",
+			expected: "ab",
+		},
+		{
+			name:     "raw block",
+			template: "{% raw %}\n{{ i }}\n{% endraw %}\n",
+			expected: "{{ i }}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, opts, err := applyTemplateHeader(tt.header+tt.template, defaultTemplateOptions())
+			require.NoError(t, err)
+			c := &evalContext{vars: vars}
+			out, err := c.evaluateWithOptions(src, opts)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+
+	_, _, err := applyTemplateHeader("#jinja2: autoescape: True\n", defaultTemplateOptions())
+	require.ErrorContains(t, err, "unsupported template option")
+}
+
+func TestTemplaterEvaluateValue(t *testing.T) {
+	vars := Variables{
+		"http_port": 80,
+		"ports":     []any{80, 443},
+		"encrypt":   false,
+		"name":      "web",
+		"settings":  "{{ {'tls': encrypt} }}",
+		"port_list": "{{ ports }}",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected any
+		native   any
+	}{
+		{name: "int", template: "{{ http_port }}", expected: "80", native: 80},
+		{name: "list", template: "{{ ports }}", expected: []any{80, 443}, native: []any{80, 443}},
+		{name: "bool", template: "{{ encrypt }}", expected: false, native: false},
+		{name: "bool filter", template: "{{ 'yes' | bool }}", expected: true, native: true},
+		{name: "string", template: "{{ name }}", expected: "web", native: "web"},
+		{name: "string literal", template: "{{ '8080' }}", expected: "8080", native: 8080},
+		{name: "concatenation", template: "{{ http_port }}{{ 0 }}", expected: "800", native: 800},
+		{name: "text", template: "port {{ http_port }}", expected: "port 80", native: "port 80"},
+		{name: "lowercase constant", template: "{{ 'true' }}", expected: "true", native: "true"},
+		{name: "dict literal", template: "{{ {'a': [1, -2.5, None]} }}", expected: map[string]any{"a": []any{1, -2.5, nil}}, native: map[string]any{"a": []any{1, -2.5, nil}}},
+		{name: "nested variable", template: "{{ settings.tls }}", expected: false, native: false},
+		{name: "nested list", template: "{{ port_list | length }}", expected: "2", native: 2},
+		{name: "leading zeros", template: "{{ '0644' }}", expected: "0644", native: "0644"},
+		{name: "leading zeros in list", template: "{{ '[0644]' }}", expected: "[0644]", native: "[0644]"},
+		{name: "zero", template: "{{ '00' }}", expected: "00", native: 0},
+		{name: "underscores", template: "{{ '1_000' }}", expected: "1_000", native: 1000},
+		{name: "trailing underscore", template: "{{ '1000_' }}", expected: "1000_", native: "1000_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := (&JinjaTemplater{}).EvaluateValue(tt.template, vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+
+			out, err = (&JinjaTemplater{native: true}).EvaluateValue(tt.template, vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.native, out)
+		})
+	}
+}
+
+func TestTemplaterTests(t *testing.T) {
+	templater := &JinjaTemplater{}
+	vars := Variables{
+		"name":    "web01",
+		"port":    8080,
+		"nothing": nil,
+		"config":  map[string]any{"tls": true},
+		"groups":  []any{"web", "db"},
+		"result":  map[string]any{"changed": false, "failed": false},
+		"looped": map[string]any{
+			"results": []any{map[string]any{"changed": false}, map[string]any{"changed": true}},
+		},
+		"skipped_result": map[string]any{"skipped": true, "changed": false},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{name: "defined", template: "{{ name is defined }} {{ missing is defined }}", expected: "True False"},
+		{name: "undefined", template: "{{ missing is undefined }}", expected: "True"},
+		{name: "negated", template: "{{ missing is not defined }} {{ nothing is not none }}", expected: "True False"},
+		{name: "not before test", template: "{{ not missing is defined }}", expected: "True"},
+		{name: "types", template: "{{ name is string }} {{ port is number }} {{ config is mapping }} {{ groups is sequence }} {{ port is string }}", expected: "True True True True False"},
+		{name: "boolean and integer", template: "{{ true is boolean }} {{ true is integer }} {{ 1.5 is float }}", expected: "True False True"},
+		{name: "test without parentheses", template: "{{ port is divisibleby 8 }} {{ config.tls is sameas true }}", expected: "True True"},
+		{name: "match", template: "{{ name is match('web') }} {{ name is match('\\\\d+') }}", expected: "True False"},
+		{name: "search", template: "{{ name is search('\\\\d+') }}", expected: "True"},
+		{name: "regex", template: "{{ name is regex('WEB', ignorecase=true, match_type='fullmatch') }} {{ name is regex('WEB\\\\d+', ignorecase=true, match_type='fullmatch') }}", expected: "False True"},
+		{name: "fqcn", template: "{{ name is ansible.builtin.match('web') }}", expected: "True"},
+		{name: "version", template: "{{ '2.10.1' is version('2.9', '>=') }} {{ '1.0' is version('1.0.0', 'lt') }}", expected: "True True"},
+		{name: "version strict", template: "{{ '1.0a1' is version('1.0', '<', strict=true) }}", expected: "True"},
+		{name: "version semver", template: "{{ '1.0.0-rc.1' is version('1.0.0-beta.11', 'gt', version_type='semver') }}", expected: "True"},
+		{name: "version pep440", template: "{{ '1.0rc1' is version('1.0', 'lt', version_type='pep440') }} {{ '1.0.post1' is version('1.0', 'gt', version_type='pep440') }}", expected: "True True"},
+		{name: "subset", template: "{{ ['web'] is subset(groups) }} {{ groups is superset(['db', 'app']) }}", expected: "True False"},
+		{name: "contains", template: "{{ groups is contains('db') }} {{ 'web' is in(groups) }}", expected: "True True"},
+		{name: "result", template: "{{ result is succeeded }} {{ result is changed }} {{ looped is changed }} {{ skipped_result is skipped }}", expected: "True False True True"},
+		{name: "even and odd", template: "{{ port is even }} {{ 3 is odd }}", expected: "True True"},
+		{name: "lower and upper", template: "{{ name is lower }} {{ 'ABC1' is upper }}", expected: "True True"},
+		{name: "select with test", template: "{{ [1, 2, 3, 4] | select('even') | list }}", expected: "[2, 4]"},
+		{name: "condition", template: "{% if config is defined and config.tls is sameas true %}tls{% endif %}", expected: "tls"},
+		{name: "inline if with test", template: "{{ 'set' if missing is defined else 'unset' }}", expected: "unset"},
+		{name: "python comparisons", template: "{{ 1 == 1.0 }} {{ '1' == 1 }} {{ true == 1 }} {{ [1, 2] < [1, 3] }} {{ none == none }}", expected: "True False True True True"},
+		{name: "python truthiness", template: "{{ [] or {} or '' or 0 or 'x' }} {{ 0.0 and 'y' }}", expected: "x 0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := templater.Evaluate(tt.template, vars)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, out)
+		})
+	}
+
+	for _, tt := range []struct {
+		template string
+		err      string
+	}{
+		{template: "{{ missing is match('x') }}", err: `"missing" is undefined`},
+		{template: "{{ name is no_such_test }}", err: `test plugin "no_such_test" is not available`},
+		{template: "{{ name is defined is string }}", err: "cannot chain multiple tests"},
+		{template: "{{ '1.0' is version('1.x', 'foo') }}", err: "invalid operator type"},
+		{template: "{{ 'a' is version('1', '<') }}", err: "version comparison failed"},
+		{template: "{{ 1 < 'a' }}", err: "not supported between instances of 'int' and 'str'"},
+	} {
+		_, err := templater.Evaluate(tt.template, vars)
+		require.ErrorContains(t, err, tt.err, tt.template)
+	}
+
+	// the results of registered tasks are not known offline
+	assert.True(t, IsUnknown(templater.EvaluatePartial("{{ install is succeeded }}", vars)))
+}
+
+func BenchmarkTemplaterEvaluate(b *testing.B) {
+	vars := Variables{
+		"port": 8080,
+		"users": []any{
+			map[string]any{"name": "alice", "admin": true},
+			map[string]any{"name": "bob", "admin": false},
+		},
+	}
+	template := "{{ users | selectattr('admin') | map(attribute='name') | join(',') }}:{{ port + 1 }}"
+
+	b.Run("cached", func(b *testing.B) {
+		templater := &JinjaTemplater{}
+		for i := 0; i < b.N; i++ {
+			if _, err := templater.Evaluate(template, vars); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := (&JinjaTemplater{}).Evaluate(template, vars); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestTemplaterCache(t *testing.T) {
+	templater := &JinjaTemplater{}
+
+	_, err := templater.Evaluate("{{ name | }}", nil)
+	require.Error(t, err)
+	assert.Empty(t, templater.cache)
+
+	for i := 0; i < maxCachedTemplates+10; i++ {
+		_, err := templater.Evaluate(fmt.Sprintf("{{ %d }}", i), nil)
+		require.NoError(t, err)
+	}
+	assert.Len(t, templater.cache, maxCachedTemplates)
+}
@@ -1,6 +1,12 @@
 package main
 
 import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/samber/lo"
 	"gopkg.in/yaml.v3"
 )
 
@@ -9,12 +15,23 @@ type Variables map[string]any
 type AnsibleProject struct {
 	path string
 
-	cfg AnsibleConfig
-	// inventory Inventory
+	cfg          AnsibleConfig
+	inventory    Inventory
 	mainPlaybook Playbook
 	playbooks    []Playbook
 
-	dataloader *DataLoader
+	dataloader  *DataLoader
+	varResolver *VariableResolver
+
+	// taskIndex contains the compiled tasks by their addresses without
+	// the host. It is built on the first lookup, since the compilation
+	// of the project does not change.
+	taskIndexOnce sync.Once
+	taskIndex     map[string]*Task
+}
+
+func (p *AnsibleProject) Inventory() *Inventory {
+	return &p.inventory
 }
 
 func (p *AnsibleProject) ListTasks() Tasks {
@@ -29,6 +46,19 @@ func (p *AnsibleProject) ListTasks() Tasks {
 	return res
 }
 
+// ListTasksForHost returns the tasks of the plays targeting the given host.
+// The returned tasks are bound to the host, so host variables and the host
+// related magic variables are available when rendering them.
+func (p *AnsibleProject) ListTasksForHost(host string) Tasks {
+	var res Tasks
+	for _, task := range p.ListTasks() {
+		if slices.Contains(p.varResolver.PlayHosts(task.Play()), host) {
+			res = append(res, task.ForHost(host))
+		}
+	}
+	return res
+}
+
 type Playbook []*Play
 
 func (p Playbook) Compile() Tasks {
@@ -45,6 +75,11 @@ type Play struct {
 	metadata Metadata
 	raw      map[string]any
 
+	// index is the position of the play in its playbook, starting with 1
+	index int
+	// parent is the play that imports the playbook of this play
+	parent *Play
+
 	roles      []*Role
 	dataloader *DataLoader
 	inner      playInner
@@ -61,19 +96,31 @@ func (p *Play) GetRoles() []*Role {
 type playInner struct {
 	Name            string            `yaml:"name"`
 	ImportPlaybook  string            `yaml:"import_playbook"`
-	Hosts           string            `yaml:"hosts"`
+	Hosts           StringList        `yaml:"hosts"`
 	RoleDefinitions []*RoleDefinition `yaml:"roles"`
 	PreTasks        []*Task           `yaml:"pre_tasks"`
 	Tasks           []*Task           `yaml:"tasks"`
 	PostTasks       []*Task           `yaml:"post_tasks"`
 	Vars            Variables         `yaml:"vars"`
-	VarFiles        []string          `yaml:"var_files"`
+	VarFiles        []string          `yaml:"vars_files"`
+	Collections     StringList        `yaml:"collections"`
+
+	keywordsInner `yaml:",inline"`
 }
 
 func (p *Play) GetMetadata() Metadata {
 	return p.metadata
 }
 
+func (p *Play) GetName() string {
+	return p.inner.Name
+}
+
+// GetHosts returns the host pattern of the play.
+func (p *Play) GetHosts() string {
+	return strings.Join(p.inner.Hosts, ",")
+}
+
 func (p *Play) GetVars() Variables {
 	return p.inner.Vars
 }
@@ -82,6 +129,11 @@ func (p *Play) GetVarsFiles() []string {
 	return p.inner.VarFiles
 }
 
+// GetCollections returns the collections searched for the modules of the play.
+func (p *Play) GetCollections() []string {
+	return p.inner.Collections
+}
+
 func (p *Play) GetRoleDefinitions() []*RoleDefinition {
 	return p.inner.RoleDefinitions
 }
@@ -104,9 +156,17 @@ func (p *Play) UpdateMetadata(parent *Metadata, path string) {
 		roleDef.metadata.parent = &p.metadata
 	}
 
-	for _, task := range p.listTasks() {
-		task.metadata.path = path
-		task.metadata.parent = &p.metadata
+	for list, tasks := range map[string][]*Task{
+		"pre_tasks":  p.inner.PreTasks,
+		"tasks":      p.inner.Tasks,
+		"post_tasks": p.inner.PostTasks,
+	} {
+		for i, task := range tasks {
+			task.metadata.path = path
+			task.metadata.parent = &p.metadata
+			task.playList = list
+			task.index = i + 1
+		}
 	}
 }
 
@@ -116,21 +176,39 @@ func (p *Play) UpdateMetadata(parent *Metadata, path string) {
 func (p *Play) Compile() Tasks {
 	var res Tasks
 	if playbookPath, ok := p.isIncludePlaybook(); ok {
+		if !p.dataloader.canInclude(p.includeStack(), playbookPath) {
+			return nil
+		}
 		included, err := p.dataloader.LoadPlaybook(&p.metadata, playbookPath)
 		if err != nil {
-			panic(err) // TODO: handle error
+			p.dataloader.reportIncludeError(p.includeStack(), fmt.Errorf("failed to import playbook %q: %w", playbookPath, err))
+			return nil
+		}
+		for _, play := range included {
+			play.parent = p
 		}
 		return included.Compile()
 	}
 
-	for _, task := range p.listTasks() {
+	// the roles run after the pre_tasks and before the tasks, as in Ansible
+	for _, task := range p.inner.PreTasks {
 		res = append(res, task.Compile()...)
 	}
 
+	// the roles and their dependencies run once per play
+	compiled := make(map[string]bool)
 	for _, role := range p.roles {
-		res = append(res, role.Compile()...)
+		res = append(res, role.compile(compiled)...)
 	}
 
+	for _, task := range p.inner.Tasks {
+		res = append(res, task.Compile()...)
+	}
+	for _, task := range p.inner.PostTasks {
+		res = append(res, task.Compile()...)
+	}
+
+	p.checkRolePlatforms(res)
 	return res
 }
 
@@ -145,13 +223,17 @@ func (p *Play) listTasks() Tasks {
 // TODO support collections
 // ansible.builtin.import_playbook: my_namespace.my_collection.my_playbook
 func (p *Play) isIncludePlaybook() (string, bool) {
-	for _, k := range applyBuiltinPrefixAll("import_playbook", "include_playbook") {
+	for _, k := range applyBuiltinPrefixAll("import_playbook", "include_playbook", legacyIncludeAction) {
 		val, exists := p.raw[k]
 		if !exists {
 			continue
 		}
 		// TODO: render tpl
 		playbookPath, ok := val.(string)
+		if k == legacyIncludeAction {
+			// the legacy include accepts the variables after the path
+			playbookPath, _, _ = strings.Cut(strings.TrimSpace(playbookPath), " ")
+		}
 		return playbookPath, ok
 	}
 
@@ -166,6 +248,26 @@ type RoleDefinition struct {
 type roleDefinitionInner struct {
 	Name string         `yaml:"role"`
 	Vars map[string]any `yaml:"vars"`
+	When StringList     `yaml:"when"`
+	Tags StringList     `yaml:"tags"`
+
+	keywordsInner `yaml:",inline"`
+
+	// Params contains the inline role parameters, i.e. all keys of the role
+	// entry that are not role keywords.
+	Params map[string]any `yaml:"-"`
+}
+
+// roleDefinitionKeywords lists the keys of a role entry that are interpreted
+// as keywords rather than role parameters.
+//
+// See https://docs.ansible.com/ansible/latest/reference_appendices/playbooks_keywords.html#role
+var roleDefinitionKeywords = []string{
+	"role", "name", "vars", "when", "tags", "become", "become_user", "become_method",
+	"become_flags", "become_exe", "environment", "delegate_to", "delegate_facts",
+	"connection", "remote_user", "no_log", "ignore_errors", "ignore_unreachable",
+	"any_errors_fatal", "check_mode", "diff", "run_once", "debugger", "collections",
+	"module_defaults", "throttle", "timeout",
 }
 
 func (r *RoleDefinition) UnmarshalYAML(node *yaml.Node) error {
@@ -179,8 +281,83 @@ func (r *RoleDefinition) UnmarshalYAML(node *yaml.Node) error {
 		return nil
 	}
 
-	return node.Decode(&r.inner)
+	if err := node.Decode(&r.inner); err != nil {
+		return err
+	}
+
+	var raw map[string]any
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+
+	// "name" is an alias for "role"
+	if r.inner.Name == "" {
+		if name, ok := raw["name"].(string); ok {
+			r.inner.Name = name
+		}
+	}
+
+	for k, v := range raw {
+		if slices.Contains(roleDefinitionKeywords, k) {
+			continue
+		}
+		if r.inner.Params == nil {
+			r.inner.Params = make(map[string]any)
+		}
+		r.inner.Params[k] = v
+	}
+
+	return nil
 }
+
 func (r *RoleDefinition) GetName() string {
 	return r.inner.Name
 }
+
+// GetParams returns the role parameters passed in the role entry. Inline
+// parameters are merged with the parameters from the "vars" keyword.
+func (r *RoleDefinition) GetParams() Variables {
+	return lo.Assign(r.inner.Params, r.inner.Vars)
+}
+
+func (r *RoleDefinition) GetWhen() []string {
+	return r.inner.When
+}
+
+func (r *RoleDefinition) GetTags() []string {
+	return r.inner.Tags
+}
+
+// GetBecome returns the value of the "become" keyword of the role entry and
+// whether it is set. Templated values are not rendered and treated as not set.
+func (r *RoleDefinition) GetBecome() (bool, bool) {
+	if r.inner.Become == nil {
+		return false, false
+	}
+	return keywordBool(r.inner.Become)
+}
+
+// GetEnvironment returns the environment variables of the role entry.
+// Templated values are not rendered and treated as not set.
+func (r *RoleDefinition) GetEnvironment() map[string]any {
+	env, _ := r.inner.Environment.(map[string]any)
+	return env
+}
+
+// StringList represents a keyword that can be specified either
+// as a single string or as a list of strings, e.g. "when" or "tags".
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = StringList{node.Value}
+		return nil
+	}
+
+	var values []string
+	if err := node.Decode(&values); err != nil {
+		return err
+	}
+	*l = values
+	return nil
+}
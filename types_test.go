@@ -44,6 +44,44 @@ func TestUnmarshallRoleDefinition(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "role with params and keywords",
+			source: `name: test
+port: 80
+vars:
+  user: admin
+when: ansible_os_family == "Debian"
+tags: [web, nginx]
+become: yes
+environment:
+  HTTP_PROXY: http://proxy
+`,
+			expected: RoleDefinition{
+				metadata: Metadata{
+					rng: Range{
+						startLine: 1,
+						endLine:   9,
+					},
+				},
+				inner: roleDefinitionInner{
+					Name: "test",
+					Vars: map[string]any{
+						"user": "admin",
+					},
+					When: StringList{`ansible_os_family == "Debian"`},
+					Tags: StringList{"web", "nginx"},
+					keywordsInner: keywordsInner{
+						Become: "yes",
+						Environment: map[string]any{
+							"HTTP_PROXY": "http://proxy",
+						},
+					},
+					Params: map[string]any{
+						"port": 80,
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1,58 +1,306 @@
 package main
 
-import "github.com/samber/lo"
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
 
-type VariableResolver struct{}
+	"github.com/samber/lo"
+)
+
+// omitPlaceholder is the value of the "omit" magic variable. Module parameters
+// rendered to this value are removed from the module.
+const omitPlaceholder = "__omit_place_holder__"
+
+type VariableResolver struct {
+	inventory *Inventory
+
+	// the variable scopes of plays and the inventory are computed once
+	// and shared by all tasks
+	mu             sync.Mutex
+	playScopes     map[*Play]*playScope
+	inventoryMagic Variables
+	// generation is incremented when the cached scopes are dropped,
+	// so that the tasks recompute the variables they cache
+	generation uint64
+}
+
+// playScope contains the variables of a play shared by all of its tasks.
+type playScope struct {
+	// defaults are the default variables of the play roles
+	defaults Variables
+	// vars are the play vars, vars files and the variables of the play roles
+	vars Variables
+	// magic are the magic variables of the play
+	magic Variables
+}
+
+func NewVariableResolver(inventory *Inventory) *VariableResolver {
+	return &VariableResolver{
+		inventory: inventory,
+	}
+}
 
-// TODO: pass Host
 /*
 The order of precedence is:
-	- play->roles->get_default_vars (if there is a play context)
-	- group_vars_files[host] (if there is a host context)
-	- host_vars_files[host] (if there is a host context)
-	- host->get_vars (if there is a host context)
-	- fact_cache[host] (if there is a host context)
-	- play vars (if there is a play context)
-	- play vars_files (if there's no host context, ignore
-		file names that cannot be templated)
-	- task->get_vars (if there is a task context)
-	- vars_cache[host] (if there is a host context)
-	- extra vars
+  - play->roles->get_default_vars (if there is a play context)
+  - group_vars_files[host] (if there is a host context)
+  - host_vars_files[host] (if there is a host context)
+  - host->get_vars (if there is a host context)
+  - fact_cache[host] (if there is a host context or facts bound to the task)
+  - play vars (if there is a play context)
+  - play vars_files (if there's no host context, ignore
+    file names that cannot be templated)
+  - task->get_vars (if there is a task context)
+  - vars_cache[host] (if there is a host context)
+  - role params
+  - extra vars
+  - magic variables
 
 See https://docs.ansible.com/ansible/latest/playbook_guide/playbooks_variables.html#variable-precedence-where-should-i-put-a-variable
 */
 func (r *VariableResolver) GetVars(play *Play, task *Task) Variables {
 	res := make(Variables)
 
+	var scope *playScope
 	if play != nil {
-		for _, role := range play.GetRoles() {
-			// TODO: check if role public
-			res = lo.Assign(res, role.LoadDefaultVars())
-		}
+		scope = r.playScope(play)
+		// TODO: check if role public
+		res = lo.Assign(res, scope.defaults)
 	}
 
-	if play != nil {
-		res = lo.Assign(res, play.GetVars())
+	var host string
+	if task != nil {
+		host = task.Host()
+	}
 
-		for _, varsFile := range play.GetVarsFiles() {
-			f, err := play.dataloader.LoadPlayVarsFile(play.GetPath(), varsFile)
-			if err != nil {
-				panic(err) // TODO: handle error
-			}
-			res = lo.Assign(res, f)
-		}
+	if host != "" && r.getInventory() != nil {
+		res = lo.Assign(res, r.inventory.HostVars(host))
+	}
 
-		for _, role := range play.GetRoles() {
-			res = lo.Assign(res, role.Vars())
-		}
+	if task != nil {
+		res = lo.Assign(res, r.hostFacts(task).Vars())
+	}
+
+	if scope != nil {
+		res = lo.Assign(res, scope.vars)
 	}
 
 	if task != nil {
 		if task.Role() != nil {
 			res = lo.Assign(res, task.Role().Vars())
 		}
-		res = lo.Assign(res, task.Vars())
+		res = lo.Assign(res, task.scopeVars())
+
+		if task.Role() != nil {
+			res = lo.Assign(res, task.Role().Params())
+		}
+	}
+
+	return lo.Assign(res, r.magicVars(scope, task, host))
+}
+
+// playScope returns the variables of the play, computing them on the first call.
+func (r *VariableResolver) playScope(play *Play) *playScope {
+	if r == nil {
+		return newPlayScope(r, play)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if scope, exists := r.playScopes[play]; exists {
+		return scope
+	}
+	if r.playScopes == nil {
+		r.playScopes = make(map[*Play]*playScope)
+	}
+	scope := newPlayScope(r, play)
+	r.playScopes[play] = scope
+	return scope
+}
+
+func newPlayScope(r *VariableResolver, play *Play) *playScope {
+	scope := &playScope{
+		defaults: make(Variables),
+		vars:     lo.Assign(play.GetVars()),
+	}
+
+	for _, role := range play.GetRoles() {
+		scope.defaults = lo.Assign(scope.defaults, role.LoadDefaultVars())
+	}
+
+	for _, varsFile := range play.GetVarsFiles() {
+		f, err := play.dataloader.LoadPlayVarsFile(play, varsFile, scope.vars)
+		if play.dataloader.reportMissingFile(play.includeStack(), err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to load vars file: %s", err)
+			continue
+		}
+		scope.vars = lo.Assign(scope.vars, f)
+	}
+
+	for _, role := range play.GetRoles() {
+		scope.vars = lo.Assign(scope.vars, role.Vars())
+	}
+
+	playHosts := r.PlayHosts(play)
+	scope.magic = Variables{
+		"ansible_play_name":      play.GetName(),
+		"ansible_play_hosts":     playHosts,
+		"ansible_play_hosts_all": playHosts,
+		"ansible_play_batch":     playHosts,
+		"play_hosts":             playHosts,
+		"playbook_dir":           filepath.Dir(play.GetPath()),
+		"role_names": lo.Map(play.GetRoles(), func(role *Role, _ int) string {
+			return role.name
+		}),
+	}
+	return scope
+}
+
+// invalidate drops the cached variable scopes, e.g. when the dependencies
+// of a role are loaded and the role defaults change.
+func (r *VariableResolver) invalidate() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.playScopes = nil
+	r.generation++
+}
+
+// getGeneration returns the number of times the cached scopes were dropped.
+func (r *VariableResolver) getGeneration() uint64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.generation
+}
+
+func (r *VariableResolver) getInventory() *Inventory {
+	if r == nil {
+		return nil
+	}
+	return r.inventory
+}
+
+// PlayHosts returns the inventory hosts targeted by the play.
+func (r *VariableResolver) PlayHosts(play *Play) []string {
+	inventory := r.getInventory()
+	if inventory == nil || play == nil {
+		return nil
+	}
+	return inventory.ResolveHosts(play.GetHosts())
+}
+
+// magicVars returns the variables that Ansible sets automatically
+// and that cannot be overridden by the user.
+//
+// See https://docs.ansible.com/ansible/latest/reference_appendices/special_variables.html#magic-variables
+func (r *VariableResolver) magicVars(scope *playScope, task *Task, host string) Variables {
+	res := Variables{
+		"omit":               omitPlaceholder,
+		"ansible_check_mode": false,
+	}
+
+	res = lo.Assign(res, r.getInventoryMagicVars())
+
+	if host != "" {
+		res["inventory_hostname"] = host
+		res["inventory_hostname_short"], _, _ = strings.Cut(host, ".")
+		if inventory := r.getInventory(); inventory != nil {
+			res["group_names"] = inventory.GroupNames(host)
+		}
+	}
+
+	if scope != nil {
+		res = lo.Assign(res, scope.magic)
+	}
+
+	if task != nil && task.Role() != nil {
+		res["role_name"] = task.Role().name
+		res["role_path"] = task.Role().path
+		res["ansible_role_name"] = task.Role().name
+	}
+	if task != nil {
+		res["ansible_search_path"] = lo.ToAnySlice(task.SearchPath().Dirs())
 	}
 
 	return res
 }
+
+// getInventoryMagicVars returns the magic variables that describe the inventory,
+// computing them on the first call.
+func (r *VariableResolver) getInventoryMagicVars() Variables {
+	inventory := r.getInventory()
+	if inventory == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inventoryMagic != nil {
+		return r.inventoryMagic
+	}
+
+	hostvars := make(map[string]any)
+	for _, h := range inventory.Hosts() {
+		hostvars[h] = map[string]any(r.hostVars(h))
+	}
+	r.inventoryMagic = Variables{
+		"groups":   inventory.Groups(),
+		"hostvars": hostvars,
+	}
+	return r.inventoryMagic
+}
+
+// hostFacts returns the facts bound to the task or, if there are none,
+// the facts attached to the task host in the inventory.
+func (r *VariableResolver) hostFacts(task *Task) FactProfile {
+	if task.facts != nil {
+		return task.facts
+	}
+	if inventory := r.getInventory(); inventory != nil && task.Host() != "" {
+		return inventory.HostFacts(task.Host())
+	}
+	return nil
+}
+
+// hostVars returns the variables of the host available through the "hostvars" magic variable.
+func (r *VariableResolver) hostVars(host string) Variables {
+	vars := lo.Assign(r.inventory.HostVars(host), r.inventory.HostFacts(host).Vars())
+	vars["inventory_hostname"] = host
+	vars["group_names"] = r.inventory.GroupNames(host)
+	return vars
+}
+
+// removeOmitted removes the values set to the "omit" magic variable from maps and lists.
+func removeOmitted(val any) any {
+	switch v := val.(type) {
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for k, vv := range v {
+			if vv == omitPlaceholder {
+				continue
+			}
+			res[k] = removeOmitted(vv)
+		}
+		return res
+	case []any:
+		res := make([]any, 0, len(v))
+		for _, vv := range v {
+			if vv == omitPlaceholder {
+				continue
+			}
+			res = append(res, removeOmitted(vv))
+		}
+		return res
+	}
+	return val
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionOperators maps the operators of the "version" test to the comparison operators.
+var versionOperators = map[string]string{
+	"==": "==", "=": "==", "eq": "==",
+	"<": "<", "lt": "<",
+	"<=": "<=", "le": "<=",
+	">": ">", "gt": ">",
+	">=": ">=", "ge": ">=",
+	"!=": "!=", "<>": "!=", "ne": "!=",
+}
+
+// compareVersions compares the versions as the "version" test of Ansible does.
+// The version type is one of "loose" (the default), "strict", "semver" or "pep440".
+func compareVersions(a, b string, versionType string) (int, error) {
+	switch versionType {
+	case "", "loose":
+		return compareLooseVersions(a, b)
+	case "strict":
+		va, err := parseStrictVersion(a)
+		if err != nil {
+			return 0, err
+		}
+		vb, err := parseStrictVersion(b)
+		if err != nil {
+			return 0, err
+		}
+		return compareVersionKeys(va, vb)
+	case "semver", "semantic":
+		return compareSemanticVersions(a, b)
+	case "pep440":
+		va, err := parsePEP440Version(a)
+		if err != nil {
+			return 0, err
+		}
+		vb, err := parsePEP440Version(b)
+		if err != nil {
+			return 0, err
+		}
+		return compareVersionKeys(va, vb)
+	}
+	return 0, fmt.Errorf("invalid version type %q", versionType)
+}
+
+// compareVersionKeys compares the lists of version components as Python compares tuples.
+func compareVersionKeys(a, b []any) (int, error) {
+	res, err := compareValues(a, b)
+	if err != nil {
+		return 0, fmt.Errorf("version comparison failed: %w", err)
+	}
+	return res, nil
+}
+
+var looseVersionComponent = regexp.MustCompile(`\d+|[a-z]+|\.`)
+
+// parseLooseVersion splits the version into numbers and strings as
+// distutils.version.LooseVersion does.
+func parseLooseVersion(version string) []any {
+	var res []any
+	add := func(part string) {
+		if part == "" || part == "." {
+			return
+		}
+		if n, err := strconv.Atoi(part); err == nil {
+			res = append(res, n)
+			return
+		}
+		res = append(res, part)
+	}
+
+	last := 0
+	for _, loc := range looseVersionComponent.FindAllStringIndex(version, -1) {
+		add(version[last:loc[0]])
+		add(version[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	add(version[last:])
+	return res
+}
+
+func compareLooseVersions(a, b string) (int, error) {
+	return compareVersionKeys(parseLooseVersion(a), parseLooseVersion(b))
+}
+
+var strictVersionRe = regexp.MustCompile(`^(\d+)\.(\d+)(?:\.(\d+))?(?:([ab])(\d+))?$`)
+
+// parseStrictVersion parses the version as distutils.version.StrictVersion does.
+// Versions without a pre-release are greater than the pre-releases.
+func parseStrictVersion(version string) ([]any, error) {
+	m := strictVersionRe.FindStringSubmatch(version)
+	if m == nil {
+		return nil, fmt.Errorf("invalid version number %q", version)
+	}
+	res := make([]any, 0, 5)
+	for _, part := range m[1:4] {
+		n, _ := strconv.Atoi(part)
+		res = append(res, n)
+	}
+	if m[4] == "" {
+		// "z" sorts after the "a" and "b" pre-releases
+		return append(res, "z", 0), nil
+	}
+	n, _ := strconv.Atoi(m[5])
+	return append(res, m[4], n), nil
+}
+
+var semverRe = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// compareSemanticVersions compares the versions according to Semantic Versioning 2.0.0.
+func compareSemanticVersions(a, b string) (int, error) {
+	ma, mb := semverRe.FindStringSubmatch(a), semverRe.FindStringSubmatch(b)
+	if ma == nil {
+		return 0, fmt.Errorf("invalid semantic version %q", a)
+	}
+	if mb == nil {
+		return 0, fmt.Errorf("invalid semantic version %q", b)
+	}
+
+	for i := 1; i <= 3; i++ {
+		na, _ := strconv.Atoi(ma[i])
+		nb, _ := strconv.Atoi(mb[i])
+		if na != nb {
+			return cmp.Compare(na, nb), nil
+		}
+	}
+
+	// a version without pre-release identifiers has a higher precedence
+	preA, preB := ma[4], mb[4]
+	switch {
+	case preA == preB:
+		return 0, nil
+	case preA == "":
+		return 1, nil
+	case preB == "":
+		return -1, nil
+	}
+
+	idsA, idsB := strings.Split(preA, "."), strings.Split(preB, ".")
+	for i := 0; i < len(idsA) && i < len(idsB); i++ {
+		na, errA := strconv.Atoi(idsA[i])
+		nb, errB := strconv.Atoi(idsB[i])
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				return cmp.Compare(na, nb), nil
+			}
+		case errA == nil:
+			// numeric identifiers have a lower precedence than alphanumeric ones
+			return -1, nil
+		case errB == nil:
+			return 1, nil
+		default:
+			if res := strings.Compare(idsA[i], idsB[i]); res != 0 {
+				return res, nil
+			}
+		}
+	}
+	return cmp.Compare(len(idsA), len(idsB)), nil
+}
+
+var pep440Re = regexp.MustCompile(`(?i)^v?(\d+(?:\.\d+)*)` +
+	`(?:[-_.]?(a|alpha|b|beta|c|rc|pre|preview)[-_.]?(\d*))?` +
+	`(?:[-_.]?(post|rev|r)[-_.]?(\d*))?` +
+	`(?:[-_.]?(dev)[-_.]?(\d*))?` +
+	`(?:\+[a-z0-9]+(?:[-_.][a-z0-9]+)*)?$`)
+
+// pep440Pre normalizes the pre-release labels of PEP 440.
+var pep440Pre = map[string]string{
+	"a": "a", "alpha": "a",
+	"b": "b", "beta": "b",
+	"c": "rc", "rc": "rc", "pre": "rc", "preview": "rc",
+}
+
+// parsePEP440Version returns the sort key of the PEP 440 version.
+// The local version label is ignored.
+func parsePEP440Version(version string) ([]any, error) {
+	m := pep440Re.FindStringSubmatch(strings.TrimSpace(version))
+	if m == nil {
+		return nil, fmt.Errorf("invalid version %q", version)
+	}
+
+	var release []any
+	for _, part := range strings.Split(m[1], ".") {
+		n, _ := strconv.Atoi(part)
+		release = append(release, n)
+	}
+	// trailing zeros do not affect the comparison, e.g. 1.0 == 1.0.0
+	for len(release) > 1 && release[len(release)-1] == 0 {
+		release = release[:len(release)-1]
+	}
+
+	number := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+
+	// the pre-release, post-release and development release segments are
+	// compared as tuples; the labels are chosen to sort in the right order
+	var pre, post, dev []any
+	switch {
+	case m[2] != "":
+		pre = []any{pep440Pre[strings.ToLower(m[2])], number(m[3])}
+	case m[4] == "" && m[6] != "":
+		// development releases of the final version sort before its pre-releases
+		pre = []any{"", 0}
+	default:
+		pre = []any{"z", 0}
+	}
+	if m[4] != "" {
+		post = []any{1, number(m[5])}
+	} else {
+		post = []any{0, 0}
+	}
+	if m[6] != "" {
+		dev = []any{0, number(m[7])}
+	} else {
+		dev = []any{1, 0}
+	}
+	return []any{release, pre, post, dev}, nil
+}